@@ -725,7 +725,7 @@ func newParsedPipeline(pipeline applied.Pipeline) (parsedPipeline, error) {
 
 	transformations := make([]transformation.Op, 0, transformPipeline.Len())
 	for i := 0; i < transformPipeline.Len(); i++ {
-		op, err := transformPipeline.At(i).Transformation.Type.NewOp()
+		op, err := transformPipeline.At(i).Transformation.NewOp()
 		if err != nil {
 			err := fmt.Errorf("transform could not construct op: %v", err)
 			return parsedPipeline{}, err
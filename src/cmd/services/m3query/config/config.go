@@ -217,6 +217,21 @@ type Configuration struct {
 
 	// Query shadowing options.
 	QueryShadowing *QueryShadowingConfiguration `yaml:"queryShadowing"`
+
+	// TenantIsolation restricts Prometheus queries to the series of the
+	// requesting tenant.
+	TenantIsolation *TenantIsolationConfiguration `yaml:"tenantIsolation"`
+
+	// QueryCostBudget rejects Prometheus queries estimated to be too expensive
+	// before they are executed.
+	QueryCostBudget *QueryCostBudgetConfiguration `yaml:"queryCostBudget"`
+
+	// PromQLFunctions restricts the functions and aggregations Prometheus
+	// queries may use, all are allowed by default.
+	PromQLFunctions *PromQLFunctionsConfiguration `yaml:"promqlFunctions"`
+
+	// CORS allows browser based clients to query the Prometheus read endpoints.
+	CORS *CORSConfiguration `yaml:"cors"`
 }
 
 // ListenAddressOrDefault returns the listen address or default.
@@ -288,8 +303,65 @@ type ResultOptions struct {
 	// KeepNaNs keeps NaNs before returning query results.
 	// The default is false, which matches Prometheus
 	KeepNaNs bool `yaml:"keepNans"`
+
+	// StreamSeriesThreshold is the number of series in a matrix result above
+	// which the response is streamed series by series instead of being
+	// buffered whole. Zero disables the series threshold.
+	StreamSeriesThreshold int `yaml:"streamSeriesThreshold"`
+
+	// StreamDatapointsThreshold is the number of datapoints in a matrix result
+	// above which the response is streamed series by series instead of being
+	// buffered whole. Zero disables the datapoints threshold.
+	StreamDatapointsThreshold int `yaml:"streamDatapointsThreshold"`
+
+	// ServerTiming reports the duration of the parse, exec and serialize
+	// phases of Prometheus queries in the Server-Timing response header.
+	ServerTiming bool `yaml:"serverTiming"`
+
+	// TruncatedQueryLimit is the length above which queries fetching too many
+	// series are truncated in logs and metric tags, defaults to 1024.
+	TruncatedQueryLimit int `yaml:"truncatedQueryLimit" validate:"min=0"`
+
+	// MaxPointsPerSeries is the number of points per series above which the
+	// matrix result of a range query is downsampled to a coarser step before
+	// being returned. Zero disables downsampling.
+	MaxPointsPerSeries int `yaml:"maxPointsPerSeries" validate:"min=0"`
+
+	// DownsampleAggregation is how the points of a downsampled step are
+	// aggregated, defaults to last.
+	DownsampleAggregation ResultDownsampleAggregation `yaml:"downsampleAggregation"`
+
+	// NonFiniteValues is how NaN and infinite values are serialized in the
+	// JSON responses of Prometheus queries, defaults to string.
+	NonFiniteValues ResultNonFiniteValues `yaml:"nonFiniteValues"`
 }
 
+// ResultDownsampleAggregation is an enum for how the points of a downsampled
+// step are aggregated.
+type ResultDownsampleAggregation string
+
+const (
+	// ResultDownsampleLast keeps the last point of the step.
+	ResultDownsampleLast ResultDownsampleAggregation = "last"
+	// ResultDownsampleAvg averages the points of the step.
+	ResultDownsampleAvg ResultDownsampleAggregation = "avg"
+)
+
+// ResultNonFiniteValues is an enum for how NaN and infinite values are
+// serialized in JSON responses.
+type ResultNonFiniteValues string
+
+const (
+	// ResultNonFiniteString serializes them as the "NaN", "+Inf" and "-Inf"
+	// strings like Prometheus.
+	ResultNonFiniteString ResultNonFiniteValues = "string"
+	// ResultNonFiniteNull serializes them as null.
+	ResultNonFiniteNull ResultNonFiniteValues = "null"
+	// ResultNonFiniteOmit omits the points and samples with them, a scalar
+	// can't be omitted and is serialized as null.
+	ResultNonFiniteOmit ResultNonFiniteValues = "omit"
+)
+
 // RemoteWriteConfiguration deals with incoming metrics samples from remote write requests
 type RemoteWriteConfiguration struct {
 	// If RejectOldSamples is true then m3 coordinator will reject samples directly from remote write requests
@@ -320,6 +392,22 @@ type QueryConfiguration struct {
 	// RequireSeriesEndpointStartEndTime requires requests to /series endpoint
 	// to specify a start and end time to prevent unbounded queries.
 	RequireSeriesEndpointStartEndTime bool `yaml:"requireSeriesEndpointStartEndTime"`
+	// MaxLookbackOverride caps the lookback a Prometheus query may set with the
+	// X-M3-Lookback header, defaults to 1h.
+	MaxLookbackOverride *time.Duration `yaml:"maxLookbackOverride"`
+	// CoalesceInFlight shares a single execution between identical Prometheus
+	// queries in flight at the same time.
+	CoalesceInFlight bool `yaml:"coalesceInFlight"`
+	// MaxScannedSamples aborts the execution of a Prometheus query once it
+	// scanned more samples, disabled when zero. Unlike the returned data
+	// limits it bounds the work of a query rather than the size of its result.
+	MaxScannedSamples int64 `yaml:"maxScannedSamples"`
+	// PartialResultsOnTimeout returns the series fetched before the storage
+	// timed out, along with a warning, rather than failing the Prometheus query.
+	PartialResultsOnTimeout bool `yaml:"partialResultsOnTimeout"`
+	// MaxQueryRange rejects Prometheus range queries spanning a longer time
+	// range, unlimited when zero.
+	MaxQueryRange time.Duration `yaml:"maxQueryRange"`
 }
 
 // TimeoutOrDefault returns the configured timeout or default value.
@@ -857,6 +945,122 @@ type PrometheusRemoteBackendConfiguration struct {
 	Retries         int                                            `yaml:"retries" validate:"min=0"`
 	TickDuration    *time.Duration                                 `yaml:"tickDuration"`
 	EnqueueTimeout  *time.Duration                                 `yaml:"enqueueTimeout"`
+	// CloseTimeout bounds how long closing waits for the pending writes to be
+	// flushed, the writes still pending after it are abandoned. Defaults to
+	// waiting for all of them.
+	CloseTimeout *time.Duration `yaml:"closeTimeout"`
+	// ClosePolicy is whether closing drains the pending writes, bounded by
+	// CloseTimeout, or abandons the ones not written after a brief attempt.
+	// Defaults to drain.
+	ClosePolicy PromRemoteClosePolicy `yaml:"closePolicy"`
+	// MaxLabelsPerSeries drops series with more labels than this before writing, zero means no limit.
+	MaxLabelsPerSeries int `yaml:"maxLabelsPerSeries"`
+	// MaxLabelNameLength drops series with a label name longer than this many bytes, zero means no limit.
+	MaxLabelNameLength int `yaml:"maxLabelNameLength"`
+	// MaxLabelValueLength drops series with a label value longer than this many bytes, zero means no limit.
+	MaxLabelValueLength int `yaml:"maxLabelValueLength"`
+	// MaxDatapointsPerSeries caps the datapoints of a series in a batch, zero means no limit.
+	MaxDatapointsPerSeries int `yaml:"maxDatapointsPerSeries"`
+	// DatapointsCapPolicy is what happens to the datapoints of a series beyond
+	// MaxDatapointsPerSeries, defaults to split.
+	DatapointsCapPolicy PromRemoteDatapointsCapPolicy `yaml:"datapointsCapPolicy"`
+	// MaxFutureSkew drops the datapoints with a timestamp later than now plus
+	// this, e.g. from clock skewed producers, zero means no limit.
+	MaxFutureSkew time.Duration `yaml:"maxFutureSkew"`
+	// Relabel rules are applied in order to the labels of every series before writing.
+	Relabel []PrometheusRemoteBackendRelabelConfiguration `yaml:"relabel"`
+	// WriteMode is how batches are written to the endpoints, defaults to primary.
+	WriteMode PromRemoteWriteMode `yaml:"writeMode"`
+	// CoalesceSeries merges the writes of a batch for the same series into a
+	// single series with all their samples before sending it.
+	CoalesceSeries bool `yaml:"coalesceSeries"`
+	// LogSampleRate is the fraction of write errors and batches logged, defaults to 0.001.
+	LogSampleRate *float64 `yaml:"logSampleRate"`
+	// WrongTenantLogSampleRate is the fraction of writes dropped for an unknown tenant
+	// that are logged, defaults to 0.01.
+	WrongTenantLogSampleRate *float64 `yaml:"wrongTenantLogSampleRate"`
+	// DefaultTenantLogSampleRate is the fraction of writes matching no tenant rule,
+	// and so routed to the default tenant, whose series are logged to help tuning
+	// the rules, defaults to 0.
+	DefaultTenantLogSampleRate *float64 `yaml:"defaultTenantLogSampleRate"`
+	// AdaptiveConcurrency limits the concurrent requests to each endpoint with a
+	// limit shared by all workers, which halves when the endpoint is overloaded
+	// and grows back as requests succeed. Disabled by default.
+	AdaptiveConcurrency *PrometheusRemoteBackendAdaptiveConcurrencyConfiguration `yaml:"adaptiveConcurrency"`
+	// MaxInFlightBatches bounds the batches dispatched to the workers and not
+	// yet written, zero means no limit.
+	MaxInFlightBatches int `yaml:"maxInFlightBatches" validate:"min=0"`
+	// InFlightPolicy is what happens to a batch once MaxInFlightBatches is
+	// reached, defaults to block.
+	InFlightPolicy PromRemoteInFlightPolicy `yaml:"inFlightPolicy"`
+	// OrderedWriteShards, when positive, preserves the order of the writes of
+	// each series, which some backends require: the batches of a tenant are split
+	// into this many shards by series and each shard only has one batch in flight
+	// at a time. This bounds the concurrent requests of a tenant to the number of
+	// shards, a single shard serializing all of them, at the cost of throughput:
+	// a batch waiting for the previous batch of its shard holds its worker, so
+	// the worker pool should be larger than the number of shards. Writes retried
+	// from the dead letter queue aren't ordered. Disabled by default.
+	OrderedWriteShards int `yaml:"orderedWriteShards" validate:"min=0"`
+	// EndpointAutoDisable excludes the endpoints whose write success ratio drops
+	// below a threshold from the failover write mode until they recover.
+	// Disabled by default.
+	EndpointAutoDisable *PrometheusRemoteBackendEndpointAutoDisableConfiguration `yaml:"endpointAutoDisable"`
+	// BatchLog logs a JSON line for every flushed batch to a dedicated sink,
+	// e.g. for audit and replay. Disabled by default because of its volume.
+	BatchLog *PrometheusRemoteBackendBatchLogConfiguration `yaml:"batchLog"`
+	// UserAgent is sent with the writes to the http endpoints, defaults to
+	// m3coordinator/<version>.
+	UserAgent string `yaml:"userAgent"`
+}
+
+// PrometheusRemoteBackendBatchLogConfiguration configures the prom remote batch log.
+type PrometheusRemoteBackendBatchLogConfiguration struct {
+	// Path is the file the batch log is appended to, defaults to stdout.
+	Path string `yaml:"path"`
+}
+
+// PrometheusRemoteBackendEndpointAutoDisableConfiguration configures when a prom
+// remote endpoint is excluded from the failover write mode.
+type PrometheusRemoteBackendEndpointAutoDisableConfiguration struct {
+	// MinSuccessRatio is the write success ratio below which an endpoint is disabled.
+	MinSuccessRatio float64 `yaml:"minSuccessRatio"`
+	// Window is the rolling window the success ratio is computed over, defaults to 1m.
+	// A disabled endpoint is probed with a write every tenth of the window.
+	Window *time.Duration `yaml:"window"`
+	// MinWrites is the number of writes in the window below which an endpoint
+	// isn't disabled, defaults to 10.
+	MinWrites int `yaml:"minWrites"`
+}
+
+// PrometheusRemoteBackendAdaptiveConcurrencyConfiguration bounds the adaptive
+// concurrency limit of each prom remote endpoint.
+type PrometheusRemoteBackendAdaptiveConcurrencyConfiguration struct {
+	// MinLimit is the lowest the limit decreases to, defaults to 1.
+	MinLimit int `yaml:"minLimit"`
+	// MaxLimit is the initial and highest limit, defaults to the pool size.
+	MaxLimit int `yaml:"maxLimit"`
+}
+
+// PromRemoteRelabelAction is an enum for prom remote relabel actions.
+type PromRemoteRelabelAction string
+
+const (
+	// PromRemoteRelabelDrop drops labels whose name matches the regex.
+	PromRemoteRelabelDrop PromRemoteRelabelAction = "drop"
+	// PromRemoteRelabelRename renames labels whose name matches the regex to the
+	// replacement, which may reference capture groups.
+	PromRemoteRelabelRename PromRemoteRelabelAction = "rename"
+	// PromRemoteRelabelAddPrefix prefixes labels whose name matches the regex with the replacement.
+	PromRemoteRelabelAddPrefix PromRemoteRelabelAction = "addPrefix"
+)
+
+// PrometheusRemoteBackendRelabelConfiguration configures a single label rewrite rule.
+type PrometheusRemoteBackendRelabelConfiguration struct {
+	Action PromRemoteRelabelAction `yaml:"action"`
+	// Regex is matched against the whole label name.
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
 }
 
 type PrometheusRemoteBackendEndpointHeader struct {
@@ -867,20 +1071,213 @@ type PrometheusRemoteBackendEndpointHeader struct {
 type PrometheusRemoteBackendTenant struct {
 	Filter string `yaml:"filter"`
 	Tenant string `yaml:"tenant"`
+	// MaxFlushDelay flushes the tenant's queue once its oldest write is this old,
+	// instead of waiting for the next tick.
+	MaxFlushDelay *time.Duration `yaml:"maxFlushDelay"`
+	// Priority orders the evaluation of the tenant rules, rules with a higher
+	// priority are evaluated first and rules with the same priority are
+	// evaluated in the order they are configured.
+	Priority int `yaml:"priority"`
+	// Split optionally routes a percentage of the matching series to another tenant.
+	Split *PrometheusRemoteBackendTenantSplit `yaml:"split"`
+	// Endpoints optionally override the global endpoints for the writes of the
+	// tenant and its split tenant, e.g. to keep its data in a given region.
+	Endpoints []PrometheusRemoteBackendEndpointConfiguration `yaml:"endpoints"`
+	// Labels are added to every series written for the tenant and its split
+	// tenant, e.g. a cluster or region label that is constant for the tenant.
+	Labels map[string]string `yaml:"labels"`
+	// OverwriteLabels replaces the value of a series label with the same name
+	// as an injected label, by default the series label is kept.
+	OverwriteLabels bool `yaml:"overwriteLabels"`
+	// SampleRate is the fraction of the writes of the tenant and its split
+	// tenant that are kept, the others are dropped at random. It is an
+	// emergency lever to shed load, defaults to 1 which keeps all writes.
+	SampleRate *float64 `yaml:"sampleRate"`
+}
+
+// PrometheusRemoteBackendTenantSplit routes a stable percentage of the series
+// matching a tenant rule to an alternate tenant, e.g. to canary a new tenant.
+type PrometheusRemoteBackendTenantSplit struct {
+	// Tenant is the alternate tenant.
+	Tenant string `yaml:"tenant"`
+	// Percent of the matching series routed to the alternate tenant, between 0 and 100.
+	Percent float64 `yaml:"percent"`
 }
 
+// PromRemoteEndpointType is an enum for the sinks a prom remote endpoint can write to.
+type PromRemoteEndpointType string
+
+const (
+	// PromRemoteHTTPEndpointType writes to a Prometheus remote write compatible HTTP endpoint.
+	PromRemoteHTTPEndpointType PromRemoteEndpointType = "http"
+	// PromRemoteKafkaEndpointType publishes the encoded remote write request to a Kafka topic.
+	PromRemoteKafkaEndpointType PromRemoteEndpointType = "kafka"
+)
+
+// PromRemoteCompression is an enum for the compression of prom remote request bodies.
+type PromRemoteCompression string
+
+const (
+	// PromRemoteSnappyBlockCompression compresses each request body as a single snappy
+	// block, as specified by the Prometheus remote write protocol.
+	PromRemoteSnappyBlockCompression PromRemoteCompression = "snappy-block"
+	// PromRemoteSnappyStreamCompression compresses each request body with the snappy
+	// framing format.
+	PromRemoteSnappyStreamCompression PromRemoteCompression = "snappy-stream"
+	// PromRemoteGzipCompression compresses each request body with gzip, for gateways
+	// that don't support snappy.
+	PromRemoteGzipCompression PromRemoteCompression = "gzip"
+)
+
+// PromRemoteSnappyFraming is an enum for the snappy framing of prom remote request bodies.
+//
+// Deprecated: use PromRemoteCompression.
+type PromRemoteSnappyFraming string
+
+const (
+	// PromRemoteSnappyBlockFraming is an alias of PromRemoteSnappyBlockCompression.
+	PromRemoteSnappyBlockFraming PromRemoteSnappyFraming = "block"
+	// PromRemoteSnappyStreamFraming is an alias of PromRemoteSnappyStreamCompression.
+	PromRemoteSnappyStreamFraming PromRemoteSnappyFraming = "stream"
+)
+
+// PromRemoteAuthType is an enum for how requests to a prom remote endpoint are authenticated.
+type PromRemoteAuthType string
+
+const (
+	// PromRemoteBasicAuthType authenticates with basic auth, the tenant as user and
+	// the ApiToken as password, when the ApiToken is set.
+	PromRemoteBasicAuthType PromRemoteAuthType = "basic"
+	// PromRemoteSigV4AuthType signs requests with AWS SigV4, e.g. for AWS managed
+	// Prometheus endpoints.
+	PromRemoteSigV4AuthType PromRemoteAuthType = "sigv4"
+)
+
+// PromRemoteWriteMode is an enum for how batches are written to the prom remote endpoints.
+type PromRemoteWriteMode string
+
+const (
+	// PromRemoteWriteModePrimary writes batches to the first endpoint only.
+	PromRemoteWriteModePrimary PromRemoteWriteMode = "primary"
+	// PromRemoteWriteModeFailover writes batches to the endpoints in order,
+	// stopping at the first one that succeeds.
+	PromRemoteWriteModeFailover PromRemoteWriteMode = "failover"
+)
+
+// PromRemoteInFlightPolicy is an enum for how batches are dispatched once the
+// prom remote in-flight batch limit is reached.
+type PromRemoteInFlightPolicy string
+
+const (
+	// PromRemoteInFlightBlock blocks the dispatch until an in-flight batch is written.
+	PromRemoteInFlightBlock PromRemoteInFlightPolicy = "block"
+	// PromRemoteInFlightShed drops the batch.
+	PromRemoteInFlightShed PromRemoteInFlightPolicy = "shed"
+)
+
+// PromRemoteClosePolicy is an enum for how the prom remote pending writes are
+// handled on close.
+type PromRemoteClosePolicy string
+
+const (
+	// PromRemoteCloseDrain waits for the pending writes to be flushed.
+	PromRemoteCloseDrain PromRemoteClosePolicy = "drain"
+	// PromRemoteCloseFastExit abandons the pending writes not flushed after a
+	// brief attempt.
+	PromRemoteCloseFastExit PromRemoteClosePolicy = "fastExit"
+)
+
+// PromRemoteDatapointsCapPolicy is an enum for how series with more datapoints
+// than the prom remote max datapoints per series are written.
+type PromRemoteDatapointsCapPolicy string
+
+const (
+	// PromRemoteDatapointsCapSplit splits the series into several series entries
+	// of at most the max datapoints each.
+	PromRemoteDatapointsCapSplit PromRemoteDatapointsCapPolicy = "split"
+	// PromRemoteDatapointsCapTruncate keeps the most recent max datapoints of the
+	// series and drops its older datapoints.
+	PromRemoteDatapointsCapTruncate PromRemoteDatapointsCapPolicy = "truncate"
+)
+
 // PrometheusRemoteBackendEndpointConfiguration configures single endpoint.
 type PrometheusRemoteBackendEndpointConfiguration struct {
 	Name    string `yaml:"name"`
 	Address string `yaml:"address"`
+	// Type is the sink type of the endpoint, defaults to http.
+	Type PromRemoteEndpointType `yaml:"type"`
+	// Topic is the topic written to by kafka endpoints, messages are keyed by tenant.
+	Topic string `yaml:"topic"`
 	// TenantHeader is used to attribute tenant for the remote write request.
 	TenantHeader string `yaml:"tenantHeader"`
 	// Headers to be added to each remote write request, must not overlap with TenantHeader.
 	Headers []PrometheusRemoteBackendEndpointHeader `yaml:"headers"`
+	// IdempotencyKeyHeader, if set, is sent with a hash of each batch that stays the same
+	// across retries so that idempotency aware backends can dedupe retried writes.
+	IdempotencyKeyHeader string `yaml:"idempotencyKeyHeader"`
+	// Compression is the compression of the request bodies, defaults to snappy-block.
+	Compression PromRemoteCompression `yaml:"compression"`
+	// SnappyFraming is the snappy framing of the request bodies, must not be set
+	// along with Compression.
+	//
+	// Deprecated: use Compression, block and stream are snappy-block and snappy-stream.
+	SnappyFraming PromRemoteSnappyFraming `yaml:"snappyFraming"`
+	// RemoteWriteVersion is sent in the X-Prometheus-Remote-Write-Version header,
+	// defaults to 0.1.0.
+	RemoteWriteVersion string `yaml:"remoteWriteVersion"`
+	// AcceptEncoding, if set, is sent in the Accept-Encoding header so that the endpoint
+	// can compress its responses, e.g. "gzip, snappy". Compressed error responses are
+	// decoded before being logged.
+	AcceptEncoding string `yaml:"acceptEncoding"`
+	// MaxIdleConnsPerHost is the number of idle connections kept open to the
+	// endpoint, defaults to maxIdleConns (100). Raise it for a busy endpoint to
+	// avoid reopening connections under load.
+	MaxIdleConnsPerHost *int `yaml:"maxIdleConnsPerHost"`
+	// MaxConnsPerHost limits the connections to the endpoint, including those
+	// in use, defaults to no limit.
+	MaxConnsPerHost *int `yaml:"maxConnsPerHost"`
+	// KeepAlive is the keep-alive period of the connections to the endpoint,
+	// defaults to the global keepAlive.
+	KeepAlive *time.Duration `yaml:"keepAlive"`
+	// HTTP2 forces HTTP/2 for the endpoint so that concurrent writes are
+	// multiplexed over fewer connections. HTTP/2 is negotiated over TLS, a
+	// plain http endpoint keeps using HTTP/1.1.
+	HTTP2 *PrometheusRemoteBackendHTTP2Configuration `yaml:"http2"`
 	// When nil all unaggregated data will be sent to this endpoint.
 	StoragePolicy *PrometheusRemoteBackendStoragePolicyConfiguration `yaml:"storagePolicy"`
 	// TODO: for GEM PoV, we can use plain text, but for production we shall get this value from secret files.
 	ApiToken string `yaml:"apiToken"`
+	// AuthType is how requests to the endpoint are authenticated, defaults to basic.
+	AuthType PromRemoteAuthType `yaml:"authType"`
+	// SigV4 configures the signing of requests when AuthType is sigv4.
+	SigV4 *PrometheusRemoteBackendSigV4Configuration `yaml:"sigv4"`
+}
+
+// PrometheusRemoteBackendHTTP2Configuration configures the HTTP/2 connections
+// to a prom remote endpoint.
+type PrometheusRemoteBackendHTTP2Configuration struct {
+	// ReadIdleTimeout is how long a connection receives no frame before it is
+	// health checked with a ping, defaults to no health check.
+	ReadIdleTimeout time.Duration `yaml:"readIdleTimeout"`
+	// PingTimeout is how long a ping waits for a response before the
+	// connection is closed, defaults to 15s.
+	PingTimeout time.Duration `yaml:"pingTimeout"`
+}
+
+// PrometheusRemoteBackendSigV4Configuration configures the AWS SigV4 signing of
+// the requests to a prom remote endpoint.
+type PrometheusRemoteBackendSigV4Configuration struct {
+	// Region is the AWS region of the endpoint.
+	Region string `yaml:"region"`
+	// Service is the AWS service name signed for, defaults to aps.
+	Service string `yaml:"service"`
+	// AccessKey and SecretKey are static credentials, when not set the default
+	// AWS credential chain is used, e.g. environment variables, the shared
+	// credentials file or the instance role, and refreshed as they expire.
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	// Profile is the shared credentials profile used by the default credential chain.
+	Profile string `yaml:"profile"`
 }
 
 // PrometheusRemoteBackendStoragePolicyConfiguration configures storage policy for single endpoint.
@@ -1010,4 +1407,89 @@ type QueryShadowingConfiguration struct {
 	// No trailing slash.
 	ShadowQueryURL        string `yaml:"shadowQueryURL"`
 	QueryShadowingWorkers int    `yaml:"queryShadowingWorkers" validate:"nonzero,min=1"`
+	// SubmitStrategy is what to do with a shadow query when all the workers
+	// are busy, defaults to dropOnFull.
+	SubmitStrategy ShadowQuerySubmitStrategy `yaml:"submitStrategy"`
+	// SubmitTimeout is how long the blockWithTimeout strategy waits for a worker.
+	SubmitTimeout *time.Duration `yaml:"submitTimeout"`
+	// OverflowQueueSize bounds the number of shadow queries waiting for a
+	// worker with the overflowQueue strategy.
+	OverflowQueueSize int `yaml:"overflowQueueSize" validate:"min=0"`
+	// ClientTimeout is the timeout of a shadow query request, defaults to 8m.
+	ClientTimeout *time.Duration `yaml:"clientTimeout"`
+	// MaxConns limits the connections, idle or in use, to the shadow query
+	// URL, defaults to 10.
+	MaxConns int `yaml:"maxConns" validate:"min=0"`
+}
+
+// ShadowQuerySubmitStrategy is an enum for how shadow queries are submitted
+// to a saturated worker pool.
+type ShadowQuerySubmitStrategy string
+
+const (
+	// ShadowQueryDropOnFull drops the shadow query if no worker frees up
+	// within a few seconds.
+	ShadowQueryDropOnFull ShadowQuerySubmitStrategy = "dropOnFull"
+	// ShadowQueryBlockWithTimeout blocks the request for up to the submit
+	// timeout waiting for a worker before dropping the shadow query.
+	ShadowQueryBlockWithTimeout ShadowQuerySubmitStrategy = "blockWithTimeout"
+	// ShadowQueryOverflowQueue queues the shadow query in a bounded queue
+	// until a worker frees up, dropping it only when the queue is full.
+	ShadowQueryOverflowQueue ShadowQuerySubmitStrategy = "overflowQueue"
+)
+
+// DefaultTenantLabel is the default series label holding the tenant.
+const DefaultTenantLabel = "tenant"
+
+// TenantIsolationConfiguration configures the tenant matcher injected into
+// the selectors of every read, restricting it to the requesting tenant.
+type TenantIsolationConfiguration struct {
+	// Header is the request header carrying the requester's tenant, requests
+	// without it are rejected.
+	Header string `yaml:"header" validate:"nonzero"`
+	// Label is the series label holding the tenant, defaults to "tenant".
+	Label string `yaml:"label" validate:"nonzero"`
+}
+
+// UnmarshalYAML unmarshals the tenant isolation configuration, defaulting the
+// label when it is omitted. An explicitly empty label fails validation.
+func (c *TenantIsolationConfiguration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawConfiguration TenantIsolationConfiguration
+	raw := rawConfiguration{Label: DefaultTenantLabel}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*c = TenantIsolationConfiguration(raw)
+	return nil
+}
+
+// PromQLFunctionsConfiguration configures the PromQL functions and aggregation
+// operators, e.g. topk, that queries may use.
+type PromQLFunctionsConfiguration struct {
+	// Allowed, if set, are the only functions and aggregations queries may use.
+	Allowed []string `yaml:"allowed"`
+	// Denied are functions and aggregations queries may not use.
+	Denied []string `yaml:"denied"`
+}
+
+// CORSConfiguration configures the CORS headers of the Prometheus read endpoints,
+// replacing the headers allowing any origin that are set by default.
+type CORSConfiguration struct {
+	// AllowedOrigins are the origins allowed to query, "*" allows any origin.
+	AllowedOrigins []string `yaml:"allowedOrigins" validate:"nonzero"`
+	// AllowedMethods are the methods allowed in preflight responses, defaults
+	// to GET and POST.
+	AllowedMethods []string `yaml:"allowedMethods"`
+	// AllowedHeaders are the request headers allowed in preflight responses,
+	// defaults to Content-Type.
+	AllowedHeaders []string `yaml:"allowedHeaders"`
+}
+
+// QueryCostBudgetConfiguration configures the budget of the estimated cost of
+// a Prometheus query, which is the number of series matched by each selector
+// multiplied by the time range it reads.
+type QueryCostBudgetConfiguration struct {
+	// MaxSeriesHours is the budget in series hours, e.g. a query reading 100
+	// series over 2h costs 200 series hours.
+	MaxSeriesHours float64 `yaml:"maxSeriesHours" validate:"nonzero"`
 }
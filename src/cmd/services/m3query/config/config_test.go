@@ -221,3 +221,61 @@ func TestKeepNaNsDefault(t *testing.T) {
 	r = ResultOptions{}
 	assert.Equal(t, false, r.KeepNaNs)
 }
+
+func TestTenantIsolationConfiguration(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected *TenantIsolationConfiguration
+		err      string
+	}{
+		{
+			name: "label defaults",
+			config: `
+tenantIsolation:
+  header: M3-Tenant
+`,
+			expected: &TenantIsolationConfiguration{Header: "M3-Tenant", Label: DefaultTenantLabel},
+		},
+		{
+			name: "label set",
+			config: `
+tenantIsolation:
+  header: M3-Tenant
+  label: team
+`,
+			expected: &TenantIsolationConfiguration{Header: "M3-Tenant", Label: "team"},
+		},
+		{
+			name: "empty header",
+			config: `
+tenantIsolation:
+  label: team
+`,
+			err: "TenantIsolation.Header: zero value",
+		},
+		{
+			name: "empty label",
+			config: `
+tenantIsolation:
+  header: M3-Tenant
+  label: ""
+`,
+			err: "TenantIsolation.Label: zero value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Configuration
+			require.NoError(t, yaml.Unmarshal([]byte(tt.config), &cfg))
+			err := validator.Validate(cfg)
+			if tt.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.Equal(t, tt.expected, cfg.TenantIsolation)
+		})
+	}
+}
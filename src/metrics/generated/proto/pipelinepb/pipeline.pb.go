@@ -46,6 +46,8 @@ import _ "github.com/gogo/protobuf/gogoproto"
 import aggregationpb "github.com/m3db/m3/src/metrics/generated/proto/aggregationpb"
 import transformationpb "github.com/m3db/m3/src/metrics/generated/proto/transformationpb"
 
+import binary "encoding/binary"
+
 import io "io"
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -151,6 +153,10 @@ func (m *AggregationOp) GetType() aggregationpb.AggregationType {
 
 type TransformationOp struct {
 	Type transformationpb.TransformationType `protobuf:"varint,1,opt,name=type,proto3,enum=transformationpb.TransformationType" json:"type,omitempty"`
+	// The parameters of the transformation types taking an operator and a value,
+	// e.g. the operator and threshold of a comparison.
+	Operator string  `protobuf:"bytes,2,opt,name=operator,proto3" json:"operator,omitempty"`
+	Value    float64 `protobuf:"fixed64,3,opt,name=value,proto3" json:"value,omitempty"`
 }
 
 func (m *TransformationOp) Reset()                    { *m = TransformationOp{} }
@@ -165,6 +171,20 @@ func (m *TransformationOp) GetType() transformationpb.TransformationType {
 	return transformationpb.TransformationType_UNKNOWN
 }
 
+func (m *TransformationOp) GetOperator() string {
+	if m != nil {
+		return m.Operator
+	}
+	return ""
+}
+
+func (m *TransformationOp) GetValue() float64 {
+	if m != nil {
+		return m.Value
+	}
+	return 0
+}
+
 type RollupOp struct {
 	NewName          string                          `protobuf:"bytes,1,opt,name=new_name,json=newName,proto3" json:"new_name,omitempty"`
 	Tags             []string                        `protobuf:"bytes,2,rep,name=tags" json:"tags,omitempty"`
@@ -395,6 +415,18 @@ func (m *TransformationOp) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintPipeline(dAtA, i, uint64(m.Type))
 	}
+	if len(m.Operator) > 0 {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintPipeline(dAtA, i, uint64(len(m.Operator)))
+		i += copy(dAtA[i:], m.Operator)
+	}
+	if m.Value != 0 {
+		dAtA[i] = 0x19
+		i++
+		binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.Value))))
+		i += 8
+	}
 	return i, nil
 }
 
@@ -667,6 +699,13 @@ func (m *TransformationOp) Size() (n int) {
 	if m.Type != 0 {
 		n += 1 + sovPipeline(uint64(m.Type))
 	}
+	l = len(m.Operator)
+	if l > 0 {
+		n += 1 + l + sovPipeline(uint64(l))
+	}
+	if m.Value != 0 {
+		n += 9
+	}
 	return n
 }
 
@@ -896,6 +935,46 @@ func (m *TransformationOp) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Operator", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowPipeline
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthPipeline
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Operator = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Value", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.Value = float64(math.Float64frombits(v))
 		default:
 			iNdEx = preIndex
 			skippy, err := skipPipeline(dAtA[iNdEx:])
@@ -1705,46 +1784,47 @@ func init() {
 }
 
 var fileDescriptorPipeline = []byte{
-	// 641 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x94, 0xcb, 0x4e, 0xdb, 0x40,
-	0x14, 0x86, 0x63, 0x3b, 0x82, 0x70, 0x02, 0xc1, 0x8c, 0xaa, 0xca, 0x5c, 0x1a, 0x22, 0x8b, 0x45,
-	0x16, 0xc5, 0x96, 0x12, 0xb5, 0x2a, 0x74, 0x15, 0x08, 0x4d, 0x53, 0x52, 0x1b, 0x4d, 0x13, 0xf5,
-	0xb2, 0x41, 0x36, 0x1e, 0x5c, 0x4b, 0xb1, 0x3d, 0xb2, 0x8d, 0x10, 0x4f, 0xd0, 0x2d, 0xaf, 0xd0,
-	0x77, 0xe8, 0x43, 0xb0, 0xec, 0xbe, 0x52, 0x55, 0xd1, 0x17, 0xa9, 0x62, 0x3b, 0xc9, 0x4c, 0x48,
-	0x2f, 0x74, 0x37, 0x33, 0x3e, 0xe7, 0x3f, 0xff, 0xfc, 0xdf, 0xc8, 0xf0, 0xd2, 0xf5, 0x92, 0x8f,
-	0x17, 0xb6, 0x76, 0x16, 0xfa, 0xba, 0xdf, 0x74, 0x6c, 0xdd, 0x6f, 0xea, 0x71, 0x74, 0xa6, 0xfb,
-	0x24, 0x89, 0xbc, 0xb3, 0x58, 0x77, 0x49, 0x40, 0x22, 0x2b, 0x21, 0x8e, 0x4e, 0xa3, 0x30, 0x09,
-	0x75, 0xea, 0x51, 0x32, 0xf4, 0x02, 0x42, 0xed, 0xc9, 0x52, 0x4b, 0xbf, 0x20, 0x98, 0x7e, 0xda,
-	0xd8, 0x65, 0x54, 0xdd, 0xd0, 0x0d, 0xb3, 0x66, 0xfb, 0xe2, 0x3c, 0xdd, 0x65, 0x4a, 0xa3, 0x55,
-	0xd6, 0xba, 0x61, 0xdc, 0xd3, 0x84, 0xe5, 0xba, 0x11, 0x71, 0xad, 0xc4, 0x0b, 0x03, 0x6a, 0xb3,
-	0xbb, 0x5c, 0xaf, 0x7f, 0x4f, 0xbd, 0x24, 0xb2, 0x82, 0xf8, 0x3c, 0x8c, 0xfc, 0xb1, 0x24, 0x7f,
-	0x90, 0xa9, 0xaa, 0x87, 0xb0, 0xd2, 0x9a, 0x8e, 0x32, 0x29, 0x6a, 0x40, 0x31, 0xb9, 0xa2, 0x44,
-	0x11, 0x6a, 0x42, 0xbd, 0xd2, 0xa8, 0x6a, 0x9c, 0x2d, 0x8d, 0xa9, 0xed, 0x5f, 0x51, 0x82, 0xd3,
-	0x5a, 0xb5, 0x07, 0x72, 0x9f, 0x13, 0x37, 0x29, 0x7a, 0xc6, 0xe9, 0xec, 0x68, 0xb3, 0x76, 0x34,
-	0xbe, 0x83, 0x51, 0xfb, 0x26, 0x40, 0x09, 0x87, 0xc3, 0xe1, 0x05, 0x35, 0x29, 0x5a, 0x87, 0x52,
-	0x40, 0x2e, 0x4f, 0x03, 0xcb, 0xcf, 0xa4, 0x96, 0xf0, 0x62, 0x40, 0x2e, 0x0d, 0xcb, 0x27, 0x08,
-	0x41, 0x31, 0xb1, 0xdc, 0x58, 0x11, 0x6b, 0x52, 0x7d, 0x09, 0xa7, 0x6b, 0x74, 0x0c, 0x6b, 0x8c,
-	0xe1, 0xd3, 0x91, 0x5e, 0xac, 0x48, 0x35, 0xe9, 0x1f, 0xae, 0x22, 0x5b, 0xfc, 0x41, 0x8c, 0x76,
-	0xf3, 0x2b, 0x14, 0xd3, 0x2b, 0xac, 0x6b, 0xd3, 0xb7, 0xa0, 0x8d, 0xfd, 0x69, 0x8c, 0xef, 0x1d,
-	0x28, 0x8e, 0x76, 0x68, 0x19, 0x4a, 0x1d, 0x6c, 0x0e, 0x4e, 0x4e, 0x0f, 0xde, 0xcb, 0x05, 0x54,
-	0x01, 0x38, 0x7a, 0x77, 0xd8, 0x1b, 0xb4, 0x8f, 0x46, 0x7b, 0x41, 0xfd, 0x22, 0x02, 0x9c, 0xe4,
-	0x42, 0x26, 0x45, 0x3a, 0x17, 0xd3, 0x26, 0x3b, 0x63, 0x5a, 0xc5, 0x4c, 0x41, 0xcf, 0xa1, 0xcc,
-	0x18, 0x55, 0xc4, 0x9a, 0x50, 0x2f, 0xf3, 0xde, 0x38, 0x9e, 0x98, 0xad, 0x46, 0x6d, 0xa8, 0xf0,
-	0x1c, 0x14, 0x29, 0xed, 0xdf, 0x62, 0xfb, 0x67, 0x51, 0xe2, 0x99, 0x1e, 0xf4, 0x18, 0x16, 0xa2,
-	0xf4, 0xfe, 0x69, 0x32, 0xe5, 0xc6, 0x83, 0x79, 0xc9, 0xe0, 0xbc, 0x46, 0x6d, 0xe7, 0xb1, 0x94,
-	0x61, 0x71, 0x60, 0x1c, 0x1b, 0xe6, 0x5b, 0x43, 0x2e, 0xa0, 0x55, 0x28, 0xb7, 0x3a, 0x1d, 0x7c,
-	0xd4, 0x69, 0xf5, 0xbb, 0xa6, 0x21, 0x0b, 0x08, 0x41, 0xa5, 0x8f, 0x5b, 0xc6, 0x9b, 0x17, 0x26,
-	0x7e, 0x9d, 0x9d, 0x89, 0x08, 0x60, 0x01, 0x9b, 0xbd, 0xde, 0xe0, 0x44, 0x96, 0xd4, 0x7d, 0x28,
-	0x8d, 0xf3, 0x40, 0x1a, 0x48, 0x21, 0x8d, 0x15, 0xa1, 0x26, 0xd5, 0xcb, 0x8d, 0x87, 0xf3, 0x23,
-	0x3b, 0x28, 0xde, 0x7c, 0xdf, 0x2e, 0xe0, 0x51, 0xa1, 0x3a, 0x84, 0xd5, 0x16, 0xa5, 0x43, 0x8f,
-	0x38, 0x93, 0x67, 0x55, 0x01, 0xd1, 0x73, 0xd2, 0xd0, 0x97, 0xb1, 0xe8, 0x39, 0xa8, 0x0b, 0x15,
-	0xf6, 0xdd, 0x78, 0x4e, 0x1e, 0xec, 0xd6, 0xef, 0x1f, 0x4d, 0xb7, 0x9d, 0xcf, 0x58, 0x61, 0x4a,
-	0xba, 0x8e, 0xfa, 0x49, 0x84, 0xb5, 0x7c, 0x1c, 0xc3, 0xf9, 0x29, 0xc7, 0x59, 0xe5, 0x78, 0xcd,
-	0x16, 0xb3, 0xb8, 0x5f, 0xdd, 0x21, 0x26, 0xfe, 0x9d, 0x58, 0x6e, 0x6c, 0x96, 0xdb, 0xde, 0x84,
-	0x5b, 0x46, 0x7d, 0x73, 0x8e, 0x8b, 0x71, 0x42, 0xb9, 0xc4, 0x18, 0x62, 0x73, 0x1e, 0xc4, 0xbb,
-	0xcc, 0x04, 0x86, 0x99, 0xa8, 0x1a, 0x93, 0xdc, 0x27, 0xe8, 0x9e, 0xb0, 0xe8, 0x1e, 0xfd, 0x31,
-	0x05, 0x86, 0xe0, 0x7e, 0xf1, 0xfa, 0xf3, 0x76, 0xe1, 0xe0, 0xf8, 0xe6, 0xb6, 0x2a, 0x7c, 0xbd,
-	0xad, 0x0a, 0x3f, 0x6e, 0xab, 0xc2, 0xf5, 0xcf, 0x6a, 0xe1, 0xc3, 0xde, 0x7f, 0xff, 0xe8, 0xed,
-	0x85, 0xf4, 0xa4, 0xf9, 0x2b, 0x00, 0x00, 0xff, 0xff, 0x82, 0xb2, 0x32, 0x0e, 0x2c, 0x06, 0x00,
-	0x00,
+	// 669 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0xcd, 0x4e, 0xdb, 0x40,
+	0x10, 0xce, 0xda, 0x29, 0x84, 0x31, 0x84, 0xb0, 0x42, 0x55, 0xf8, 0x69, 0x88, 0x2c, 0x0e, 0x39,
+	0x14, 0x5b, 0x4a, 0xd4, 0xaa, 0xd0, 0x53, 0x20, 0x34, 0x4d, 0xa1, 0x36, 0xda, 0x26, 0xea, 0xcf,
+	0x05, 0x39, 0x78, 0x71, 0x2d, 0xc5, 0xf6, 0xca, 0x76, 0x8a, 0xb8, 0xf4, 0xda, 0x2b, 0xaf, 0xd0,
+	0x77, 0xe8, 0x43, 0x70, 0xec, 0xbd, 0x52, 0x55, 0xd1, 0x17, 0xa9, 0x62, 0x3b, 0xc9, 0xda, 0xa4,
+	0x3f, 0xf4, 0xb6, 0x33, 0x9e, 0xf9, 0xe6, 0x9b, 0xef, 0x1b, 0xc9, 0xf0, 0xdc, 0xb2, 0xc3, 0xf7,
+	0xc3, 0xbe, 0x72, 0xe6, 0x39, 0xaa, 0xd3, 0x30, 0xfb, 0xaa, 0xd3, 0x50, 0x03, 0xff, 0x4c, 0x75,
+	0x68, 0xe8, 0xdb, 0x67, 0x81, 0x6a, 0x51, 0x97, 0xfa, 0x46, 0x48, 0x4d, 0x95, 0xf9, 0x5e, 0xe8,
+	0xa9, 0xcc, 0x66, 0x74, 0x60, 0xbb, 0x94, 0xf5, 0x27, 0x4f, 0x25, 0xfa, 0x82, 0x61, 0xfa, 0x69,
+	0x7d, 0x87, 0x43, 0xb5, 0x3c, 0xcb, 0x8b, 0x9b, 0xfb, 0xc3, 0xf3, 0x28, 0x8a, 0x91, 0x46, 0xaf,
+	0xb8, 0x75, 0x5d, 0xbb, 0x23, 0x09, 0xc3, 0xb2, 0x7c, 0x6a, 0x19, 0xa1, 0xed, 0xb9, 0xac, 0xcf,
+	0x47, 0x09, 0x5e, 0xf7, 0x8e, 0x78, 0xa1, 0x6f, 0xb8, 0xc1, 0xb9, 0xe7, 0x3b, 0x63, 0xc8, 0x74,
+	0x22, 0x46, 0x95, 0x0f, 0x60, 0xa9, 0x39, 0x1d, 0xa5, 0x33, 0x5c, 0x87, 0x7c, 0x78, 0xc9, 0x68,
+	0x19, 0x55, 0x51, 0xad, 0x58, 0xaf, 0x28, 0x29, 0x5a, 0x0a, 0x57, 0xdb, 0xbd, 0x64, 0x94, 0x44,
+	0xb5, 0xf2, 0x47, 0x28, 0x75, 0x53, 0xe0, 0x3a, 0xc3, 0x4f, 0x52, 0x38, 0xdb, 0x4a, 0x96, 0x8e,
+	0x92, 0xee, 0x98, 0xa2, 0xe1, 0x75, 0x28, 0x78, 0x6c, 0xb4, 0x8a, 0xe7, 0x97, 0x85, 0x2a, 0xaa,
+	0x2d, 0x90, 0x49, 0x8c, 0x57, 0xe1, 0xde, 0x07, 0x63, 0x30, 0xa4, 0x65, 0xb1, 0x8a, 0x6a, 0x88,
+	0xc4, 0x81, 0xfc, 0x0d, 0x41, 0x81, 0x78, 0x83, 0xc1, 0x90, 0xe9, 0x0c, 0xaf, 0x41, 0xc1, 0xa5,
+	0x17, 0xa7, 0xae, 0xe1, 0xc4, 0xc3, 0x17, 0xc8, 0xbc, 0x4b, 0x2f, 0x34, 0xc3, 0xa1, 0x18, 0x43,
+	0x3e, 0x34, 0xac, 0xa0, 0x2c, 0x54, 0xc5, 0xda, 0x02, 0x89, 0xde, 0xf8, 0x08, 0x56, 0xb8, 0x15,
+	0x4f, 0x47, 0x0c, 0x82, 0xb2, 0x58, 0x15, 0xff, 0x61, 0xf9, 0x92, 0x91, 0x4e, 0x04, 0x78, 0x27,
+	0x59, 0x3a, 0x1f, 0x2d, 0xbd, 0xa6, 0x4c, 0xaf, 0x47, 0x19, 0xf3, 0x53, 0x38, 0xdd, 0xb6, 0x21,
+	0x3f, 0x8a, 0xf0, 0x22, 0x14, 0xda, 0x44, 0xef, 0x9d, 0x9c, 0xee, 0xbf, 0x2d, 0xe5, 0x70, 0x11,
+	0xe0, 0xf0, 0xcd, 0xc1, 0x71, 0xaf, 0x75, 0x38, 0x8a, 0x91, 0xfc, 0x45, 0x00, 0x38, 0x49, 0x80,
+	0x74, 0x86, 0xd5, 0x94, 0xb0, 0x1b, 0xfc, 0x8c, 0x69, 0x15, 0x37, 0x05, 0x3f, 0x05, 0x89, 0x23,
+	0x1a, 0x49, 0x2a, 0xa5, 0xb9, 0xa5, 0x2e, 0x80, 0xf0, 0xd5, 0xb8, 0x05, 0xc5, 0xb4, 0x73, 0x91,
+	0xf2, 0x52, 0x7d, 0x93, 0xef, 0xcf, 0x9a, 0x4f, 0x32, 0x3d, 0xf8, 0x21, 0xcc, 0xf9, 0xd1, 0xfe,
+	0x91, 0x32, 0x52, 0x7d, 0x75, 0x96, 0x32, 0x24, 0xa9, 0x91, 0x5b, 0x89, 0x2c, 0x12, 0xcc, 0xf7,
+	0xb4, 0x23, 0x4d, 0x7f, 0xad, 0x95, 0x72, 0x78, 0x19, 0xa4, 0x66, 0xbb, 0x4d, 0x0e, 0xdb, 0xcd,
+	0x6e, 0x47, 0xd7, 0x4a, 0x08, 0x63, 0x28, 0x76, 0x49, 0x53, 0x7b, 0xf5, 0x4c, 0x27, 0x2f, 0xe3,
+	0x9c, 0x80, 0x01, 0xe6, 0x88, 0x7e, 0x7c, 0xdc, 0x3b, 0x29, 0x89, 0xf2, 0x1e, 0x14, 0xc6, 0x7a,
+	0x60, 0x05, 0x44, 0x8f, 0x05, 0x65, 0x54, 0x15, 0x6b, 0x52, 0xfd, 0xfe, 0x6c, 0xc9, 0xf6, 0xf3,
+	0xd7, 0xdf, 0xb7, 0x72, 0x64, 0x54, 0x28, 0x0f, 0x60, 0xb9, 0xc9, 0xd8, 0xc0, 0xa6, 0xe6, 0xe4,
+	0xac, 0x8a, 0x20, 0xd8, 0x66, 0x24, 0xfa, 0x22, 0x11, 0x6c, 0x13, 0x77, 0xa0, 0xc8, 0xdf, 0x8d,
+	0x6d, 0x26, 0xc2, 0x6e, 0xfe, 0xfe, 0x68, 0x3a, 0xad, 0x64, 0xc6, 0x12, 0x57, 0xd2, 0x31, 0xe5,
+	0x4f, 0x02, 0xac, 0x24, 0xe3, 0x38, 0x9f, 0x1f, 0xa7, 0x7c, 0x96, 0x53, 0x7e, 0x65, 0x8b, 0x79,
+	0xbb, 0x5f, 0xdc, 0x72, 0x4c, 0xf8, 0xbb, 0x63, 0x09, 0xb1, 0xac, 0x6f, 0xbb, 0x13, 0xdf, 0x62,
+	0xd7, 0x37, 0x66, 0xb0, 0x18, 0x2b, 0x94, 0x40, 0x8c, 0x4d, 0x6c, 0xcc, 0x32, 0xf1, 0xb6, 0x67,
+	0x88, 0xf3, 0x4c, 0x90, 0x35, 0x58, 0xce, 0xec, 0x86, 0x1f, 0xf1, 0xd6, 0x3d, 0xf8, 0xa3, 0x0a,
+	0x9c, 0x83, 0x7b, 0xf9, 0xab, 0xcf, 0x5b, 0xb9, 0xfd, 0xa3, 0xeb, 0x9b, 0x0a, 0xfa, 0x7a, 0x53,
+	0x41, 0x3f, 0x6e, 0x2a, 0xe8, 0xea, 0x67, 0x25, 0xf7, 0x6e, 0xf7, 0xbf, 0x7f, 0x0d, 0xfd, 0xb9,
+	0x28, 0xd3, 0xf8, 0x35, 0x00, 0x64, 0x1a, 0xc2, 0xdd, 0x5e, 0x06, 0x00, 0x00,
 }
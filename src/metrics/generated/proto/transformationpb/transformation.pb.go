@@ -49,13 +49,15 @@ const _ = proto.GoGoProtoPackageIsVersion2 // please upgrade the proto package
 type TransformationType int32
 
 const (
-	TransformationType_UNKNOWN     TransformationType = 0
-	TransformationType_ABSOLUTE    TransformationType = 1
-	TransformationType_PERSECOND   TransformationType = 2
-	TransformationType_INCREASE    TransformationType = 3
-	TransformationType_ADD         TransformationType = 4
-	TransformationType_RESET       TransformationType = 5
-	TransformationType_INCREASEV2  TransformationType = 6
+	TransformationType_UNKNOWN    TransformationType = 0
+	TransformationType_ABSOLUTE   TransformationType = 1
+	TransformationType_PERSECOND  TransformationType = 2
+	TransformationType_INCREASE   TransformationType = 3
+	TransformationType_ADD        TransformationType = 4
+	TransformationType_RESET      TransformationType = 5
+	TransformationType_INCREASEV2 TransformationType = 6
+	TransformationType_COMPARISON TransformationType = 7
+	TransformationType_ARITHMETIC TransformationType = 8
 )
 
 var TransformationType_name = map[int32]string{
@@ -66,15 +68,19 @@ var TransformationType_name = map[int32]string{
 	4: "ADD",
 	5: "RESET",
 	6: "INCREASEV2",
+	7: "COMPARISON",
+	8: "ARITHMETIC",
 }
 var TransformationType_value = map[string]int32{
-	"UNKNOWN":     0,
-	"ABSOLUTE":    1,
-	"PERSECOND":   2,
-	"INCREASE":    3,
-	"ADD":         4,
-	"RESET":       5,
-	"INCREASEV2":  6,
+	"UNKNOWN":    0,
+	"ABSOLUTE":   1,
+	"PERSECOND":  2,
+	"INCREASE":   3,
+	"ADD":        4,
+	"RESET":      5,
+	"INCREASEV2": 6,
+	"COMPARISON": 7,
+	"ARITHMETIC": 8,
 }
 
 func (x TransformationType) String() string {
@@ -93,19 +99,21 @@ func init() {
 }
 
 var fileDescriptorTransformation = []byte{
-	// 212 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x0a, 0x49, 0xcf, 0x2c, 0xc9,
-	0x28, 0x4d, 0xd2, 0x4b, 0xce, 0xcf, 0xd5, 0xcf, 0x35, 0x4e, 0x49, 0xd2, 0xcf, 0x35, 0xd6, 0x2f,
-	0x2e, 0x4a, 0xd6, 0xcf, 0x4d, 0x2d, 0x29, 0xca, 0x4c, 0x2e, 0xd6, 0x4f, 0x4f, 0xcd, 0x4b, 0x2d,
-	0x4a, 0x2c, 0x49, 0x4d, 0xd1, 0x2f, 0x28, 0xca, 0x2f, 0xc9, 0xd7, 0x2f, 0x29, 0x4a, 0xcc, 0x2b,
-	0x4e, 0xcb, 0x2f, 0xca, 0x4d, 0x2c, 0xc9, 0xcc, 0xcf, 0x2b, 0x48, 0x42, 0x13, 0xd0, 0x03, 0xab,
-	0x12, 0x12, 0x40, 0x57, 0xa6, 0x95, 0xc0, 0x25, 0x14, 0x82, 0x22, 0x16, 0x52, 0x59, 0x90, 0x2a,
-	0xc4, 0xcd, 0xc5, 0x1e, 0xea, 0xe7, 0xed, 0xe7, 0x1f, 0xee, 0x27, 0xc0, 0x20, 0xc4, 0xc3, 0xc5,
-	0xe1, 0xe8, 0x14, 0xec, 0xef, 0x13, 0x1a, 0xe2, 0x2a, 0xc0, 0x28, 0xc4, 0xcb, 0xc5, 0x19, 0xe0,
-	0x1a, 0x14, 0xec, 0xea, 0xec, 0xef, 0xe7, 0x22, 0xc0, 0x04, 0x92, 0xf4, 0xf4, 0x73, 0x0e, 0x72,
-	0x75, 0x0c, 0x76, 0x15, 0x60, 0x16, 0x62, 0xe7, 0x62, 0x76, 0x74, 0x71, 0x11, 0x60, 0x11, 0xe2,
-	0xe4, 0x62, 0x0d, 0x72, 0x0d, 0x76, 0x0d, 0x11, 0x60, 0x75, 0x0a, 0x3c, 0xf1, 0x48, 0x8e, 0xf1,
-	0xc2, 0x23, 0x39, 0xc6, 0x07, 0x8f, 0xe4, 0x18, 0x27, 0x3c, 0x96, 0x63, 0x88, 0xb2, 0xa7, 0xd0,
-	0x6f, 0x49, 0x6c, 0x60, 0x71, 0x63, 0x40, 0x00, 0x00, 0x00, 0xff, 0xff, 0x71, 0x38, 0xb4, 0xa1,
-	0x25, 0x01, 0x00, 0x00,
+	// 247 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x90, 0x3f, 0x4e, 0xc3, 0x30,
+	0x1c, 0x46, 0x1b, 0x4a, 0x9b, 0xd6, 0xfc, 0xd1, 0x4f, 0x3e, 0x40, 0x0e, 0xc0, 0x50, 0x4b, 0xe4,
+	0x00, 0x28, 0x4d, 0x2c, 0x11, 0x41, 0xed, 0x62, 0xbb, 0x20, 0xb1, 0x25, 0xa9, 0x29, 0x19, 0x1c,
+	0x47, 0x8e, 0x19, 0xb8, 0x45, 0x8f, 0xc5, 0xc8, 0x11, 0x50, 0xb8, 0x08, 0x4a, 0x25, 0x06, 0xba,
+	0x32, 0xbe, 0xf7, 0xbd, 0xe9, 0x43, 0x6a, 0x57, 0xfb, 0xd7, 0xb7, 0x72, 0x51, 0x59, 0x43, 0x4c,
+	0xbc, 0x2d, 0x89, 0x89, 0x49, 0xe7, 0x2a, 0x62, 0xb4, 0x77, 0x75, 0xd5, 0x91, 0x9d, 0x6e, 0xb4,
+	0x2b, 0xbc, 0xde, 0x92, 0xd6, 0x59, 0x6f, 0x89, 0x77, 0x45, 0xd3, 0xbd, 0x58, 0x67, 0x0a, 0x5f,
+	0xdb, 0xa6, 0x2d, 0x8f, 0xc4, 0xe2, 0x50, 0x61, 0x38, 0xce, 0xae, 0xf6, 0x01, 0xc2, 0xea, 0x8f,
+	0x54, 0xef, 0xad, 0xc6, 0x67, 0x28, 0xdc, 0xb0, 0x3b, 0xc6, 0x9f, 0x18, 0x8c, 0xf0, 0x39, 0x9a,
+	0x25, 0x4b, 0xc9, 0xef, 0x37, 0x8a, 0x42, 0x80, 0x2f, 0xd0, 0x7c, 0x4d, 0x85, 0xa4, 0x29, 0x67,
+	0x19, 0x9c, 0x0c, 0x63, 0xce, 0x52, 0x41, 0x13, 0x49, 0x61, 0x8c, 0x43, 0x34, 0x4e, 0xb2, 0x0c,
+	0x4e, 0xf1, 0x1c, 0x4d, 0x04, 0x95, 0x54, 0xc1, 0x04, 0x5f, 0x22, 0xf4, 0x5b, 0x3c, 0x5e, 0xc3,
+	0x74, 0xe0, 0x94, 0xaf, 0xd6, 0x89, 0xc8, 0x25, 0x67, 0x10, 0x0e, 0x9c, 0x88, 0x5c, 0xdd, 0xae,
+	0xa8, 0xca, 0x53, 0x98, 0x2d, 0x1f, 0x3e, 0xfa, 0x28, 0xf8, 0xec, 0xa3, 0xe0, 0xab, 0x8f, 0x82,
+	0xfd, 0x77, 0x34, 0x7a, 0xbe, 0xf9, 0xe7, 0x19, 0xe5, 0xf4, 0xe0, 0xe3, 0x9f, 0x01, 0x00, 0xa1,
+	0x89, 0x06, 0xa1, 0x56, 0x01, 0x00, 0x00,
 }
@@ -99,7 +99,7 @@ func (u OpUnion) Equal(other OpUnion) bool {
 		return u.Rollup.Equal(other.Rollup)
 	}
 
-	return u.Transformation.Type == other.Transformation.Type
+	return u.Transformation.Equal(other.Transformation)
 }
 
 // Clone clones an operation union.
@@ -159,7 +159,7 @@ func (u *OpUnion) FromProto(pb pipelinepb.AppliedPipelineOp) error {
 		return u.Transformation.FromProto(pb.Transformation)
 	case pipelinepb.AppliedPipelineOp_ROLLUP:
 		u.Type = pipeline.RollupOpType
-		u.Transformation.Type = transformation.UnknownType
+		u.Transformation = pipeline.TransformationOp{}
 		return u.Rollup.FromProto(pb.Rollup)
 	default:
 		return errUnknownOpType
@@ -209,7 +209,7 @@ func (p Pipeline) Equal(other Pipeline) bool {
 				return false
 			}
 		case pipeline.TransformationOpType:
-			if p.Operations[i].Transformation.Type != other.Operations[i].Transformation.Type {
+			if !p.Operations[i].Transformation.Equal(other.Operations[i].Transformation) {
 				return false
 			}
 		}
@@ -322,11 +322,11 @@ func OperationsFromProto(pb []pipelinepb.AppliedPipelineOp, ops []OpUnion) error
 			if pb[i].Transformation.Type == transformationpb.TransformationType_UNKNOWN {
 				return errNilTransformationOpProto
 			}
-			if err := u.Transformation.Type.FromProto(pb[i].Transformation.Type); err != nil {
+			if err := u.Transformation.FromProto(pb[i].Transformation); err != nil {
 				return err
 			}
 		case pipeline.RollupOpType:
-			u.Transformation.Type = transformation.UnknownType
+			u.Transformation = pipeline.TransformationOp{}
 			if pb == nil {
 				return errNilAppliedRollupOpProto
 			}
@@ -26,6 +26,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/m3db/m3/src/metrics/aggregation"
@@ -126,6 +127,8 @@ func (op *AggregationOp) UnmarshalText(data []byte) error {
 type TransformationOp struct {
 	// Type of transformation performed.
 	Type transformation.Type
+	// Params of the transformation, only set for the types taking parameters.
+	Params transformation.Params
 }
 
 // NewTransformationOpFromProto creates a new transformation op from proto.
@@ -139,7 +142,7 @@ func NewTransformationOpFromProto(pb *pipelinepb.TransformationOp) (Transformati
 
 // Equal determines whether two transformation operations are equal.
 func (op TransformationOp) Equal(other TransformationOp) bool {
-	return op.Type == other.Type
+	return op.Type == other.Type && op.Params == other.Params
 }
 
 // Clone clones the transformation operation.
@@ -156,28 +159,74 @@ func (op TransformationOp) Proto() (*pipelinepb.TransformationOp, error) {
 	return &pbOp, nil
 }
 
+// NewOp returns the constructed operation of the transformation.
+func (op TransformationOp) NewOp() (transformation.Op, error) {
+	return op.Type.NewOpWithParams(op.Params)
+}
+
 func (op TransformationOp) String() string {
-	return op.Type.String()
+	if !op.Type.IsParameterized() {
+		return op.Type.String()
+	}
+	return fmt.Sprintf("%s(%s,%s)", op.Type.String(), op.Params.Operator,
+		strconv.FormatFloat(op.Params.Value, 'g', -1, 64))
 }
 
 // ToProto converts the transformation op to a protobuf message in place.
 func (op TransformationOp) ToProto(pb *pipelinepb.TransformationOp) error {
+	pb.Operator = op.Params.Operator
+	pb.Value = op.Params.Value
 	return op.Type.ToProto(&pb.Type)
 }
 
 // FromProto converts the protobuf message to a transformation in place.
 func (op *TransformationOp) FromProto(pb pipelinepb.TransformationOp) error {
+	op.Params = transformation.Params{Operator: pb.Operator, Value: pb.Value}
 	return op.Type.FromProto(pb.Type)
 }
 
-// UnmarshalText extracts this type from its textual representation.
+// UnmarshalText extracts this type from its textual representation, the
+// parameters of the types taking them are given as in Comparison(gt,0.5).
 func (op *TransformationOp) UnmarshalText(text []byte) error {
-	return op.Type.UnmarshalText(text)
+	str := string(text)
+	idx := strings.IndexByte(str, '(')
+	if idx < 0 {
+		if err := op.Type.UnmarshalText(text); err != nil {
+			return err
+		}
+		if op.Type.IsParameterized() {
+			return fmt.Errorf("transformation %s requires parameters", str)
+		}
+		op.Params = transformation.Params{}
+		return nil
+	}
+	if !strings.HasSuffix(str, ")") {
+		return fmt.Errorf("invalid transformation parameters: %s", str)
+	}
+	params := strings.Split(str[idx+1:len(str)-1], ",")
+	if len(params) != 2 {
+		return fmt.Errorf("invalid transformation parameters: %s", str)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(params[1]), 64)
+	if err != nil {
+		return fmt.Errorf("invalid transformation parameters: %s", str)
+	}
+	if err := op.Type.UnmarshalText([]byte(str[:idx])); err != nil {
+		return err
+	}
+	if !op.Type.IsParameterized() {
+		return fmt.Errorf("transformation %s does not take parameters", str[:idx])
+	}
+	op.Params = transformation.Params{Operator: strings.TrimSpace(params[0]), Value: value}
+	return nil
 }
 
 // MarshalText serializes this type to its textual representation.
 func (op TransformationOp) MarshalText() (text []byte, err error) {
-	return op.Type.MarshalText()
+	if !op.Type.IsParameterized() {
+		return op.Type.MarshalText()
+	}
+	return []byte(op.String()), nil
 }
 
 // RollupType is the rollup type.
@@ -45,6 +45,19 @@ var (
 	testBadTransformationOpProto = pipelinepb.TransformationOp{
 		Type: transformationpb.TransformationType_UNKNOWN,
 	}
+	testComparisonOp = TransformationOp{
+		Type:   transformation.Comparison,
+		Params: transformation.Params{Operator: "gt", Value: 0.5},
+	}
+	testArithmeticOp = TransformationOp{
+		Type:   transformation.Arithmetic,
+		Params: transformation.Params{Operator: "div", Value: 1024},
+	}
+	testComparisonOpProto = pipelinepb.TransformationOp{
+		Type:     transformationpb.TransformationType_COMPARISON,
+		Operator: "gt",
+		Value:    0.5,
+	}
 )
 
 func TestAggregationOpEqual(t *testing.T) {
@@ -121,13 +134,26 @@ func TestTransformationOpEqual(t *testing.T) {
 		expected bool
 	}{
 		{
-			a1:       TransformationOp{transformation.Absolute},
-			a2:       TransformationOp{transformation.Absolute},
+			a1:       TransformationOp{Type: transformation.Absolute},
+			a2:       TransformationOp{Type: transformation.Absolute},
+			expected: true,
+		},
+		{
+			a1:       TransformationOp{Type: transformation.Absolute},
+			a2:       TransformationOp{Type: transformation.PerSecond},
+			expected: false,
+		},
+		{
+			a1:       testComparisonOp,
+			a2:       testComparisonOp,
 			expected: true,
 		},
 		{
-			a1:       TransformationOp{transformation.Absolute},
-			a2:       TransformationOp{transformation.PerSecond},
+			a1: testComparisonOp,
+			a2: TransformationOp{
+				Type:   transformation.Comparison,
+				Params: transformation.Params{Operator: "gt", Value: 1},
+			},
 			expected: false,
 		},
 	}
@@ -139,7 +165,7 @@ func TestTransformationOpEqual(t *testing.T) {
 }
 
 func TestTransformationOpClone(t *testing.T) {
-	source := TransformationOp{transformation.Absolute}
+	source := TransformationOp{Type: transformation.Absolute}
 	clone := source.Clone()
 	require.Equal(t, source, clone)
 	clone.Type = transformation.PerSecond
@@ -219,6 +245,52 @@ func TestTransformationOpRoundTrip(t *testing.T) {
 	require.Equal(t, testTransformationOp, res)
 }
 
+func TestTransformationOpParamsRoundTrip(t *testing.T) {
+	var pb pipelinepb.TransformationOp
+	require.NoError(t, testComparisonOp.ToProto(&pb))
+	require.Equal(t, testComparisonOpProto, pb)
+
+	data, err := pb.Marshal()
+	require.NoError(t, err)
+	var decoded pipelinepb.TransformationOp
+	require.NoError(t, decoded.Unmarshal(data))
+
+	var res TransformationOp
+	require.NoError(t, res.FromProto(decoded))
+	require.Equal(t, testComparisonOp, res)
+}
+
+func TestTransformationOpNewOp(t *testing.T) {
+	op, err := testComparisonOp.NewOp()
+	require.NoError(t, err)
+	tf, ok := op.UnaryTransform()
+	require.True(t, ok)
+	require.Equal(t, 1.0, tf.Evaluate(transformation.Datapoint{Value: 1}).Value)
+
+	_, err = TransformationOp{Type: transformation.Comparison}.NewOp()
+	require.Error(t, err)
+}
+
+func TestTransformationOpMarshalling(t *testing.T) {
+	testmarshal.TestMarshalersRoundtrip(t,
+		[]TransformationOp{testTransformationOp, testComparisonOp, testArithmeticOp},
+		[]testmarshal.Marshaler{testmarshal.TextMarshaler, testmarshal.JSONMarshaler, testmarshal.YAMLMarshaler})
+	testmarshal.AssertMarshals(t, testmarshal.TextMarshaler, testComparisonOp, []byte("Comparison(gt,0.5)"))
+	testmarshal.AssertUnmarshals(t, testmarshal.TextMarshaler, testComparisonOp, []byte("Comparison(gt, 0.5)"))
+	testmarshal.AssertMarshals(t, testmarshal.TextMarshaler, testArithmeticOp, []byte("Arithmetic(div,1024)"))
+
+	for _, text := range []string{
+		"Comparison",
+		"Comparison(gt)",
+		"Comparison(gt,abc)",
+		"Comparison(gt,0.5",
+		"PerSecond(gt,0.5)",
+	} {
+		var op TransformationOp
+		require.Error(t, op.UnmarshalText([]byte(text)), text)
+	}
+}
+
 func TestRollupOpEqual(t *testing.T) {
 	inputs := []struct {
 		a1       RollupOp
@@ -451,6 +523,7 @@ func TestPipelineUnmarshalYAML(t *testing.T) {
 	input := `
 - aggregation: Sum
 - transformation: PerSecond
+- transformation: Comparison(gt,0.5)
 - rollup:
     newName: testRollup
     tags:
@@ -478,6 +551,10 @@ func TestPipelineUnmarshalYAML(t *testing.T) {
 			Type:           TransformationOpType,
 			Transformation: TransformationOp{Type: transformation.PerSecond},
 		},
+		{
+			Type:           TransformationOpType,
+			Transformation: testComparisonOp,
+		},
 		{
 			Type: RollupOpType,
 			Rollup: RollupOp{
@@ -362,6 +362,9 @@ func validateTransformationOp(transformationOp mpipeline.TransformationOp) error
 	if !transformationOp.Type.IsValid() {
 		return fmt.Errorf("invalid transformation type: %v", transformationOp.Type)
 	}
+	if _, err := transformationOp.NewOp(); err != nil {
+		return fmt.Errorf("invalid transformation %v: %v", transformationOp, err)
+	}
 	return nil
 }
 
@@ -0,0 +1,103 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transformation
+
+import (
+	"fmt"
+	"math"
+)
+
+// ArithmeticOp is the operator of an arithmetic transform.
+type ArithmeticOp string
+
+// Supported arithmetic operators.
+const (
+	ArithmeticMultiply ArithmeticOp = "mul"
+	ArithmeticDivide   ArithmeticOp = "div"
+	ArithmeticAdd      ArithmeticOp = "add"
+	ArithmeticSubtract ArithmeticOp = "sub"
+)
+
+// ParseArithmeticOp parses an arithmetic operator.
+func ParseArithmeticOp(str string) (ArithmeticOp, error) {
+	op := ArithmeticOp(str)
+	switch op {
+	case ArithmeticMultiply, ArithmeticDivide, ArithmeticAdd, ArithmeticSubtract:
+		return op, nil
+	}
+	return "", fmt.Errorf("invalid arithmetic operator: %s", str)
+}
+
+// UnmarshalYAML unmarshals text-encoded data into an arithmetic operator.
+func (op *ArithmeticOp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	value, err := ParseArithmeticOp(str)
+	if err != nil {
+		return err
+	}
+	*op = value
+	return nil
+}
+
+func (op ArithmeticOp) apply(value, operand float64) float64 {
+	switch op {
+	case ArithmeticMultiply:
+		return value * operand
+	case ArithmeticDivide:
+		return value / operand
+	case ArithmeticAdd:
+		return value + operand
+	default:
+		return value - operand
+	}
+}
+
+// NewArithmetic returns a transform applying the operator to the value of
+// each datapoint and the operand, e.g. div(1073741824) converts bytes to GiB.
+// Note:
+// * A NaN value is a gap, it is returned as is.
+// * Dividing by zero returns an empty datapoint at the time of the input.
+// * The transform is stateless and can be shared by several series.
+func NewArithmetic(op ArithmeticOp, operand float64) (UnaryTransform, error) {
+	if _, err := ParseArithmeticOp(string(op)); err != nil {
+		return nil, err
+	}
+	if math.IsNaN(operand) || math.IsInf(operand, 0) {
+		return nil, fmt.Errorf("arithmetic operand must be a finite number, got %v", operand)
+	}
+	return UnaryTransformFn(func(dp Datapoint) Datapoint {
+		res := Datapoint{TimeNanos: dp.TimeNanos, Value: math.NaN()}
+		if math.IsNaN(dp.Value) || (op == ArithmeticDivide && operand == 0) {
+			return res
+		}
+		res.Value = op.apply(dp.Value, operand)
+		return res
+	}), nil
+}
+
+// newArithmeticTransform returns the arithmetic of the Arithmetic type, the
+// params are the arithmetic operator and the operand.
+func newArithmeticTransform(params Params) (UnaryTransform, error) {
+	return NewArithmetic(ArithmeticOp(params.Operator), params.Value)
+}
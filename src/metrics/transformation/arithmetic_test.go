@@ -0,0 +1,114 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transformation
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestArithmetic(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name     string
+		op       ArithmeticOp
+		operand  float64
+		values   []float64
+		expected []float64
+	}{
+		{
+			name:     "bytes to GiB",
+			op:       ArithmeticDivide,
+			operand:  1 << 30,
+			values:   []float64{0, 1 << 30, 3 << 29, nan},
+			expected: []float64{0, 1, 1.5, nan},
+		},
+		{
+			name:     "seconds to ms",
+			op:       ArithmeticMultiply,
+			operand:  1000,
+			values:   []float64{0, 1.5, -2, nan},
+			expected: []float64{0, 1500, -2000, nan},
+		},
+		{
+			name:     "add",
+			op:       ArithmeticAdd,
+			operand:  10,
+			values:   []float64{0, -10, 2.5, nan},
+			expected: []float64{10, 0, 12.5, nan},
+		},
+		{
+			name:     "sub",
+			op:       ArithmeticSubtract,
+			operand:  10,
+			values:   []float64{0, 10, 2.5, nan},
+			expected: []float64{-10, 0, -7.5, nan},
+		},
+		{
+			name:     "divide by zero",
+			op:       ArithmeticDivide,
+			operand:  0,
+			values:   []float64{0, 1, -1, nan},
+			expected: []float64{nan, nan, nan, nan},
+		},
+		{
+			name:     "multiply by zero",
+			op:       ArithmeticMultiply,
+			operand:  0,
+			values:   []float64{1, -1, nan},
+			expected: []float64{0, 0, nan},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := NewArithmetic(tt.op, tt.operand)
+			require.NoError(t, err)
+			for i, v := range tt.values {
+				res := tf.Evaluate(Datapoint{TimeNanos: int64(i), Value: v})
+				require.Equal(t, int64(i), res.TimeNanos)
+				if math.IsNaN(tt.expected[i]) {
+					require.True(t, res.IsEmpty(), "value %v", v)
+					continue
+				}
+				require.Equal(t, tt.expected[i], res.Value, "value %v", v)
+			}
+		})
+	}
+}
+
+func TestArithmeticInvalid(t *testing.T) {
+	_, err := NewArithmetic("pow", 2)
+	require.EqualError(t, err, "invalid arithmetic operator: pow")
+	_, err = NewArithmetic(ArithmeticMultiply, math.NaN())
+	require.Error(t, err)
+	_, err = NewArithmetic(ArithmeticAdd, math.Inf(1))
+	require.Error(t, err)
+}
+
+func TestArithmeticOpUnmarshalYAML(t *testing.T) {
+	var ops []ArithmeticOp
+	require.NoError(t, yaml.Unmarshal([]byte("[mul, div, add, sub]"), &ops))
+	require.Equal(t, []ArithmeticOp{ArithmeticMultiply, ArithmeticDivide, ArithmeticAdd, ArithmeticSubtract}, ops)
+	require.Error(t, yaml.Unmarshal([]byte("[mod]"), &ops))
+}
@@ -21,7 +21,9 @@
 package transformation
 
 import (
+	"fmt"
 	"math"
+	"sync/atomic"
 	"time"
 )
 
@@ -51,10 +53,10 @@ func perSecond(prev, curr Datapoint, flags FeatureFlags) Datapoint {
 	if prev.TimeNanos >= curr.TimeNanos || math.IsNaN(prev.Value) || math.IsNaN(curr.Value) {
 		return emptyDatapoint
 	}
-	diff := curr.Value - prev.Value
-	if diff < 0 {
+	if isCounterReset(prev, curr) {
 		return emptyDatapoint
 	}
+	diff := curr.Value - prev.Value
 	rate := diff * float64(nanosPerSecond) / float64(curr.TimeNanos-prev.TimeNanos)
 	return Datapoint{TimeNanos: curr.TimeNanos, Value: rate}
 }
@@ -86,11 +88,17 @@ func increase(prev, curr Datapoint, _ FeatureFlags) Datapoint {
 		prev.Value = 0
 	}
 
-	diff := curr.Value - prev.Value
-	if diff < 0 {
+	if isCounterReset(prev, curr) {
 		return emptyDatapoint
 	}
-	return Datapoint{TimeNanos: curr.TimeNanos, Value: diff}
+	return Datapoint{TimeNanos: curr.TimeNanos, Value: curr.Value - prev.Value}
+}
+
+// isCounterReset returns true if the value decreased between consecutive
+// datapoints, which perSecond and increase treat as a counter reset.
+func isCounterReset(prev, curr Datapoint) bool {
+	return prev.TimeNanos < curr.TimeNanos && !math.IsNaN(prev.Value) &&
+		!math.IsNaN(curr.Value) && curr.Value < prev.Value
 }
 
 // increasev2 treats a NaN prev as curr. That's the only difference between increase and increasev2.
@@ -100,3 +108,100 @@ func increasev2(prev, curr Datapoint, ff FeatureFlags) Datapoint {
 	}
 	return increase(prev, curr, ff)
 }
+
+// NewIncreaseWithAbsoluteTolerance returns a transform computing the increase
+// between consecutive datapoints like increase, except that a value lower than
+// the previous one by at most the tolerance, e.g. due to scrape races between
+// replicas, results in an increase of zero instead of an empty datapoint.
+func NewIncreaseWithAbsoluteTolerance(tolerance float64) (BinaryTransform, error) {
+	if math.IsNaN(tolerance) || tolerance < 0 {
+		return nil, fmt.Errorf("increase tolerance must be non negative, got %v", tolerance)
+	}
+	return increaseWithTolerance(func(float64) float64 {
+		return tolerance
+	}), nil
+}
+
+// NewIncreaseWithRelativeTolerance is like NewIncreaseWithAbsoluteTolerance but
+// the tolerance is a fraction of the previous value, e.g. 0.01 tolerates values
+// up to 1% lower than the previous one.
+func NewIncreaseWithRelativeTolerance(tolerance float64) (BinaryTransform, error) {
+	if math.IsNaN(tolerance) || tolerance < 0 {
+		return nil, fmt.Errorf("increase tolerance must be non negative, got %v", tolerance)
+	}
+	return increaseWithTolerance(func(prev float64) float64 {
+		return tolerance * math.Abs(prev)
+	}), nil
+}
+
+func increaseWithTolerance(toleranceFn func(prev float64) float64) BinaryTransform {
+	return BinaryTransformFn(func(prev, curr Datapoint, flags FeatureFlags) Datapoint {
+		if prev.TimeNanos < curr.TimeNanos && !math.IsNaN(prev.Value) && !math.IsNaN(curr.Value) &&
+			curr.Value < prev.Value && prev.Value-curr.Value <= toleranceFn(prev.Value) {
+			return Datapoint{TimeNanos: curr.TimeNanos, Value: 0}
+		}
+		return increase(prev, curr, flags)
+	})
+}
+
+// MaxRate is a binary transform computing the per second rate between
+// consecutive datapoints like perSecond, but clamping it to a ceiling so
+// that spikes caused by bad data do not trigger alert storms.
+type MaxRate struct {
+	ceiling float64
+	clamped int64
+}
+
+// NewMaxRate returns a max rate transform clamping rates above the ceiling,
+// which must be a non negative number.
+func NewMaxRate(ceiling float64) (*MaxRate, error) {
+	if math.IsNaN(ceiling) || ceiling < 0 {
+		return nil, fmt.Errorf("max rate ceiling must be non negative, got %v", ceiling)
+	}
+	return &MaxRate{ceiling: ceiling}, nil
+}
+
+// Evaluate computes the per second rate, returning the ceiling instead if the
+// rate is above it. Datapoints perSecond returns empty are returned as is.
+func (t *MaxRate) Evaluate(prev, curr Datapoint, flags FeatureFlags) Datapoint {
+	dp := perSecond(prev, curr, flags)
+	if dp.IsEmpty() || dp.Value <= t.ceiling {
+		return dp
+	}
+	atomic.AddInt64(&t.clamped, 1)
+	return Datapoint{TimeNanos: dp.TimeNanos, Value: t.ceiling}
+}
+
+// Clamped returns the number of rates clamped to the ceiling so far.
+func (t *MaxRate) Clamped() int64 {
+	return atomic.LoadInt64(&t.clamped)
+}
+
+// ResetCount is a binary transform wrapping the rate or increase of a series
+// which counts the counter resets seen along the way, e.g. to tell genuinely
+// high rates from rates inflated by resets. The wrapped transform output is
+// returned as is.
+type ResetCount struct {
+	transform BinaryTransform
+	resets    int64
+}
+
+// NewResetCount returns a reset count transform wrapping the transform, e.g.
+// PerSecond or Increase. A NaN previous value is never counted as a reset.
+func NewResetCount(transform BinaryTransform) *ResetCount {
+	return &ResetCount{transform: transform}
+}
+
+// Evaluate evaluates the wrapped transform, counting a reset if the value
+// decreased.
+func (t *ResetCount) Evaluate(prev, curr Datapoint, flags FeatureFlags) Datapoint {
+	if isCounterReset(prev, curr) {
+		atomic.AddInt64(&t.resets, 1)
+	}
+	return t.transform.Evaluate(prev, curr, flags)
+}
+
+// Resets returns the number of counter resets seen so far.
+func (t *ResetCount) Resets() int64 {
+	return atomic.LoadInt64(&t.resets)
+}
@@ -106,3 +106,176 @@ func TestIncrease(t *testing.T) {
 		require.Equal(t, input.expected2, increasev2(input.prev, input.curr, FeatureFlags{}))
 	}
 }
+
+func TestIncreaseWithTolerance(t *testing.T) {
+	absolute, err := NewIncreaseWithAbsoluteTolerance(2)
+	require.NoError(t, err)
+	relative, err := NewIncreaseWithRelativeTolerance(0.1)
+	require.NoError(t, err)
+
+	prev := Datapoint{TimeNanos: time.Unix(1230, 0).UnixNano(), Value: 20}
+	at := func(v float64) Datapoint {
+		return Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: v}
+	}
+	inputs := []struct {
+		name        string
+		curr        Datapoint
+		expectedNaN bool
+		expected    Datapoint
+	}{
+		{name: "increase", curr: at(25), expected: at(5)},
+		{name: "equal", curr: at(20), expected: at(0)},
+		{name: "within tolerance", curr: at(18.5), expected: at(0)},
+		{name: "at tolerance", curr: at(18), expected: at(0)},
+		{name: "above tolerance", curr: at(17.5), expectedNaN: true},
+		{name: "NaN", curr: at(math.NaN()), expectedNaN: true},
+		{name: "same time", curr: Datapoint{TimeNanos: prev.TimeNanos, Value: 19}, expectedNaN: true},
+	}
+	for _, transform := range []BinaryTransform{absolute, relative} {
+		for _, input := range inputs {
+			actual := transform.Evaluate(prev, input.curr, FeatureFlags{})
+			if input.expectedNaN {
+				require.True(t, actual.IsEmpty(), input.name)
+			} else {
+				require.Equal(t, input.expected, actual, input.name)
+			}
+		}
+	}
+
+	// A NaN previous value is treated as zero like increase.
+	nanPrev := Datapoint{TimeNanos: prev.TimeNanos, Value: math.NaN()}
+	require.Equal(t, at(18), absolute.Evaluate(nanPrev, at(18), FeatureFlags{}))
+
+	// The relative tolerance scales with the previous value.
+	prev.Value = 200
+	require.Equal(t, at(0), relative.Evaluate(prev, at(180), FeatureFlags{}))
+	require.True(t, relative.Evaluate(prev, at(179.9), FeatureFlags{}).IsEmpty())
+	require.True(t, absolute.Evaluate(prev, at(180), FeatureFlags{}).IsEmpty())
+}
+
+func TestIncreaseWithToleranceInvalid(t *testing.T) {
+	for _, tolerance := range []float64{-1, math.NaN()} {
+		_, err := NewIncreaseWithAbsoluteTolerance(tolerance)
+		require.Error(t, err)
+		_, err = NewIncreaseWithRelativeTolerance(tolerance)
+		require.Error(t, err)
+	}
+}
+
+func TestMaxRate(t *testing.T) {
+	maxRate, err := NewMaxRate(1)
+	require.NoError(t, err)
+	var _ BinaryTransform = maxRate
+
+	prev := Datapoint{TimeNanos: time.Unix(1230, 0).UnixNano(), Value: 10}
+	inputs := []struct {
+		curr        Datapoint
+		expectedNaN bool
+		expected    Datapoint
+		clamped     int64
+	}{
+		{
+			curr:     Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 15},
+			expected: Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 0.5},
+		},
+		{
+			// A rate equal to the ceiling isn't clamped.
+			curr:     Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 20},
+			expected: Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 1},
+		},
+		{
+			curr:     Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 20.5},
+			expected: Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 1},
+			clamped:  1,
+		},
+		{
+			curr:     Datapoint{TimeNanos: time.Unix(1231, 0).UnixNano(), Value: 1000},
+			expected: Datapoint{TimeNanos: time.Unix(1231, 0).UnixNano(), Value: 1},
+			clamped:  2,
+		},
+		{
+			curr:        Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: math.NaN()},
+			expectedNaN: true,
+			clamped:     2,
+		},
+		{
+			curr:        Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 5},
+			expectedNaN: true,
+			clamped:     2,
+		},
+	}
+
+	for _, input := range inputs {
+		actual := maxRate.Evaluate(prev, input.curr, FeatureFlags{})
+		if input.expectedNaN {
+			require.True(t, actual.IsEmpty())
+		} else {
+			require.Equal(t, input.expected, actual)
+		}
+		require.Equal(t, input.clamped, maxRate.Clamped())
+	}
+
+	nanPrev := Datapoint{TimeNanos: prev.TimeNanos, Value: math.NaN()}
+	require.True(t, maxRate.Evaluate(nanPrev, inputs[3].curr, FeatureFlags{}).IsEmpty())
+	require.Equal(t, int64(2), maxRate.Clamped())
+}
+
+func TestMaxRateZeroCeiling(t *testing.T) {
+	maxRate, err := NewMaxRate(0)
+	require.NoError(t, err)
+	prev := Datapoint{TimeNanos: time.Unix(1230, 0).UnixNano(), Value: 10}
+	require.Equal(t, Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 0},
+		maxRate.Evaluate(prev, Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 10}, FeatureFlags{}))
+	require.Equal(t, int64(0), maxRate.Clamped())
+	require.Equal(t, Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 0},
+		maxRate.Evaluate(prev, Datapoint{TimeNanos: time.Unix(1240, 0).UnixNano(), Value: 11}, FeatureFlags{}))
+	require.Equal(t, int64(1), maxRate.Clamped())
+}
+
+func TestMaxRateInvalidCeiling(t *testing.T) {
+	for _, ceiling := range []float64{-1, math.NaN()} {
+		_, err := NewMaxRate(ceiling)
+		require.Error(t, err)
+	}
+}
+
+func TestResetCount(t *testing.T) {
+	// The series resets from 5 to 2 and from 8 to 3.
+	values := []float64{1, 5, 2, 8, 3, 4}
+	expectedResets := []int64{0, 1, 1, 2, 2}
+	for _, typ := range []Type{PerSecond, Increase} {
+		transform, err := typ.BinaryTransform()
+		require.NoError(t, err)
+		resets := NewResetCount(transform)
+		var _ BinaryTransform = resets
+
+		prev := Datapoint{TimeNanos: time.Unix(1230, 0).UnixNano(), Value: values[0]}
+		for i, v := range values[1:] {
+			curr := Datapoint{TimeNanos: prev.TimeNanos + int64(10*time.Second), Value: v}
+			expected := transform.Evaluate(prev, curr, FeatureFlags{})
+			actual := resets.Evaluate(prev, curr, FeatureFlags{})
+			if expected.IsEmpty() {
+				require.True(t, actual.IsEmpty(), "%s at %d", typ, i)
+			} else {
+				require.Equal(t, expected, actual, "%s at %d", typ, i)
+			}
+			require.Equal(t, expectedResets[i], resets.Resets(), "%s at %d", typ, i)
+			prev = curr
+		}
+		require.Equal(t, int64(2), resets.Resets(), typ.String())
+	}
+}
+
+func TestResetCountGap(t *testing.T) {
+	resets := NewResetCount(transformIncrease())
+	at := func(sec int64, v float64) Datapoint {
+		return Datapoint{TimeNanos: time.Unix(sec, 0).UnixNano(), Value: v}
+	}
+	// A decrease across a gap, or out of order datapoints, aren't resets.
+	resets.Evaluate(at(1230, 8), at(1240, math.NaN()), FeatureFlags{})
+	resets.Evaluate(at(1240, math.NaN()), at(1250, 3), FeatureFlags{})
+	resets.Evaluate(at(1250, 3), at(1250, 1), FeatureFlags{})
+	require.Equal(t, int64(0), resets.Resets())
+	resets.Evaluate(at(1250, 3), at(1260, 1), FeatureFlags{})
+	require.Equal(t, int64(1), resets.Resets())
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transformation
+
+import (
+	"fmt"
+	"math"
+)
+
+// ComparisonOp is the operator of a comparison transform.
+type ComparisonOp string
+
+// Supported comparison operators.
+const (
+	GreaterThan ComparisonOp = "gt"
+	LessThan    ComparisonOp = "lt"
+	Equal       ComparisonOp = "eq"
+)
+
+// ParseComparisonOp parses a comparison operator.
+func ParseComparisonOp(str string) (ComparisonOp, error) {
+	op := ComparisonOp(str)
+	switch op {
+	case GreaterThan, LessThan, Equal:
+		return op, nil
+	}
+	return "", fmt.Errorf("invalid comparison operator: %s", str)
+}
+
+// UnmarshalYAML unmarshals text-encoded data into a comparison operator.
+func (op *ComparisonOp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	value, err := ParseComparisonOp(str)
+	if err != nil {
+		return err
+	}
+	*op = value
+	return nil
+}
+
+func (op ComparisonOp) compare(value, threshold float64) bool {
+	switch op {
+	case GreaterThan:
+		return value > threshold
+	case LessThan:
+		return value < threshold
+	default:
+		return value == threshold
+	}
+}
+
+// NewComparison returns a transform emitting 1 for the datapoints whose value
+// compares true to the threshold with the operator and 0 for the others, e.g.
+// to precompute an alert condition.
+// Note:
+// * A NaN value is a gap, it is returned as is.
+// * The transform is stateless and can be shared by several series.
+func NewComparison(op ComparisonOp, threshold float64) (UnaryTransform, error) {
+	if _, err := ParseComparisonOp(string(op)); err != nil {
+		return nil, err
+	}
+	if math.IsNaN(threshold) {
+		return nil, fmt.Errorf("comparison threshold must be a number, got %v", threshold)
+	}
+	return UnaryTransformFn(func(dp Datapoint) Datapoint {
+		res := Datapoint{TimeNanos: dp.TimeNanos}
+		switch {
+		case math.IsNaN(dp.Value):
+			res.Value = math.NaN()
+		case op.compare(dp.Value, threshold):
+			res.Value = 1
+		}
+		return res
+	}), nil
+}
+
+// newComparisonTransform returns the comparison of the Comparison type, the
+// params are the comparison operator and the threshold.
+func newComparisonTransform(params Params) (UnaryTransform, error) {
+	return NewComparison(ComparisonOp(params.Operator), params.Value)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transformation
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestComparison(t *testing.T) {
+	const threshold = 10.0
+	values := []float64{9.999, threshold, 10.001, math.Inf(-1), math.Inf(1)}
+	tests := []struct {
+		op       ComparisonOp
+		expected []float64
+	}{
+		{op: GreaterThan, expected: []float64{0, 0, 1, 0, 1}},
+		{op: LessThan, expected: []float64{1, 0, 0, 1, 0}},
+		{op: Equal, expected: []float64{0, 1, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.op), func(t *testing.T) {
+			tf, err := NewComparison(tt.op, threshold)
+			require.NoError(t, err)
+			for i, v := range values {
+				res := tf.Evaluate(Datapoint{TimeNanos: int64(i), Value: v})
+				require.Equal(t, Datapoint{TimeNanos: int64(i), Value: tt.expected[i]}, res, "value %v", v)
+			}
+			res := tf.Evaluate(Datapoint{TimeNanos: 42, Value: math.NaN()})
+			require.Equal(t, int64(42), res.TimeNanos)
+			require.True(t, res.IsEmpty())
+		})
+	}
+}
+
+func TestComparisonInvalid(t *testing.T) {
+	_, err := NewComparison("ge", 1)
+	require.EqualError(t, err, "invalid comparison operator: ge")
+	_, err = NewComparison(GreaterThan, math.NaN())
+	require.Error(t, err)
+}
+
+func TestComparisonOpUnmarshalYAML(t *testing.T) {
+	var ops []ComparisonOp
+	require.NoError(t, yaml.Unmarshal([]byte("[gt, lt, eq]"), &ops))
+	require.Equal(t, []ComparisonOp{GreaterThan, LessThan, Equal}, ops)
+	require.Error(t, yaml.Unmarshal([]byte("[ne]"), &ops))
+}
@@ -54,6 +54,24 @@ func (fn UnaryTransformFn) Evaluate(dp Datapoint) Datapoint {
 	return fn(dp)
 }
 
+// StatefulTransform is a unary transformation whose output depends on the
+// previous datapoints of a series, e.g. a moving average. It only holds the
+// parameters of the transformation and can be shared by several series, the
+// state of each series is created by NewState.
+type StatefulTransform interface {
+	// NewState returns the initial state of a series.
+	NewState() TransformState
+}
+
+// TransformState is the state of a StatefulTransform for a single series.
+type TransformState interface {
+	// Evaluate transforms the next datapoint of the series, updating the state.
+	Evaluate(dp Datapoint) Datapoint
+
+	// Reset resets the state to its initial value, as if no datapoint was seen.
+	Reset()
+}
+
 // FeatureFlags holds options passed into transformations from
 // the aggregator configuration file.
 // nolint:gofumpt
@@ -90,3 +108,67 @@ type UnaryMultiOutputTransformFn func(dp Datapoint, resolution time.Duration) (D
 func (fn UnaryMultiOutputTransformFn) Evaluate(dp Datapoint, resolution time.Duration) (Datapoint, Datapoint) {
 	return fn(dp, resolution)
 }
+
+// HistogramBucket is a classic histogram bucket, counting the observations
+// less than or equal to its upper bound.
+type HistogramBucket struct {
+	UpperBound float64
+	Count      float64
+}
+
+// HistogramDatapoint is a histogram data point containing a timestamp in
+// Unix nanoseconds since epoch and its cumulative buckets. The buckets are
+// expected to be sorted by upper bound with the last one being +Inf.
+type HistogramDatapoint struct {
+	TimeNanos int64
+	Buckets   []HistogramBucket
+}
+
+// HistogramTransform is a transformation that takes a single histogram
+// datapoint as input and transforms it into a datapoint as output.
+type HistogramTransform interface {
+	Evaluate(dp HistogramDatapoint) Datapoint
+}
+
+// HistogramTransformFn implements HistogramTransform as a function.
+type HistogramTransformFn func(dp HistogramDatapoint) Datapoint
+
+// Evaluate implements HistogramTransform as a function.
+func (fn HistogramTransformFn) Evaluate(dp HistogramDatapoint) Datapoint {
+	return fn(dp)
+}
+
+// WindowTransform is a transformation that takes all the datapoints of a
+// window as input and reduces them into a single datapoint as output.
+type WindowTransform interface {
+	Evaluate(dps []Datapoint) Datapoint
+}
+
+// WindowTransformFn implements WindowTransform as a function.
+type WindowTransformFn func(dps []Datapoint) Datapoint
+
+// Evaluate implements WindowTransform as a function.
+func (fn WindowTransformFn) Evaluate(dps []Datapoint) Datapoint {
+	return fn(dps)
+}
+
+// Window is the time range of a window, in Unix nanoseconds since epoch.
+type Window struct {
+	StartNanos int64
+	EndNanos   int64
+}
+
+// BoundedWindowTransform is a transformation that takes the datapoints of a
+// window along with its boundaries as input and reduces them into a single
+// datapoint as output, e.g. to produce a datapoint for an empty window.
+type BoundedWindowTransform interface {
+	Evaluate(window Window, dps []Datapoint) Datapoint
+}
+
+// BoundedWindowTransformFn implements BoundedWindowTransform as a function.
+type BoundedWindowTransformFn func(window Window, dps []Datapoint) Datapoint
+
+// Evaluate implements BoundedWindowTransform as a function.
+func (fn BoundedWindowTransformFn) Evaluate(window Window, dps []Datapoint) Datapoint {
+	return fn(window, dps)
+}
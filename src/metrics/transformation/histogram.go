@@ -0,0 +1,92 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transformation
+
+import (
+	"fmt"
+	"math"
+)
+
+// NewHistogramQuantile returns a transform computing the q-quantile, between
+// 0 and 1, of classic histogram buckets. It follows the Prometheus
+// histogram_quantile function and assumes the observations are uniformly
+// distributed within each bucket:
+// * The result is NaN if there are fewer than two buckets, if the last
+// bucket isn't +Inf or if there are no observations.
+// * If the quantile falls into the +Inf bucket the upper bound of the
+// second to last bucket is returned.
+// * If the quantile falls into the first bucket and its upper bound is
+// positive the bucket is assumed to start at zero.
+func NewHistogramQuantile(q float64) (HistogramTransform, error) {
+	if math.IsNaN(q) || q < 0 || q > 1 {
+		return nil, fmt.Errorf("histogram quantile must be between 0 and 1, got %v", q)
+	}
+	return HistogramTransformFn(func(dp HistogramDatapoint) Datapoint {
+		return Datapoint{TimeNanos: dp.TimeNanos, Value: bucketQuantile(q, dp.Buckets)}
+	}), nil
+}
+
+func bucketQuantile(q float64, buckets []HistogramBucket) float64 {
+	n := len(buckets)
+	if n < 2 || !math.IsInf(buckets[n-1].UpperBound, 1) {
+		return math.NaN()
+	}
+	// Counts scraped from different buckets are not necessarily consistent,
+	// so treat any decrease as no observations in that bucket.
+	counts := make([]float64, n)
+	for i, b := range buckets {
+		counts[i] = b.Count
+		if i > 0 && counts[i] < counts[i-1] {
+			counts[i] = counts[i-1]
+		}
+	}
+	total := counts[n-1]
+	if total == 0 || math.IsNaN(total) {
+		return math.NaN()
+	}
+
+	rank := q * total
+	b := 0
+	for b < n-1 && counts[b] < rank {
+		b++
+	}
+	switch {
+	case b == n-1:
+		return buckets[n-2].UpperBound
+	case b == 0 && buckets[0].UpperBound <= 0:
+		return buckets[0].UpperBound
+	}
+
+	var (
+		bucketStart float64
+		bucketEnd   = buckets[b].UpperBound
+		count       = counts[b]
+	)
+	if b > 0 {
+		bucketStart = buckets[b-1].UpperBound
+		count -= counts[b-1]
+		rank -= counts[b-1]
+	}
+	if count == 0 {
+		return bucketStart
+	}
+	return bucketStart + (bucketEnd-bucketStart)*(rank/count)
+}
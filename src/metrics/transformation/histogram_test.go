@@ -0,0 +1,113 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transformation
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	// 100 observations spread evenly over (0, 1], 50 in (1, 2] and 10 above 2.
+	buckets := []HistogramBucket{
+		{UpperBound: 0.5, Count: 50},
+		{UpperBound: 1, Count: 100},
+		{UpperBound: 2, Count: 150},
+		{UpperBound: math.Inf(1), Count: 160},
+	}
+	inputs := []struct {
+		q        float64
+		buckets  []HistogramBucket
+		expected float64
+	}{
+		{q: 0, buckets: buckets, expected: 0},
+		{q: 0.25, buckets: buckets, expected: 0.4},
+		{q: 0.5, buckets: buckets, expected: 0.8},
+		{q: 0.75, buckets: buckets, expected: 1.4},
+		{q: 0.9, buckets: buckets, expected: 1.88},
+		// The quantile falls into the +Inf bucket.
+		{q: 0.99, buckets: buckets, expected: 2},
+		{q: 1, buckets: buckets, expected: 2},
+		{
+			q: 0.5,
+			buckets: []HistogramBucket{
+				{UpperBound: -1, Count: 10},
+				{UpperBound: 0, Count: 20},
+				{UpperBound: math.Inf(1), Count: 20},
+			},
+			expected: -1,
+		},
+		{
+			// Non monotonic counts are treated as empty buckets.
+			q: 0.5,
+			buckets: []HistogramBucket{
+				{UpperBound: 1, Count: 10},
+				{UpperBound: 2, Count: 5},
+				{UpperBound: 4, Count: 20},
+				{UpperBound: math.Inf(1), Count: 20},
+			},
+			expected: 1,
+		},
+		{
+			q: 0.9,
+			buckets: []HistogramBucket{
+				{UpperBound: 1, Count: 10},
+				{UpperBound: 2, Count: 5},
+				{UpperBound: 4, Count: 20},
+				{UpperBound: math.Inf(1), Count: 20},
+			},
+			expected: 3.6,
+		},
+	}
+
+	for _, input := range inputs {
+		tf, err := NewHistogramQuantile(input.q)
+		require.NoError(t, err)
+		res := tf.Evaluate(HistogramDatapoint{TimeNanos: 1234, Buckets: input.buckets})
+		require.Equal(t, int64(1234), res.TimeNanos)
+		require.InDelta(t, input.expected, res.Value, 1e-9, "q=%v", input.q)
+	}
+}
+
+func TestHistogramQuantileEmpty(t *testing.T) {
+	tf, err := NewHistogramQuantile(0.5)
+	require.NoError(t, err)
+
+	inputs := [][]HistogramBucket{
+		nil,
+		{{UpperBound: math.Inf(1), Count: 10}},
+		{{UpperBound: 1, Count: 10}, {UpperBound: 2, Count: 20}},
+		{{UpperBound: 1, Count: 0}, {UpperBound: math.Inf(1), Count: 0}},
+	}
+	for _, buckets := range inputs {
+		res := tf.Evaluate(HistogramDatapoint{TimeNanos: 1234, Buckets: buckets})
+		require.True(t, res.IsEmpty())
+	}
+}
+
+func TestHistogramQuantileInvalid(t *testing.T) {
+	for _, q := range []float64{-0.1, 1.1, math.NaN()} {
+		_, err := NewHistogramQuantile(q)
+		require.Error(t, err)
+	}
+}
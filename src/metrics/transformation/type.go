@@ -42,13 +42,23 @@ const (
 	Add
 	Reset
 	Increasev2
+	Comparison
+	Arithmetic
 )
 
 const (
 	_minValidTransformationType = Absolute
-	_maxValidTransformationType = Increasev2
+	_maxValidTransformationType = Arithmetic
 )
 
+// Params are the parameters of the transformation types taking an operator and
+// a value, e.g. the operator and threshold of a comparison or the operator and
+// operand of an arithmetic.
+type Params struct {
+	Operator string
+	Value    float64
+}
+
 // IsValid checks if the transformation type is valid.
 func (t Type) IsValid() bool {
 	return t.IsUnaryTransform() || t.IsBinaryTransform() || t.IsUnaryMultiOutputTransform()
@@ -57,6 +67,12 @@ func (t Type) IsValid() bool {
 // IsUnaryTransform returns whether this is a unary transformation.
 func (t Type) IsUnaryTransform() bool {
 	_, exists := unaryTransforms[t]
+	return exists || t.IsParameterized()
+}
+
+// IsParameterized returns whether this transformation is constructed from Params.
+func (t Type) IsParameterized() bool {
+	_, exists := parameterizedTransforms[t]
 	return exists
 }
 
@@ -101,9 +117,31 @@ func (t Type) NewOp() (Op, error) {
 	}, nil
 }
 
+// NewOpWithParams returns a constructed operation like NewOp, with the params
+// of the transformation types taking parameters.
+func (t Type) NewOpWithParams(params Params) (Op, error) {
+	if !t.IsParameterized() {
+		if params != (Params{}) {
+			return Op{}, fmt.Errorf("%v does not take parameters", t)
+		}
+		return t.NewOp()
+	}
+	unary, err := parameterizedTransforms[t](params)
+	if err != nil {
+		return Op{}, err
+	}
+	return Op{
+		opType: t,
+		unary:  unary,
+	}, nil
+}
+
 // UnaryTransform returns the unary transformation function associated with
 // the transformation type if applicable, or an error otherwise.
 func (t Type) UnaryTransform() (UnaryTransform, error) {
+	if t.IsParameterized() {
+		return nil, fmt.Errorf("%v requires parameters", t)
+	}
 	tf, exists := unaryTransforms[t]
 	if !exists {
 		return nil, fmt.Errorf("%v is not a unary transfomration", t)
@@ -271,6 +309,10 @@ var (
 	unaryMultiOutputTransforms = map[Type]func() UnaryMultiOutputTransform{
 		Reset: transformReset,
 	}
+	parameterizedTransforms = map[Type]func(Params) (UnaryTransform, error){
+		Comparison: newComparisonTransform,
+		Arithmetic: newArithmeticTransform,
+	}
 	typeStringMap map[string]Type
 )
 
@@ -285,4 +327,7 @@ func init() {
 	for t := range unaryMultiOutputTransforms {
 		typeStringMap[t.String()] = t
 	}
+	for t := range parameterizedTransforms {
+		typeStringMap[t.String()] = t
+	}
 }
@@ -35,11 +35,13 @@ func _() {
 	_ = x[Add-4]
 	_ = x[Reset-5]
 	_ = x[Increasev2-6]
+	_ = x[Comparison-7]
+	_ = x[Arithmetic-8]
 }
 
-const _Type_name = "UnknownTypeAbsolutePerSecondIncreaseAddResetIncreasev2"
+const _Type_name = "UnknownTypeAbsolutePerSecondIncreaseAddResetIncreasev2ComparisonArithmetic"
 
-var _Type_index = [...]uint8{0, 11, 19, 28, 36, 39, 44, 54}
+var _Type_index = [...]uint8{0, 11, 19, 28, 36, 39, 44, 54, 64, 74}
 
 func (i Type) String() string {
 	if i < 0 || i >= Type(len(_Type_index)-1) {
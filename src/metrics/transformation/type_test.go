@@ -44,6 +44,8 @@ func TestIsUnaryTransform(t *testing.T) {
 		expected bool
 	}{
 		{typ: Absolute, expected: true},
+		{typ: Comparison, expected: true},
+		{typ: Arithmetic, expected: true},
 		{typ: UnknownType, expected: false},
 		{typ: PerSecond, expected: false},
 		{typ: Type(10000), expected: false},
@@ -86,6 +88,8 @@ func TestUnaryTransformErrors(t *testing.T) {
 	inputs := []Type{
 		UnknownType,
 		PerSecond,
+		Comparison,
+		Arithmetic,
 		Type(10000),
 	}
 
@@ -96,6 +100,39 @@ func TestUnaryTransformErrors(t *testing.T) {
 	}
 }
 
+func TestNewOpWithParams(t *testing.T) {
+	op, err := Comparison.NewOpWithParams(Params{Operator: "lt", Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, Comparison, op.Type())
+	tf, ok := op.UnaryTransform()
+	require.True(t, ok)
+	require.Equal(t, Datapoint{TimeNanos: 1, Value: 1}, tf.Evaluate(Datapoint{TimeNanos: 1, Value: 0.5}))
+
+	op, err = Arithmetic.NewOpWithParams(Params{Operator: "div", Value: 1024})
+	require.NoError(t, err)
+	require.Equal(t, Arithmetic, op.Type())
+	tf, ok = op.UnaryTransform()
+	require.True(t, ok)
+	require.Equal(t, Datapoint{TimeNanos: 1, Value: 2}, tf.Evaluate(Datapoint{TimeNanos: 1, Value: 2048}))
+
+	op, err = Absolute.NewOpWithParams(Params{})
+	require.NoError(t, err)
+	require.Equal(t, Absolute, op.Type())
+}
+
+func TestNewOpWithParamsErrors(t *testing.T) {
+	_, err := Comparison.NewOp()
+	require.EqualError(t, err, "Comparison requires parameters")
+	_, err = Comparison.NewOpWithParams(Params{Operator: "ge", Value: 1})
+	require.EqualError(t, err, "invalid comparison operator: ge")
+	_, err = Arithmetic.NewOp()
+	require.EqualError(t, err, "Arithmetic requires parameters")
+	_, err = Arithmetic.NewOpWithParams(Params{Operator: "mod", Value: 2})
+	require.EqualError(t, err, "invalid arithmetic operator: mod")
+	_, err = Absolute.NewOpWithParams(Params{Operator: "gt", Value: 1})
+	require.EqualError(t, err, "Absolute does not take parameters")
+}
+
 func TestMustUnaryTransform(t *testing.T) {
 	inputs := []Type{
 		Absolute,
@@ -182,6 +219,8 @@ func TestTypeString(t *testing.T) {
 		{typ: UnknownType, expected: "UnknownType"},
 		{typ: Absolute, expected: "Absolute"},
 		{typ: PerSecond, expected: "PerSecond"},
+		{typ: Comparison, expected: "Comparison"},
+		{typ: Arithmetic, expected: "Arithmetic"},
 		{typ: Type(1000), expected: "Type(1000)"},
 	}
 
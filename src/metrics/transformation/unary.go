@@ -20,7 +20,11 @@
 
 package transformation
 
-import "math"
+import (
+	"fmt"
+	"math"
+	"time"
+)
 
 var (
 	// allows to use a single transform fn ref (instead of
@@ -52,3 +56,159 @@ func transformAdd() UnaryTransform {
 		return Datapoint{TimeNanos: dp.TimeNanos, Value: curr}
 	})
 }
+
+// NewEWMA returns a transform smoothing datapoints with an exponentially
+// weighted moving average, i.e. smoothed = alpha*value + (1-alpha)*smoothed,
+// where alpha is in (0, 1] and higher values discount older datapoints faster.
+// A NaN value is a gap, it is returned as is and resets the average so that
+// the next value starts a new one.
+func NewEWMA(alpha float64) (StatefulTransform, error) {
+	if math.IsNaN(alpha) || alpha <= 0 || alpha > 1 {
+		return nil, fmt.Errorf("ewma alpha must be in (0, 1], got %v", alpha)
+	}
+	return ewma{alpha: alpha}, nil
+}
+
+type ewma struct {
+	alpha float64
+}
+
+func (t ewma) NewState() TransformState {
+	return &ewmaState{alpha: t.alpha, smoothed: math.NaN()}
+}
+
+type ewmaState struct {
+	alpha    float64
+	smoothed float64
+}
+
+func (s *ewmaState) Evaluate(dp Datapoint) Datapoint {
+	switch {
+	case math.IsNaN(dp.Value):
+		s.Reset()
+	case math.IsNaN(s.smoothed):
+		s.smoothed = dp.Value
+	default:
+		s.smoothed = s.alpha*dp.Value + (1-s.alpha)*s.smoothed
+	}
+	return Datapoint{TimeNanos: dp.TimeNanos, Value: s.smoothed}
+}
+
+func (s *ewmaState) Reset() {
+	s.smoothed = math.NaN()
+}
+
+// NewSecondsSinceChange returns a transform emitting, for every datapoint, the
+// number of seconds since the value last changed, which is zero for the first
+// datapoint and whenever the value changes. A NaN value is a gap, it is
+// returned as is. A gap longer than the horizon resets the state, so that the
+// next value counts as a change.
+func NewSecondsSinceChange(horizon time.Duration) (StatefulTransform, error) {
+	if horizon <= 0 {
+		return nil, fmt.Errorf("seconds since change horizon must be positive, got %v", horizon)
+	}
+	return secondsSinceChange{horizonNanos: horizon.Nanoseconds()}, nil
+}
+
+type secondsSinceChange struct {
+	horizonNanos int64
+}
+
+func (t secondsSinceChange) NewState() TransformState {
+	return &secondsSinceChangeState{horizonNanos: t.horizonNanos, lastValue: math.NaN()}
+}
+
+type secondsSinceChangeState struct {
+	horizonNanos    int64
+	lastValue       float64
+	lastChangeNanos int64
+	lastSeenNanos   int64
+}
+
+func (s *secondsSinceChangeState) Evaluate(dp Datapoint) Datapoint {
+	if math.IsNaN(dp.Value) {
+		return Datapoint{TimeNanos: dp.TimeNanos, Value: math.NaN()}
+	}
+	if !math.IsNaN(s.lastValue) && dp.TimeNanos-s.lastSeenNanos > s.horizonNanos {
+		s.Reset()
+	}
+	if math.IsNaN(s.lastValue) || dp.Value != s.lastValue {
+		s.lastChangeNanos = dp.TimeNanos
+	}
+	s.lastValue = dp.Value
+	s.lastSeenNanos = dp.TimeNanos
+	elapsed := time.Duration(dp.TimeNanos - s.lastChangeNanos)
+	return Datapoint{TimeNanos: dp.TimeNanos, Value: elapsed.Seconds()}
+}
+
+func (s *secondsSinceChangeState) Reset() {
+	s.lastValue = math.NaN()
+	s.lastChangeNanos = 0
+	s.lastSeenNanos = 0
+}
+
+// NewHysteresis returns a transform emitting 0 or 1, debouncing a flapping
+// signal: the output rises to 1 once the value stayed above the rising
+// threshold for riseDwell consecutive datapoints, and falls back to 0 once it
+// stayed below the falling threshold for fallDwell consecutive datapoints.
+// A NaN value is a gap, it is returned as is and resets the output to 0 and
+// the dwell count.
+func NewHysteresis(rising, falling float64, riseDwell, fallDwell int) (StatefulTransform, error) {
+	if math.IsNaN(rising) || math.IsNaN(falling) || falling > rising {
+		return nil, fmt.Errorf(
+			"hysteresis thresholds must be numbers with falling <= rising, got rising %v and falling %v",
+			rising, falling)
+	}
+	if riseDwell < 1 || fallDwell < 1 {
+		return nil, fmt.Errorf("hysteresis dwell counts must be positive, got rise %d and fall %d",
+			riseDwell, fallDwell)
+	}
+	return hysteresis{
+		rising:    rising,
+		falling:   falling,
+		riseDwell: riseDwell,
+		fallDwell: fallDwell,
+	}, nil
+}
+
+type hysteresis struct {
+	rising    float64
+	falling   float64
+	riseDwell int
+	fallDwell int
+}
+
+func (t hysteresis) NewState() TransformState {
+	return &hysteresisState{hysteresis: t}
+}
+
+type hysteresisState struct {
+	hysteresis
+	output float64
+	// streak is the number of consecutive datapoints past the threshold.
+	streak int
+}
+
+func (s *hysteresisState) Evaluate(dp Datapoint) Datapoint {
+	if math.IsNaN(dp.Value) {
+		s.Reset()
+		return Datapoint{TimeNanos: dp.TimeNanos, Value: math.NaN()}
+	}
+	past, dwell := dp.Value > s.rising, s.riseDwell
+	if s.output == 1 {
+		past, dwell = dp.Value < s.falling, s.fallDwell
+	}
+	if !past {
+		s.streak = 0
+		return Datapoint{TimeNanos: dp.TimeNanos, Value: s.output}
+	}
+	s.streak++
+	if s.streak >= dwell {
+		s.output, s.streak = 1-s.output, 0
+	}
+	return Datapoint{TimeNanos: dp.TimeNanos, Value: s.output}
+}
+
+func (s *hysteresisState) Reset() {
+	s.output, s.streak = 0, 0
+}
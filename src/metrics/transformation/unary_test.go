@@ -21,7 +21,9 @@
 package transformation
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -49,3 +51,195 @@ func TestAbsolute(t *testing.T) {
 		require.Equal(t, input.expected, absolute(input.dp))
 	}
 }
+
+func TestEWMAStep(t *testing.T) {
+	const alpha = 0.25
+	tf, err := NewEWMA(alpha)
+	require.NoError(t, err)
+	state := tf.NewState()
+
+	require.Equal(t, Datapoint{TimeNanos: 0, Value: 0}, state.Evaluate(Datapoint{TimeNanos: 0, Value: 0}))
+	// After n datapoints of a step from 0 to 1 the remaining distance to the
+	// step is (1-alpha)^n.
+	for n := 1; n <= 20; n++ {
+		res := state.Evaluate(Datapoint{TimeNanos: int64(n), Value: 1})
+		require.Equal(t, int64(n), res.TimeNanos)
+		require.InDelta(t, 1-math.Pow(1-alpha, float64(n)), res.Value, 1e-12)
+	}
+}
+
+func TestEWMAResetOnGap(t *testing.T) {
+	tf, err := NewEWMA(0.5)
+	require.NoError(t, err)
+	state := tf.NewState()
+
+	require.Equal(t, 10.0, state.Evaluate(Datapoint{Value: 10}).Value)
+	require.Equal(t, 15.0, state.Evaluate(Datapoint{Value: 20}).Value)
+	require.True(t, state.Evaluate(Datapoint{Value: math.NaN()}).IsEmpty())
+	// The average starts over after the gap.
+	require.Equal(t, 100.0, state.Evaluate(Datapoint{Value: 100}).Value)
+	require.Equal(t, 50.0, state.Evaluate(Datapoint{Value: 0}).Value)
+	// As it does after a reset.
+	state.Reset()
+	require.Equal(t, 30.0, state.Evaluate(Datapoint{Value: 30}).Value)
+}
+
+func TestEWMAStatePerSeries(t *testing.T) {
+	tf, err := NewEWMA(0.5)
+	require.NoError(t, err)
+	first, second := tf.NewState(), tf.NewState()
+
+	require.Equal(t, 10.0, first.Evaluate(Datapoint{Value: 10}).Value)
+	require.Equal(t, 30.0, second.Evaluate(Datapoint{Value: 30}).Value)
+	require.Equal(t, 5.0, first.Evaluate(Datapoint{Value: 0}).Value)
+	require.Equal(t, 15.0, second.Evaluate(Datapoint{Value: 0}).Value)
+}
+
+func TestEWMAInvalidAlpha(t *testing.T) {
+	for _, alpha := range []float64{0, -0.5, 1.5, math.NaN()} {
+		_, err := NewEWMA(alpha)
+		require.Error(t, err)
+	}
+	_, err := NewEWMA(1)
+	require.NoError(t, err)
+}
+
+func TestSecondsSinceChange(t *testing.T) {
+	tf, err := NewSecondsSinceChange(time.Minute)
+	require.NoError(t, err)
+	state := tf.NewState()
+
+	at := func(seconds int) int64 {
+		return int64(seconds) * int64(time.Second)
+	}
+	for _, tt := range []struct {
+		seconds  int
+		value    float64
+		expected float64
+	}{
+		{seconds: 0, value: 1, expected: 0},
+		{seconds: 10, value: 1, expected: 10},
+		{seconds: 20, value: 1, expected: 20},
+		{seconds: 30, value: 2, expected: 0},
+		{seconds: 45, value: 2, expected: 15},
+		{seconds: 50, value: math.NaN(), expected: math.NaN()},
+		// A gap shorter than the horizon keeps the last change.
+		{seconds: 100, value: 2, expected: 70},
+		{seconds: 110, value: 3, expected: 0},
+		{seconds: 120, value: math.NaN(), expected: math.NaN()},
+		{seconds: 160, value: math.NaN(), expected: math.NaN()},
+		// A gap longer than the horizon forgets the last change.
+		{seconds: 200, value: 3, expected: 0},
+		{seconds: 215, value: 3, expected: 15},
+	} {
+		res := state.Evaluate(Datapoint{TimeNanos: at(tt.seconds), Value: tt.value})
+		require.Equal(t, at(tt.seconds), res.TimeNanos)
+		if math.IsNaN(tt.expected) {
+			require.True(t, res.IsEmpty(), "at %ds", tt.seconds)
+			continue
+		}
+		require.Equal(t, tt.expected, res.Value, "at %ds", tt.seconds)
+	}
+}
+
+func TestSecondsSinceChangeStatePerSeries(t *testing.T) {
+	tf, err := NewSecondsSinceChange(time.Minute)
+	require.NoError(t, err)
+	first, second := tf.NewState(), tf.NewState()
+
+	require.Equal(t, 0.0, first.Evaluate(Datapoint{TimeNanos: 0, Value: 1}).Value)
+	require.Equal(t, 0.0, second.Evaluate(Datapoint{TimeNanos: int64(10 * time.Second), Value: 1}).Value)
+	require.Equal(t, 20.0, first.Evaluate(Datapoint{TimeNanos: int64(20 * time.Second), Value: 1}).Value)
+	require.Equal(t, 10.0, second.Evaluate(Datapoint{TimeNanos: int64(20 * time.Second), Value: 1}).Value)
+
+	first.Reset()
+	require.Equal(t, 0.0, first.Evaluate(Datapoint{TimeNanos: int64(30 * time.Second), Value: 1}).Value)
+}
+
+func TestSecondsSinceChangeInvalidHorizon(t *testing.T) {
+	_, err := NewSecondsSinceChange(0)
+	require.Error(t, err)
+}
+
+func TestHysteresis(t *testing.T) {
+	// Rises after 3 datapoints above 10, falls after 2 datapoints below 5.
+	tf, err := NewHysteresis(10, 5, 3, 2)
+	require.NoError(t, err)
+	state := tf.NewState()
+
+	for i, tt := range []struct {
+		value    float64
+		expected float64
+	}{
+		{value: 1, expected: 0},
+		// Flapping above the rising threshold doesn't rise.
+		{value: 11, expected: 0},
+		{value: 12, expected: 0},
+		{value: 9, expected: 0},
+		{value: 11, expected: 0},
+		{value: 11, expected: 0},
+		// Rises once the dwell is satisfied.
+		{value: 11, expected: 1},
+		// Values between the thresholds keep the output.
+		{value: 7, expected: 1},
+		{value: 4, expected: 1},
+		{value: 7, expected: 1},
+		{value: 4, expected: 1},
+		// Falls once the dwell is satisfied.
+		{value: 3, expected: 0},
+		{value: 7, expected: 0},
+		{value: 11, expected: 0},
+		{value: 11, expected: 0},
+		// A gap resets the state.
+		{value: math.NaN(), expected: math.NaN()},
+		{value: 11, expected: 0},
+		{value: 11, expected: 0},
+		{value: 11, expected: 1},
+		{value: math.NaN(), expected: math.NaN()},
+		{value: 7, expected: 0},
+	} {
+		res := state.Evaluate(Datapoint{TimeNanos: int64(i), Value: tt.value})
+		require.Equal(t, int64(i), res.TimeNanos)
+		if math.IsNaN(tt.expected) {
+			require.True(t, res.IsEmpty(), "datapoint %d", i)
+			continue
+		}
+		require.Equal(t, tt.expected, res.Value, "datapoint %d", i)
+	}
+}
+
+func TestHysteresisSingleDwell(t *testing.T) {
+	tf, err := NewHysteresis(1, 1, 1, 1)
+	require.NoError(t, err)
+	state := tf.NewState()
+	for i, v := range []float64{2, 1, 0, 2} {
+		res := state.Evaluate(Datapoint{TimeNanos: int64(i), Value: v})
+		require.Equal(t, []float64{1, 1, 0, 1}[i], res.Value, "datapoint %d", i)
+	}
+}
+
+func TestHysteresisStatePerSeries(t *testing.T) {
+	tf, err := NewHysteresis(10, 5, 2, 1)
+	require.NoError(t, err)
+	first, second := tf.NewState(), tf.NewState()
+
+	require.Equal(t, 0.0, first.Evaluate(Datapoint{Value: 11}).Value)
+	require.Equal(t, 0.0, second.Evaluate(Datapoint{Value: 11}).Value)
+	require.Equal(t, 1.0, first.Evaluate(Datapoint{Value: 11}).Value)
+	require.Equal(t, 0.0, second.Evaluate(Datapoint{Value: 1}).Value)
+	require.Equal(t, 1.0, first.Evaluate(Datapoint{Value: 7}).Value)
+
+	first.Reset()
+	require.Equal(t, 0.0, first.Evaluate(Datapoint{Value: 7}).Value)
+}
+
+func TestHysteresisInvalid(t *testing.T) {
+	_, err := NewHysteresis(5, 10, 1, 1)
+	require.Error(t, err)
+	_, err = NewHysteresis(math.NaN(), 0, 1, 1)
+	require.Error(t, err)
+	_, err = NewHysteresis(10, 5, 0, 1)
+	require.Error(t, err)
+	_, err = NewHysteresis(10, 5, 1, -1)
+	require.Error(t, err)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transformation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// NewQuantileOverTime returns a window transform computing the q-quantile,
+// between 0 and 1, of the values of the datapoints in a window. It follows
+// the Prometheus quantile_over_time function and interpolates linearly
+// between the two values closest to the rank of the quantile:
+// * Empty datapoints are skipped and the result is NaN if there are none left.
+// * The result of a window with a single datapoint is its value.
+// * The result is timestamped with the latest datapoint of the window.
+func NewQuantileOverTime(q float64) (WindowTransform, error) {
+	if math.IsNaN(q) || q < 0 || q > 1 {
+		return nil, fmt.Errorf("quantile over time must be between 0 and 1, got %v", q)
+	}
+	return WindowTransformFn(func(dps []Datapoint) Datapoint {
+		var (
+			timeNanos int64
+			values    = make([]float64, 0, len(dps))
+		)
+		for _, dp := range dps {
+			if dp.IsEmpty() {
+				continue
+			}
+			values = append(values, dp.Value)
+			if dp.TimeNanos > timeNanos {
+				timeNanos = dp.TimeNanos
+			}
+		}
+		if len(values) == 0 {
+			return emptyDatapoint
+		}
+		return Datapoint{TimeNanos: timeNanos, Value: valuesQuantile(q, values)}
+	}), nil
+}
+
+// valuesQuantile sorts the values in place and returns their q-quantile.
+func valuesQuantile(q float64, values []float64) float64 {
+	sort.Float64s(values)
+	rank := q * float64(len(values)-1)
+	lower := math.Floor(rank)
+	upper := math.Min(lower+1, float64(len(values)-1))
+	weight := rank - lower
+	return values[int(lower)]*(1-weight) + values[int(upper)]*weight
+}
+
+// NewHoltWinters returns a window transform producing the smoothed value of the
+// datapoints in a window with double exponential smoothing. It follows the
+// Prometheus holt_winters function, the smoothing factor sf weighs the latest
+// values and the trend factor tf the latest trend, both between 0 and 1 exclusive:
+// * The datapoints of the window are expected in time order.
+// * Empty datapoints are skipped and the result is NaN if less than two are left.
+// * The result is timestamped with the latest datapoint of the window.
+func NewHoltWinters(sf, tf float64) (WindowTransform, error) {
+	if math.IsNaN(sf) || sf <= 0 || sf >= 1 {
+		return nil, fmt.Errorf("holt winters smoothing factor must be between 0 and 1 exclusive, got %v", sf)
+	}
+	if math.IsNaN(tf) || tf <= 0 || tf >= 1 {
+		return nil, fmt.Errorf("holt winters trend factor must be between 0 and 1 exclusive, got %v", tf)
+	}
+	return WindowTransformFn(func(dps []Datapoint) Datapoint {
+		var (
+			timeNanos int64
+			n         int
+			// s0 and s1 are the previous and current smoothed values, b the trend.
+			s0, s1, b float64
+		)
+		for _, dp := range dps {
+			if dp.IsEmpty() {
+				continue
+			}
+			if dp.TimeNanos > timeNanos {
+				timeNanos = dp.TimeNanos
+			}
+			switch n {
+			case 0:
+				s1 = dp.Value
+			case 1:
+				b = dp.Value - s1
+				s0, s1 = s1, sf*dp.Value+(1-sf)*(s1+b)
+			default:
+				b = tf*(s1-s0) + (1-tf)*b
+				s0, s1 = s1, sf*dp.Value+(1-sf)*(s1+b)
+			}
+			n++
+		}
+		if n < 2 {
+			return emptyDatapoint
+		}
+		return Datapoint{TimeNanos: timeNanos, Value: s1}
+	}), nil
+}
+
+// NewAbsent returns a bounded window transform detecting missing data, e.g. for
+// dead man's switch alerts. It follows the Prometheus absent function:
+// * The result of a window without datapoints is 1, empty datapoints are skipped.
+// * The result of a window with datapoints is empty, or 0 if zeroWhenPresent is set.
+// * The result is timestamped with the end of the window.
+func NewAbsent(zeroWhenPresent bool) BoundedWindowTransform {
+	return BoundedWindowTransformFn(func(window Window, dps []Datapoint) Datapoint {
+		for _, dp := range dps {
+			if dp.IsEmpty() {
+				continue
+			}
+			if !zeroWhenPresent {
+				return emptyDatapoint
+			}
+			return Datapoint{TimeNanos: window.EndNanos, Value: 0}
+		}
+		return Datapoint{TimeNanos: window.EndNanos, Value: 1}
+	})
+}
+
+// WindowAggregation is the reduction of a window aggregation transform.
+type WindowAggregation int
+
+const (
+	// WindowMin is the minimum value of the window.
+	WindowMin WindowAggregation = iota
+	// WindowMax is the maximum value of the window.
+	WindowMax
+	// WindowAvg is the average value of the window.
+	WindowAvg
+	// WindowSum is the sum of the values of the window.
+	WindowSum
+)
+
+// NewWindowAggregation returns a bounded window transform reducing the
+// datapoints of a window to their min, max, avg or sum, e.g. for rollups:
+// * Empty datapoints are skipped and the result is NaN if there are none left.
+// * The result is timestamped with the end of the window.
+func NewWindowAggregation(agg WindowAggregation) (BoundedWindowTransform, error) {
+	if agg < WindowMin || agg > WindowSum {
+		return nil, fmt.Errorf("unknown window aggregation %d", agg)
+	}
+	return BoundedWindowTransformFn(func(window Window, dps []Datapoint) Datapoint {
+		var (
+			n      int
+			result float64
+		)
+		for _, dp := range dps {
+			if dp.IsEmpty() {
+				continue
+			}
+			switch {
+			case n == 0:
+				result = dp.Value
+			case agg == WindowMin:
+				result = math.Min(result, dp.Value)
+			case agg == WindowMax:
+				result = math.Max(result, dp.Value)
+			default:
+				result += dp.Value
+			}
+			n++
+		}
+		if n == 0 {
+			return emptyDatapoint
+		}
+		if agg == WindowAvg {
+			result /= float64(n)
+		}
+		return Datapoint{TimeNanos: window.EndNanos, Value: result}
+	}), nil
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2018 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transformation
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantileOverTime(t *testing.T) {
+	// The values 1 to 100 in a shuffled order, timestamped in order.
+	window := make([]Datapoint, 0, 100)
+	for i, v := range rand.New(rand.NewSource(0)).Perm(100) {
+		window = append(window, Datapoint{TimeNanos: int64(i + 1), Value: float64(v + 1)})
+	}
+	inputs := []struct {
+		q        float64
+		dps      []Datapoint
+		expected Datapoint
+	}{
+		{q: 0, dps: window, expected: Datapoint{TimeNanos: 100, Value: 1}},
+		{q: 0.5, dps: window, expected: Datapoint{TimeNanos: 100, Value: 50.5}},
+		{q: 0.9, dps: window, expected: Datapoint{TimeNanos: 100, Value: 90.1}},
+		{q: 0.99, dps: window, expected: Datapoint{TimeNanos: 100, Value: 99.01}},
+		{q: 1, dps: window, expected: Datapoint{TimeNanos: 100, Value: 100}},
+		{
+			q:        0.9,
+			dps:      []Datapoint{{TimeNanos: 10, Value: 3}},
+			expected: Datapoint{TimeNanos: 10, Value: 3},
+		},
+		{
+			q: 0.5,
+			dps: []Datapoint{
+				{TimeNanos: 10, Value: 4},
+				{TimeNanos: 20, Value: math.NaN()},
+				{TimeNanos: 30, Value: 2},
+			},
+			expected: Datapoint{TimeNanos: 30, Value: 3},
+		},
+	}
+	for _, input := range inputs {
+		tf, err := NewQuantileOverTime(input.q)
+		require.NoError(t, err)
+		res := tf.Evaluate(input.dps)
+		require.Equal(t, input.expected.TimeNanos, res.TimeNanos)
+		require.InDelta(t, input.expected.Value, res.Value, 1e-9, "q=%v", input.q)
+	}
+}
+
+func TestQuantileOverTimeEmptyWindow(t *testing.T) {
+	tf, err := NewQuantileOverTime(0.5)
+	require.NoError(t, err)
+	require.True(t, tf.Evaluate(nil).IsEmpty())
+	require.True(t, tf.Evaluate([]Datapoint{{TimeNanos: 10, Value: math.NaN()}}).IsEmpty())
+}
+
+func TestQuantileOverTimeInvalidQuantile(t *testing.T) {
+	for _, q := range []float64{-0.1, 1.1, math.NaN()} {
+		_, err := NewQuantileOverTime(q)
+		require.Error(t, err)
+	}
+}
+
+func TestHoltWinters(t *testing.T) {
+	inputs := []struct {
+		sf, tf   float64
+		dps      []Datapoint
+		expected Datapoint
+	}{
+		{
+			// s=1, b=2 -> s=3 -> b=2, s=4.5 -> b=1.75, s=7.125
+			sf: 0.5, tf: 0.5,
+			dps: []Datapoint{
+				{TimeNanos: 10, Value: 1},
+				{TimeNanos: 20, Value: 3},
+				{TimeNanos: 30, Value: 4},
+				{TimeNanos: 40, Value: 8},
+			},
+			expected: Datapoint{TimeNanos: 40, Value: 7.125},
+		},
+		{
+			// s=10, b=2 -> s=12 -> b=2, s=13.7
+			sf: 0.1, tf: 0.9,
+			dps: []Datapoint{
+				{TimeNanos: 10, Value: 10},
+				{TimeNanos: 20, Value: math.NaN()},
+				{TimeNanos: 30, Value: 12},
+				{TimeNanos: 40, Value: 11},
+			},
+			expected: Datapoint{TimeNanos: 40, Value: 13.7},
+		},
+		{
+			// The trend of two datapoints is their difference so the result is the latest value.
+			sf: 0.3, tf: 0.6,
+			dps:      []Datapoint{{TimeNanos: 10, Value: 5}, {TimeNanos: 20, Value: 9}},
+			expected: Datapoint{TimeNanos: 20, Value: 9},
+		},
+	}
+	for _, input := range inputs {
+		tf, err := NewHoltWinters(input.sf, input.tf)
+		require.NoError(t, err)
+		res := tf.Evaluate(input.dps)
+		require.Equal(t, input.expected.TimeNanos, res.TimeNanos)
+		require.InDelta(t, input.expected.Value, res.Value, 1e-9, "sf=%v tf=%v", input.sf, input.tf)
+	}
+}
+
+func TestHoltWintersNotEnoughDatapoints(t *testing.T) {
+	tf, err := NewHoltWinters(0.5, 0.5)
+	require.NoError(t, err)
+	require.True(t, tf.Evaluate(nil).IsEmpty())
+	require.True(t, tf.Evaluate([]Datapoint{{TimeNanos: 10, Value: 1}}).IsEmpty())
+	require.True(t, tf.Evaluate([]Datapoint{
+		{TimeNanos: 10, Value: 1},
+		{TimeNanos: 20, Value: math.NaN()},
+	}).IsEmpty())
+}
+
+func TestHoltWintersInvalidFactors(t *testing.T) {
+	for _, factor := range []float64{0, 1, -0.1, 1.1, math.NaN()} {
+		_, err := NewHoltWinters(factor, 0.5)
+		require.Error(t, err)
+		_, err = NewHoltWinters(0.5, factor)
+		require.Error(t, err)
+	}
+}
+
+func TestAbsent(t *testing.T) {
+	window := Window{StartNanos: 10, EndNanos: 40}
+	inputs := []struct {
+		name            string
+		zeroWhenPresent bool
+		dps             []Datapoint
+		expected        Datapoint
+	}{
+		{
+			name:     "empty window",
+			expected: Datapoint{TimeNanos: 40, Value: 1},
+		},
+		{
+			name:            "empty window with zero when present",
+			zeroWhenPresent: true,
+			expected:        Datapoint{TimeNanos: 40, Value: 1},
+		},
+		{
+			name:     "only empty datapoints",
+			dps:      []Datapoint{{TimeNanos: 20, Value: math.NaN()}},
+			expected: Datapoint{TimeNanos: 40, Value: 1},
+		},
+		{
+			name:     "populated window",
+			dps:      []Datapoint{{TimeNanos: 20, Value: math.NaN()}, {TimeNanos: 30, Value: 5}},
+			expected: emptyDatapoint,
+		},
+		{
+			name:            "populated window with zero when present",
+			zeroWhenPresent: true,
+			dps:             []Datapoint{{TimeNanos: 20, Value: 0}},
+			expected:        Datapoint{TimeNanos: 40, Value: 0},
+		},
+	}
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			res := NewAbsent(input.zeroWhenPresent).Evaluate(window, input.dps)
+			if input.expected.IsEmpty() {
+				require.True(t, res.IsEmpty())
+				return
+			}
+			require.Equal(t, input.expected, res)
+		})
+	}
+}
+
+func TestWindowAggregation(t *testing.T) {
+	window := Window{StartNanos: 10, EndNanos: 60}
+	dps := []Datapoint{
+		{TimeNanos: 20, Value: 4},
+		{TimeNanos: 30, Value: -2},
+		{TimeNanos: 40, Value: math.NaN()},
+		{TimeNanos: 50, Value: 7},
+	}
+	inputs := []struct {
+		agg      WindowAggregation
+		expected float64
+	}{
+		{agg: WindowMin, expected: -2},
+		{agg: WindowMax, expected: 7},
+		{agg: WindowAvg, expected: 3},
+		{agg: WindowSum, expected: 9},
+	}
+	for _, input := range inputs {
+		tf, err := NewWindowAggregation(input.agg)
+		require.NoError(t, err)
+		require.Equal(t, Datapoint{TimeNanos: 60, Value: input.expected}, tf.Evaluate(window, dps), "agg=%d", input.agg)
+		require.Equal(t, Datapoint{TimeNanos: 60, Value: 5}, tf.Evaluate(window, []Datapoint{{TimeNanos: 30, Value: 5}}))
+	}
+}
+
+func TestWindowAggregationEmptyWindow(t *testing.T) {
+	window := Window{StartNanos: 10, EndNanos: 60}
+	for _, agg := range []WindowAggregation{WindowMin, WindowMax, WindowAvg, WindowSum} {
+		tf, err := NewWindowAggregation(agg)
+		require.NoError(t, err)
+		require.True(t, tf.Evaluate(window, nil).IsEmpty())
+		require.True(t, tf.Evaluate(window, []Datapoint{{TimeNanos: 20, Value: math.NaN()}}).IsEmpty())
+	}
+}
+
+func TestWindowAggregationUnknown(t *testing.T) {
+	for _, agg := range []WindowAggregation{-1, WindowSum + 1} {
+		_, err := NewWindowAggregation(agg)
+		require.Error(t, err)
+	}
+}
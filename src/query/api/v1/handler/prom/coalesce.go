@@ -0,0 +1,242 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m3db/m3/src/query/block"
+	"github.com/m3db/m3/src/query/models"
+	"github.com/m3db/m3/src/query/storage"
+
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/uber-go/tally"
+)
+
+// queryCoalescer shares a single execution between the identical queries in
+// flight at the same time, e.g. when many dashboards load at once. Unlike a
+// result cache nothing outlives the execution.
+type queryCoalescer struct {
+	sync.Mutex
+	calls     map[string]*coalescedCall
+	waiting   int
+	coalesced tally.Counter
+	// pending is the number of callers executing or waiting for a query.
+	pending tally.Gauge
+}
+
+// coalescedCall is a shared execution along with its waiters.
+type coalescedCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	res     *promql.Result
+	meta    block.ResultMetadata
+	err     error
+}
+
+func newQueryCoalescer(enabled bool, scope tally.Scope) *queryCoalescer {
+	if !enabled {
+		return nil
+	}
+	return &queryCoalescer{
+		calls:     make(map[string]*coalescedCall),
+		coalesced: scope.Counter("coalesced_queries"),
+		pending:   scope.Gauge("coalesced_queries_pending"),
+	}
+}
+
+// exec runs fn once for all the callers of the same key in flight and returns
+// each caller its own copy of the result. The result returned by fn is shared
+// so it must not be released when its query is closed.
+//
+// fn runs on a context detached from the caller that started it, bounded by
+// the timeout, so that the other callers don't fail when it goes away. The
+// context is only cancelled once all the callers stopped waiting, each of
+// them stops waiting when its own context is done.
+func (c *queryCoalescer) exec(
+	ctx context.Context,
+	key string,
+	timeout time.Duration,
+	fn func(ctx context.Context) (*promql.Result, block.ResultMetadata, error),
+) (*promql.Result, block.ResultMetadata, error) {
+	c.Lock()
+	call, ok := c.calls[key]
+	if ok {
+		c.coalesced.Inc(1)
+	} else {
+		call = c.start(ctx, key, timeout, fn)
+	}
+	call.waiters++
+	c.waiting++
+	c.pending.Update(float64(c.waiting))
+	c.Unlock()
+
+	select {
+	case <-call.done:
+		c.leave(key, call)
+	case <-ctx.Done():
+		c.leave(key, call)
+		return waiterCanceled(ctx.Err()), block.ResultMetadata{}, nil
+	}
+	if call.err != nil {
+		return nil, block.ResultMetadata{}, call.err
+	}
+	meta := call.meta
+	// NB: the callers append warnings to their copy.
+	meta.Warnings = meta.Warnings[:len(meta.Warnings):len(meta.Warnings)]
+	return shareResult(call.res), meta, nil
+}
+
+// start runs fn in the background for the key, it must be called locked.
+func (c *queryCoalescer) start(
+	ctx context.Context,
+	key string,
+	timeout time.Duration,
+	fn func(ctx context.Context) (*promql.Result, block.ResultMetadata, error),
+) *coalescedCall {
+	var (
+		execCtx context.Context = detachedContext{ctx}
+		cancel  context.CancelFunc
+	)
+	if timeout > 0 {
+		execCtx, cancel = context.WithTimeout(execCtx, timeout)
+	} else {
+		execCtx, cancel = context.WithCancel(execCtx)
+	}
+	call := &coalescedCall{done: make(chan struct{}), cancel: cancel}
+	c.calls[key] = call
+	go func() {
+		defer cancel()
+		call.res, call.meta, call.err = fn(execCtx)
+		c.Lock()
+		c.forget(key, call)
+		c.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// leave removes a waiter of the call, the execution is cancelled when it was
+// the last one.
+func (c *queryCoalescer) leave(key string, call *coalescedCall) {
+	c.Lock()
+	defer c.Unlock()
+	call.waiters--
+	c.waiting--
+	c.pending.Update(float64(c.waiting))
+	if call.waiters == 0 {
+		// The later callers start a new execution instead of joining a cancelled one.
+		c.forget(key, call)
+		call.cancel()
+	}
+}
+
+// forget stops new callers from joining the call, it must be called locked.
+func (c *queryCoalescer) forget(key string, call *coalescedCall) {
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+}
+
+// waiterCanceled returns the result of a caller that stopped waiting for a
+// shared execution, handled like the result of its own query.
+func waiterCanceled(err error) *promql.Result {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &promql.Result{Err: promql.ErrQueryTimeout("waiting for a coalesced query")}
+	}
+	return &promql.Result{Err: promql.ErrQueryCanceled("waiting for a coalesced query")}
+}
+
+// detachedContext keeps the values of its parent, e.g. the fetch options,
+// without its deadline and cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// coalesceKey returns the key identifying the executions of a query, or false
+// if the query must not be coalesced.
+func coalesceKey(params models.RequestParams, fetchOpts *storage.FetchOptions) (string, bool) {
+	expr, err := parser.ParseExpr(params.Query)
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%d\x00%d\x00%d\x00%d\x00%d\x00%d\x00%t",
+		expr.String(), params.Start, params.End, params.Step, params.LookbackDuration,
+		fetchOpts.SeriesLimit, fetchOpts.DocsLimit, fetchOpts.RequireExhaustive)
+	restrict := fetchOpts.RestrictQueryOptions
+	for _, t := range append([]*storage.RestrictByType{restrict.GetRestrictByType()},
+		restrict.GetRestrictByTypes()...) {
+		if t != nil {
+			fmt.Fprintf(&b, "\x00%s:%s", t.MetricsType, t.StoragePolicy)
+		}
+	}
+	if tag := restrict.GetRestrictByTag(); tag != nil {
+		fmt.Fprintf(&b, "\x00%s\x00%q", tag.GetMatchers(), tag.Strip)
+	}
+	return b.String(), true
+}
+
+// copyResult returns a copy of the result that outlives its query, whose
+// points are released when it is closed.
+func copyResult(res *promql.Result) *promql.Result {
+	copied := *res
+	switch v := res.Value.(type) {
+	case promql.Matrix:
+		matrix := make(promql.Matrix, 0, len(v))
+		for _, series := range v {
+			matrix = append(matrix, promql.Series{
+				Metric: series.Metric,
+				Points: append([]promql.Point(nil), series.Points...),
+			})
+		}
+		copied.Value = matrix
+	case promql.Vector:
+		copied.Value = append(promql.Vector(nil), v...)
+	}
+	return &copied
+}
+
+// shareResult returns a copy of a shared result that a caller can limit,
+// downsample and append warnings to. The points are not copied since they
+// are only ever replaced.
+func shareResult(res *promql.Result) *promql.Result {
+	shared := *res
+	shared.Warnings = res.Warnings[:len(res.Warnings):len(res.Warnings)]
+	switch v := res.Value.(type) {
+	case promql.Matrix:
+		shared.Value = append(promql.Matrix(nil), v...)
+	case promql.Vector:
+		shared.Value = append(promql.Vector(nil), v...)
+	}
+	return &shared
+}
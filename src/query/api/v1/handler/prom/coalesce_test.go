@@ -0,0 +1,251 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+	"github.com/m3db/m3/src/query/models"
+	"github.com/m3db/m3/src/query/storage"
+	xclock "github.com/m3db/m3/src/x/clock"
+	"github.com/m3db/m3/src/x/instrument"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+)
+
+// coalesceTest serves the queries of a read handler coalescing them, whose
+// selects block until released.
+type coalesceTest struct {
+	t       *testing.T
+	setup   testHandlers
+	scope   tally.TestScope
+	start   time.Time
+	selects *atomic.Int32
+	release chan struct{}
+}
+
+func newCoalesceTest(t *testing.T) *coalesceTest {
+	scope := tally.NewTestScope("", nil)
+	test := &coalesceTest{
+		t:     t,
+		scope: scope,
+		setup: setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+			cfg := o.Config()
+			cfg.Query.CoalesceInFlight = true
+			return o.SetConfig(cfg).SetInstrumentOpts(instrument.NewOptions().SetMetricsScope(scope))
+		}),
+		start:   time.Now().Truncate(time.Minute),
+		selects: atomic.NewInt32(0),
+		release: make(chan struct{}),
+	}
+	test.setup.queryable.selectFn = func(
+		bool,
+		*promstorage.SelectHints,
+		...*labels.Matcher,
+	) promstorage.SeriesSet {
+		test.selects.Inc()
+		<-test.release
+		samples := []tsdbutil.Sample{testSample{t: test.start.UnixNano() / int64(time.Millisecond), v: 1}}
+		return &listSeriesSet{series: []promstorage.Series{
+			promstorage.NewListSeries(labels.FromStrings("__name__", "foo"), samples),
+		}}
+	}
+	return test
+}
+
+func (c *coalesceTest) serve(ctx context.Context, query string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequestWithContext(ctx, "GET", native.PromReadURL, nil)
+	params := defaultParams()
+	params.Set(queryParam, query)
+	params.Set(startParam, c.start.Format(time.RFC3339))
+	params.Set(endParam, c.start.Add(30*time.Second).Format(time.RFC3339))
+	req.URL.RawQuery = params.Encode()
+	recorder := httptest.NewRecorder()
+	c.setup.readHandler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// waitPending waits until n callers execute or wait for a coalesced query.
+func (c *coalesceTest) waitPending(n int) {
+	require.True(c.t, xclock.WaitUntil(func() bool {
+		gauge, ok := c.scope.Snapshot().Gauges()["coalesced_queries_pending+handler=prometheus-read"]
+		return ok && gauge.Value() == float64(n)
+	}, 10*time.Second))
+}
+
+func TestPromReadHandlerCoalescesIdenticalQueries(t *testing.T) {
+	const requests = 5
+	test := newCoalesceTest(t)
+	serve := func(query string) *httptest.ResponseRecorder {
+		return test.serve(context.Background(), query)
+	}
+	selects := test.selects
+
+	var (
+		wg     sync.WaitGroup
+		codes  = make([]int, requests)
+		bodies = make([]string, requests)
+	)
+	for i := 0; i < requests; i++ {
+		i := i
+		// The queries only differ by formatting.
+		query := "foo"
+		if i%2 == 1 {
+			query = "foo{}"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := serve(query)
+			codes[i], bodies[i] = recorder.Code, recorder.Body.String()
+		}()
+	}
+	test.waitPending(requests)
+	close(test.release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), selects.Load())
+	for _, code := range codes {
+		require.Equal(t, http.StatusOK, code)
+	}
+	require.Contains(t, bodies[0], `"__name__":"foo"`)
+	for _, body := range bodies[1:] {
+		require.Equal(t, bodies[0], body)
+	}
+
+	// Queries are only coalesced while in flight.
+	require.Equal(t, http.StatusOK, serve("foo").Code)
+	require.Equal(t, int32(2), selects.Load())
+}
+
+func TestPromReadHandlerCoalescedQueryOutlivesLeader(t *testing.T) {
+	test := newCoalesceTest(t)
+
+	// The leader starts the shared execution, then goes away.
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leader := make(chan int)
+	go func() { leader <- test.serve(leaderCtx, "foo").Code }()
+	test.waitPending(1)
+
+	const followers = 3
+	var (
+		wg    sync.WaitGroup
+		codes = make([]int, followers)
+	)
+	for i := 0; i < followers; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = test.serve(context.Background(), "foo").Code
+		}()
+	}
+	test.waitPending(1 + followers)
+
+	cancelLeader()
+	require.Equal(t, 499, <-leader)
+	test.waitPending(followers)
+	close(test.release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), test.selects.Load())
+	for _, code := range codes {
+		require.Equal(t, http.StatusOK, code)
+	}
+	counter, ok := test.scope.Snapshot().Counters()["query_error+class=canceled,handler=prometheus-read"]
+	require.True(t, ok)
+	require.Equal(t, int64(1), counter.Value())
+}
+
+func TestPromReadHandlerCoalescedQueryCancelledWithoutWaiters(t *testing.T) {
+	test := newCoalesceTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- test.serve(ctx, "foo").Code }()
+	test.waitPending(1)
+	cancel()
+	require.Equal(t, 499, <-done)
+
+	// The cancelled execution is not joined by later callers.
+	close(test.release)
+	require.Equal(t, http.StatusOK, test.serve(context.Background(), "foo").Code)
+	require.Equal(t, int32(2), test.selects.Load())
+}
+
+func TestCoalesceKey(t *testing.T) {
+	params := models.RequestParams{
+		Query: `sum(rate(foo{a="b"}[1m]))`,
+		Start: 1000,
+		End:   2000,
+		Step:  10 * time.Second,
+	}
+	key, ok := coalesceKey(params, storage.NewFetchOptions())
+	require.True(t, ok)
+
+	normalized := params
+	normalized.Query = `sum (rate(foo{a="b"}[1m]))`
+	normalizedKey, ok := coalesceKey(normalized, storage.NewFetchOptions())
+	require.True(t, ok)
+	require.Equal(t, key, normalizedKey)
+
+	other := params
+	other.Step = time.Minute
+	otherKey, _ := coalesceKey(other, storage.NewFetchOptions())
+	require.NotEqual(t, key, otherKey)
+
+	restricted := storage.NewFetchOptions()
+	restricted.RestrictQueryOptions = &storage.RestrictQueryOptions{
+		RestrictByTag: &storage.RestrictByTag{
+			Restrict: models.Matchers{{Type: models.MatchEqual, Name: []byte("a"), Value: []byte("b")}},
+		},
+	}
+	restrictedKey, _ := coalesceKey(params, restricted)
+	require.NotEqual(t, key, restrictedKey)
+
+	params.Query = "foo{"
+	_, ok = coalesceKey(params, storage.NewFetchOptions())
+	require.False(t, ok)
+}
+
+func TestShareResult(t *testing.T) {
+	res := copyResult(&promql.Result{Value: promql.Matrix{
+		{Metric: labels.FromStrings("a", "1"), Points: []promql.Point{{T: 1, V: 1}}},
+		{Metric: labels.FromStrings("a", "2"), Points: []promql.Point{{T: 1, V: 2}}},
+	}})
+	first, second := shareResult(res), shareResult(res)
+	first.Value.(promql.Matrix)[0].Points = nil
+	first.Value = first.Value.(promql.Matrix)[:1]
+	require.Len(t, second.Value, 2)
+	require.Len(t, second.Value.(promql.Matrix)[0].Points, 1)
+}
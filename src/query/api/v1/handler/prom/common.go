@@ -28,6 +28,7 @@ import (
 	xhttp "github.com/m3db/m3/src/x/net/http"
 
 	jsoniter "github.com/json-iterator/go"
+	promqlengine "github.com/prometheus/prometheus/promql"
 	promql "github.com/prometheus/prometheus/promql/parser"
 	promstorage "github.com/prometheus/prometheus/storage"
 )
@@ -53,10 +54,15 @@ const (
 
 type errorType string
 
+// streamFlushSeries is the number of series encoded between flushes to the
+// client when streaming a response.
+const streamFlushSeries = 1000
+
 // QueryData struct to be used when responding from HTTP handler.
 type QueryData struct {
 	ResultType promql.ValueType `json:"resultType"`
 	Result     promql.Value     `json:"result"`
+	Stats      *QueryStats      `json:"stats,omitempty"`
 }
 
 type response struct {
@@ -82,3 +88,79 @@ func Respond(w http.ResponseWriter, data interface{}, warnings promstorage.Warni
 		Warnings: warningStrings,
 	})
 }
+
+// RespondMatrixStream responds with HTTP OK status code and writes the matrix
+// to the response body one series at a time, flushing to the client every
+// streamFlushSeries series so that large results are delivered progressively
+// rather than relying on the encoder's buffering. The body is identical to
+// the one written by Respond for the same matrix and stats.
+func RespondMatrixStream(
+	w http.ResponseWriter,
+	matrix promqlengine.Matrix,
+	stats *QueryStats,
+	warnings promstorage.Warnings,
+) error {
+	return respondMatrixStream(w, matrix, nonFiniteValues(""), stats, warnings)
+}
+
+// respondMatrixStream streams the matrix like RespondMatrixStream, with its
+// non-finite values rewritten.
+func respondMatrixStream(
+	w http.ResponseWriter,
+	matrix promqlengine.Matrix,
+	nonFinite nonFiniteValues,
+	stats *QueryStats,
+	warnings promstorage.Warnings,
+) error {
+	w.Header().Set(xhttp.HeaderContentType, xhttp.ContentTypeJSON)
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+	stream := json.BorrowStream(w)
+	defer json.ReturnStream(stream)
+
+	flusher, _ := w.(http.Flusher)
+	stream.WriteRaw(`{"status":"` + string(statusSuccess) +
+		`","data":{"resultType":"` + string(promql.ValueTypeMatrix) + `","result":`)
+	if matrix == nil {
+		stream.WriteNil()
+	} else {
+		stream.WriteArrayStart()
+		for i, series := range matrix {
+			if i > 0 {
+				stream.WriteMore()
+			}
+			stream.WriteVal(nonFinite.series(series))
+			if stream.Error != nil {
+				return stream.Error
+			}
+			if (i+1)%streamFlushSeries != 0 {
+				continue
+			}
+			if err := stream.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		stream.WriteArrayEnd()
+	}
+	if stats != nil {
+		stream.WriteRaw(`,"stats":`)
+		stream.WriteVal(stats)
+	}
+	stream.WriteRaw("}")
+
+	if len(warnings) > 0 {
+		warningStrings := make([]string, 0, len(warnings))
+		for _, warning := range warnings {
+			warningStrings = append(warningStrings, warning.Error())
+		}
+		stream.WriteRaw(`,"warnings":`)
+		stream.WriteVal(warningStrings)
+	}
+	stream.WriteRaw("}\n")
+	if stream.Error != nil {
+		return stream.Error
+	}
+	return stream.Flush()
+}
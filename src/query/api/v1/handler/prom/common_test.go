@@ -0,0 +1,132 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func testMatrix(numSeries, numPoints int) promql.Matrix {
+	matrix := make(promql.Matrix, 0, numSeries)
+	for i := 0; i < numSeries; i++ {
+		points := make([]promql.Point, 0, numPoints)
+		for j := 0; j < numPoints; j++ {
+			points = append(points, promql.Point{T: int64(j * 1000), V: float64(i + j)})
+		}
+		matrix = append(matrix, promql.Series{
+			Metric: labels.FromStrings("__name__", "foo", "id", fmt.Sprint(i), "html", "<&>"),
+			Points: points,
+		})
+	}
+	return matrix
+}
+
+func TestRespondMatrixStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		matrix   promql.Matrix
+		warnings promstorage.Warnings
+	}{
+		{name: "nil", matrix: nil},
+		{name: "empty", matrix: promql.Matrix{}},
+		{name: "single series", matrix: testMatrix(1, 3)},
+		{name: "beyond flush size", matrix: testMatrix(2000, 10)},
+		{
+			name:     "warnings",
+			matrix:   testMatrix(3, 3),
+			warnings: promstorage.Warnings{errors.New("foo"), errors.New("bar")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := httptest.NewRecorder()
+			require.NoError(t, Respond(expected, &QueryData{
+				Result:     tt.matrix,
+				ResultType: tt.matrix.Type(),
+			}, tt.warnings))
+
+			actual := httptest.NewRecorder()
+			require.NoError(t, RespondMatrixStream(actual, tt.matrix, nil, tt.warnings))
+
+			require.Equal(t, expected.Header(), actual.Header())
+			require.Equal(t, expected.Body.String(), actual.Body.String())
+		})
+	}
+}
+
+func TestRespondMatrixStreamFlushes(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	require.NoError(t, RespondMatrixStream(recorder, testMatrix(2000, 10), nil, nil))
+	require.True(t, recorder.Flushed)
+}
+
+// discardResponseWriter avoids accumulating the response body and records the
+// largest single write, which bounds the encoded data held in memory at once.
+type discardResponseWriter struct {
+	*httptest.ResponseRecorder
+	maxWrite int
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	if len(b) > w.maxWrite {
+		w.maxWrite = len(b)
+	}
+	return len(b), nil
+}
+
+func BenchmarkRespondMatrix(b *testing.B) {
+	matrix := testMatrix(100000, 10)
+	run := func(b *testing.B, respond func(w http.ResponseWriter) error) {
+		b.ReportAllocs()
+		maxWrite := 0
+		for i := 0; i < b.N; i++ {
+			w := &discardResponseWriter{ResponseRecorder: httptest.NewRecorder()}
+			if err := respond(w); err != nil {
+				b.Fatal(err)
+			}
+			maxWrite = w.maxWrite
+		}
+		b.ReportMetric(float64(maxWrite), "max-write-bytes")
+	}
+	b.Run("buffered", func(b *testing.B) {
+		run(b, func(w http.ResponseWriter) error {
+			return Respond(w, &QueryData{
+				Result:     matrix,
+				ResultType: matrix.Type(),
+			}, nil)
+		})
+	})
+	b.Run("streamed", func(b *testing.B) {
+		run(b, func(w http.ResponseWriter) error {
+			return RespondMatrixStream(w, matrix, nil, nil)
+		})
+	})
+}
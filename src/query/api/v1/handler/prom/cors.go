@@ -0,0 +1,99 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/m3db/m3/src/query/api/v1/options"
+)
+
+const corsAllowAnyOrigin = "*"
+
+var (
+	defaultCORSAllowedMethods = []string{http.MethodGet, http.MethodPost}
+	defaultCORSAllowedHeaders = []string{"Content-Type"}
+)
+
+// cors sets the CORS headers of the responses to the allowed origins so that
+// browser based clients can query, it also answers their preflight requests.
+type cors struct {
+	origins map[string]struct{}
+	methods string
+	headers string
+}
+
+func newCORS(hOpts options.HandlerOptions) *cors {
+	if len(hOpts.CORSAllowedOrigins()) == 0 {
+		return nil
+	}
+	origins := make(map[string]struct{}, len(hOpts.CORSAllowedOrigins()))
+	for _, origin := range hOpts.CORSAllowedOrigins() {
+		origins[origin] = struct{}{}
+	}
+	methods := hOpts.CORSAllowedMethods()
+	if len(methods) == 0 {
+		methods = defaultCORSAllowedMethods
+	}
+	headers := hOpts.CORSAllowedHeaders()
+	if len(headers) == 0 {
+		headers = defaultCORSAllowedHeaders
+	}
+	return &cors{
+		origins: origins,
+		methods: strings.Join(methods, ", "),
+		headers: strings.Join(headers, ", "),
+	}
+}
+
+// setHeaders sets the CORS headers of the response if the origin of the
+// request is allowed and returns whether the request is a preflight request,
+// which is fully answered.
+func (c *cors) setHeaders(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	allowed := origin != "" && c.allowed(origin)
+	if allowed {
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if r.Method != http.MethodOptions {
+		return false
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	header := w.Header()
+	header.Set("Access-Control-Allow-Methods", c.methods)
+	header.Set("Access-Control-Allow-Headers", c.headers)
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func (c *cors) allowed(origin string) bool {
+	if _, ok := c.origins[corsAllowAnyOrigin]; ok {
+		return true
+	}
+	_, ok := c.origins[origin]
+	return ok
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromReadHandlerCORSPreflight(t *testing.T) {
+	setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		return o.SetCORSAllowedOrigins([]string{"https://dashboards.example.com"}).
+			SetCORSAllowedHeaders([]string{"Content-Type", "Authorization"})
+	})
+
+	tests := []struct {
+		name    string
+		origin  string
+		code    int
+		allowed bool
+	}{
+		{name: "allowed origin", origin: "https://dashboards.example.com", code: http.StatusNoContent, allowed: true},
+		{name: "other origin", origin: "https://evil.example.com", code: http.StatusForbidden},
+		{name: "no origin", code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, native.PromReadURL, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			recorder := httptest.NewRecorder()
+			setup.readHandler.ServeHTTP(recorder, req)
+
+			require.Equal(t, tt.code, recorder.Code)
+			header := recorder.Header()
+			if !tt.allowed {
+				assert.Empty(t, header.Get("Access-Control-Allow-Origin"))
+				assert.Empty(t, header.Get("Access-Control-Allow-Methods"))
+				return
+			}
+			assert.Equal(t, tt.origin, header.Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, "GET, POST", header.Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "Content-Type, Authorization", header.Get("Access-Control-Allow-Headers"))
+			assert.Equal(t, "Origin", header.Get("Vary"))
+		})
+	}
+}
+
+func TestPromReadHandlerCORSHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		allowed bool
+	}{
+		{name: "disabled", origin: "https://dashboards.example.com"},
+		{name: "allowed origin", origins: []string{"https://dashboards.example.com"},
+			origin: "https://dashboards.example.com", allowed: true},
+		{name: "other origin", origins: []string{"https://dashboards.example.com"},
+			origin: "https://evil.example.com"},
+		{name: "any origin", origins: []string{"*"}, origin: "https://evil.example.com", allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+				return o.SetCORSAllowedOrigins(tt.origins)
+			})
+			req := httptest.NewRequest(http.MethodGet, native.PromReadInstantURL, nil)
+			params := defaultParams()
+			params.Set(queryParam, "up")
+			req.URL.RawQuery = params.Encode()
+			req.Header.Set("Origin", tt.origin)
+			recorder := httptest.NewRecorder()
+			setup.readHandler.ServeHTTP(recorder, req)
+
+			require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+			if tt.allowed {
+				assert.Equal(t, tt.origin, recorder.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+			}
+			// Only preflight responses list the allowed methods.
+			assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Methods"))
+		})
+	}
+}
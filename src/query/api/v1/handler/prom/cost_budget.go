@@ -0,0 +1,89 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/storage"
+	xerrors "github.com/m3db/m3/src/x/errors"
+	xhttp "github.com/m3db/m3/src/x/net/http"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.uber.org/zap"
+)
+
+// queryCostBudget rejects queries before execution when the series matched by
+// their selectors multiplied by the time range they read exceeds a budget.
+type queryCostBudget struct {
+	maxSeriesHours float64
+}
+
+func newQueryCostBudget(cfg *config.QueryCostBudgetConfiguration) *queryCostBudget {
+	if cfg == nil {
+		return nil
+	}
+	return &queryCostBudget{maxSeriesHours: cfg.MaxSeriesHours}
+}
+
+// checkCostBudget returns an error if the estimated cost of the query exceeds
+// the budget. Queries whose series can't be estimated are let through.
+func (h *readHandler) checkCostBudget(
+	ctx context.Context,
+	query string,
+	start, end time.Time,
+	lookback time.Duration,
+	fetchOpts *storage.FetchOptions,
+) error {
+	if h.costBudget == nil || h.hOpts.Storage() == nil {
+		return nil
+	}
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return xerrors.NewInvalidParamsError(err)
+	}
+	if lookback <= 0 {
+		lookback = h.hOpts.DefaultLookback()
+	}
+
+	var cost float64
+	selectors, explanations := querySelectors(expr, start, end, lookback)
+	for i, vs := range selectors {
+		selector := explanations[i]
+		series, err := h.estimateSeries(ctx, vs, selector.ReadStart, selector.ReadEnd, fetchOpts)
+		if err != nil {
+			h.logger.Warn("unable to estimate series for query cost budget",
+				zap.Error(err), zap.String("selector", selector.Selector))
+			return nil
+		}
+		cost += float64(series) * selector.ReadEnd.Sub(selector.ReadStart).Hours()
+	}
+	if cost > h.costBudget.maxSeriesHours {
+		return xhttp.NewError(fmt.Errorf(
+			"query estimated cost of %.2f series hours exceeds the budget of %.2f series hours",
+			cost, h.costBudget.maxSeriesHours), http.StatusRequestEntityTooLarge)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+	"github.com/m3db/m3/src/query/models"
+	"github.com/m3db/m3/src/query/storage"
+	"github.com/m3db/m3/src/query/storage/mock"
+
+	"github.com/prometheus/prometheus/model/labels"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromReadHandlerCostBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget *config.QueryCostBudgetConfiguration
+		code   int
+		err    string
+	}{
+		{
+			name: "disabled",
+			code: http.StatusOK,
+		},
+		{
+			name:   "within budget",
+			budget: &config.QueryCostBudgetConfiguration{MaxSeriesHours: 10},
+			code:   http.StatusOK,
+		},
+		{
+			// 3 series read over 1h plus the 1m lookback cost 3.05 series hours.
+			name:   "over budget",
+			budget: &config.QueryCostBudgetConfiguration{MaxSeriesHours: 3},
+			code:   http.StatusRequestEntityTooLarge,
+			err:    "query estimated cost of 3.05 series hours exceeds the budget of 3.00 series hours",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := mock.NewMockStorage()
+			store.SetSearchSeriesResult(&storage.SearchResults{
+				Metrics: models.Metrics{{}, {}, {}},
+			}, nil)
+			setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+				cfg := o.Config()
+				cfg.QueryCostBudget = tt.budget
+				return o.SetConfig(cfg).SetStorage(store).SetTagOptions(models.NewTagOptions())
+			})
+			executed := false
+			setup.queryable.selectFn = func(
+				bool, *promstorage.SelectHints, ...*labels.Matcher,
+			) promstorage.SeriesSet {
+				executed = true
+				return &mockSeriesSet{}
+			}
+
+			start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+			req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+			params := defaultParams()
+			params.Set(queryParam, "up")
+			params.Set(startParam, start.Format(time.RFC3339))
+			params.Set(endParam, start.Add(time.Hour).Format(time.RFC3339))
+			params.Set(handleroptions.StepParam, time.Minute.String())
+			req.URL.RawQuery = params.Encode()
+
+			recorder := httptest.NewRecorder()
+			setup.readHandler.ServeHTTP(recorder, req)
+			require.Equal(t, tt.code, recorder.Code, recorder.Body.String())
+			assert.Equal(t, tt.code == http.StatusOK, executed)
+			if tt.err != "" {
+				assert.Contains(t, recorder.Body.String(), tt.err)
+			}
+		})
+	}
+}
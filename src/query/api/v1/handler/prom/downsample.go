@@ -0,0 +1,153 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/models"
+
+	"github.com/prometheus/prometheus/promql"
+)
+
+// downsampledStepHeader is set to the step in seconds of a downsampled
+// range query result.
+const downsampledStepHeader = "X-M3-Downsampled-Step"
+
+// resultDownsampler downsamples range query results with more points per
+// series than a panel can show to a coarser step, which unlike the returned
+// datapoints limit reshapes the result rather than truncating it.
+type resultDownsampler struct {
+	maxPoints   int
+	aggregation config.ResultDownsampleAggregation
+}
+
+func newResultDownsampler(opts config.ResultOptions) (*resultDownsampler, error) {
+	if opts.MaxPointsPerSeries <= 0 {
+		return nil, nil
+	}
+	aggregation := opts.DownsampleAggregation
+	switch aggregation {
+	case "":
+		aggregation = config.ResultDownsampleLast
+	case config.ResultDownsampleLast, config.ResultDownsampleAvg:
+	default:
+		return nil, fmt.Errorf("unknown result downsample aggregation %s", aggregation)
+	}
+	return &resultDownsampler{
+		maxPoints:   opts.MaxPointsPerSeries,
+		aggregation: aggregation,
+	}, nil
+}
+
+// step returns the coarser step of a range query producing more than the max
+// points per series, a multiple of the query step, or false if the query step
+// produces few enough points.
+func (d *resultDownsampler) step(start, end time.Time, step time.Duration) (time.Duration, bool) {
+	if d == nil || step <= 0 {
+		return 0, false
+	}
+	points := int(end.Sub(start)/step) + 1
+	if points <= d.maxPoints {
+		return 0, false
+	}
+	factor := (points + d.maxPoints - 1) / d.maxPoints
+	return step * time.Duration(factor), true
+}
+
+// downsample aggregates the points of each series into buckets of the step
+// ending at end - k*step, so that a point at t covers (t-step, t] like a
+// query with the coarser step would.
+func (d *resultDownsampler) downsample(
+	matrix promql.Matrix,
+	end time.Time,
+	step time.Duration,
+) promql.Matrix {
+	var (
+		endMs  = end.UnixNano() / int64(time.Millisecond)
+		stepMs = step.Milliseconds()
+	)
+	for i, series := range matrix {
+		points := make([]promql.Point, 0, len(series.Points)/2+1)
+		var (
+			bucket = int64(-1)
+			value  float64
+			count  int
+		)
+		for _, p := range series.Points {
+			if b := (endMs - p.T) / stepMs; b != bucket {
+				points = d.appendBucket(points, endMs-bucket*stepMs, value, count)
+				bucket, value, count = b, 0, 0
+			}
+			// The value is the last point of the bucket, or the sum of its
+			// points when averaging.
+			if d.aggregation == config.ResultDownsampleLast {
+				value = p.V
+			} else {
+				value += p.V
+			}
+			count++
+		}
+		matrix[i].Points = d.appendBucket(points, endMs-bucket*stepMs, value, count)
+	}
+	return matrix
+}
+
+func (d *resultDownsampler) appendBucket(
+	points []promql.Point,
+	t int64,
+	value float64,
+	count int,
+) []promql.Point {
+	if count == 0 {
+		return points
+	}
+	if d.aggregation == config.ResultDownsampleAvg {
+		value /= float64(count)
+	}
+	return append(points, promql.Point{T: t, V: value})
+}
+
+// downsampleResult downsamples the matrix result of a range query when its
+// step produces too many points, reporting the applied step in the response.
+func (h *readHandler) downsampleResult(
+	w http.ResponseWriter,
+	params models.RequestParams,
+	res *promql.Result,
+) {
+	if h.opts.instant {
+		return
+	}
+	step, ok := h.downsampler.step(params.Start.ToTime(), params.End.ToTime(), params.Step)
+	if !ok {
+		return
+	}
+	matrix, ok := res.Value.(promql.Matrix)
+	if !ok {
+		return
+	}
+	res.Value = h.downsampler.downsample(matrix, params.End.ToTime(), step)
+	w.Header().Set(downsampledStepHeader, strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+}
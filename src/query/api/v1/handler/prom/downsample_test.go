@@ -0,0 +1,143 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultDownsamplerStep(t *testing.T) {
+	d, err := newResultDownsampler(config.ResultOptions{MaxPointsPerSeries: 100})
+	require.NoError(t, err)
+	require.Equal(t, config.ResultDownsampleLast, d.aggregation)
+
+	start := time.Unix(0, 0)
+	_, ok := d.step(start, start.Add(990*time.Second), 10*time.Second)
+	require.False(t, ok)
+
+	step, ok := d.step(start, start.Add(time.Hour), 10*time.Second)
+	require.True(t, ok)
+	require.Equal(t, 40*time.Second, step)
+
+	d, err = newResultDownsampler(config.ResultOptions{})
+	require.NoError(t, err)
+	require.Nil(t, d)
+	_, ok = d.step(start, start.Add(time.Hour), time.Second)
+	require.False(t, ok)
+
+	_, err = newResultDownsampler(config.ResultOptions{
+		MaxPointsPerSeries:    100,
+		DownsampleAggregation: "max",
+	})
+	require.EqualError(t, err, "unknown result downsample aggregation max")
+}
+
+func TestResultDownsamplerDownsample(t *testing.T) {
+	newMatrix := func() promql.Matrix {
+		// Points every 10s from 0 to 60s, with a gap at 30s.
+		return promql.Matrix{{
+			Metric: labels.FromStrings("a", "b"),
+			Points: []promql.Point{
+				{T: 0, V: 1}, {T: 10000, V: 2}, {T: 20000, V: 3},
+				{T: 40000, V: 5}, {T: 50000, V: 6}, {T: 60000, V: 7},
+			},
+		}}
+	}
+
+	tests := []struct {
+		aggregation config.ResultDownsampleAggregation
+		expected    []promql.Point
+	}{
+		{
+			aggregation: config.ResultDownsampleLast,
+			expected:    []promql.Point{{T: 0, V: 1}, {T: 30000, V: 3}, {T: 60000, V: 7}},
+		},
+		{
+			aggregation: config.ResultDownsampleAvg,
+			expected:    []promql.Point{{T: 0, V: 1}, {T: 30000, V: 2.5}, {T: 60000, V: 6}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.aggregation), func(t *testing.T) {
+			d, err := newResultDownsampler(config.ResultOptions{
+				MaxPointsPerSeries:    3,
+				DownsampleAggregation: tt.aggregation,
+			})
+			require.NoError(t, err)
+			matrix := d.downsample(newMatrix(), time.Unix(60, 0), 30*time.Second)
+			require.Len(t, matrix, 1)
+			require.Equal(t, tt.expected, matrix[0].Points)
+		})
+	}
+}
+
+func TestPromReadHandlerDownsamplesResult(t *testing.T) {
+	serve := func(t *testing.T, setup testHandlers) (*httptest.ResponseRecorder, int) {
+		req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+		params := defaultParams()
+		start := time.Now()
+		params.Set(queryParam, "vector(1)")
+		params.Set(startParam, start.Format(time.RFC3339))
+		params.Set(endParam, start.Add(10*time.Minute).Format(time.RFC3339))
+		req.URL.RawQuery = params.Encode()
+
+		recorder := httptest.NewRecorder()
+		setup.readHandler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var resp struct {
+			Data struct {
+				Result []struct {
+					Values [][]interface{} `json:"values"`
+				} `json:"result"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		require.Len(t, resp.Data.Result, 1)
+		return recorder, len(resp.Data.Result[0].Values)
+	}
+
+	// Ten minutes at a 10s step is 61 points per series.
+	recorder, points := serve(t, setupTest(t))
+	require.Equal(t, 61, points)
+	require.Empty(t, recorder.Header().Get(downsampledStepHeader))
+
+	recorder, points = serve(t, setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		cfg := o.Config()
+		cfg.ResultOptions.MaxPointsPerSeries = 10
+		return o.SetConfig(cfg)
+	}))
+	require.Equal(t, 9, points)
+	require.Equal(t, "70", recorder.Header().Get(downsampledStepHeader))
+	require.Equal(t, "9", recorder.Header().Get(returnedDatapointsHeader))
+}
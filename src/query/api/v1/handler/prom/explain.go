@@ -0,0 +1,213 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	m3promql "github.com/m3db/m3/src/query/parser/promql"
+	"github.com/m3db/m3/src/query/storage"
+	xerrors "github.com/m3db/m3/src/x/errors"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.uber.org/zap"
+)
+
+const explainParam = "explain"
+
+// QueryExplanation summarizes the work a query would do, returned instead of
+// the query result when the explain param is set.
+type QueryExplanation struct {
+	Query   string    `json:"query"`
+	Instant bool      `json:"instant"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Step    string    `json:"step,omitempty"`
+	// ReadStart and ReadEnd bound the data read from storage by all selectors,
+	// taking ranges, offsets and the lookback into account.
+	ReadStart time.Time             `json:"readStart"`
+	ReadEnd   time.Time             `json:"readEnd"`
+	ReadSpan  string                `json:"readSpan"`
+	Selectors []SelectorExplanation `json:"selectors"`
+	// EstimatedSeries is the number of series matched by all selectors, it is
+	// only set when the series could be looked up for every selector.
+	EstimatedSeries *int `json:"estimatedSeries,omitempty"`
+}
+
+// SelectorExplanation summarizes a single selector of an explained query.
+type SelectorExplanation struct {
+	Selector  string    `json:"selector"`
+	ReadStart time.Time `json:"readStart"`
+	ReadEnd   time.Time `json:"readEnd"`
+	// EstimatedSeries is the number of series matched by the selector, it is
+	// only set when the series could be looked up in storage.
+	EstimatedSeries *int `json:"estimatedSeries,omitempty"`
+}
+
+func explainRequested(r *http.Request) bool {
+	explain, err := strconv.ParseBool(r.FormValue(explainParam))
+	return err == nil && explain
+}
+
+// explain writes a summary of the query without executing it.
+func (h *readHandler) explain(
+	ctx context.Context,
+	w http.ResponseWriter,
+	query string,
+	start, end time.Time,
+	step, lookback time.Duration,
+	fetchOpts *storage.FetchOptions,
+) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		h.writeError(w, xerrors.NewInvalidParamsError(err))
+		return
+	}
+	if lookback <= 0 {
+		lookback = h.hOpts.DefaultLookback()
+	}
+
+	explanation := QueryExplanation{
+		Query:     query,
+		Instant:   h.opts.instant,
+		Start:     start,
+		End:       end,
+		ReadStart: start,
+		ReadEnd:   end,
+	}
+	if !h.opts.instant {
+		explanation.Step = step.String()
+	}
+
+	var (
+		selectors []*parser.VectorSelector
+		total     = 0
+		estimated = h.hOpts.Storage() != nil
+	)
+	selectors, explanation.Selectors = querySelectors(expr, start, end, lookback)
+	for _, selector := range explanation.Selectors {
+		if selector.ReadStart.Before(explanation.ReadStart) {
+			explanation.ReadStart = selector.ReadStart
+		}
+		if selector.ReadEnd.After(explanation.ReadEnd) {
+			explanation.ReadEnd = selector.ReadEnd
+		}
+	}
+	explanation.ReadSpan = explanation.ReadEnd.Sub(explanation.ReadStart).String()
+
+	for i, vs := range selectors {
+		if !estimated {
+			break
+		}
+		selector := &explanation.Selectors[i]
+		series, err := h.estimateSeries(ctx, vs, selector.ReadStart, selector.ReadEnd, fetchOpts)
+		if err != nil {
+			h.logger.Warn("unable to estimate series for explained query",
+				zap.Error(err), zap.String("selector", selector.Selector))
+			estimated = false
+			break
+		}
+		selector.EstimatedSeries = &series
+		total += series
+	}
+	if estimated {
+		explanation.EstimatedSeries = &total
+	}
+
+	if err := Respond(w, explanation, nil); err != nil {
+		h.logger.Error("error writing query explanation",
+			zap.Error(err), zap.String("query", query))
+	}
+}
+
+// querySelectors returns the vector selectors of the query along with the
+// range of data each of them reads from storage.
+func querySelectors(
+	expr parser.Expr,
+	start, end time.Time,
+	lookback time.Duration,
+) ([]*parser.VectorSelector, []SelectorExplanation) {
+	var (
+		selectors    []*parser.VectorSelector
+		explanations = []SelectorExplanation{}
+	)
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		readRange, offset := selectorReadRange(vs, path, lookback)
+		explanations = append(explanations, SelectorExplanation{
+			Selector:  vs.String(),
+			ReadStart: start.Add(-readRange - offset),
+			ReadEnd:   end.Add(-offset),
+		})
+		selectors = append(selectors, vs)
+		return nil
+	})
+	return selectors, explanations
+}
+
+// selectorReadRange returns how far back before the evaluation time a selector
+// reads and the offset applied to it, including the enclosing subqueries.
+func selectorReadRange(
+	vs *parser.VectorSelector,
+	path []parser.Node,
+	lookback time.Duration,
+) (time.Duration, time.Duration) {
+	readRange, offset := lookback, vs.OriginalOffset
+	if len(path) > 0 {
+		if ms, ok := path[len(path)-1].(*parser.MatrixSelector); ok {
+			readRange = ms.Range
+		}
+	}
+	for _, node := range path {
+		if sq, ok := node.(*parser.SubqueryExpr); ok {
+			readRange += sq.Range
+			offset += sq.OriginalOffset
+		}
+	}
+	return readRange, offset
+}
+
+func (h *readHandler) estimateSeries(
+	ctx context.Context,
+	vs *parser.VectorSelector,
+	start, end time.Time,
+	fetchOpts *storage.FetchOptions,
+) (int, error) {
+	matchers, err := m3promql.LabelMatchersToModelMatcher(vs.LabelMatchers, h.hOpts.TagOptions())
+	if err != nil {
+		return 0, err
+	}
+	res, err := h.hOpts.Storage().SearchSeries(ctx, &storage.FetchQuery{
+		TagMatchers: matchers,
+		Start:       start,
+		End:         end,
+	}, fetchOpts)
+	if err != nil {
+		return 0, err
+	}
+	return len(res.Metrics), nil
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+	"github.com/m3db/m3/src/query/models"
+	"github.com/m3db/m3/src/query/storage"
+	"github.com/m3db/m3/src/query/storage/mock"
+
+	"github.com/prometheus/prometheus/model/labels"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type explainResponse struct {
+	Status status           `json:"status"`
+	Data   QueryExplanation `json:"data"`
+}
+
+func serveExplain(t *testing.T, setup testHandlers, query string, start, end time.Time) explainResponse {
+	req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+	params := defaultParams()
+	params.Set(queryParam, query)
+	params.Set(startParam, start.Format(time.RFC3339))
+	params.Set(endParam, end.Format(time.RFC3339))
+	params.Set(handleroptions.StepParam, time.Minute.String())
+	params.Set(explainParam, "true")
+	req.URL.RawQuery = params.Encode()
+
+	recorder := httptest.NewRecorder()
+	setup.readHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var resp explainResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Equal(t, statusSuccess, resp.Status)
+	return resp
+}
+
+func TestPromReadHandlerExplain(t *testing.T) {
+	setup := setupTest(t)
+	executed := false
+	setup.queryable.selectFn = func(
+		bool, *promstorage.SelectHints, ...*labels.Matcher,
+	) promstorage.SeriesSet {
+		executed = true
+		return &mockSeriesSet{}
+	}
+
+	var (
+		start = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		end   = start.Add(time.Hour)
+		query = `sum(rate(http_requests_total{job="api"}[5m] offset 1h)) / max_over_time(up[10m:1m] offset 1m)`
+	)
+	resp := serveExplain(t, setup, query, start, end)
+	assert.False(t, executed)
+
+	explanation := resp.Data
+	assert.Equal(t, query, explanation.Query)
+	assert.False(t, explanation.Instant)
+	assert.True(t, start.Equal(explanation.Start))
+	assert.True(t, end.Equal(explanation.End))
+	assert.Equal(t, "1m0s", explanation.Step)
+	require.Len(t, explanation.Selectors, 2)
+
+	rate := explanation.Selectors[0]
+	assert.Equal(t, `http_requests_total{job="api"} offset 1h`, rate.Selector)
+	assert.True(t, start.Add(-65*time.Minute).Equal(rate.ReadStart))
+	assert.True(t, end.Add(-time.Hour).Equal(rate.ReadEnd))
+
+	// The subquery range and offset apply on top of the default lookback.
+	up := explanation.Selectors[1]
+	assert.Equal(t, "up", up.Selector)
+	assert.Equal(t, start.Add(-12*time.Minute).String(), up.ReadStart.UTC().String())
+	assert.Equal(t, end.Add(-time.Minute).String(), up.ReadEnd.UTC().String())
+	assert.True(t, end.Add(-time.Minute).Equal(up.ReadEnd))
+
+	assert.True(t, start.Add(-65*time.Minute).Equal(explanation.ReadStart))
+	assert.True(t, end.Equal(explanation.ReadEnd))
+	assert.Equal(t, "2h5m0s", explanation.ReadSpan)
+	assert.Nil(t, up.EstimatedSeries)
+	assert.Nil(t, explanation.EstimatedSeries)
+}
+
+func TestPromReadHandlerExplainEstimatedSeries(t *testing.T) {
+	store := mock.NewMockStorage()
+	store.SetSearchSeriesResult(&storage.SearchResults{
+		Metrics: models.Metrics{{}, {}, {}},
+	}, nil)
+	setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		return o.SetStorage(store).SetTagOptions(models.NewTagOptions())
+	})
+
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	resp := serveExplain(t, setup, `up + rate(http_requests_total[5m])`, start, start.Add(time.Hour))
+
+	explanation := resp.Data
+	require.Len(t, explanation.Selectors, 2)
+	for _, selector := range explanation.Selectors {
+		require.NotNil(t, selector.EstimatedSeries)
+		assert.Equal(t, 3, *selector.EstimatedSeries)
+	}
+	require.NotNil(t, explanation.EstimatedSeries)
+	assert.Equal(t, 6, *explanation.EstimatedSeries)
+}
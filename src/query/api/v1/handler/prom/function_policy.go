@@ -0,0 +1,125 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	xerrors "github.com/m3db/m3/src/x/errors"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// functionPolicy rejects queries using functions or aggregations that aren't
+// allowed, e.g. to keep the expensive ones off a shared cluster.
+type functionPolicy struct {
+	// allowed is nil if all functions not denied are allowed.
+	allowed map[string]struct{}
+	denied  map[string]struct{}
+}
+
+func newFunctionPolicy(cfg *config.PromQLFunctionsConfiguration) (*functionPolicy, error) {
+	if cfg == nil || (len(cfg.Allowed) == 0 && len(cfg.Denied) == 0) {
+		return nil, nil
+	}
+	policy := &functionPolicy{}
+	var err error
+	if len(cfg.Allowed) > 0 {
+		if policy.allowed, err = functionSet(cfg.Allowed); err != nil {
+			return nil, err
+		}
+	}
+	if policy.denied, err = functionSet(cfg.Denied); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func functionSet(names []string) (map[string]struct{}, error) {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if !knownFunction(name) {
+			return nil, fmt.Errorf("unknown PromQL function or aggregation %s", name)
+		}
+		set[name] = struct{}{}
+	}
+	return set, nil
+}
+
+func knownFunction(name string) bool {
+	if _, ok := parser.Functions[name]; ok {
+		return true
+	}
+	for item, str := range parser.ItemTypeStr {
+		if item.IsAggregator() && str == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *functionPolicy) isAllowed(name string) bool {
+	if _, ok := p.denied[name]; ok {
+		return false
+	}
+	if p.allowed == nil {
+		return true
+	}
+	_, ok := p.allowed[name]
+	return ok
+}
+
+// checkQuery returns an invalid params error naming the first function or
+// aggregation of the query that isn't allowed.
+func (p *functionPolicy) checkQuery(query string) error {
+	if p == nil {
+		return nil
+	}
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		// NB: the query fails to parse again when executed.
+		return nil
+	}
+	var disallowed string
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		var name string
+		switch n := node.(type) {
+		case *parser.Call:
+			name = n.Func.Name
+		case *parser.AggregateExpr:
+			name = n.Op.String()
+		default:
+			return nil
+		}
+		if p.isAllowed(name) {
+			return nil
+		}
+		disallowed = name
+		return errors.New(name)
+	})
+	if disallowed == "" {
+		return nil
+	}
+	return xerrors.NewInvalidParamsError(fmt.Errorf(
+		"PromQL function %s is not allowed on this cluster", disallowed))
+}
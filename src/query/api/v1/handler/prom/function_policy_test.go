@@ -0,0 +1,134 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunctionPolicyCheckQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        *config.PromQLFunctionsConfiguration
+		query      string
+		disallowed string
+	}{
+		{
+			name:  "no policy",
+			query: `holt_winters(foo[5m], 0.5, 0.5)`,
+		},
+		{
+			name:       "denied function",
+			cfg:        &config.PromQLFunctionsConfiguration{Denied: []string{"holt_winters"}},
+			query:      `sum(holt_winters(foo[5m], 0.5, 0.5))`,
+			disallowed: "holt_winters",
+		},
+		{
+			name:       "denied aggregation",
+			cfg:        &config.PromQLFunctionsConfiguration{Denied: []string{"topk"}},
+			query:      `topk(5, rate(foo[5m]))`,
+			disallowed: "topk",
+		},
+		{
+			name:  "not denied",
+			cfg:   &config.PromQLFunctionsConfiguration{Denied: []string{"topk"}},
+			query: `sum(rate(foo[5m]))`,
+		},
+		{
+			name:  "allowed",
+			cfg:   &config.PromQLFunctionsConfiguration{Allowed: []string{"sum", "rate"}},
+			query: `sum(rate(foo[5m])) / 2`,
+		},
+		{
+			name:       "not allowed",
+			cfg:        &config.PromQLFunctionsConfiguration{Allowed: []string{"sum", "rate"}},
+			query:      `sum(irate(foo[5m]))`,
+			disallowed: "irate",
+		},
+		{
+			name: "allowed and denied",
+			cfg: &config.PromQLFunctionsConfiguration{
+				Allowed: []string{"sum", "rate"},
+				Denied:  []string{"rate"},
+			},
+			query:      `sum(rate(foo[5m]))`,
+			disallowed: "rate",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := newFunctionPolicy(tt.cfg)
+			require.NoError(t, err)
+			err = policy.checkQuery(tt.query)
+			if tt.disallowed == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "function "+tt.disallowed+" ")
+		})
+	}
+}
+
+func TestFunctionPolicyUnknownFunction(t *testing.T) {
+	_, err := newFunctionPolicy(&config.PromQLFunctionsConfiguration{
+		Denied: []string{"not_a_function"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not_a_function")
+}
+
+func TestPromReadHandlerFunctionPolicy(t *testing.T) {
+	setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		cfg := o.Config()
+		cfg.PromQLFunctions = &config.PromQLFunctionsConfiguration{
+			Denied: []string{"topk"},
+		}
+		return o.SetConfig(cfg)
+	})
+
+	for _, handler := range []http.Handler{setup.readHandler, setup.readInstantHandler} {
+		req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+		params := defaultParams()
+		params.Set(queryParam, `topk(5, foo)`)
+		req.URL.RawQuery = params.Encode()
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		assert.Contains(t, recorder.Body.String(), "PromQL function topk is not allowed")
+
+		req, _ = http.NewRequest("GET", native.PromReadURL, nil)
+		req.URL.RawQuery = defaultParams().Encode()
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	xhttp "github.com/m3db/m3/src/x/net/http"
+)
+
+const (
+	// lookbackHeader overrides the lookback of a single query, e.g. for
+	// recording rule backfills, without changing the configured lookback.
+	lookbackHeader = "X-M3-Lookback"
+
+	// defaultMaxLookbackOverride caps the lookback set by lookbackHeader
+	// when no max is configured.
+	defaultMaxLookbackOverride = time.Hour
+)
+
+// lookbackOverride returns the lookback set by the request header capped to
+// the max, or false if the header isn't set.
+func lookbackOverride(r *http.Request, max time.Duration) (time.Duration, bool, error) {
+	value := r.Header.Get(lookbackHeader)
+	if value == "" {
+		return 0, false, nil
+	}
+	lookback, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false, xhttp.NewError(fmt.Errorf("invalid %s header: %w", lookbackHeader, err),
+			http.StatusBadRequest)
+	}
+	if lookback <= 0 {
+		return 0, false, xhttp.NewError(fmt.Errorf("invalid %s header: %s must be positive",
+			lookbackHeader, value), http.StatusBadRequest)
+	}
+	if lookback > max {
+		lookback = max
+	}
+	return lookback, true, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromReadHandlerLookbackOverride(t *testing.T) {
+	maxLookback := 10 * time.Minute
+	tests := []struct {
+		name     string
+		header   string
+		code     int
+		lookback time.Duration
+	}{
+		{name: "no header", code: http.StatusOK, lookback: time.Minute},
+		{name: "override", header: "5m", code: http.StatusOK, lookback: 5 * time.Minute},
+		{name: "capped", header: "1h", code: http.StatusOK, lookback: maxLookback},
+		{name: "invalid", header: "five minutes", code: http.StatusBadRequest},
+		{name: "negative", header: "-5m", code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hOpts options.HandlerOptions
+			setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+				cfg := o.Config()
+				cfg.Query.MaxLookbackOverride = &maxLookback
+				hOpts = o.SetConfig(cfg)
+				return hOpts
+			})
+			var engineLookback time.Duration
+			engineFn := func(lookback time.Duration) (*promql.Engine, error) {
+				engineLookback = lookback
+				return newMockPromQLEngine(), nil
+			}
+
+			for _, instant := range []bool{false, true} {
+				newQueryFn := newRangeQueryFn(engineFn, setup.queryable)
+				if instant {
+					newQueryFn = newInstantQueryFn(engineFn, setup.queryable)
+				}
+				handler, err := newReadHandler(hOpts, opts{
+					queryable:  setup.queryable,
+					instant:    instant,
+					newQueryFn: newQueryFn,
+				})
+				require.NoError(t, err)
+
+				engineLookback = 0
+				req := httptest.NewRequest("GET", native.PromReadURL, nil)
+				req.URL.RawQuery = defaultParams().Encode()
+				if tt.header != "" {
+					req.Header.Set(lookbackHeader, tt.header)
+				}
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, req)
+				require.Equal(t, tt.code, recorder.Code, recorder.Body.String())
+				assert.Equal(t, tt.lookback, engineLookback)
+			}
+		})
+	}
+}
@@ -25,6 +25,8 @@ import (
 	"errors"
 	"time"
 
+	"github.com/m3db/m3/src/query/block"
+	"github.com/m3db/m3/src/query/storage/prometheus"
 	"github.com/m3db/m3/src/x/instrument"
 
 	"github.com/go-kit/kit/log"
@@ -82,9 +84,16 @@ type mockOptions struct {
 
 type mockQueryable struct {
 	mockOptions
+	// resultMetadata is reported to the handler like the m3 storage does when set.
+	resultMetadata *block.ResultMetadata
 }
 
-func (q *mockQueryable) Querier(_ context.Context, _, _ int64) (promstorage.Querier, error) {
+func (q *mockQueryable) Querier(ctx context.Context, _, _ int64) (promstorage.Querier, error) {
+	if q.resultMetadata != nil {
+		if fn, ok := ctx.Value(prometheus.BlockResultMetadataFnKey).(func(block.ResultMetadata)); ok {
+			fn(*q.resultMetadata)
+		}
+	}
 	return &mockQuerier{mockOptions: q.mockOptions}, nil
 }
 
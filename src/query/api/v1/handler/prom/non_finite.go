@@ -0,0 +1,191 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// nonFiniteValues rewrites the NaN and infinite values of query results for
+// clients that can't parse the strings Prometheus serializes them as.
+type nonFiniteValues config.ResultNonFiniteValues
+
+func newNonFiniteValues(opts config.ResultOptions) (nonFiniteValues, error) {
+	switch opts.NonFiniteValues {
+	case "":
+		return nonFiniteValues(config.ResultNonFiniteString), nil
+	case config.ResultNonFiniteString, config.ResultNonFiniteNull, config.ResultNonFiniteOmit:
+		return nonFiniteValues(opts.NonFiniteValues), nil
+	default:
+		return "", fmt.Errorf("unknown result non finite values %s", opts.NonFiniteValues)
+	}
+}
+
+// value returns the result value to serialize.
+func (n nonFiniteValues) value(v parser.Value) parser.Value {
+	switch config.ResultNonFiniteValues(n) {
+	case config.ResultNonFiniteNull:
+		switch v := v.(type) {
+		case promql.Matrix:
+			return nullMatrix(v)
+		case promql.Vector:
+			return nullVector(v)
+		case promql.Scalar:
+			return nullScalar(v)
+		}
+	case config.ResultNonFiniteOmit:
+		switch v := v.(type) {
+		case promql.Matrix:
+			matrix := make(promql.Matrix, 0, len(v))
+			for _, series := range v {
+				matrix = append(matrix, promql.Series{Metric: series.Metric, Points: finitePoints(series.Points)})
+			}
+			return matrix
+		case promql.Vector:
+			vector := make(promql.Vector, 0, len(v))
+			for _, sample := range v {
+				if isFinite(sample.V) {
+					vector = append(vector, sample)
+				}
+			}
+			return vector
+		case promql.Scalar:
+			return nullScalar(v)
+		}
+	}
+	return v
+}
+
+// series returns the series of a streamed matrix to serialize.
+func (n nonFiniteValues) series(s promql.Series) interface{} {
+	switch config.ResultNonFiniteValues(n) {
+	case config.ResultNonFiniteNull:
+		return nullSeries(s)
+	case config.ResultNonFiniteOmit:
+		return promql.Series{Metric: s.Metric, Points: finitePoints(s.Points)}
+	}
+	return s
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// finitePoints returns the finite points, the points are only copied if some
+// aren't since results can be shared.
+func finitePoints(points []promql.Point) []promql.Point {
+	for i, p := range points {
+		if isFinite(p.V) {
+			continue
+		}
+		finite := append(make([]promql.Point, 0, len(points)-1), points[:i]...)
+		for _, p := range points[i+1:] {
+			if isFinite(p.V) {
+				finite = append(finite, p)
+			}
+		}
+		return finite
+	}
+	return points
+}
+
+// nullPoint is a point serialized with a null value if it isn't finite.
+type nullPoint promql.Point
+
+func (p nullPoint) MarshalJSON() ([]byte, error) {
+	if isFinite(p.V) {
+		return promql.Point(p).MarshalJSON()
+	}
+	return json.Marshal([...]interface{}{float64(p.T) / 1000, nil})
+}
+
+func nullPoints(points []promql.Point) []nullPoint {
+	nulls := make([]nullPoint, 0, len(points))
+	for _, p := range points {
+		nulls = append(nulls, nullPoint(p))
+	}
+	return nulls
+}
+
+type nullSeries promql.Series
+
+func (s nullSeries) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Metric labels.Labels `json:"metric"`
+		Points []nullPoint   `json:"values"`
+	}{
+		Metric: s.Metric,
+		Points: nullPoints(s.Points),
+	})
+}
+
+type nullMatrix promql.Matrix
+
+func (m nullMatrix) Type() parser.ValueType { return parser.ValueTypeMatrix }
+func (m nullMatrix) String() string         { return promql.Matrix(m).String() }
+
+func (m nullMatrix) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+	series := make([]nullSeries, 0, len(m))
+	for _, s := range m {
+		series = append(series, nullSeries(s))
+	}
+	return json.Marshal(series)
+}
+
+type nullVector promql.Vector
+
+func (v nullVector) Type() parser.ValueType { return parser.ValueTypeVector }
+func (v nullVector) String() string         { return promql.Vector(v).String() }
+
+func (v nullVector) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	type nullSample struct {
+		Metric labels.Labels `json:"metric"`
+		Point  nullPoint     `json:"value"`
+	}
+	samples := make([]nullSample, 0, len(v))
+	for _, s := range v {
+		samples = append(samples, nullSample{Metric: s.Metric, Point: nullPoint(s.Point)})
+	}
+	return json.Marshal(samples)
+}
+
+type nullScalar promql.Scalar
+
+func (s nullScalar) Type() parser.ValueType { return parser.ValueTypeScalar }
+func (s nullScalar) String() string         { return promql.Scalar(s).String() }
+
+func (s nullScalar) MarshalJSON() ([]byte, error) {
+	return nullPoint{T: s.T, V: s.V}.MarshalJSON()
+}
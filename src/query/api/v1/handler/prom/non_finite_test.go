@@ -0,0 +1,165 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromReadHandlerNonFiniteValues(t *testing.T) {
+	start := time.Now().Truncate(time.Minute)
+	values := []float64{1, math.NaN(), math.Inf(1), math.Inf(-1)}
+	newSeries := func() promstorage.Series {
+		samples := make([]tsdbutil.Sample, 0, len(values))
+		for i, v := range values {
+			ts := start.Add(time.Duration(i) * 10 * time.Second)
+			samples = append(samples, testSample{t: ts.UnixNano() / int64(time.Millisecond), v: v})
+		}
+		return promstorage.NewListSeries(labels.FromStrings("__name__", "foo"), samples)
+	}
+
+	tests := []struct {
+		mode     config.ResultNonFiniteValues
+		expected []interface{}
+	}{
+		{mode: "", expected: []interface{}{"1", "NaN", "+Inf", "-Inf"}},
+		{mode: config.ResultNonFiniteString, expected: []interface{}{"1", "NaN", "+Inf", "-Inf"}},
+		{mode: config.ResultNonFiniteNull, expected: []interface{}{"1", nil, nil, nil}},
+		{mode: config.ResultNonFiniteOmit, expected: []interface{}{"1"}},
+	}
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+				cfg := o.Config()
+				cfg.ResultOptions.NonFiniteValues = tt.mode
+				if stream {
+					cfg.ResultOptions.StreamDatapointsThreshold = 1
+				}
+				return o.SetConfig(cfg)
+			})
+			setup.queryable.selectFn = func(
+				bool,
+				*promstorage.SelectHints,
+				...*labels.Matcher,
+			) promstorage.SeriesSet {
+				return &listSeriesSet{series: []promstorage.Series{newSeries()}}
+			}
+
+			req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+			params := defaultParams()
+			params.Set(queryParam, "foo")
+			params.Set(startParam, start.Format(time.RFC3339))
+			params.Set(endParam, start.Add(30*time.Second).Format(time.RFC3339))
+			req.URL.RawQuery = params.Encode()
+
+			recorder := httptest.NewRecorder()
+			setup.readHandler.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+			var resp struct {
+				Data struct {
+					Result []struct {
+						Values [][]interface{} `json:"values"`
+					} `json:"result"`
+				} `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+			require.Len(t, resp.Data.Result, 1)
+			actual := make([]interface{}, 0, len(resp.Data.Result[0].Values))
+			for _, point := range resp.Data.Result[0].Values {
+				require.Len(t, point, 2)
+				actual = append(actual, point[1])
+			}
+			assert.Equal(t, tt.expected, actual, "mode %q, stream %v", tt.mode, stream)
+		}
+	}
+}
+
+func TestNonFiniteValuesInstant(t *testing.T) {
+	vector := promql.Vector{
+		{Metric: labels.FromStrings("a", "1"), Point: promql.Point{T: 1000, V: 1}},
+		{Metric: labels.FromStrings("a", "2"), Point: promql.Point{T: 1000, V: math.NaN()}},
+	}
+	scalar := promql.Scalar{T: 1000, V: math.Inf(1)}
+	tests := []struct {
+		mode   config.ResultNonFiniteValues
+		vector string
+		scalar string
+	}{
+		{
+			mode:   config.ResultNonFiniteString,
+			vector: `[{"metric":{"a":"1"},"value":[1,"1"]},{"metric":{"a":"2"},"value":[1,"NaN"]}]`,
+			scalar: `[1,"+Inf"]`,
+		},
+		{
+			mode:   config.ResultNonFiniteNull,
+			vector: `[{"metric":{"a":"1"},"value":[1,"1"]},{"metric":{"a":"2"},"value":[1,null]}]`,
+			scalar: `[1,null]`,
+		},
+		{
+			mode:   config.ResultNonFiniteOmit,
+			vector: `[{"metric":{"a":"1"},"value":[1,"1"]}]`,
+			scalar: `[1,null]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			n, err := newNonFiniteValues(config.ResultOptions{NonFiniteValues: tt.mode})
+			require.NoError(t, err)
+
+			v := n.value(vector)
+			assert.Equal(t, parser.ValueTypeVector, v.Type())
+			encoded, err := json.Marshal(v)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.vector, string(encoded))
+
+			s := n.value(scalar)
+			assert.Equal(t, parser.ValueTypeScalar, s.Type())
+			encoded, err = json.Marshal(s)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.scalar, string(encoded))
+		})
+	}
+	// The result isn't modified.
+	assert.Len(t, vector, 2)
+}
+
+func TestNewNonFiniteValuesInvalid(t *testing.T) {
+	_, err := newNonFiniteValues(config.ResultOptions{NonFiniteValues: "zero"})
+	require.EqualError(t, err, "unknown result non finite values zero")
+}
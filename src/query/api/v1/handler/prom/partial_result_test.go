@@ -0,0 +1,152 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/dbnode/encoding"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+	"github.com/m3db/m3/src/query/block"
+	"github.com/m3db/m3/src/query/models"
+	"github.com/m3db/m3/src/query/storage"
+	"github.com/m3db/m3/src/query/storage/fanout"
+	"github.com/m3db/m3/src/query/storage/m3"
+	"github.com/m3db/m3/src/query/storage/m3/consolidators"
+	"github.com/m3db/m3/src/query/storage/m3/storagemetadata"
+	"github.com/m3db/m3/src/query/storage/prometheus"
+	"github.com/m3db/m3/src/query/test"
+	"github.com/m3db/m3/src/x/headers"
+	"github.com/m3db/m3/src/x/instrument"
+	xtest "github.com/m3db/m3/src/x/test"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromReadHandlerPartialResultOnTimeout(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial %v", partial), func(t *testing.T) {
+			ctrl := xtest.NewController(t)
+			defer ctrl.Finish()
+
+			// One of the stores of the fanout times out while the other one
+			// returns a series.
+			okStore := newPartialResultTestStore(ctrl, "ok")
+			okStore.EXPECT().FetchCompressed(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(context.Context, *storage.FetchQuery, *storage.FetchOptions) (
+					consolidators.MultiFetchResult, error,
+				) {
+					return partialResultTestFetchResult(t), nil
+				})
+			timeoutStore := newPartialResultTestStore(ctrl, "timeout")
+			timeoutStore.EXPECT().FetchCompressed(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(nil, fmt.Errorf("fetch timed out: %w", context.DeadlineExceeded))
+			filter := func(storage.Query, storage.Storage) bool { return true }
+			store := fanout.NewStorage([]storage.Storage{okStore, timeoutStore}, filter, filter,
+				func(storage.CompleteTagsQuery, storage.Storage) bool { return true },
+				models.NewTagOptions(), m3.NewOptions(encoding.NewOptions()), instrument.NewOptions())
+			queryable := prometheus.NewPrometheusQueryable(prometheus.PrometheusOptions{
+				Storage:           store,
+				InstrumentOptions: instrument.NewOptions(),
+			})
+			hOpts := newTestHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+				cfg := o.Config()
+				cfg.Query.PartialResultsOnTimeout = partial
+				return o.SetConfig(cfg)
+			})
+			handler, err := newReadHandler(hOpts, opts{
+				queryable:  queryable,
+				newQueryFn: newRangeQueryFn(testPromQLEngineFn, queryable),
+			})
+			require.NoError(t, err)
+
+			req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+			params := defaultParams()
+			params.Set(queryParam, "foo")
+			params.Set(startParam, test.Start.ToTime().Format(time.RFC3339))
+			params.Set(endParam, test.End.ToTime().Format(time.RFC3339))
+			params.Set(handleroptions.StepParam, time.Minute.String())
+			req.URL.RawQuery = params.Encode()
+			req.Header.Set(headers.LimitMaxSeriesHeader, "100")
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if !partial {
+				assert.Equal(t, http.StatusGatewayTimeout, recorder.Code, recorder.Body.String())
+				assert.Empty(t, recorder.Header().Get(partialResultHeader))
+				return
+			}
+
+			require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+			assert.Equal(t, "true", recorder.Header().Get(partialResultHeader))
+			var resp struct {
+				Status string `json:"status"`
+				Data   struct {
+					Result []struct {
+						Values [][]interface{} `json:"values"`
+					} `json:"result"`
+				} `json:"data"`
+				Warnings []string `json:"warnings"`
+			}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+			assert.Equal(t, string(statusSuccess), resp.Status)
+			assert.Contains(t, resp.Warnings, prometheus.PartialResultWarning.Message)
+			// The series of the store that did not time out is returned.
+			require.Len(t, resp.Data.Result, 1)
+			assert.NotEmpty(t, resp.Data.Result[0].Values)
+		})
+	}
+}
+
+func newPartialResultTestStore(ctrl *gomock.Controller, name string) *storage.MockStorage {
+	store := storage.NewMockStorage(ctrl)
+	store.EXPECT().Name().Return(name).AnyTimes()
+	store.EXPECT().Type().Return(storage.TypeLocalDC).AnyTimes()
+	store.EXPECT().ErrorBehavior().Return(storage.BehaviorFail).AnyTimes()
+	return store
+}
+
+func partialResultTestFetchResult(t *testing.T) consolidators.MultiFetchResult {
+	it, err := test.BuildTestSeriesIterator("foo")
+	require.NoError(t, err)
+	result := consolidators.NewMultiFetchResult(
+		consolidators.NamespaceCoversAllQueryRange,
+		consolidators.MatchOptions{MatchType: consolidators.MatchTags},
+		models.NewTagOptions(),
+		consolidators.LimitOptions{},
+	)
+	result.Add(consolidators.MultiFetchResults{
+		SeriesIterators: encoding.NewSeriesIterators([]encoding.SeriesIterator{it}),
+		Metadata:        block.NewResultMetadata(),
+		Attrs:           storagemetadata.Attributes{Resolution: time.Second},
+	})
+	return result
+}
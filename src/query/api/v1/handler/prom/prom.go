@@ -22,11 +22,15 @@ package prom
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"runtime/debug"
+	"time"
 
 	"github.com/m3db/m3/src/query/api/v1/options"
 	"github.com/m3db/m3/src/query/block"
 	"github.com/m3db/m3/src/query/storage/prometheus"
+	xerrors "github.com/m3db/m3/src/x/errors"
 
 	"github.com/prometheus/prometheus/promql/parser"
 	promstorage "github.com/prometheus/prometheus/storage"
@@ -109,3 +113,67 @@ func ApplyRangeWarnings(
 
 	return nil
 }
+
+// engineVersion is the version of the Prometheus engine, reported when a
+// query uses a PromQL feature the engine doesn't support.
+var engineVersion = prometheusEngineVersion()
+
+func prometheusEngineVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != "github.com/prometheus/prometheus" {
+			continue
+		}
+		if dep.Replace != nil {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return "unknown"
+}
+
+// validateQueryFeatures returns an invalid params error naming the first
+// PromQL feature used by the query that the engine doesn't support, which are
+// the @ modifier and negative offsets. Queries that fail to parse are left for
+// the engine to report.
+func validateQueryFeatures(query string) error {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil
+	}
+
+	var unsupported string
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		var (
+			timestamp  *int64
+			startOrEnd parser.ItemType
+			offset     time.Duration
+		)
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			timestamp, startOrEnd, offset = n.Timestamp, n.StartOrEnd, n.OriginalOffset
+		case *parser.SubqueryExpr:
+			timestamp, startOrEnd, offset = n.Timestamp, n.StartOrEnd, n.OriginalOffset
+		default:
+			return nil
+		}
+		switch {
+		case timestamp != nil || startOrEnd != 0:
+			unsupported = "@ modifier"
+		case offset < 0:
+			unsupported = "negative offset"
+		default:
+			return nil
+		}
+		return errors.New(unsupported)
+	})
+	if unsupported == "" {
+		return nil
+	}
+	return xerrors.NewInvalidParamsError(fmt.Errorf(
+		"unsupported PromQL feature: %s is not supported by the query engine (prometheus %s)",
+		unsupported, engineVersion))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"net/http"
+
+	xhttp "github.com/m3db/m3/src/x/net/http"
+
+	"github.com/uber-go/tally"
+)
+
+// The classes of the query errors, so that client errors can be told apart
+// from server errors, e.g. for an availability SLO.
+const (
+	queryErrorClient   = "client_4xx"
+	queryErrorServer   = "server_5xx"
+	queryErrorTimeout  = "timeout"
+	queryErrorCanceled = "canceled"
+)
+
+// statusClientClosedRequest is the status code of canceled queries.
+const statusClientClosedRequest = 499
+
+type queryErrorMetrics map[string]tally.Counter
+
+func newQueryErrorMetrics(scope tally.Scope) queryErrorMetrics {
+	m := make(queryErrorMetrics)
+	for _, class := range []string{
+		queryErrorClient, queryErrorServer, queryErrorTimeout, queryErrorCanceled,
+	} {
+		m[class] = scope.Tagged(map[string]string{"class": class}).Counter("query_error")
+	}
+	return m
+}
+
+// queryErrorClass returns the class of a query error given its status code.
+func queryErrorClass(status int) string {
+	switch {
+	case status == statusClientClosedRequest:
+		return queryErrorCanceled
+	case status == http.StatusGatewayTimeout:
+		return queryErrorTimeout
+	case status >= 400 && status < 500:
+		return queryErrorClient
+	default:
+		return queryErrorServer
+	}
+}
+
+// writeError serves the error and counts it by class.
+func (h *readHandler) writeError(w http.ResponseWriter, err error) {
+	h.queryErrors[queryErrorClass(xhttp.StatusCode(err))].Inc(1)
+	xhttp.WriteError(w, err)
+}
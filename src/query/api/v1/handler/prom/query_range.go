@@ -0,0 +1,53 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/m3db/m3/src/query/models"
+	xerrors "github.com/m3db/m3/src/x/errors"
+)
+
+// checkQueryRange returns an invalid params error if the time range of a
+// range query exceeds the max query range of the request.
+func (h *readHandler) checkQueryRange(r *http.Request, params models.RequestParams) error {
+	if h.opts.instant {
+		return nil
+	}
+	max := h.maxQueryRange
+	if resolve := h.hOpts.MaxQueryRangeResolver(); resolve != nil {
+		if resolved := resolve(r); resolved >= 0 {
+			max = resolved
+		}
+	}
+	if max <= 0 {
+		return nil
+	}
+	queryRange := params.End.Sub(params.Start)
+	if queryRange <= max {
+		return nil
+	}
+	return xerrors.NewInvalidParamsError(fmt.Errorf(
+		"query time range %s exceeds the max query range of %s, narrow the range or split the query",
+		queryRange, max))
+}
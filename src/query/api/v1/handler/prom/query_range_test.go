@@ -0,0 +1,109 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromReadHandlerMaxQueryRange(t *testing.T) {
+	setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		cfg := o.Config()
+		cfg.Query.MaxQueryRange = 24 * time.Hour
+		return o.SetConfig(cfg).SetMaxQueryRangeResolver(func(r *http.Request) time.Duration {
+			switch r.Header.Get("X-Tenant") {
+			case "premium":
+				return 0
+			case "free":
+				return time.Hour
+			}
+			return -1
+		})
+	})
+	end := time.Now().Truncate(time.Minute)
+	newRequest := func(url string, queryRange time.Duration, tenant string) *http.Request {
+		req, _ := http.NewRequest("GET", url, nil)
+		params := defaultParams()
+		params.Set(startParam, end.Add(-queryRange).Format(time.RFC3339))
+		params.Set(endParam, end.Format(time.RFC3339))
+		params.Set(handleroptions.StepParam, "1h")
+		req.URL.RawQuery = params.Encode()
+		req.Header.Set("X-Tenant", tenant)
+		return req
+	}
+
+	tests := []struct {
+		name       string
+		queryRange time.Duration
+		tenant     string
+		rejected   bool
+	}{
+		{name: "within max", queryRange: time.Hour},
+		{name: "at max", queryRange: 24 * time.Hour},
+		{name: "beyond max", queryRange: 24*time.Hour + time.Minute, rejected: true},
+		{name: "unlimited tenant", queryRange: 365 * 24 * time.Hour, tenant: "premium"},
+		{name: "at tenant max", queryRange: time.Hour, tenant: "free"},
+		{name: "beyond tenant max", queryRange: 2 * time.Hour, tenant: "free", rejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			setup.readHandler.ServeHTTP(recorder, newRequest(native.PromReadURL, tt.queryRange, tt.tenant))
+			if !tt.rejected {
+				require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+				return
+			}
+			require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+			assert.Contains(t, recorder.Body.String(), "exceeds the max query range")
+		})
+	}
+
+	// Instant queries have no range to limit.
+	recorder := httptest.NewRecorder()
+	setup.readInstantHandler.ServeHTTP(recorder,
+		newRequest(native.PromReadInstantURL, 48*time.Hour, ""))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
+
+func TestPromReadHandlerMaxQueryRangeUnlimited(t *testing.T) {
+	setup := setupTest(t)
+	req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+	params := defaultParams()
+	end := time.Now().Truncate(time.Minute)
+	params.Set(startParam, end.Add(-365*24*time.Hour).Format(time.RFC3339))
+	params.Set(endParam, end.Format(time.RFC3339))
+	params.Set(handleroptions.StepParam, "24h")
+	req.URL.RawQuery = params.Encode()
+
+	recorder := httptest.NewRecorder()
+	setup.readHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
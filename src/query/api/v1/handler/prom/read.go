@@ -24,13 +24,19 @@ package prom
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	promhandler "github.com/m3db/m3/src/query/api/v1/handler/prometheus"
 	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
 	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
 	"github.com/m3db/m3/src/query/api/v1/options"
@@ -39,15 +45,20 @@ import (
 	"github.com/m3db/m3/src/query/models"
 	"github.com/m3db/m3/src/query/storage"
 	"github.com/m3db/m3/src/query/storage/prometheus"
+	"github.com/m3db/m3/src/query/tracepoint"
 	xerrors "github.com/m3db/m3/src/x/errors"
 	xhttp "github.com/m3db/m3/src/x/net/http"
 
 	xsync "github.com/m3db/m3/src/x/sync"
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
 	errs "github.com/pkg/errors"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/promql/parser"
 	promstorage "github.com/prometheus/prometheus/storage"
 	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
@@ -56,7 +67,28 @@ const (
 	querySeriesWarn = 1e5
 
 	// Query max size for metric
-	truncatedQueryLimit = 1024
+	defaultTruncatedQueryLimit = 1024
+
+	// queryHashLength is the number of hex characters of the query hash.
+	queryHashLength = 12
+
+	// fetchedSeriesCountHeader and returnedDatapointsHeader are set on every
+	// response so that clients can observe the weight of their queries.
+	fetchedSeriesCountHeader = "X-M3-Fetched-Series-Count"
+	returnedDatapointsHeader = "X-M3-Returned-Datapoints"
+	// partialResultHeader is set to true on responses with a partial result
+	// returned on a storage timeout.
+	partialResultHeader = "X-M3-Partial"
+
+	// defaultShadowSubmitTimeout is how long the dropOnFull strategy waits
+	// for a shadowing worker before dropping the shadow query.
+	defaultShadowSubmitTimeout = 3 * time.Second
+
+	// defaultShadowClientTimeout is the timeout of shadow query requests.
+	defaultShadowClientTimeout = 8 * 60 * time.Second
+
+	// defaultShadowMaxConns is the max connections to the shadow query URL.
+	defaultShadowMaxConns = 10
 )
 
 // NewQueryFn creates a new promql Query.
@@ -67,6 +99,7 @@ var (
 		engineFn options.PromQLEngineFn,
 		queryable promstorage.Queryable,
 	) NewQueryFn {
+		queryable = newSelectorStatsQueryable(queryable)
 		return func(params models.RequestParams) (promql.Query, error) {
 			engine, err := engineFn(params.LookbackDuration)
 			if err != nil {
@@ -85,6 +118,7 @@ var (
 		engineFn options.PromQLEngineFn,
 		queryable promstorage.Queryable,
 	) NewQueryFn {
+		queryable = newSelectorStatsQueryable(queryable)
 		return func(params models.RequestParams) (promql.Query, error) {
 			engine, err := engineFn(params.LookbackDuration)
 			if err != nil {
@@ -102,9 +136,27 @@ type readHandler struct {
 	hOpts               options.HandlerOptions
 	scope               tally.Scope
 	logger              *zap.Logger
+	tracer              opentracing.Tracer
 	opts                opts
 	returnedDataMetrics native.PromReadReturnedDataMetrics
+	queryErrors         queryErrorMetrics
 	qs                  *queryShadowing
+	tenantIsolation     *promhandler.TenantIsolation
+	costBudget          *queryCostBudget
+	functionPolicy      *functionPolicy
+	cors                *cors
+	downsampler         *resultDownsampler
+	coalescer           *queryCoalescer
+	nonFinite           nonFiniteValues
+
+	streamSeriesThreshold     int
+	streamDatapointsThreshold int
+	serverTiming              bool
+	truncatedQueryLimit       int
+	maxLookbackOverride       time.Duration
+	maxScannedSamples         int64
+	partialResultsOnTimeout   bool
+	maxQueryRange             time.Duration
 }
 
 func newReadHandler(
@@ -114,22 +166,66 @@ func newReadHandler(
 	scope := hOpts.InstrumentOpts().MetricsScope().Tagged(
 		map[string]string{"handler": "prometheus-read"},
 	)
+	downsampler, err := newResultDownsampler(hOpts.Config().ResultOptions)
+	if err != nil {
+		return nil, err
+	}
+	nonFinite, err := newNonFiniteValues(hOpts.Config().ResultOptions)
+	if err != nil {
+		return nil, err
+	}
+	functionPolicy, err := newFunctionPolicy(hOpts.Config().PromQLFunctions)
+	if err != nil {
+		return nil, err
+	}
+	tracer := hOpts.InstrumentOpts().Tracer()
+	if tracer == nil {
+		tracer = opentracing.NoopTracer{}
+	}
 	var qs *queryShadowing = nil
 	if hOpts.ShadowQueryURL() != "" {
-		qs = newQueryShadowing(hOpts.ShadowQueryURL(), hOpts.QueryShadowingWorkers(), scope)
+		qs, err = newQueryShadowing(hOpts, scope)
+		if err != nil {
+			return nil, err
+		}
 	}
 	handler := &readHandler{
 		hOpts:               hOpts,
 		opts:                options,
 		scope:               scope,
 		logger:              hOpts.InstrumentOpts().Logger(),
+		tracer:              tracer,
 		returnedDataMetrics: native.NewPromReadReturnedDataMetrics(scope),
+		queryErrors:         newQueryErrorMetrics(scope),
 		qs: 			     qs,
+		tenantIsolation:     promhandler.NewTenantIsolation(hOpts.Config().TenantIsolation),
+		costBudget:          newQueryCostBudget(hOpts.Config().QueryCostBudget),
+		functionPolicy:      functionPolicy,
+		cors:                newCORS(hOpts),
+		downsampler:         downsampler,
+		coalescer:           newQueryCoalescer(hOpts.Config().Query.CoalesceInFlight, scope),
+		nonFinite:           nonFinite,
+
+		streamSeriesThreshold:     hOpts.Config().ResultOptions.StreamSeriesThreshold,
+		streamDatapointsThreshold: hOpts.Config().ResultOptions.StreamDatapointsThreshold,
+		serverTiming:              hOpts.Config().ResultOptions.ServerTiming,
+		truncatedQueryLimit:       hOpts.Config().ResultOptions.TruncatedQueryLimit,
+		maxLookbackOverride:       defaultMaxLookbackOverride,
+		maxScannedSamples:         hOpts.Config().Query.MaxScannedSamples,
+		partialResultsOnTimeout:   hOpts.Config().Query.PartialResultsOnTimeout,
+		maxQueryRange:             hOpts.Config().Query.MaxQueryRange,
+	}
+	if handler.truncatedQueryLimit <= 0 {
+		handler.truncatedQueryLimit = defaultTruncatedQueryLimit
+	}
+	if max := hOpts.Config().Query.MaxLookbackOverride; max != nil {
+		handler.maxLookbackOverride = *max
 	}
 	if handler.qs != nil {
 		handler.logger.Info("Query shadowing is enabled",
 		    zap.String("shadowQueryURL", handler.qs.shadowQueryURL),
 			zap.Int("QueryShadowingWorkers", hOpts.QueryShadowingWorkers()),
+			zap.String("submitStrategy", string(handler.qs.submitStrategy)),
 		)
 	}
 	return handler, nil
@@ -145,30 +241,101 @@ type queryShadowing struct {
 	respondedQueryCounter tally.Counter
 	responded2xxQueryCounter tally.Counter
 	skippedQueryCounter tally.Counter
+
+	submitStrategy config.ShadowQuerySubmitStrategy
+	submitTimeout  time.Duration
+	// overflowQueue holds the shadow queries waiting for a worker with the
+	// overflowQueue strategy, it is drained by a single goroutine.
+	overflowQueue      chan xsync.Work
+	overflowQueueDepth tally.Gauge
 }
 
-func getHttpClient() *http.Client {
+func getHttpClient(timeout time.Duration, maxConns int) *http.Client {
 	t := http.DefaultTransport.(*http.Transport).Clone()
-	t.MaxIdleConns = 10
-	t.MaxConnsPerHost = 10
-	t.MaxIdleConnsPerHost = 10
+	t.MaxIdleConns = maxConns
+	t.MaxConnsPerHost = maxConns
+	t.MaxIdleConnsPerHost = maxConns
 	return &http.Client{
-		Timeout:   8 * 60 * time.Second,
+		Timeout:   timeout,
 		Transport: t,
 	}
 }
 
-func newQueryShadowing(shadowQueryURL string, numWorkers int, scope tally.Scope) *queryShadowing {
-	workerPool := xsync.NewWorkerPool(numWorkers)
+func newQueryShadowing(hOpts options.HandlerOptions, scope tally.Scope) (*queryShadowing, error) {
+	submitStrategy := hOpts.ShadowQuerySubmitStrategy()
+	if submitStrategy == "" {
+		submitStrategy = config.ShadowQueryDropOnFull
+	}
+	submitTimeout := defaultShadowSubmitTimeout
+	switch submitStrategy {
+	case config.ShadowQueryDropOnFull:
+	case config.ShadowQueryBlockWithTimeout:
+		if hOpts.ShadowQuerySubmitTimeout() <= 0 {
+			return nil, fmt.Errorf("shadow query submit timeout must be positive for the %s strategy",
+				submitStrategy)
+		}
+		submitTimeout = hOpts.ShadowQuerySubmitTimeout()
+	case config.ShadowQueryOverflowQueue:
+		if hOpts.ShadowQueryOverflowQueueSize() <= 0 {
+			return nil, fmt.Errorf("shadow query overflow queue size must be positive for the %s strategy",
+				submitStrategy)
+		}
+	default:
+		return nil, fmt.Errorf("unknown shadow query submit strategy %s", submitStrategy)
+	}
+
+	clientTimeout := defaultShadowClientTimeout
+	if hOpts.ShadowQueryClientTimeout() > 0 {
+		clientTimeout = hOpts.ShadowQueryClientTimeout()
+	}
+	maxConns := defaultShadowMaxConns
+	if hOpts.ShadowQueryMaxConns() > 0 {
+		maxConns = hOpts.ShadowQueryMaxConns()
+	}
+
+	workerPool := xsync.NewWorkerPool(hOpts.QueryShadowingWorkers())
 	workerPool.Init()
-	return &queryShadowing{
-		shadowQueryURL: shadowQueryURL,
+	qs := &queryShadowing{
+		shadowQueryURL: hOpts.ShadowQueryURL(),
 		workerPool:     workerPool,
-		client:         getHttpClient(),
+		client:         getHttpClient(clientTimeout, maxConns),
 		failedQueryCounter: scope.Counter("failed_shadow_query"),
 		respondedQueryCounter: scope.Counter("responded_shadow_query"),
 		responded2xxQueryCounter: scope.Counter("2xx_shadow_query"),
 		skippedQueryCounter: scope.Counter("skipped_shadow_query"),
+		submitStrategy: submitStrategy,
+		submitTimeout:  submitTimeout,
+	}
+	if submitStrategy == config.ShadowQueryOverflowQueue {
+		qs.overflowQueue = make(chan xsync.Work, hOpts.ShadowQueryOverflowQueueSize())
+		qs.overflowQueueDepth = scope.Gauge("shadow_query_overflow_queue_depth")
+		go qs.drainOverflowQueue()
+	}
+	return qs, nil
+}
+
+// submit hands the shadow query to a worker according to the submit strategy,
+// returning false if the query was dropped.
+func (qs *queryShadowing) submit(work xsync.Work) bool {
+	if qs.submitStrategy != config.ShadowQueryOverflowQueue {
+		return qs.workerPool.GoWithTimeout(work, qs.submitTimeout)
+	}
+	if qs.workerPool.GoIfAvailable(work) {
+		return true
+	}
+	select {
+	case qs.overflowQueue <- work:
+		qs.overflowQueueDepth.Update(float64(len(qs.overflowQueue)))
+		return true
+	default:
+		return false
+	}
+}
+
+func (qs *queryShadowing) drainOverflowQueue() {
+	for work := range qs.overflowQueue {
+		qs.overflowQueueDepth.Update(float64(len(qs.overflowQueue)))
+		qs.workerPool.Go(work)
 	}
 }
 
@@ -239,26 +406,82 @@ func (h* readHandler) sendShadowQuery(r *http.Request) {
 			)
 		}
 	}
-	if !h.qs.workerPool.GoWithTimeout(doSend, time.Second * 3) {
+	if !h.qs.submit(doSend) {
 		h.logger.Error("Failed to send shadow query because worker pool can't catch up with the pending requests",
 			zap.Int("workerPoolCapacity", h.qs.workerPool.Size()),
+			zap.String("submitStrategy", string(h.qs.submitStrategy)),
 		)
 		h.qs.skippedQueryCounter.Inc(1)
 	}
 }
 
 func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.cors != nil && h.cors.setHeaders(w, r) {
+		return
+	}
 	ctx := r.Context()
+	// The phase timings are also recorded when only the stats are requested.
+	withStats := statsRequested(r)
+	var timing *serverTiming
+	if h.serverTiming || withStats {
+		timing = &serverTiming{header: h.serverTiming}
+	}
+	parseStart := time.Now()
+	parseSp, _ := opentracing.StartSpanFromContextWithTracer(ctx, h.tracer, tracepoint.PromReadParse)
 	ctx, request, err := native.ParseRequest(ctx, r, h.opts.instant, h.hOpts)
+	if err == nil {
+		err = validateQueryFeatures(request.Params.Query)
+	}
+	if err == nil {
+		err = h.functionPolicy.checkQuery(request.Params.Query)
+	}
+	if err == nil {
+		err = h.checkQueryRange(r, request.Params)
+	}
+	if err == nil {
+		request.Params.Query, err = h.tenantIsolation.RestrictQuery(r, request.Params.Query)
+	}
+	finishSpan(parseSp, err)
 	if err != nil {
-		xhttp.WriteError(w, err)
+		h.writeError(w, err)
 		return
 	}
+	timing.add("parse", time.Since(parseStart))
 
 	h.sendShadowQuery(r)
 
 	params := request.Params
 	fetchOptions := request.FetchOpts
+	lookback, ok, err := lookbackOverride(r, h.maxLookbackOverride)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if ok {
+		params.LookbackDuration = lookback
+		fetchOptions.LookbackDuration = &lookback
+	}
+	if resolveLimits := h.hOpts.LimitsResolver(); resolveLimits != nil {
+		series, datapoints := resolveLimits(r)
+		if series >= 0 {
+			fetchOptions.ReturnedSeriesLimit = series
+		}
+		if datapoints >= 0 {
+			fetchOptions.ReturnedDatapointsLimit = datapoints
+		}
+	}
+
+	if explainRequested(r) {
+		h.explain(ctx, w, params.Query, params.Start.ToTime(), params.End.ToTime(),
+			params.Step, params.LookbackDuration, fetchOptions)
+		return
+	}
+
+	if err := h.checkCostBudget(ctx, params.Query, params.Start.ToTime(), params.End.ToTime(),
+		params.LookbackDuration, fetchOptions); err != nil {
+		h.writeError(w, err)
+		return
+	}
 
 	// NB (@shreyas): We put the FetchOptions in context so it can be
 	// retrieved in the queryable object as there is no other way to pass
@@ -276,30 +499,75 @@ func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	ctx = context.WithValue(ctx, prometheus.FetchOptionsContextKey, fetchOptions)
 	ctx = context.WithValue(ctx, prometheus.BlockResultMetadataFnKey, resultMetadataReceiveFn)
-
-	qry, err := h.opts.newQueryFn(params)
+	if h.partialResultsOnTimeout {
+		ctx = context.WithValue(ctx, prometheus.PartialResultsOnTimeoutContextKey, true)
+	}
+	var samples *atomic.Int64
+	if withStats {
+		ctx, samples = withSamplesScanned(ctx)
+	}
+	execStart := time.Now()
+	execSp, execCtx := opentracing.StartSpanFromContextWithTracer(ctx, h.tracer, tracepoint.PromReadExec)
+	execSp.LogFields(
+		opentracinglog.String("query", params.Query),
+		opentracinglog.Bool("instant", h.opts.instant),
+	)
+	var (
+		qry promql.Query
+		res *promql.Result
+	)
+	key, coalesce := "", false
+	if h.coalescer != nil && !withStats {
+		// NB: the stats are those of the query of the request.
+		key, coalesce = coalesceKey(params, fetchOptions)
+	}
+	if coalesce {
+		res, resultMetadata, err = h.coalescer.exec(execCtx, key, fetchOptions.Timeout,
+			func(ctx context.Context) (*promql.Result, block.ResultMetadata, error) {
+				qry, err := h.opts.newQueryFn(params)
+				if err != nil {
+					return nil, block.ResultMetadata{}, err
+				}
+				defer qry.Close()
+				res := copyResult(h.execQuery(ctx, qry))
+				resultMetadataMutex.Lock()
+				defer resultMetadataMutex.Unlock()
+				return res, resultMetadata, nil
+			})
+	} else {
+		qry, err = h.opts.newQueryFn(params)
+		if err == nil {
+			defer qry.Close()
+			res = h.execQuery(execCtx, qry)
+		}
+	}
 	if err != nil {
+		finishSpan(execSp, err)
 		h.logger.Error("error creating query",
 			zap.Error(err), zap.String("query", params.Query),
 			zap.Bool("instant", h.opts.instant))
-		xhttp.WriteError(w, xerrors.NewInvalidParamsError(err))
+		h.writeError(w, xerrors.NewInvalidParamsError(err))
 		return
 	}
-	defer qry.Close()
-
-	res := qry.Exec(ctx)
+	finishSpan(execSp, res.Err)
+	timing.add("exec", time.Since(execStart))
 	if res.Err != nil {
 		h.logger.Error("error executing query",
 			zap.Error(res.Err), zap.String("query", params.Query),
 			zap.Bool("instant", h.opts.instant))
-		var sErr *prometheus.StorageErr
-		if errors.As(res.Err, &sErr) {
+		var (
+			sErr      *prometheus.StorageErr
+			budgetErr sampleBudgetError
+		)
+		if errors.As(res.Err, &budgetErr) {
+			h.writeError(w, xhttp.NewError(budgetErr, http.StatusUnprocessableEntity))
+		} else if errors.As(res.Err, &sErr) {
 			// If the error happened in the m3 storage layer, propagate the causing error as is.
 			err := sErr.Unwrap()
 			if queryerrors.IsTimeout(err) {
-				xhttp.WriteError(w, queryerrors.NewErrQueryTimeout(err))
+				h.writeError(w, queryerrors.NewErrQueryTimeout(err))
 			} else {
-				xhttp.WriteError(w, err)
+				h.writeError(w, err)
 			}
 		} else {
 			promErr := errs.Cause(res.Err)
@@ -311,7 +579,7 @@ func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				// Assume any prometheus library error is a 4xx, since there are no remote calls.
 				promErr = xerrors.NewInvalidParamsError(res.Err)
 			}
-			xhttp.WriteError(w, promErr)
+			h.writeError(w, promErr)
 		}
 		return
 	}
@@ -331,11 +599,22 @@ func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	err = handleroptions.AddDBResultResponseHeaders(w, resultMetadata, fetchOptions)
 	if err != nil {
 		h.logger.Error("error writing database limit headers", zap.Error(err))
-		xhttp.WriteError(w, err)
+		h.writeError(w, err)
 		return
 	}
 
+	// Downsampling reshapes the result before the returned data limits count it.
+	h.downsampleResult(w, params, res)
+
+	limitSp, _ := opentracing.StartSpanFromContextWithTracer(ctx, h.tracer, tracepoint.PromReadLimit)
 	returnedDataLimited := h.limitReturnedData(query, res, fetchOptions)
+	limitSp.LogFields(
+		opentracinglog.Bool("limited", returnedDataLimited.Limited),
+		opentracinglog.Int("series", returnedDataLimited.Series),
+		opentracinglog.Int("totalSeries", returnedDataLimited.TotalSeries),
+		opentracinglog.Int("datapoints", returnedDataLimited.Datapoints),
+	)
+	limitSp.Finish()
 	h.returnedDataMetrics.FetchM3Series.RecordValue(float64(resultMetadata.FetchedSeriesCount))
 	h.returnedDataMetrics.FetchDatapoints.RecordValue(float64(returnedDataLimited.Datapoints))
 	h.returnedDataMetrics.FetchSeries.RecordValue(float64(returnedDataLimited.Series))
@@ -343,20 +622,30 @@ func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// if query return data more than warning limit, logging an as warning
 	if resultMetadata.FetchedSeriesCount > querySeriesWarn {
 		metricName := h.extractMetricName(query)
+		truncatedQuery := h.truncateQuery(query)
+		// The hash identifies the exact query even when truncated queries collide.
+		hash := queryHash(query)
 		h.logger.Warn("The time series query return more than query limit", zap.Int("limit threshold", querySeriesWarn),
-			zap.Int("time series", resultMetadata.FetchedSeriesCount), zap.String("metric", metricName), zap.String("query", query))
+			zap.Int("time series", resultMetadata.FetchedSeriesCount), zap.String("metric", metricName),
+			zap.String("query", truncatedQuery), zap.String("queryHash", hash),
+			zap.Strings("heaviestSelectors", heaviestSelectors(resultMetadata)))
 
-		truncatedQuery := h.truncateQuery(query)
-		gauge, exists := h.returnedDataMetrics.OverLimitFetchM3Series[metricName]
+		gauge, exists := h.returnedDataMetrics.OverLimitFetchM3Series[hash]
 		if !exists {
 			gauge = h.returnedDataMetrics.Scope.Tagged(
-				map[string]string{"query": truncatedQuery, "metric": metricName},
+				map[string]string{"query": truncatedQuery, "query_hash": hash, "metric": metricName},
 			).Gauge("fetch.over_limit_m3_series")
-			h.returnedDataMetrics.OverLimitFetchM3Series[truncatedQuery] = gauge
+			h.returnedDataMetrics.OverLimitFetchM3Series[hash] = gauge
 		}
 		gauge.Update(float64(resultMetadata.FetchedSeriesCount))
 	}
 
+	if prometheus.IsPartialResult(resultMetadata) {
+		w.Header().Set(partialResultHeader, "true")
+	}
+	w.Header().Set(fetchedSeriesCountHeader, strconv.Itoa(resultMetadata.FetchedSeriesCount))
+	w.Header().Set(returnedDatapointsHeader, strconv.Itoa(returnedDataLimited.Datapoints))
+
 	limited := &handleroptions.ReturnedDataLimited{
 		Limited:     returnedDataLimited.Limited,
 		Series:      returnedDataLimited.Series,
@@ -368,14 +657,46 @@ func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.logger.Error("error writing response headers",
 			zap.Error(err), zap.String("query", query),
 			zap.Bool("instant", h.opts.instant))
-		xhttp.WriteError(w, err)
+		h.writeError(w, err)
 		return
 	}
 
-	if err := Respond(w, &QueryData{
-		Result:     res.Value,
-		ResultType: res.Value.Type(),
-	}, res.Warnings); err != nil {
+	var queryStats *QueryStats
+	if withStats {
+		queryStats = newQueryStats(qry, timing, samples, resultMetadata)
+	}
+
+	serializeStart := time.Now()
+	respondSp, _ := opentracing.StartSpanFromContextWithTracer(ctx, h.tracer, tracepoint.PromReadRespond)
+	switch matrix, ok := res.Value.(promql.Matrix); {
+	case ok && h.shouldStream(returnedDataLimited):
+		// NB: the headers are sent before the first series, so the serialize
+		// phase can only be reported in a trailer.
+		timing.writeHeader(w)
+		err = respondMatrixStream(w, matrix, h.nonFinite, queryStats, res.Warnings)
+		timing.writeTrailer(w, "serialize", time.Since(serializeStart))
+	case h.serverTiming:
+		// The response is buffered to report the serialize phase in the header.
+		bw := &bufferedResponseWriter{ResponseWriter: w}
+		err = Respond(bw, &QueryData{
+			Result:     h.nonFinite.value(res.Value),
+			ResultType: res.Value.Type(),
+			Stats:      queryStats,
+		}, res.Warnings)
+		timing.add("serialize", time.Since(serializeStart))
+		timing.writeHeader(w)
+		if err == nil {
+			_, err = w.Write(bw.buf.Bytes())
+		}
+	default:
+		err = Respond(w, &QueryData{
+			Result:     h.nonFinite.value(res.Value),
+			ResultType: res.Value.Type(),
+			Stats:      queryStats,
+		}, res.Warnings)
+	}
+	finishSpan(respondSp, err)
+	if err != nil {
 		h.logger.Error("error writing prom response",
 			zap.Error(err),
 			zap.String("query", params.Query),
@@ -383,6 +704,21 @@ func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// shouldStream returns true if the returned data exceeds one of the
+// configured thresholds and should be streamed rather than buffered whole.
+func (h *readHandler) shouldStream(returned native.ReturnedDataLimited) bool {
+	return (h.streamSeriesThreshold > 0 && returned.Series > h.streamSeriesThreshold) ||
+		(h.streamDatapointsThreshold > 0 && returned.Datapoints > h.streamDatapointsThreshold)
+}
+
+func finishSpan(sp opentracing.Span, err error) {
+	if err != nil {
+		sp.LogFields(opentracinglog.Error(err))
+		opentracingext.Error.Set(sp, true)
+	}
+	sp.Finish()
+}
+
 // NB: this is a naive but lightweight method to extra a metric name from a PromQL query.
 // It returns an empty string if it fails to extract a metric name.
 // We don't want to parse the PromQL here because the extraction is not super important.
@@ -414,10 +750,16 @@ func (h *readHandler) extractMetricName(query string) string {
 }
 
 func (h *readHandler) truncateQuery(query string) string {
-	if len(query) <= truncatedQueryLimit {
+	if len(query) <= h.truncatedQueryLimit {
 		return query
 	}
-	return query[:truncatedQueryLimit] + "..."
+	return query[:h.truncatedQueryLimit] + "..."
+}
+
+// queryHash returns a short stable hash of the full query.
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])[:queryHashLength]
 }
 
 func (h *readHandler) limitReturnedData(query string,
@@ -27,22 +27,33 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
 	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
 	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
 	"github.com/m3db/m3/src/query/api/v1/options"
+	"github.com/m3db/m3/src/query/block"
 	"github.com/m3db/m3/src/query/executor"
 	"github.com/m3db/m3/src/query/storage"
 	"github.com/m3db/m3/src/query/storage/prometheus"
+	"github.com/m3db/m3/src/query/tracepoint"
+	"github.com/m3db/m3/src/x/headers"
 	xerrors "github.com/m3db/m3/src/x/errors"
 	"github.com/m3db/m3/src/x/instrument"
+	xsync "github.com/m3db/m3/src/x/sync"
 
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql"
 	promstorage "github.com/prometheus/prometheus/storage"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
 
@@ -65,20 +76,16 @@ type testHandlers struct {
 }
 
 func setupTest(t *testing.T) testHandlers {
-	fetchOptsBuilderCfg := handleroptions.FetchOptionsBuilderOptions{
-		Timeout: 15 * time.Second,
-	}
-	fetchOptsBuilder, err := handleroptions.NewFetchOptionsBuilder(fetchOptsBuilderCfg)
-	require.NoError(t, err)
-	instrumentOpts := instrument.NewOptions()
-	engineOpts := executor.NewEngineOptions().
-		SetLookbackDuration(time.Minute).
-		SetInstrumentOptions(instrumentOpts)
-	engine := executor.NewEngine(engineOpts)
-	hOpts := options.EmptyHandlerOptions().
-		SetFetchOptionsBuilder(fetchOptsBuilder).
-		SetEngine(engine)
+	return setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		return o
+	})
+}
 
+func setupTestWithHandlerOptions(
+	t *testing.T,
+	fn func(options.HandlerOptions) options.HandlerOptions,
+) testHandlers {
+	hOpts := newTestHandlerOptions(t, fn)
 	queryable := &mockQueryable{}
 	readHandler, err := newReadHandler(hOpts, opts{
 		queryable:  queryable,
@@ -99,6 +106,25 @@ func setupTest(t *testing.T) testHandlers {
 	}
 }
 
+func newTestHandlerOptions(
+	t *testing.T,
+	fn func(options.HandlerOptions) options.HandlerOptions,
+) options.HandlerOptions {
+	fetchOptsBuilderCfg := handleroptions.FetchOptionsBuilderOptions{
+		Timeout: 15 * time.Second,
+	}
+	fetchOptsBuilder, err := handleroptions.NewFetchOptionsBuilder(fetchOptsBuilderCfg)
+	require.NoError(t, err)
+	instrumentOpts := instrument.NewOptions()
+	engineOpts := executor.NewEngineOptions().
+		SetLookbackDuration(time.Minute).
+		SetInstrumentOptions(instrumentOpts)
+	engine := executor.NewEngine(engineOpts)
+	return fn(options.EmptyHandlerOptions().
+		SetFetchOptionsBuilder(fetchOptsBuilder).
+		SetEngine(engine))
+}
+
 func defaultParams() url.Values {
 	vals := url.Values{}
 	now := time.Now()
@@ -149,41 +175,56 @@ func TestPromReadHandlerInvalidQuery(t *testing.T) {
 
 func TestPromReadHandlerErrors(t *testing.T) {
 	testCases := []struct {
-		name     string
-		err      error
-		httpCode int
+		name       string
+		err        error
+		httpCode   int
+		errorClass string
 	}{
 		{
-			name:     "prom error",
-			err:      fmt.Errorf("prom error"),
-			httpCode: http.StatusBadRequest,
+			name:       "prom error",
+			err:        fmt.Errorf("prom error"),
+			httpCode:   http.StatusBadRequest,
+			errorClass: queryErrorClient,
+		},
+		{
+			name:       "prom timeout",
+			err:        promql.ErrQueryTimeout("timeout"),
+			httpCode:   http.StatusGatewayTimeout,
+			errorClass: queryErrorTimeout,
 		},
 		{
-			name:     "prom timeout",
-			err:      promql.ErrQueryTimeout("timeout"),
-			httpCode: http.StatusGatewayTimeout,
+			name:       "prom cancel",
+			err:        promql.ErrQueryCanceled("cancel"),
+			httpCode:   499,
+			errorClass: queryErrorCanceled,
 		},
 		{
-			name:     "prom cancel",
-			err:      promql.ErrQueryCanceled("cancel"),
-			httpCode: 499,
+			name:       "storage 500",
+			err:        prometheus.NewStorageErr(fmt.Errorf("500 storage error")),
+			httpCode:   http.StatusInternalServerError,
+			errorClass: queryErrorServer,
 		},
 		{
-			name:     "storage 500",
-			err:      prometheus.NewStorageErr(fmt.Errorf("500 storage error")),
-			httpCode: http.StatusInternalServerError,
+			name:       "storage 400",
+			err:        prometheus.NewStorageErr(xerrors.NewInvalidParamsError(fmt.Errorf("400 storage error"))),
+			httpCode:   http.StatusBadRequest,
+			errorClass: queryErrorClient,
 		},
 		{
-			name:     "storage 400",
-			err:      prometheus.NewStorageErr(xerrors.NewInvalidParamsError(fmt.Errorf("400 storage error"))),
-			httpCode: http.StatusBadRequest,
+			name:       "storage timeout",
+			err:        prometheus.NewStorageErr(context.DeadlineExceeded),
+			httpCode:   http.StatusGatewayTimeout,
+			errorClass: queryErrorTimeout,
 		},
 	}
 
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			setup := setupTest(t)
+			scope := tally.NewTestScope("", nil)
+			setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+				return o.SetInstrumentOpts(instrument.NewOptions().SetMetricsScope(scope))
+			})
 			setup.queryable.selectFn = func(
 				sortSeries bool,
 				hints *promstorage.SelectHints,
@@ -202,10 +243,141 @@ func TestPromReadHandlerErrors(t *testing.T) {
 			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
 			require.Equal(t, statusError, resp.Status)
 			require.Equal(t, tc.httpCode, recorder.Code)
+
+			// Only the counter of the class of the error is incremented.
+			counters := scope.Snapshot().Counters()
+			for _, class := range []string{
+				queryErrorClient, queryErrorServer, queryErrorTimeout, queryErrorCanceled,
+			} {
+				var expected int64
+				if class == tc.errorClass {
+					expected = 1
+				}
+				counter, ok := counters["query_error+class="+class+",handler=prometheus-read"]
+				require.True(t, ok, class)
+				require.Equal(t, expected, counter.Value(), class)
+			}
 		})
 	}
 }
 
+func TestPromReadHandlerTracing(t *testing.T) {
+	spanNames := func(spans []*mocktracer.MockSpan) []string {
+		names := make([]string, 0, len(spans))
+		for _, sp := range spans {
+			names = append(names, sp.OperationName)
+		}
+		return names
+	}
+
+	setupTestWithTracer := func(t *testing.T, mtr *mocktracer.MockTracer) testHandlers {
+		return setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+			return o.SetInstrumentOpts(o.InstrumentOpts().SetTracer(mtr))
+		})
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mtr := mocktracer.New()
+		setup := setupTestWithTracer(t, mtr)
+		root := mtr.StartSpan("root")
+		ctx := opentracing.ContextWithSpan(context.Background(), root)
+
+		req, _ := http.NewRequestWithContext(ctx, "GET", native.PromReadURL, nil)
+		req.URL.RawQuery = defaultParams().Encode()
+
+		recorder := httptest.NewRecorder()
+		setup.readHandler.ServeHTTP(recorder, req)
+		root.Finish()
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		spans := mtr.FinishedSpans()
+		require.Equal(t, []string{
+			tracepoint.PromReadParse,
+			tracepoint.PromReadExec,
+			tracepoint.PromReadLimit,
+			tracepoint.PromReadRespond,
+			"root",
+		}, spanNames(spans))
+		for _, sp := range spans[:4] {
+			require.Equal(t, root.Context().(mocktracer.MockSpanContext).SpanID, sp.ParentID)
+			require.Nil(t, sp.Tag("error"))
+		}
+	})
+
+	t.Run("exec error", func(t *testing.T) {
+		mtr := mocktracer.New()
+		setup := setupTestWithTracer(t, mtr)
+		setup.queryable.selectFn = func(
+			sortSeries bool,
+			hints *promstorage.SelectHints,
+			labelMatchers ...*labels.Matcher,
+		) promstorage.SeriesSet {
+			return promstorage.ErrSeriesSet(fmt.Errorf("storage error"))
+		}
+		root := mtr.StartSpan("root")
+		ctx := opentracing.ContextWithSpan(context.Background(), root)
+
+		req, _ := http.NewRequestWithContext(ctx, "GET", native.PromReadURL, nil)
+		req.URL.RawQuery = defaultParams().Encode()
+
+		recorder := httptest.NewRecorder()
+		setup.readHandler.ServeHTTP(recorder, req)
+		root.Finish()
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		spans := mtr.FinishedSpans()
+		require.Equal(t, []string{
+			tracepoint.PromReadParse,
+			tracepoint.PromReadExec,
+			"root",
+		}, spanNames(spans))
+		require.Equal(t, true, spans[1].Tag("error"))
+	})
+}
+
+func TestPromReadHandlerLimitsResolver(t *testing.T) {
+	// Two series with distinct label sets, evaluated without touching storage.
+	const twoSeriesQuery = `label_replace(vector(1), "a", "x", "", "") or vector(2)`
+	newRequest := func(tenant string) *http.Request {
+		req, _ := http.NewRequest("GET", native.PromReadInstantURL, nil)
+		params := defaultParams()
+		params.Set(queryParam, twoSeriesQuery)
+		req.URL.RawQuery = params.Encode()
+		req.Header.Set("X-Tenant", tenant)
+		return req
+	}
+	setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		return o.SetLimitsResolver(func(r *http.Request) (int, int) {
+			if r.Header.Get("X-Tenant") == "free" {
+				return 1, -1
+			}
+			return -1, -1
+		})
+	})
+
+	t.Run("resolved limits applied", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		setup.readInstantHandler.ServeHTTP(recorder, newRequest("free"))
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var resp response
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		require.Equal(t, statusSuccess, resp.Status)
+		require.Equal(t,
+			`{"Series":1,"Datapoints":1,"TotalSeries":2,"Limited":true}`,
+			recorder.Header().Get(headers.ReturnedDataLimitedHeader))
+	})
+
+	t.Run("negative keeps configured limits", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		setup.readInstantHandler.ServeHTTP(recorder, newRequest("premium"))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t,
+			`{"Series":2,"Datapoints":2,"TotalSeries":2,"Limited":false}`,
+			recorder.Header().Get(headers.ReturnedDataLimitedHeader))
+	})
+}
+
 func TestPromReadInstantHandler(t *testing.T) {
 	setup := setupTest(t)
 
@@ -635,6 +807,29 @@ func TestExtractMetricName(t *testing.T) {
 	}
 }
 
+func TestTruncateQuery(t *testing.T) {
+	setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		cfg := o.Config()
+		cfg.ResultOptions.TruncatedQueryLimit = 10
+		return o.SetConfig(cfg)
+	})
+	handler := setup.readHandler.(*readHandler)
+	require.Equal(t, "sum(rate(u...", handler.truncateQuery("sum(rate(up[5m]))"))
+	require.Equal(t, "up", handler.truncateQuery("up"))
+
+	handler = setupTest(t).readHandler.(*readHandler)
+	require.Equal(t, defaultTruncatedQueryLimit, handler.truncatedQueryLimit)
+}
+
+func TestQueryHash(t *testing.T) {
+	long := strings.Repeat("up or ", 500) + "up"
+	hash := queryHash(long)
+	require.Len(t, hash, 12)
+	require.Equal(t, hash, queryHash(long))
+	// Queries sharing their truncated prefix have distinct hashes.
+	require.NotEqual(t, hash, queryHash(long+" or down"))
+}
+
 func abs(v time.Duration) time.Duration {
 	if v < 0 {
 		return v * -1
@@ -645,3 +840,354 @@ func abs(v time.Duration) time.Duration {
 func millisTime(timestampMilliseconds int64) time.Time {
 	return time.Unix(0, timestampMilliseconds*int64(time.Millisecond))
 }
+
+func TestPromReadHandlerStreamsAboveThreshold(t *testing.T) {
+	start := time.Now().Truncate(time.Minute)
+	serve := func(setup testHandlers) string {
+		req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+		params := defaultParams()
+		params.Set(queryParam, `label_replace(vector(1), "a", "x", "", "") or vector(2)`)
+		params.Set(startParam, start.Format(time.RFC3339))
+		params.Set(endParam, start.Add(30*time.Second).Format(time.RFC3339))
+		req.URL.RawQuery = params.Encode()
+
+		recorder := httptest.NewRecorder()
+		setup.readHandler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		return recorder.Body.String()
+	}
+
+	buffered := serve(setupTest(t))
+	streamed := serve(setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+		cfg := o.Config()
+		cfg.ResultOptions.StreamSeriesThreshold = 1
+		return o.SetConfig(cfg)
+	}))
+	require.Equal(t, buffered, streamed)
+}
+
+func TestPromReadHandlerShouldStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		series     int
+		datapoints int
+		returned   native.ReturnedDataLimited
+		expected   bool
+	}{
+		{name: "disabled", returned: native.ReturnedDataLimited{Series: 10, Datapoints: 100}},
+		{name: "below series", series: 10, returned: native.ReturnedDataLimited{Series: 10}},
+		{name: "above series", series: 10, returned: native.ReturnedDataLimited{Series: 11}, expected: true},
+		{name: "below datapoints", datapoints: 100, returned: native.ReturnedDataLimited{Datapoints: 100}},
+		{
+			name:       "above datapoints",
+			datapoints: 100,
+			returned:   native.ReturnedDataLimited{Datapoints: 101},
+			expected:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &readHandler{
+				streamSeriesThreshold:     tt.series,
+				streamDatapointsThreshold: tt.datapoints,
+			}
+			require.Equal(t, tt.expected, h.shouldStream(tt.returned))
+		})
+	}
+}
+
+func TestPromReadHandlerUnsupportedFeatures(t *testing.T) {
+	tests := []struct {
+		query       string
+		unsupported string
+	}{
+		{query: `up @ start()`, unsupported: "@ modifier"},
+		{query: `up @ 1609746000`, unsupported: "@ modifier"},
+		{query: `rate(up[5m] @ end())`, unsupported: "@ modifier"},
+		{query: `up offset -5m`, unsupported: "negative offset"},
+		{query: `sum(rate(up[5m] offset -1h))`, unsupported: "negative offset"},
+		{query: `max_over_time(up[10m:1m] @ start())`, unsupported: "@ modifier"},
+		{query: `max_over_time(up[10m:1m] offset -5m)`, unsupported: "negative offset"},
+		{query: `max_over_time((up @ end())[10m:1m])`, unsupported: "@ modifier"},
+		{query: `max_over_time(up[10m:1m] offset 5m)`},
+		{query: `up offset 5m`},
+	}
+
+	setup := setupTest(t)
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", native.PromReadInstantURL, nil)
+			params := defaultParams()
+			params.Set(queryParam, tt.query)
+			req.URL.RawQuery = params.Encode()
+
+			recorder := httptest.NewRecorder()
+			setup.readInstantHandler.ServeHTTP(recorder, req)
+
+			if tt.unsupported == "" {
+				require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+				return
+			}
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+			var resp response
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+			require.Equal(t, statusError, resp.Status)
+			require.Equal(t, fmt.Sprintf(
+				"unsupported PromQL feature: %s is not supported by the query engine (prometheus %s)",
+				tt.unsupported, engineVersion), resp.Error)
+		})
+	}
+}
+
+func TestQueryShadowingSubmitStrategyValidation(t *testing.T) {
+	hOpts := options.EmptyHandlerOptions()
+	_, err := newQueryShadowing(hOpts.SetShadowQuerySubmitStrategy("retry"), tally.NoopScope)
+	require.EqualError(t, err, "unknown shadow query submit strategy retry")
+
+	_, err = newQueryShadowing(hOpts.SetShadowQuerySubmitStrategy(config.ShadowQueryBlockWithTimeout), tally.NoopScope)
+	require.EqualError(t, err, "shadow query submit timeout must be positive for the blockWithTimeout strategy")
+
+	_, err = newQueryShadowing(hOpts.SetShadowQuerySubmitStrategy(config.ShadowQueryOverflowQueue), tally.NoopScope)
+	require.EqualError(t, err, "shadow query overflow queue size must be positive for the overflowQueue strategy")
+}
+
+func TestQueryShadowingClient(t *testing.T) {
+	hOpts := options.EmptyHandlerOptions()
+	qs, err := newQueryShadowing(hOpts, tally.NoopScope)
+	require.NoError(t, err)
+	require.Equal(t, defaultShadowClientTimeout, qs.client.Timeout)
+	transport := qs.client.Transport.(*http.Transport)
+	require.Equal(t, defaultShadowMaxConns, transport.MaxIdleConns)
+	require.Equal(t, defaultShadowMaxConns, transport.MaxIdleConnsPerHost)
+	require.Equal(t, defaultShadowMaxConns, transport.MaxConnsPerHost)
+
+	qs, err = newQueryShadowing(hOpts.
+		SetShadowQueryClientTimeout(time.Minute).
+		SetShadowQueryMaxConns(200), tally.NoopScope)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, qs.client.Timeout)
+	transport = qs.client.Transport.(*http.Transport)
+	require.Equal(t, 200, transport.MaxIdleConns)
+	require.Equal(t, 200, transport.MaxIdleConnsPerHost)
+	require.Equal(t, 200, transport.MaxConnsPerHost)
+}
+
+func TestQueryShadowingOverflowQueue(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	workerPool := xsync.NewWorkerPool(1)
+	workerPool.Init()
+	qs := &queryShadowing{
+		workerPool:         workerPool,
+		submitStrategy:     config.ShadowQueryOverflowQueue,
+		overflowQueue:      make(chan xsync.Work, 2),
+		overflowQueueDepth: scope.Gauge("shadow_query_overflow_queue_depth"),
+	}
+
+	var (
+		release = make(chan struct{})
+		wg      sync.WaitGroup
+		ran     atomic.Int32
+	)
+	work := func() {
+		defer wg.Done()
+		<-release
+		ran.Add(1)
+	}
+
+	// The first query takes the only worker, the next two overflow and the
+	// last one is dropped since the queue is full.
+	wg.Add(3)
+	require.True(t, qs.submit(work))
+	require.True(t, qs.submit(work))
+	require.True(t, qs.submit(work))
+	require.False(t, qs.submit(work))
+	require.Equal(t, 2.0, scope.Snapshot().Gauges()["shadow_query_overflow_queue_depth+"].Value())
+
+	go qs.drainOverflowQueue()
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(3), ran.Load())
+	close(qs.overflowQueue)
+}
+
+func TestPromReadHandlerTenantIsolation(t *testing.T) {
+	const tenantHeader = "M3-Tenant"
+	tests := []struct {
+		name   string
+		query  string
+		tenant string
+		code   int
+		err    string
+	}{
+		{
+			name:  "missing tenant header",
+			query: `up`,
+			code:  http.StatusForbidden,
+			err:   "missing tenant header M3-Tenant",
+		},
+		{
+			name:   "selector without tenant",
+			query:  `up`,
+			tenant: "acme",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "every selector restricted",
+			query:  `sum(rate(up{job="a"}[5m])) / count(max_over_time(down[10m:1m]))`,
+			tenant: "acme",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "regexp on tenant is narrowed",
+			query:  `up{tenant=~".+"}`,
+			tenant: "acme",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "own tenant pinned",
+			query:  `up{tenant="acme"}`,
+			tenant: "acme",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "other tenant pinned",
+			query:  `up{tenant="evil"}`,
+			tenant: "acme",
+			code:   http.StatusForbidden,
+			err:    `query selects tenant="evil" which is not the requesting tenant`,
+		},
+		{
+			name:   "other tenant pinned in nested selector",
+			query:  `up{tenant="acme"} or on() label_replace(secrets{tenant="evil"}, "tenant", "acme", "", "")`,
+			tenant: "acme",
+			code:   http.StatusForbidden,
+			err:    `query selects tenant="evil" which is not the requesting tenant`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+				cfg := o.Config()
+				cfg.TenantIsolation = &config.TenantIsolationConfiguration{
+					Header: tenantHeader,
+					Label:  config.DefaultTenantLabel,
+				}
+				return o.SetConfig(cfg)
+			})
+			var (
+				mu      sync.Mutex
+				selects [][]*labels.Matcher
+			)
+			setup.queryable.selectFn = func(
+				_ bool,
+				_ *promstorage.SelectHints,
+				matchers ...*labels.Matcher,
+			) promstorage.SeriesSet {
+				mu.Lock()
+				defer mu.Unlock()
+				selects = append(selects, matchers)
+				return &mockSeriesSet{}
+			}
+
+			req, _ := http.NewRequest("GET", native.PromReadInstantURL, nil)
+			params := defaultParams()
+			params.Set(queryParam, tt.query)
+			req.URL.RawQuery = params.Encode()
+			if tt.tenant != "" {
+				req.Header.Set(tenantHeader, tt.tenant)
+			}
+
+			recorder := httptest.NewRecorder()
+			setup.readInstantHandler.ServeHTTP(recorder, req)
+			require.Equal(t, tt.code, recorder.Code, recorder.Body.String())
+
+			if tt.err != "" {
+				var resp response
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+				require.Equal(t, statusError, resp.Status)
+				require.Equal(t, tt.err, resp.Error)
+				require.Empty(t, selects)
+				return
+			}
+			require.NotEmpty(t, selects)
+			for _, matchers := range selects {
+				require.Contains(t, matchers,
+					labels.MustNewMatcher(labels.MatchEqual, "tenant", tt.tenant))
+			}
+		})
+	}
+}
+
+func TestPromReadHandlerQueryWeightHeaders(t *testing.T) {
+	setup := setupTest(t)
+	meta := block.NewResultMetadata()
+	meta.FetchedSeriesCount = 7
+	setup.queryable.resultMetadata = &meta
+
+	start := time.Now().Truncate(time.Minute)
+	req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+	params := defaultParams()
+	params.Set(queryParam, `vector(1) or up`)
+	params.Set(startParam, start.Format(time.RFC3339))
+	params.Set(endParam, start.Add(30*time.Second).Format(time.RFC3339))
+	req.URL.RawQuery = params.Encode()
+
+	recorder := httptest.NewRecorder()
+	setup.readHandler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	// vector(1) has a datapoint at each of the 4 steps of the range.
+	require.Equal(t, "7", recorder.Header().Get(fetchedSeriesCountHeader))
+	require.Equal(t, "4", recorder.Header().Get(returnedDatapointsHeader))
+}
+
+func TestPromReadHandlerServerTiming(t *testing.T) {
+	start := time.Now().Truncate(time.Minute)
+	serve := func(t *testing.T, setup testHandlers) *http.Response {
+		req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+		params := defaultParams()
+		params.Set(queryParam, `label_replace(vector(1), "a", "x", "", "") or vector(2)`)
+		params.Set(startParam, start.Format(time.RFC3339))
+		params.Set(endParam, start.Add(30*time.Second).Format(time.RFC3339))
+		req.URL.RawQuery = params.Encode()
+
+		recorder := httptest.NewRecorder()
+		setup.readHandler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var resp response
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		require.Equal(t, statusSuccess, resp.Status)
+		return recorder.Result()
+	}
+	withConfig := func(t *testing.T, fn func(*config.Configuration)) testHandlers {
+		return setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+			cfg := o.Config()
+			fn(&cfg)
+			return o.SetConfig(cfg)
+		})
+	}
+	metric := `;dur=\d+\.\d{3}`
+
+	t.Run("disabled by default", func(t *testing.T) {
+		res := serve(t, setupTest(t))
+		require.Empty(t, res.Header.Get(serverTimingHeader))
+	})
+
+	t.Run("buffered response", func(t *testing.T) {
+		res := serve(t, withConfig(t, func(cfg *config.Configuration) {
+			cfg.ResultOptions.ServerTiming = true
+		}))
+		require.Regexp(t, "^parse"+metric+", exec"+metric+", serialize"+metric+"$",
+			res.Header.Get(serverTimingHeader))
+	})
+
+	t.Run("streamed response", func(t *testing.T) {
+		res := serve(t, withConfig(t, func(cfg *config.Configuration) {
+			cfg.ResultOptions.ServerTiming = true
+			cfg.ResultOptions.StreamSeriesThreshold = 1
+		}))
+		require.Regexp(t, "^parse"+metric+", exec"+metric+"$", res.Header.Get(serverTimingHeader))
+		require.Regexp(t, "^serialize"+metric+"$", res.Trailer.Get(serverTimingHeader))
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/prometheus/promql"
+	"go.uber.org/atomic"
+)
+
+type sampleBudgetKey struct{}
+
+// sampleBudget aborts the execution of a query once it scanned more samples
+// than its budget, unlike the returned data limits which only trim the result
+// of a query that ran to completion.
+type sampleBudget struct {
+	max      int64
+	scanned  atomic.Int64
+	exceeded atomic.Bool
+	cancel   context.CancelFunc
+}
+
+// withSampleBudget returns a context that is canceled once the queries run
+// with it scanned more than max samples. The returned cancel func must be
+// called when the query is done.
+func withSampleBudget(
+	ctx context.Context,
+	max int64,
+) (context.Context, *sampleBudget, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	budget := &sampleBudget{max: max, cancel: cancel}
+	return context.WithValue(ctx, sampleBudgetKey{}, budget), budget, cancel
+}
+
+func sampleBudgetFromContext(ctx context.Context) *sampleBudget {
+	budget, _ := ctx.Value(sampleBudgetKey{}).(*sampleBudget)
+	return budget
+}
+
+// scan accounts for a scanned sample and returns false once the budget is
+// exceeded.
+func (b *sampleBudget) scan() bool {
+	if b.scanned.Inc() <= b.max {
+		return true
+	}
+	if b.exceeded.CAS(false, true) {
+		b.cancel()
+	}
+	return false
+}
+
+// err returns the error of the query if the budget was exceeded, nil otherwise.
+func (b *sampleBudget) err() error {
+	if b == nil || !b.exceeded.Load() {
+		return nil
+	}
+	return sampleBudgetError{max: b.max}
+}
+
+// apply replaces the error of the result, usually a cancellation, when the
+// budget was exceeded during its execution.
+func (b *sampleBudget) apply(res *promql.Result) *promql.Result {
+	if err := b.err(); err != nil {
+		res.Value, res.Err = nil, err
+	}
+	return res
+}
+
+type sampleBudgetError struct {
+	max int64
+}
+
+func (e sampleBudgetError) Error() string {
+	return fmt.Sprintf("query exceeded the budget of %d scanned samples", e.max)
+}
+
+// execQuery executes the query within the scanned samples budget, if any.
+func (h *readHandler) execQuery(ctx context.Context, qry promql.Query) *promql.Result {
+	if h.maxScannedSamples <= 0 {
+		return qry.Exec(ctx)
+	}
+	ctx, budget, cancel := withSampleBudget(ctx, h.maxScannedSamples)
+	defer cancel()
+	return budget.apply(qry.Exec(ctx))
+}
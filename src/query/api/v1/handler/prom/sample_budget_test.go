@@ -0,0 +1,110 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+
+	"github.com/prometheus/prometheus/model/labels"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromReadHandlerSampleBudget(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int64
+		code int
+		err  string
+	}{
+		{
+			name: "disabled",
+			code: http.StatusOK,
+		},
+		{
+			// 2 series of 4 samples scan 8 samples.
+			name: "within budget",
+			max:  8,
+			code: http.StatusOK,
+		},
+		{
+			name: "over budget",
+			max:  5,
+			code: http.StatusUnprocessableEntity,
+			err:  "query exceeded the budget of 5 scanned samples",
+		},
+	}
+
+	start := time.Now().Truncate(time.Minute)
+	newSeries := func(name string) promstorage.Series {
+		samples := make([]tsdbutil.Sample, 0, 4)
+		for i := 0; i < 4; i++ {
+			ts := start.Add(time.Duration(i) * 10 * time.Second)
+			samples = append(samples, testSample{t: ts.UnixNano() / int64(time.Millisecond), v: 1})
+		}
+		return promstorage.NewListSeries(labels.FromStrings("__name__", "foo", "a", name), samples)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+				cfg := o.Config()
+				cfg.Query.MaxScannedSamples = tt.max
+				return o.SetConfig(cfg)
+			})
+			setup.queryable.selectFn = func(
+				bool,
+				*promstorage.SelectHints,
+				...*labels.Matcher,
+			) promstorage.SeriesSet {
+				return &listSeriesSet{series: []promstorage.Series{newSeries("x"), newSeries("y")}}
+			}
+
+			req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+			params := defaultParams()
+			params.Set(queryParam, "foo")
+			params.Set(startParam, start.Format(time.RFC3339))
+			params.Set(endParam, start.Add(30*time.Second).Format(time.RFC3339))
+			req.URL.RawQuery = params.Encode()
+
+			recorder := httptest.NewRecorder()
+			setup.readHandler.ServeHTTP(recorder, req)
+			require.Equal(t, tt.code, recorder.Code, recorder.Body.String())
+			if tt.err == "" {
+				return
+			}
+			var resp struct {
+				Error string `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+			assert.Equal(t, tt.err, resp.Error)
+		})
+	}
+}
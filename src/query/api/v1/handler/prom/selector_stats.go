@@ -0,0 +1,187 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m3db/m3/src/query/block"
+	"github.com/m3db/m3/src/query/storage/prometheus"
+
+	"github.com/prometheus/prometheus/model/labels"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"go.uber.org/atomic"
+)
+
+// slowQueryHeaviestSelectors is the number of heaviest selectors reported
+// when a query fetches too many series.
+const slowQueryHeaviestSelectors = 5
+
+// selectorStatsQueryable decorates a queryable to record the matcher set and
+// the number of series fetched by each selector into the result metadata.
+type selectorStatsQueryable struct {
+	queryable promstorage.Queryable
+}
+
+func newSelectorStatsQueryable(queryable promstorage.Queryable) promstorage.Queryable {
+	return &selectorStatsQueryable{queryable: queryable}
+}
+
+func (q *selectorStatsQueryable) Querier(
+	ctx context.Context,
+	mint, maxt int64,
+) (promstorage.Querier, error) {
+	querier, err := q.queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	receiveFn, _ := ctx.Value(prometheus.BlockResultMetadataFnKey).(func(block.ResultMetadata))
+	samples, budget := samplesScanned(ctx), sampleBudgetFromContext(ctx)
+	if receiveFn == nil && samples == nil && budget == nil {
+		return querier, nil
+	}
+	return &selectorStatsQuerier{
+		Querier:   querier,
+		receiveFn: receiveFn,
+		samples:   samples,
+		budget:    budget,
+	}, nil
+}
+
+type selectorStatsQuerier struct {
+	promstorage.Querier
+	receiveFn func(block.ResultMetadata)
+	samples   *atomic.Int64
+	budget    *sampleBudget
+}
+
+func (q *selectorStatsQuerier) Select(
+	sortSeries bool,
+	hints *promstorage.SelectHints,
+	labelMatchers ...*labels.Matcher,
+) promstorage.SeriesSet {
+	return &selectorStatsSeriesSet{
+		SeriesSet: q.Querier.Select(sortSeries, hints, labelMatchers...),
+		matchers:  formatMatchers(labelMatchers),
+		receiveFn: q.receiveFn,
+		samples:   q.samples,
+		budget:    q.budget,
+	}
+}
+
+// selectorStatsSeriesSet counts the series of a selector as they are
+// iterated, and reports them once the set is exhausted without error. When
+// samples or budget are set it also counts the samples scanned from the series.
+type selectorStatsSeriesSet struct {
+	promstorage.SeriesSet
+	matchers  string
+	receiveFn func(block.ResultMetadata)
+	samples   *atomic.Int64
+	budget    *sampleBudget
+	series    int
+	reported  bool
+}
+
+func (s *selectorStatsSeriesSet) Next() bool {
+	if s.SeriesSet.Next() {
+		s.series++
+		return true
+	}
+	if !s.reported && s.receiveFn != nil && s.Err() == nil {
+		s.reported = true
+		meta := block.NewResultMetadata()
+		meta.Selectors = []block.SelectorStats{{
+			Matchers:           s.matchers,
+			FetchedSeriesCount: s.series,
+		}}
+		s.receiveFn(meta)
+	}
+	return false
+}
+
+func (s *selectorStatsSeriesSet) At() promstorage.Series {
+	series := s.SeriesSet.At()
+	if s.samples == nil && s.budget == nil {
+		return series
+	}
+	return &samplesScannedSeries{Series: series, samples: s.samples, budget: s.budget}
+}
+
+type samplesScannedSeries struct {
+	promstorage.Series
+	samples *atomic.Int64
+	budget  *sampleBudget
+}
+
+func (s *samplesScannedSeries) Iterator() chunkenc.Iterator {
+	return &samplesScannedIterator{
+		Iterator: s.Series.Iterator(),
+		samples:  s.samples,
+		budget:   s.budget,
+	}
+}
+
+// samplesScannedIterator counts the samples a series iterator advances to
+// with Next, and stops once the sample budget of the query is exceeded.
+type samplesScannedIterator struct {
+	chunkenc.Iterator
+	samples *atomic.Int64
+	budget  *sampleBudget
+}
+
+func (it *samplesScannedIterator) Next() bool {
+	if !it.Iterator.Next() {
+		return false
+	}
+	if it.samples != nil {
+		it.samples.Inc()
+	}
+	return it.budget == nil || it.budget.scan()
+}
+
+func (it *samplesScannedIterator) Err() error {
+	if err := it.budget.err(); err != nil {
+		return err
+	}
+	return it.Iterator.Err()
+}
+
+func formatMatchers(matchers []*labels.Matcher) string {
+	formatted := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		formatted = append(formatted, m.String())
+	}
+	return "{" + strings.Join(formatted, ",") + "}"
+}
+
+// heaviestSelectors returns the heaviest selectors of the result formatted
+// for logging.
+func heaviestSelectors(meta block.ResultMetadata) []string {
+	selectors := meta.HeaviestSelectors(slowQueryHeaviestSelectors)
+	formatted := make([]string, 0, len(selectors))
+	for _, s := range selectors {
+		formatted = append(formatted, fmt.Sprintf("%s: %d", s.Matchers, s.FetchedSeriesCount))
+	}
+	return formatted
+}
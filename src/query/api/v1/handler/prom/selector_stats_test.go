@@ -0,0 +1,96 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m3db/m3/src/query/block"
+	"github.com/m3db/m3/src/query/storage/prometheus"
+
+	"github.com/prometheus/prometheus/model/labels"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// countSeriesSet yields n empty series.
+type countSeriesSet struct {
+	mockSeriesSet
+	n int
+}
+
+func (s *countSeriesSet) Next() bool {
+	if s.n == 0 {
+		return false
+	}
+	s.n--
+	return true
+}
+
+func TestSelectorStatsQueryable(t *testing.T) {
+	queryable := &mockQueryable{}
+	queryable.selectFn = func(
+		_ bool,
+		_ *promstorage.SelectHints,
+		labelMatchers ...*labels.Matcher,
+	) promstorage.SeriesSet {
+		if labelMatchers[0].Value == "heavy" {
+			return &countSeriesSet{n: 7}
+		}
+		return &countSeriesSet{n: 2}
+	}
+
+	meta := block.NewResultMetadata()
+	ctx := context.WithValue(context.Background(), prometheus.BlockResultMetadataFnKey,
+		func(m block.ResultMetadata) {
+			meta = meta.CombineMetadata(m)
+		})
+
+	querier, err := newSelectorStatsQueryable(queryable).Querier(ctx, 0, 0)
+	require.NoError(t, err)
+
+	for _, name := range []string{"light", "heavy"} {
+		set := querier.Select(false, nil,
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, name),
+			labels.MustNewMatcher(labels.MatchRegexp, "job", "api.*"))
+		for set.Next() {
+		}
+		// Exhausted sets are only reported once.
+		require.False(t, set.Next())
+	}
+
+	require.Equal(t, []block.SelectorStats{
+		{Matchers: `{__name__="light",job=~"api.*"}`, FetchedSeriesCount: 2},
+		{Matchers: `{__name__="heavy",job=~"api.*"}`, FetchedSeriesCount: 7},
+	}, meta.Selectors)
+	require.Equal(t, []string{
+		`{__name__="heavy",job=~"api.*"}: 7`,
+		`{__name__="light",job=~"api.*"}: 2`,
+	}, heaviestSelectors(meta))
+}
+
+func TestSelectorStatsQueryableNoMetadataFn(t *testing.T) {
+	queryable := &mockQueryable{}
+	querier, err := newSelectorStatsQueryable(queryable).Querier(context.Background(), 0, 0)
+	require.NoError(t, err)
+	require.IsType(t, &mockQuerier{}, querier)
+}
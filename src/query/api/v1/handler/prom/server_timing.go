@@ -0,0 +1,95 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const serverTimingHeader = "Server-Timing"
+
+// serverTiming collects the durations of the phases of a request, reported in
+// the Server-Timing header when header is set. A nil serverTiming records
+// nothing.
+type serverTiming struct {
+	header    bool
+	phases    []string
+	durations []time.Duration
+}
+
+func (t *serverTiming) add(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.phases = append(t.phases, name)
+	t.durations = append(t.durations, d)
+}
+
+// duration returns the recorded duration of a phase, zero if not recorded.
+func (t *serverTiming) duration(name string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	for i, phase := range t.phases {
+		if phase == name {
+			return t.durations[i]
+		}
+	}
+	return 0
+}
+
+func (t *serverTiming) writeHeader(w http.ResponseWriter) {
+	if t == nil || !t.header {
+		return
+	}
+	metrics := make([]string, 0, len(t.phases))
+	for i, phase := range t.phases {
+		metrics = append(metrics, serverTimingMetric(phase, t.durations[i]))
+	}
+	w.Header().Set(serverTimingHeader, strings.Join(metrics, ", "))
+}
+
+// writeTrailer reports a phase that ended after the response headers were sent.
+func (t *serverTiming) writeTrailer(w http.ResponseWriter, name string, d time.Duration) {
+	if t == nil || !t.header {
+		return
+	}
+	w.Header().Set(http.TrailerPrefix+serverTimingHeader, serverTimingMetric(name, d))
+}
+
+func serverTimingMetric(name string, d time.Duration) string {
+	ms := float64(d) / float64(time.Millisecond)
+	return name + ";dur=" + strconv.FormatFloat(ms, 'f', 3, 64)
+}
+
+// bufferedResponseWriter buffers the response body instead of writing it.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
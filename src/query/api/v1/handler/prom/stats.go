@@ -0,0 +1,114 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/m3db/m3/src/query/block"
+
+	"github.com/prometheus/prometheus/promql"
+	promstats "github.com/prometheus/prometheus/util/stats"
+	"go.uber.org/atomic"
+)
+
+const statsParam = "stats"
+
+type samplesScannedKey struct{}
+
+// QueryStats are the execution stats of a query, returned in the shape of the
+// Prometheus query API when the stats parameter is set.
+type QueryStats struct {
+	Timings QueryTimings `json:"timings"`
+	Samples QuerySamples `json:"samples"`
+}
+
+// QueryTimings are the durations of the phases of a query in seconds. The
+// serialize phase is not included since the stats are part of the serialized
+// response, it is reported in the Server-Timing header instead.
+type QueryTimings struct {
+	EvalTotalTime        float64 `json:"evalTotalTime"`
+	ResultSortTime       float64 `json:"resultSortTime"`
+	QueryPreparationTime float64 `json:"queryPreparationTime"`
+	InnerEvalTime        float64 `json:"innerEvalTime"`
+	ExecQueueTime        float64 `json:"execQueueTime"`
+	ExecTotalTime        float64 `json:"execTotalTime"`
+	ParseTime            float64 `json:"parseTime"`
+	ExecTime             float64 `json:"execTime"`
+}
+
+// QuerySamples are the amount of data touched by a query.
+type QuerySamples struct {
+	TotalQueryableSamples int64 `json:"totalQueryableSamples"`
+	SeriesFetched         int   `json:"seriesFetched"`
+}
+
+func statsRequested(r *http.Request) bool {
+	return r.FormValue(statsParam) != ""
+}
+
+// withSamplesScanned returns a context that counts the samples scanned by the
+// queries run with it.
+func withSamplesScanned(ctx context.Context) (context.Context, *atomic.Int64) {
+	samples := atomic.NewInt64(0)
+	return context.WithValue(ctx, samplesScannedKey{}, samples), samples
+}
+
+func samplesScanned(ctx context.Context) *atomic.Int64 {
+	samples, _ := ctx.Value(samplesScannedKey{}).(*atomic.Int64)
+	return samples
+}
+
+func newQueryStats(
+	qry promql.Query,
+	timing *serverTiming,
+	samples *atomic.Int64,
+	meta block.ResultMetadata,
+) *QueryStats {
+	timings := promstats.NewQueryStats(qry.Stats()).Timings
+	return &QueryStats{
+		Timings: QueryTimings{
+			EvalTotalTime:        timings.EvalTotalTime,
+			ResultSortTime:       timings.ResultSortTime,
+			QueryPreparationTime: timings.QueryPreparationTime,
+			InnerEvalTime:        timings.InnerEvalTime,
+			ExecQueueTime:        timings.ExecQueueTime,
+			ExecTotalTime:        timings.ExecTotalTime,
+			ParseTime:            timing.duration("parse").Seconds(),
+			ExecTime:             timing.duration("exec").Seconds(),
+		},
+		Samples: QuerySamples{
+			TotalQueryableSamples: samples.Load(),
+			SeriesFetched:         seriesFetched(meta),
+		},
+	}
+}
+
+// seriesFetched returns the number of series fetched by the selectors of the
+// query, a series matched by several selectors is counted once per selector.
+func seriesFetched(meta block.ResultMetadata) int {
+	fetched := 0
+	for _, s := range meta.Selectors {
+		fetched += s.FetchedSeriesCount
+	}
+	return fetched
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prom
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/native"
+	"github.com/m3db/m3/src/query/api/v1/options"
+
+	"github.com/prometheus/prometheus/model/labels"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/require"
+)
+
+type testSample struct {
+	t int64
+	v float64
+}
+
+func (s testSample) T() int64   { return s.t }
+func (s testSample) V() float64 { return s.v }
+
+// listSeriesSet yields the given series.
+type listSeriesSet struct {
+	mockSeriesSet
+	series []promstorage.Series
+	cur    promstorage.Series
+}
+
+func (s *listSeriesSet) Next() bool {
+	if len(s.series) == 0 {
+		return false
+	}
+	s.cur, s.series = s.series[0], s.series[1:]
+	return true
+}
+
+func (s *listSeriesSet) At() promstorage.Series { return s.cur }
+
+func TestPromReadHandlerStats(t *testing.T) {
+	start := time.Now().Truncate(time.Minute)
+	newSeries := func(name string) promstorage.Series {
+		samples := make([]tsdbutil.Sample, 0, 4)
+		for i := 0; i < 4; i++ {
+			ts := start.Add(time.Duration(i) * 10 * time.Second)
+			samples = append(samples, testSample{t: ts.UnixNano() / int64(time.Millisecond), v: 1})
+		}
+		return promstorage.NewListSeries(labels.FromStrings("__name__", "foo", "a", name), samples)
+	}
+	serve := func(t *testing.T, setup testHandlers, stats bool) response {
+		setup.queryable.selectFn = func(
+			bool,
+			*promstorage.SelectHints,
+			...*labels.Matcher,
+		) promstorage.SeriesSet {
+			return &listSeriesSet{series: []promstorage.Series{newSeries("x"), newSeries("y")}}
+		}
+
+		req, _ := http.NewRequest("GET", native.PromReadURL, nil)
+		params := defaultParams()
+		params.Set(queryParam, "foo")
+		params.Set(startParam, start.Format(time.RFC3339))
+		params.Set(endParam, start.Add(30*time.Second).Format(time.RFC3339))
+		if stats {
+			params.Set(statsParam, "all")
+		}
+		req.URL.RawQuery = params.Encode()
+
+		recorder := httptest.NewRecorder()
+		setup.readHandler.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var resp response
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		require.Equal(t, statusSuccess, resp.Status)
+		return resp
+	}
+	requireStats := func(t *testing.T, resp response) {
+		data := resp.Data.(map[string]interface{})
+		require.Len(t, data["result"], 2)
+		require.Contains(t, data, "stats")
+		stats := data["stats"].(map[string]interface{})
+		timings := stats["timings"].(map[string]interface{})
+		for _, name := range []string{"evalTotalTime", "execTotalTime", "parseTime", "execTime"} {
+			require.True(t, timings[name].(float64) > 0, name)
+		}
+		require.Equal(t, map[string]interface{}{
+			"totalQueryableSamples": 8.0,
+			"seriesFetched":         2.0,
+		}, stats["samples"])
+	}
+	withConfig := func(t *testing.T, fn func(*config.Configuration)) testHandlers {
+		return setupTestWithHandlerOptions(t, func(o options.HandlerOptions) options.HandlerOptions {
+			cfg := o.Config()
+			fn(&cfg)
+			return o.SetConfig(cfg)
+		})
+	}
+
+	t.Run("not requested", func(t *testing.T) {
+		data := serve(t, setupTest(t), false).Data.(map[string]interface{})
+		require.Len(t, data["result"], 2)
+		require.NotContains(t, data, "stats")
+	})
+
+	t.Run("requested", func(t *testing.T) {
+		requireStats(t, serve(t, setupTest(t), true))
+	})
+
+	t.Run("requested with server timing", func(t *testing.T) {
+		requireStats(t, serve(t, withConfig(t, func(cfg *config.Configuration) {
+			cfg.ResultOptions.ServerTiming = true
+		}), true))
+	})
+
+	t.Run("requested with streamed response", func(t *testing.T) {
+		requireStats(t, serve(t, withConfig(t, func(cfg *config.Configuration) {
+			cfg.ResultOptions.StreamSeriesThreshold = 1
+		}), true))
+	})
+}
@@ -55,6 +55,7 @@ type CompleteTagsHandler struct {
 	storage             storage.Storage
 	fetchOptionsBuilder handleroptions.FetchOptionsBuilder
 	instrumentOpts      instrument.Options
+	tenantIsolation     *prometheus.TenantIsolation
 }
 
 // NewCompleteTagsHandler returns a new instance of handler.
@@ -63,6 +64,7 @@ func NewCompleteTagsHandler(opts options.HandlerOptions) http.Handler {
 		storage:             opts.Storage(),
 		fetchOptionsBuilder: opts.FetchOptionsBuilder(),
 		instrumentOpts:      opts.InstrumentOpts(),
+		tenantIsolation:     prometheus.NewTenantIsolation(opts.Config().TenantIsolation),
 	}
 }
 
@@ -80,6 +82,14 @@ func (h *CompleteTagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		xhttp.WriteError(w, rErr)
 		return
 	}
+	for _, query := range tagCompletionQueries.Queries {
+		var err error
+		query.TagMatchers, err = h.tenantIsolation.RestrictMatchers(r, query.TagMatchers)
+		if err != nil {
+			xhttp.WriteError(w, err)
+			return
+		}
+	}
 
 	var (
 		mu       sync.Mutex
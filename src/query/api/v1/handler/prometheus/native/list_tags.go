@@ -57,6 +57,7 @@ type ListTagsHandler struct {
 	parseOpts           promql.ParseOptions
 	instrumentOpts      instrument.Options
 	tagOpts             models.TagOptions
+	tenantIsolation     *prometheus.TenantIsolation
 }
 
 // NewListTagsHandler returns a new instance of handler.
@@ -67,8 +68,9 @@ func NewListTagsHandler(opts options.HandlerOptions) http.Handler {
 		parseOpts: promql.NewParseOptions().
 			SetRequireStartEndTime(opts.Config().Query.RequireLabelsEndpointStartEndTime).
 			SetNowFn(opts.NowFn()),
-		instrumentOpts: opts.InstrumentOpts(),
-		tagOpts:        opts.TagOptions(),
+		instrumentOpts:  opts.InstrumentOpts(),
+		tagOpts:         opts.TagOptions(),
+		tenantIsolation: prometheus.NewTenantIsolation(opts.Config().TenantIsolation),
 	}
 }
 
@@ -103,6 +105,11 @@ func (h *ListTagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		tagMatchers = reqTagMatchers[0].Matchers
 	}
+	tagMatchers, err = h.tenantIsolation.RestrictMatchers(r, tagMatchers)
+	if err != nil {
+		xhttp.WriteError(w, err)
+		return
+	}
 
 	query := &storage.CompleteTagsQuery{
 		CompleteNameOnly: true,
@@ -26,9 +26,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
 	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
 	"github.com/m3db/m3/src/query/api/v1/options"
 	"github.com/m3db/m3/src/query/block"
@@ -242,3 +244,88 @@ func TestListTagsUseRequestContext(t *testing.T) {
 	assert.Equal(t, 499, w.Code, "Status code not 499")
 	assert.Contains(t, w.Body.String(), "context canceled")
 }
+
+func TestListTagsTenantIsolation(t *testing.T) {
+	const tenantHeader = "M3-Tenant"
+	tenantMatcher := models.Matcher{Type: models.MatchEqual, Name: b("tenant"), Value: b("acme")}
+	tests := []struct {
+		name     string
+		target   string
+		tenant   string
+		code     int
+		matchers models.Matchers
+	}{
+		{
+			name:   "missing tenant header",
+			target: "/labels",
+			code:   http.StatusForbidden,
+		},
+		{
+			name:     "all labels restricted",
+			target:   "/labels",
+			tenant:   "acme",
+			code:     http.StatusOK,
+			matchers: models.Matchers{tenantMatcher},
+		},
+		{
+			name:   "match restricted",
+			target: "/labels?match[]=" + url.QueryEscape(`up{tenant!="evil"}`),
+			tenant: "acme",
+			code:   http.StatusOK,
+			matchers: models.Matchers{
+				{Type: models.MatchNotEqual, Name: b("tenant"), Value: b("evil")},
+				{Type: models.MatchEqual, Name: b("__name__"), Value: b("up")},
+				tenantMatcher,
+			},
+		},
+		{
+			name:   "match pins other tenant",
+			target: "/labels?match[]=" + url.QueryEscape(`up{tenant="evil"}`),
+			tenant: "acme",
+			code:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := xtest.NewController(t)
+			defer ctrl.Finish()
+
+			store := storage.NewMockStorage(ctrl)
+			if tt.matchers != nil {
+				store.EXPECT().CompleteTags(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(
+						_ context.Context,
+						q *storage.CompleteTagsQuery,
+						_ *storage.FetchOptions,
+					) (*consolidators.CompleteTagsResult, error) {
+						require.Equal(t, tt.matchers, q.TagMatchers)
+						return &consolidators.CompleteTagsResult{CompleteNameOnly: true}, nil
+					})
+			}
+
+			fb, err := handleroptions.NewFetchOptionsBuilder(
+				handleroptions.FetchOptionsBuilderOptions{Timeout: 15 * time.Second})
+			require.NoError(t, err)
+			cfg := config.Configuration{
+				TenantIsolation: &config.TenantIsolationConfiguration{
+					Header: tenantHeader,
+					Label:  config.DefaultTenantLabel,
+				},
+			}
+			opts := options.EmptyHandlerOptions().
+				SetStorage(store).
+				SetFetchOptionsBuilder(fb).
+				SetTagOptions(models.NewTagOptions()).
+				SetConfig(cfg)
+
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.tenant != "" {
+				req.Header.Set(tenantHeader, tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			NewListTagsHandler(opts).ServeHTTP(w, req)
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+		})
+	}
+}
@@ -23,6 +23,7 @@ package native
 import (
 	"net/http"
 
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus"
 	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
 	"github.com/m3db/m3/src/query/api/v1/options"
 	"github.com/m3db/m3/src/query/api/v1/route"
@@ -79,6 +80,7 @@ type promReadHandler struct {
 	instant         bool
 	promReadMetrics promReadMetrics
 	opts            options.HandlerOptions
+	tenantIsolation *prometheus.TenantIsolation
 }
 
 // NewPromReadHandler returns a new prometheus-compatible read handler.
@@ -104,6 +106,7 @@ func newHandler(opts options.HandlerOptions, instant bool) http.Handler {
 		promReadMetrics: newPromReadMetrics(taggedScope),
 		opts:            opts,
 		instant:         instant,
+		tenantIsolation: prometheus.NewTenantIsolation(opts.Config().TenantIsolation),
 	}
 	return h
 }
@@ -122,6 +125,12 @@ func (h *promReadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteError(w, rErr)
 		return
 	}
+	parsedOptions.Params.Query, rErr = h.tenantIsolation.RestrictQuery(r, parsedOptions.Params.Query)
+	if rErr != nil {
+		h.promReadMetrics.incError(rErr)
+		xhttp.WriteError(w, rErr)
+		return
+	}
 	ctx = logging.NewContext(ctx,
 		iOpts,
 		zap.String("query", parsedOptions.Params.Query),
@@ -49,6 +49,7 @@ type PromSeriesMatchHandler struct {
 	fetchOptionsBuilder handleroptions.FetchOptionsBuilder
 	instrumentOpts      instrument.Options
 	parseOpts           promql.ParseOptions
+	tenantIsolation     *prometheus.TenantIsolation
 }
 
 // NewPromSeriesMatchHandler returns a new instance of handler.
@@ -62,6 +63,7 @@ func NewPromSeriesMatchHandler(opts options.HandlerOptions) http.Handler {
 		instrumentOpts:      opts.InstrumentOpts(),
 		parseOpts: opts.Engine().Options().ParseOptions().
 			SetRequireStartEndTime(opts.Config().Query.RequireSeriesEndpointStartEndTime),
+		tenantIsolation: prometheus.NewTenantIsolation(opts.Config().TenantIsolation),
 	}
 }
 
@@ -84,6 +86,14 @@ func (h *PromSeriesMatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	for _, query := range queries {
+		query.TagMatchers, err = h.tenantIsolation.RestrictMatchers(r, query.TagMatchers)
+		if err != nil {
+			xhttp.WriteError(w, err)
+			return
+		}
+	}
+
 	results := make([]models.Metrics, len(queries))
 	meta := block.NewResultMetadata()
 	for i, query := range queries {
@@ -0,0 +1,132 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package remote
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
+	"github.com/m3db/m3/src/query/api/v1/options"
+	"github.com/m3db/m3/src/query/api/v1/route"
+	"github.com/m3db/m3/src/query/block"
+	"github.com/m3db/m3/src/query/models"
+	"github.com/m3db/m3/src/query/storage"
+	"github.com/m3db/m3/src/x/instrument"
+	xtest "github.com/m3db/m3/src/x/test"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromSeriesMatchTenantIsolation(t *testing.T) {
+	const tenantHeader = "M3-Tenant"
+	tenantMatcher := models.Matcher{Type: models.MatchEqual, Name: b("tenant"), Value: b("acme")}
+	tests := []struct {
+		name     string
+		match    []string
+		tenant   string
+		code     int
+		matchers []models.Matchers
+	}{
+		{
+			name:  "missing tenant header",
+			match: []string{`up`},
+			code:  http.StatusForbidden,
+		},
+		{
+			name:   "every match restricted",
+			match:  []string{`up`, `{job="api"}`},
+			tenant: "acme",
+			code:   http.StatusOK,
+			matchers: []models.Matchers{
+				{{Type: models.MatchEqual, Name: b("__name__"), Value: b("up")}, tenantMatcher},
+				{{Type: models.MatchEqual, Name: b("job"), Value: b("api")}, tenantMatcher},
+			},
+		},
+		{
+			name:   "own tenant pinned",
+			match:  []string{`up{tenant="acme"}`},
+			tenant: "acme",
+			code:   http.StatusOK,
+			matchers: []models.Matchers{
+				{tenantMatcher, {Type: models.MatchEqual, Name: b("__name__"), Value: b("up")}, tenantMatcher},
+			},
+		},
+		{
+			name:   "other tenant pinned",
+			match:  []string{`up`, `secrets{tenant="evil"}`},
+			tenant: "acme",
+			code:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := xtest.NewController(t)
+			defer ctrl.Finish()
+
+			var searched []models.Matchers
+			store := storage.NewMockStorage(ctrl)
+			store.EXPECT().SearchSeries(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(
+					_ context.Context,
+					q *storage.FetchQuery,
+					_ *storage.FetchOptions,
+				) (*storage.SearchResults, error) {
+					searched = append(searched, q.TagMatchers)
+					return &storage.SearchResults{Metadata: block.NewResultMetadata()}, nil
+				}).
+				Times(len(tt.matchers))
+
+			fb, err := handleroptions.NewFetchOptionsBuilder(
+				handleroptions.FetchOptionsBuilderOptions{Timeout: 15 * time.Second})
+			require.NoError(t, err)
+			cfg := config.Configuration{
+				TenantIsolation: &config.TenantIsolationConfiguration{
+					Header: tenantHeader,
+					Label:  config.DefaultTenantLabel,
+				},
+			}
+			opts := options.EmptyHandlerOptions().
+				SetStorage(store).
+				SetEngine(newEngine(store, defaultLookbackDuration, instrument.NewOptions())).
+				SetFetchOptionsBuilder(fb).
+				SetTagOptions(models.NewTagOptions()).
+				SetConfig(cfg)
+
+			params := url.Values{"match[]": tt.match}
+			req := httptest.NewRequest("GET", route.SeriesMatchURL+"?"+params.Encode(), nil)
+			if tt.tenant != "" {
+				req.Header.Set(tenantHeader, tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			NewPromSeriesMatchHandler(opts).ServeHTTP(w, req)
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+			require.Equal(t, tt.matchers, searched)
+		})
+	}
+}
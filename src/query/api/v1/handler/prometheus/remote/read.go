@@ -69,6 +69,7 @@ var PromReadHTTPMethods = []string{http.MethodPost, http.MethodGet}
 type promReadHandler struct {
 	promReadMetrics promReadMetrics
 	opts            options.HandlerOptions
+	tenantIsolation *prometheus.TenantIsolation
 }
 
 // NewPromReadHandler returns a new instance of handler.
@@ -78,6 +79,7 @@ func NewPromReadHandler(opts options.HandlerOptions) http.Handler {
 	return &promReadHandler{
 		promReadMetrics: newPromReadMetrics(taggedScope),
 		opts:            opts,
+		tenantIsolation: prometheus.NewTenantIsolation(opts.Config().TenantIsolation),
 	}
 }
 
@@ -123,6 +125,11 @@ func (h *promReadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteError(w, rErr)
 		return
 	}
+	if err := h.tenantIsolation.RestrictReadRequest(r, req); err != nil {
+		h.promReadMetrics.incError(err)
+		xhttp.WriteError(w, err)
+		return
+	}
 
 	readResult, err := Read(ctx, req, fetchOpts, h.opts)
 	if err != nil {
@@ -61,6 +61,7 @@ type TagValuesHandler struct {
 	parseOpts           promql.ParseOptions
 	instrumentOpts      instrument.Options
 	tagOpts             models.TagOptions
+	tenantIsolation     *prometheus.TenantIsolation
 }
 
 // TagValuesResponse is the response that gets returned to the user
@@ -76,8 +77,9 @@ func NewTagValuesHandler(opts options.HandlerOptions) http.Handler {
 		parseOpts: promql.NewParseOptions().
 			SetRequireStartEndTime(opts.Config().Query.RequireLabelsEndpointStartEndTime).
 			SetNowFn(opts.NowFn()),
-		instrumentOpts: opts.InstrumentOpts(),
-		tagOpts:        opts.TagOptions(),
+		instrumentOpts:  opts.InstrumentOpts(),
+		tagOpts:         opts.TagOptions(),
+		tenantIsolation: prometheus.NewTenantIsolation(opts.Config().TenantIsolation),
 	}
 }
 
@@ -192,6 +194,11 @@ func (h *TagValuesHandler) parseTagValuesToQuery(
 		}
 	}
 
+	tagMatchers, err = h.tenantIsolation.RestrictMatchers(r, tagMatchers)
+	if err != nil {
+		return nil, err
+	}
+
 	return &storage.CompleteTagsQuery{
 		Start:            xtime.ToUnixNano(start),
 		End:              xtime.ToUnixNano(end),
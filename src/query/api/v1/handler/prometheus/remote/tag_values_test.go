@@ -28,9 +28,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
 	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
 	"github.com/m3db/m3/src/query/api/v1/options"
 	"github.com/m3db/m3/src/query/api/v1/route"
@@ -333,3 +335,96 @@ func expectTimeout(
 	}
 	return nil, nil
 }
+
+func TestTagValuesTenantIsolation(t *testing.T) {
+	const tenantHeader = "M3-Tenant"
+	var (
+		nameMatcher   = models.Matcher{Type: models.MatchField, Name: b("tenant")}
+		tenantMatcher = models.Matcher{Type: models.MatchEqual, Name: b("tenant"), Value: b("acme")}
+	)
+	tests := []struct {
+		name     string
+		match    string
+		tenant   string
+		code     int
+		matchers models.Matchers
+	}{
+		{
+			name: "missing tenant header",
+			code: http.StatusForbidden,
+		},
+		{
+			name:     "tenant values restricted",
+			tenant:   "acme",
+			code:     http.StatusOK,
+			matchers: models.Matchers{nameMatcher, tenantMatcher},
+		},
+		{
+			name:   "match restricted",
+			match:  `secrets{tenant!="acme"}`,
+			tenant: "acme",
+			code:   http.StatusOK,
+			matchers: models.Matchers{
+				nameMatcher,
+				{Type: models.MatchNotEqual, Name: b("tenant"), Value: b("acme")},
+				{Type: models.MatchEqual, Name: b("__name__"), Value: b("secrets")},
+				tenantMatcher,
+			},
+		},
+		{
+			name:   "match pins other tenant",
+			match:  `secrets{tenant="evil"}`,
+			tenant: "acme",
+			code:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := xtest.NewController(t)
+			defer ctrl.Finish()
+
+			store := storage.NewMockStorage(ctrl)
+			if tt.matchers != nil {
+				store.EXPECT().CompleteTags(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(
+						_ context.Context,
+						q *storage.CompleteTagsQuery,
+						_ *storage.FetchOptions,
+					) (*consolidators.CompleteTagsResult, error) {
+						require.Equal(t, tt.matchers, q.TagMatchers)
+						return &consolidators.CompleteTagsResult{}, nil
+					})
+			}
+
+			fb, err := handleroptions.NewFetchOptionsBuilder(
+				handleroptions.FetchOptionsBuilderOptions{Timeout: 15 * time.Second})
+			require.NoError(t, err)
+			cfg := config.Configuration{
+				TenantIsolation: &config.TenantIsolationConfiguration{
+					Header: tenantHeader,
+					Label:  config.DefaultTenantLabel,
+				},
+			}
+			opts := options.EmptyHandlerOptions().
+				SetStorage(store).
+				SetFetchOptionsBuilder(fb).
+				SetTagOptions(models.NewTagOptions()).
+				SetConfig(cfg)
+
+			path := fmt.Sprintf("%s/label/tenant/values", route.Prefix)
+			if tt.match != "" {
+				path += "?match[]=" + url.QueryEscape(tt.match)
+			}
+			req := httptest.NewRequest("GET", path, nil)
+			if tt.tenant != "" {
+				req.Header.Set(tenantHeader, tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc(TagValuesURL, NewTagValuesHandler(opts).ServeHTTP)
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+		})
+	}
+}
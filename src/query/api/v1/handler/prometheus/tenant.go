@@ -0,0 +1,172 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/generated/proto/prompb"
+	"github.com/m3db/m3/src/query/models"
+	xerrors "github.com/m3db/m3/src/x/errors"
+	xhttp "github.com/m3db/m3/src/x/net/http"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// TenantIsolation restricts reads to the series of the requesting tenant by
+// ANDing a matcher on its tenant label into every selector of a read. A nil
+// TenantIsolation leaves reads unrestricted.
+type TenantIsolation struct {
+	header string
+	label  []byte
+}
+
+// NewTenantIsolation returns the tenant isolation for the configuration, or
+// nil when it is not configured.
+func NewTenantIsolation(cfg *config.TenantIsolationConfiguration) *TenantIsolation {
+	if cfg == nil {
+		return nil
+	}
+	return &TenantIsolation{
+		header: cfg.Header,
+		label:  []byte(cfg.Label),
+	}
+}
+
+// RestrictQuery returns the PromQL query with the tenant matcher ANDed into
+// every vector selector.
+func (t *TenantIsolation) RestrictQuery(r *http.Request, query string) (string, error) {
+	if t == nil {
+		return query, nil
+	}
+	tenant, err := t.tenant(r)
+	if err != nil {
+		return "", err
+	}
+
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", xerrors.NewInvalidParamsError(err)
+	}
+
+	var forbidden error
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		for _, m := range vs.LabelMatchers {
+			forbidden = t.checkMatcher(tenant, m.Type == labels.MatchEqual,
+				[]byte(m.Name), []byte(m.Value))
+			if forbidden != nil {
+				return forbidden
+			}
+		}
+		vs.LabelMatchers = append(vs.LabelMatchers,
+			labels.MustNewMatcher(labels.MatchEqual, string(t.label), string(tenant)))
+		return nil
+	})
+	if forbidden != nil {
+		return "", forbidden
+	}
+	return expr.String(), nil
+}
+
+// RestrictMatchers returns the matchers with the tenant matcher ANDed in,
+// match all matchers are dropped since the tenant matcher replaces them.
+func (t *TenantIsolation) RestrictMatchers(
+	r *http.Request,
+	matchers models.Matchers,
+) (models.Matchers, error) {
+	if t == nil {
+		return matchers, nil
+	}
+	tenant, err := t.tenant(r)
+	if err != nil {
+		return nil, err
+	}
+
+	restricted := make(models.Matchers, 0, len(matchers)+1)
+	for _, m := range matchers {
+		if m.Type == models.MatchAll {
+			continue
+		}
+		if err := t.checkMatcher(tenant, m.Type == models.MatchEqual, m.Name, m.Value); err != nil {
+			return nil, err
+		}
+		restricted = append(restricted, m)
+	}
+	return append(restricted, models.Matcher{
+		Type:  models.MatchEqual,
+		Name:  t.label,
+		Value: tenant,
+	}), nil
+}
+
+// RestrictReadRequest ANDs the tenant matcher into every query of the remote
+// read request.
+func (t *TenantIsolation) RestrictReadRequest(r *http.Request, req *prompb.ReadRequest) error {
+	if t == nil {
+		return nil
+	}
+	tenant, err := t.tenant(r)
+	if err != nil {
+		return err
+	}
+
+	for _, q := range req.Queries {
+		for _, m := range q.Matchers {
+			if err := t.checkMatcher(tenant, m.Type == prompb.LabelMatcher_EQ, m.Name, m.Value); err != nil {
+				return err
+			}
+		}
+		q.Matchers = append(q.Matchers, &prompb.LabelMatcher{
+			Type:  prompb.LabelMatcher_EQ,
+			Name:  t.label,
+			Value: tenant,
+		})
+	}
+	return nil
+}
+
+// tenant returns the requesting tenant, requests without one are forbidden.
+func (t *TenantIsolation) tenant(r *http.Request) ([]byte, error) {
+	tenant := r.Header.Get(t.header)
+	if tenant == "" {
+		return nil, xhttp.NewError(
+			fmt.Errorf("missing tenant header %s", t.header), http.StatusForbidden)
+	}
+	return []byte(tenant), nil
+}
+
+// checkMatcher forbids equality matchers pinning the tenant label to another
+// tenant, any other matcher is narrowed by the tenant matcher.
+func (t *TenantIsolation) checkMatcher(tenant []byte, equal bool, name, value []byte) error {
+	if !equal || !bytes.Equal(name, t.label) || bytes.Equal(value, tenant) {
+		return nil
+	}
+	return xhttp.NewError(fmt.Errorf("query selects %s=%q which is not the requesting tenant",
+		t.label, value), http.StatusForbidden)
+}
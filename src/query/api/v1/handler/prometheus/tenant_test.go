@@ -0,0 +1,150 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+	"github.com/m3db/m3/src/query/generated/proto/prompb"
+	"github.com/m3db/m3/src/query/models"
+	xhttp "github.com/m3db/m3/src/x/net/http"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testTenantHeader = "M3-Tenant"
+
+func newTestTenantIsolation() *TenantIsolation {
+	return NewTenantIsolation(&config.TenantIsolationConfiguration{
+		Header: testTenantHeader,
+		Label:  config.DefaultTenantLabel,
+	})
+}
+
+func newTenantRequest(tenant string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if tenant != "" {
+		req.Header.Set(testTenantHeader, tenant)
+	}
+	return req
+}
+
+func requireForbidden(t *testing.T, err error, msg string) {
+	require.Error(t, err)
+	require.Equal(t, msg, err.Error())
+	require.Equal(t, http.StatusForbidden, xhttp.StatusCode(err))
+}
+
+func TestTenantIsolationNotConfigured(t *testing.T) {
+	ti := NewTenantIsolation(nil)
+	require.Nil(t, ti)
+
+	req := newTenantRequest("")
+	query, err := ti.RestrictQuery(req, `up{tenant="evil"}`)
+	require.NoError(t, err)
+	require.Equal(t, `up{tenant="evil"}`, query)
+
+	matchers := models.Matchers{{Type: models.MatchAll}}
+	restricted, err := ti.RestrictMatchers(req, matchers)
+	require.NoError(t, err)
+	require.Equal(t, matchers, restricted)
+
+	readReq := &prompb.ReadRequest{Queries: []*prompb.Query{{}}}
+	require.NoError(t, ti.RestrictReadRequest(req, readReq))
+	require.Empty(t, readReq.Queries[0].Matchers)
+}
+
+func TestTenantIsolationRestrictQuery(t *testing.T) {
+	ti := newTestTenantIsolation()
+
+	query, err := ti.RestrictQuery(newTenantRequest("acme"), `sum(up) / count(up{tenant="acme"})`)
+	require.NoError(t, err)
+	require.Equal(t, `sum(up{tenant="acme"}) / count(up{tenant="acme",tenant="acme"})`, query)
+
+	_, err = ti.RestrictQuery(newTenantRequest(""), `up`)
+	requireForbidden(t, err, "missing tenant header M3-Tenant")
+
+	_, err = ti.RestrictQuery(newTenantRequest("acme"), `up or secrets{tenant="evil"}`)
+	requireForbidden(t, err, `query selects tenant="evil" which is not the requesting tenant`)
+}
+
+func TestTenantIsolationRestrictMatchers(t *testing.T) {
+	ti := newTestTenantIsolation()
+	tenantMatcher := models.Matcher{Type: models.MatchEqual, Name: []byte("tenant"), Value: []byte("acme")}
+
+	restricted, err := ti.RestrictMatchers(newTenantRequest("acme"), models.Matchers{{Type: models.MatchAll}})
+	require.NoError(t, err)
+	require.Equal(t, models.Matchers{tenantMatcher}, restricted)
+
+	job := models.Matcher{Type: models.MatchEqual, Name: []byte("job"), Value: []byte("api")}
+	notTenant := models.Matcher{Type: models.MatchNotEqual, Name: []byte("tenant"), Value: []byte("evil")}
+	restricted, err = ti.RestrictMatchers(newTenantRequest("acme"), models.Matchers{job, notTenant})
+	require.NoError(t, err)
+	require.Equal(t, models.Matchers{job, notTenant, tenantMatcher}, restricted)
+
+	_, err = ti.RestrictMatchers(newTenantRequest(""), models.Matchers{job})
+	requireForbidden(t, err, "missing tenant header M3-Tenant")
+
+	evil := models.Matcher{Type: models.MatchEqual, Name: []byte("tenant"), Value: []byte("evil")}
+	_, err = ti.RestrictMatchers(newTenantRequest("acme"), models.Matchers{job, evil})
+	requireForbidden(t, err, `query selects tenant="evil" which is not the requesting tenant`)
+}
+
+func TestTenantIsolationRestrictReadRequest(t *testing.T) {
+	ti := newTestTenantIsolation()
+	tenantMatcher := &prompb.LabelMatcher{
+		Type:  prompb.LabelMatcher_EQ,
+		Name:  []byte("tenant"),
+		Value: []byte("acme"),
+	}
+	up := &prompb.LabelMatcher{
+		Type:  prompb.LabelMatcher_EQ,
+		Name:  []byte("__name__"),
+		Value: []byte("up"),
+	}
+
+	req := &prompb.ReadRequest{Queries: []*prompb.Query{
+		{Matchers: []*prompb.LabelMatcher{up}},
+		{Matchers: []*prompb.LabelMatcher{up}},
+	}}
+	require.NoError(t, ti.RestrictReadRequest(newTenantRequest("acme"), req))
+	for _, q := range req.Queries {
+		require.Equal(t, []*prompb.LabelMatcher{up, tenantMatcher}, q.Matchers)
+	}
+
+	req = &prompb.ReadRequest{Queries: []*prompb.Query{{Matchers: []*prompb.LabelMatcher{up}}}}
+	err := ti.RestrictReadRequest(newTenantRequest(""), req)
+	requireForbidden(t, err, "missing tenant header M3-Tenant")
+
+	req = &prompb.ReadRequest{Queries: []*prompb.Query{
+		{Matchers: []*prompb.LabelMatcher{up}},
+		{Matchers: []*prompb.LabelMatcher{up, {
+			Type:  prompb.LabelMatcher_EQ,
+			Name:  []byte("tenant"),
+			Value: []byte("evil"),
+		}}},
+	}}
+	err = ti.RestrictReadRequest(newTenantRequest("acme"), req)
+	requireForbidden(t, err, `query selects tenant="evil" which is not the requesting tenant`)
+}
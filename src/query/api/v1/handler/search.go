@@ -27,6 +27,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/m3db/m3/src/query/api/v1/handler/prometheus"
 	"github.com/m3db/m3/src/query/api/v1/handler/prometheus/handleroptions"
 	"github.com/m3db/m3/src/query/api/v1/options"
 	"github.com/m3db/m3/src/query/errors"
@@ -54,6 +55,7 @@ type SearchHandler struct {
 	store               storage.Storage
 	fetchOptionsBuilder handleroptions.FetchOptionsBuilder
 	instrumentOpts      instrument.Options
+	tenantIsolation     *prometheus.TenantIsolation
 }
 
 // NewSearchHandler returns a new instance of handler
@@ -62,6 +64,7 @@ func NewSearchHandler(opts options.HandlerOptions) http.Handler {
 		store:               opts.Storage(),
 		fetchOptionsBuilder: opts.FetchOptionsBuilder(),
 		instrumentOpts:      opts.InstrumentOpts(),
+		tenantIsolation:     prometheus.NewTenantIsolation(opts.Config().TenantIsolation),
 	}
 }
 
@@ -76,6 +79,12 @@ func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteError(w, err)
 		return
 	}
+	tagMatchers, err := h.tenantIsolation.RestrictMatchers(r, query.TagMatchers)
+	if err != nil {
+		xhttp.WriteError(w, err)
+		return
+	}
+	query.TagMatchers = tagMatchers
 
 	results, err := h.search(ctx, query, fetchOpts)
 	if err != nil {
@@ -175,7 +175,7 @@ func (h *Handler) RegisterRoutes() error {
 		Path:               native.PromReadURL,
 		Handler:            h.options.QueryRouter(),
 		Methods:            native.PromReadHTTPMethods,
-		MiddlewareOverride: native.WithRangeQueryParamsAndRangeRewriting,
+		MiddlewareOverride: h.withHandlerCORS(native.WithRangeQueryParamsAndRangeRewriting),
 	}); err != nil {
 		return err
 	}
@@ -183,7 +183,7 @@ func (h *Handler) RegisterRoutes() error {
 		Path:               native.PromReadInstantURL,
 		Handler:            h.options.InstantQueryRouter(),
 		Methods:            native.PromReadInstantHTTPMethods,
-		MiddlewareOverride: native.WithInstantQueryParamsAndRangeRewriting,
+		MiddlewareOverride: h.withHandlerCORS(native.WithInstantQueryParamsAndRangeRewriting),
 	}); err != nil {
 		return err
 	}
@@ -193,7 +193,7 @@ func (h *Handler) RegisterRoutes() error {
 		Path:               "/prometheus" + native.PromReadURL,
 		Handler:            promqlQueryHandler,
 		Methods:            native.PromReadHTTPMethods,
-		MiddlewareOverride: native.WithRangeQueryParamsAndRangeRewriting,
+		MiddlewareOverride: h.withHandlerCORS(native.WithRangeQueryParamsAndRangeRewriting),
 	}); err != nil {
 		return err
 	}
@@ -201,11 +201,31 @@ func (h *Handler) RegisterRoutes() error {
 		Path:               "/prometheus" + native.PromReadInstantURL,
 		Handler:            promqlInstantQueryHandler,
 		Methods:            native.PromReadInstantHTTPMethods,
-		MiddlewareOverride: native.WithInstantQueryParamsAndRangeRewriting,
+		MiddlewareOverride: h.withHandlerCORS(native.WithInstantQueryParamsAndRangeRewriting),
 	}); err != nil {
 		return err
 	}
 
+	// CORS preflight requests are answered by the Prometheus handlers, without
+	// the query middleware since they carry no query.
+	if len(h.options.CORSAllowedOrigins()) > 0 {
+		for path, handler := range map[string]http.Handler{
+			native.PromReadURL:                        promqlQueryHandler,
+			native.PromReadInstantURL:                 promqlInstantQueryHandler,
+			"/prometheus" + native.PromReadURL:        promqlQueryHandler,
+			"/prometheus" + native.PromReadInstantURL: promqlInstantQueryHandler,
+		} {
+			if err := h.registry.Register(queryhttp.RegisterOptions{
+				Path:               path,
+				Handler:            handler,
+				Methods:            methods(http.MethodOptions),
+				MiddlewareOverride: h.withHandlerCORS(nil),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
 	// M3Query endpoints.
 	if err := h.registry.Register(queryhttp.RegisterOptions{
 		Path:               "/m3query" + native.PromReadURL,
@@ -511,6 +531,22 @@ func (h *Handler) RegisterRoutes() error {
 	return nil
 }
 
+// withHandlerCORS disables the allow all CORS middleware of the route when CORS
+// origins are configured, since the Prometheus handlers then set CORS headers
+// for the allowed origins only.
+func (h *Handler) withHandlerCORS(override middleware.OverrideOptions) middleware.OverrideOptions {
+	if len(h.options.CORSAllowedOrigins()) == 0 {
+		return override
+	}
+	return func(opts middleware.Options) middleware.Options {
+		if override != nil {
+			opts = override(opts)
+		}
+		opts.Cors.Disabled = true
+		return opts
+	}
+}
+
 func (h *Handler) placementOpts() (placementhandler.HandlerOptions, error) {
 	return placementhandler.NewHandlerOptions(
 		h.options.ClusterClient(),
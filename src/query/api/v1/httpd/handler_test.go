@@ -227,6 +227,39 @@ func TestPromNativeReadPost(t *testing.T) {
 	}
 }
 
+func TestPromReadCORSPreflight(t *testing.T) {
+	for _, url := range []string{
+		native.PromReadURL,
+		native.PromReadInstantURL,
+		"/prometheus" + native.PromReadURL,
+		"/prometheus" + native.PromReadInstantURL,
+	} {
+		t.Run("Testing endpoint OPTIONS "+url, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storage, _ := m3.NewStorageAndSession(t, ctrl)
+			h, err := setupHandler(storage)
+			require.NoError(t, err, "unable to setup handler")
+			h.RegisterRoutes()
+			req := httptest.NewRequest(http.MethodOptions, url, nil)
+			req.Header.Set("Origin", "https://dashboards.example.com")
+			res := httptest.NewRecorder()
+			h.Router().ServeHTTP(res, req)
+			require.Equal(t, http.StatusMethodNotAllowed, res.Code, "CORS disabled")
+
+			h, err = setupHandler(storage)
+			require.NoError(t, err, "unable to setup handler")
+			h.options = h.options.SetCORSAllowedOrigins([]string{"https://dashboards.example.com"})
+			h.RegisterRoutes()
+			res = httptest.NewRecorder()
+			h.Router().ServeHTTP(res, req)
+			require.Equal(t, http.StatusNoContent, res.Code)
+			require.Equal(t, "https://dashboards.example.com", res.Header().Get("Access-Control-Allow-Origin"))
+			// The allow all CORS middleware is disabled for the route.
+			require.Equal(t, "GET, POST", res.Header().Get("Access-Control-Allow-Methods"))
+		})
+	}
+}
+
 func TestJSONWritePost(t *testing.T) {
 	req := httptest.NewRequest("POST", m3json.WriteJSONURL, nil)
 	res := httptest.NewRecorder()
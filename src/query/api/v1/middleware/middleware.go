@@ -48,6 +48,13 @@ type Options struct {
 	Metrics                MetricsOptions
 	Source                 SourceOptions
 	PrometheusRangeRewrite PrometheusRangeRewriteOptions
+	Cors                   CorsOptions
+}
+
+// CorsOptions are the options for the Cors middleware.
+type CorsOptions struct {
+	// Disabled skips the middleware for handlers setting their own CORS headers.
+	Disabled bool
 }
 
 // OverrideOptions is a function that returns new Options from the provided Options.
@@ -58,7 +65,7 @@ type OverrideOptions func(opts Options) Options
 func Default(opts Options) []mux.MiddlewareFunc {
 	// The order of middleware is important. Be very careful when reordering existing middleware.
 	return []mux.MiddlewareFunc{
-		Cors(),
+		corsOrDisabled(opts.Cors),
 		// install tracing before logging so the trace_id is available for response logging.
 		Tracing(opentracing.GlobalTracer(), opts.InstrumentOpts),
 		// install source before logging so the source is available for response logging.
@@ -85,6 +92,15 @@ func Cors() mux.MiddlewareFunc {
 	}
 }
 
+func corsOrDisabled(opts CorsOptions) mux.MiddlewareFunc {
+	if opts.Disabled {
+		return func(base http.Handler) http.Handler {
+			return base
+		}
+	}
+	return Cors()
+}
+
 // Compression adds suitable response compression based on the client's Accept-Encoding headers.
 func Compression() mux.MiddlewareFunc {
 	return func(base http.Handler) http.Handler {
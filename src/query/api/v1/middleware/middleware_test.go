@@ -103,6 +103,20 @@ func TestCors(t *testing.T) {
 	assert.Equal(t, "*", res.Header().Get("Access-Control-Allow-Origin"))
 }
 
+func TestCorsDisabled(t *testing.T) {
+	router := mux.NewRouter()
+	setupTestRouteRouter(router)
+
+	router.Use(corsOrDisabled(CorsOptions{Disabled: true}))
+
+	req := httptest.NewRequest("GET", testRoute, nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, "hello!", res.Body.String())
+	assert.Empty(t, res.Header().Get("Access-Control-Allow-Origin"))
+}
+
 const testRoute = "/foobar"
 
 func setupTestRouteRouter(r *mux.Router) {
@@ -286,7 +286,71 @@ type HandlerOptions interface {
 	ShadowQueryURL() string
 
 	QueryShadowingWorkers() int
-}
+
+	// ShadowQuerySubmitStrategy returns how shadow queries are submitted when
+	// all the shadowing workers are busy.
+	ShadowQuerySubmitStrategy() config.ShadowQuerySubmitStrategy
+	// SetShadowQuerySubmitStrategy sets how shadow queries are submitted when
+	// all the shadowing workers are busy.
+	SetShadowQuerySubmitStrategy(value config.ShadowQuerySubmitStrategy) HandlerOptions
+
+	// ShadowQuerySubmitTimeout returns how long the blockWithTimeout strategy waits for a worker.
+	ShadowQuerySubmitTimeout() time.Duration
+	// SetShadowQuerySubmitTimeout sets how long the blockWithTimeout strategy waits for a worker.
+	SetShadowQuerySubmitTimeout(value time.Duration) HandlerOptions
+
+	// ShadowQueryOverflowQueueSize returns the size of the overflowQueue strategy queue.
+	ShadowQueryOverflowQueueSize() int
+	// SetShadowQueryOverflowQueueSize sets the size of the overflowQueue strategy queue.
+	SetShadowQueryOverflowQueueSize(value int) HandlerOptions
+
+	// ShadowQueryClientTimeout returns the timeout of shadow query requests.
+	ShadowQueryClientTimeout() time.Duration
+	// SetShadowQueryClientTimeout sets the timeout of shadow query requests.
+	SetShadowQueryClientTimeout(value time.Duration) HandlerOptions
+
+	// ShadowQueryMaxConns returns the max connections to the shadow query URL.
+	ShadowQueryMaxConns() int
+	// SetShadowQueryMaxConns sets the max connections to the shadow query URL.
+	SetShadowQueryMaxConns(value int) HandlerOptions
+
+	// CORSAllowedOrigins returns the origins allowed to query from a browser.
+	CORSAllowedOrigins() []string
+	// SetCORSAllowedOrigins sets the origins allowed to query from a browser.
+	SetCORSAllowedOrigins(value []string) HandlerOptions
+
+	// CORSAllowedMethods returns the methods allowed in CORS preflight responses.
+	CORSAllowedMethods() []string
+	// SetCORSAllowedMethods sets the methods allowed in CORS preflight responses.
+	SetCORSAllowedMethods(value []string) HandlerOptions
+
+	// CORSAllowedHeaders returns the headers allowed in CORS preflight responses.
+	CORSAllowedHeaders() []string
+	// SetCORSAllowedHeaders sets the headers allowed in CORS preflight responses.
+	SetCORSAllowedHeaders(value []string) HandlerOptions
+
+	// LimitsResolver returns the resolver for per request returned data limits.
+	LimitsResolver() LimitsResolver
+	// SetLimitsResolver sets the resolver for per request returned data limits.
+	SetLimitsResolver(value LimitsResolver) HandlerOptions
+
+	// MaxQueryRangeResolver returns the resolver for the per request max query range.
+	MaxQueryRangeResolver() MaxQueryRangeResolver
+	// SetMaxQueryRangeResolver sets the resolver for the per request max query range.
+	SetMaxQueryRangeResolver(value MaxQueryRangeResolver) HandlerOptions
+}
+
+// LimitsResolver resolves the returned series and datapoints limits for a
+// request, e.g. from a tenant identity header, overriding the limits from
+// the fetch options. Zero means no limit and a negative value keeps the
+// configured limit.
+type LimitsResolver func(r *http.Request) (series, datapoints int)
+
+// MaxQueryRangeResolver resolves the max time range of a range query for a
+// request, e.g. from a tenant identity header, overriding the configured max
+// query range. Zero means no limit and a negative value keeps the configured
+// max.
+type MaxQueryRangeResolver func(r *http.Request) time.Duration
 
 // HandlerOptions represents handler options.
 type handlerOptions struct {
@@ -322,6 +386,16 @@ type handlerOptions struct {
 	defaultLookback                   time.Duration
 	shadowQueryURL                    string
 	queryShadowingWorkers             int
+	shadowQuerySubmitStrategy         config.ShadowQuerySubmitStrategy
+	shadowQuerySubmitTimeout          time.Duration
+	shadowQueryOverflowQueueSize      int
+	shadowQueryClientTimeout          time.Duration
+	shadowQueryMaxConns               int
+	corsAllowedOrigins                []string
+	corsAllowedMethods                []string
+	corsAllowedHeaders                []string
+	limitsResolver                    LimitsResolver
+	maxQueryRangeResolver             MaxQueryRangeResolver
 }
 
 // EmptyHandlerOptions returns  default handler options.
@@ -396,6 +470,20 @@ func NewHandlerOptions(
 	if cfg.QueryShadowing != nil {
 		opts.shadowQueryURL = cfg.QueryShadowing.ShadowQueryURL
 		opts.queryShadowingWorkers = cfg.QueryShadowing.QueryShadowingWorkers
+		opts.shadowQuerySubmitStrategy = cfg.QueryShadowing.SubmitStrategy
+		if cfg.QueryShadowing.SubmitTimeout != nil {
+			opts.shadowQuerySubmitTimeout = *cfg.QueryShadowing.SubmitTimeout
+		}
+		opts.shadowQueryOverflowQueueSize = cfg.QueryShadowing.OverflowQueueSize
+		if cfg.QueryShadowing.ClientTimeout != nil {
+			opts.shadowQueryClientTimeout = *cfg.QueryShadowing.ClientTimeout
+		}
+		opts.shadowQueryMaxConns = cfg.QueryShadowing.MaxConns
+	}
+	if cfg.CORS != nil {
+		opts.corsAllowedOrigins = cfg.CORS.AllowedOrigins
+		opts.corsAllowedMethods = cfg.CORS.AllowedMethods
+		opts.corsAllowedHeaders = cfg.CORS.AllowedHeaders
 	}
 	return opts, nil
 }
@@ -732,5 +820,105 @@ func (o *handlerOptions) QueryShadowingWorkers() int {
 	return o.queryShadowingWorkers
 }
 
+func (o *handlerOptions) ShadowQuerySubmitStrategy() config.ShadowQuerySubmitStrategy {
+	return o.shadowQuerySubmitStrategy
+}
+
+func (o *handlerOptions) SetShadowQuerySubmitStrategy(value config.ShadowQuerySubmitStrategy) HandlerOptions {
+	opts := *o
+	opts.shadowQuerySubmitStrategy = value
+	return &opts
+}
+
+func (o *handlerOptions) ShadowQuerySubmitTimeout() time.Duration {
+	return o.shadowQuerySubmitTimeout
+}
+
+func (o *handlerOptions) SetShadowQuerySubmitTimeout(value time.Duration) HandlerOptions {
+	opts := *o
+	opts.shadowQuerySubmitTimeout = value
+	return &opts
+}
+
+func (o *handlerOptions) ShadowQueryOverflowQueueSize() int {
+	return o.shadowQueryOverflowQueueSize
+}
+
+func (o *handlerOptions) SetShadowQueryOverflowQueueSize(value int) HandlerOptions {
+	opts := *o
+	opts.shadowQueryOverflowQueueSize = value
+	return &opts
+}
+
+func (o *handlerOptions) ShadowQueryClientTimeout() time.Duration {
+	return o.shadowQueryClientTimeout
+}
+
+func (o *handlerOptions) SetShadowQueryClientTimeout(value time.Duration) HandlerOptions {
+	opts := *o
+	opts.shadowQueryClientTimeout = value
+	return &opts
+}
+
+func (o *handlerOptions) ShadowQueryMaxConns() int {
+	return o.shadowQueryMaxConns
+}
+
+func (o *handlerOptions) SetShadowQueryMaxConns(value int) HandlerOptions {
+	opts := *o
+	opts.shadowQueryMaxConns = value
+	return &opts
+}
+
+func (o *handlerOptions) CORSAllowedOrigins() []string {
+	return o.corsAllowedOrigins
+}
+
+func (o *handlerOptions) SetCORSAllowedOrigins(value []string) HandlerOptions {
+	opts := *o
+	opts.corsAllowedOrigins = value
+	return &opts
+}
+
+func (o *handlerOptions) CORSAllowedMethods() []string {
+	return o.corsAllowedMethods
+}
+
+func (o *handlerOptions) SetCORSAllowedMethods(value []string) HandlerOptions {
+	opts := *o
+	opts.corsAllowedMethods = value
+	return &opts
+}
+
+func (o *handlerOptions) CORSAllowedHeaders() []string {
+	return o.corsAllowedHeaders
+}
+
+func (o *handlerOptions) SetCORSAllowedHeaders(value []string) HandlerOptions {
+	opts := *o
+	opts.corsAllowedHeaders = value
+	return &opts
+}
+
+func (o *handlerOptions) LimitsResolver() LimitsResolver {
+	return o.limitsResolver
+}
+
+func (o *handlerOptions) SetLimitsResolver(value LimitsResolver) HandlerOptions {
+	opts := *o
+	opts.limitsResolver = value
+	return &opts
+}
+
+func (o *handlerOptions) MaxQueryRangeResolver() MaxQueryRangeResolver {
+	return o.maxQueryRangeResolver
+}
+
+func (o *handlerOptions) SetMaxQueryRangeResolver(value MaxQueryRangeResolver) HandlerOptions {
+	opts := *o
+	opts.maxQueryRangeResolver = value
+	return &opts
+}
+
 // KVStoreProtoParser parses protobuf messages based off specific keys.
 type KVStoreProtoParser func(key string) (protoiface.MessageV1, error)
@@ -142,6 +142,31 @@ type ResultMetadata struct {
 	// MetricNames is the set of unique metric tag name values across all series in this result.
 	// External users must access via `ByName(name)`.
 	metadataByName map[string]*ResultMetricMetadata
+	// Selectors is the per-selector fetch stats of this result, in the order
+	// the selectors were fetched.
+	Selectors []SelectorStats
+}
+
+// SelectorStats is the fetch stats of a single selector of a query.
+type SelectorStats struct {
+	// Matchers is the string representation of the selector's matcher set.
+	Matchers string
+	// FetchedSeriesCount is the number of series fetched by the selector.
+	FetchedSeriesCount int
+}
+
+// HeaviestSelectors returns at most n selectors of the result, ordered by
+// descending fetched series count.
+func (m ResultMetadata) HeaviestSelectors(n int) []SelectorStats {
+	selectors := make([]SelectorStats, len(m.Selectors))
+	copy(selectors, m.Selectors)
+	sort.SliceStable(selectors, func(i, j int) bool {
+		return selectors[i].FetchedSeriesCount > selectors[j].FetchedSeriesCount
+	})
+	if len(selectors) > n {
+		selectors = selectors[:n]
+	}
+	return selectors
 }
 
 // AddNamespace adds a namespace to the namespace set, initializing the underlying map if necessary.
@@ -262,6 +287,18 @@ func combineWarnings(a, b Warnings) Warnings {
 	return nil
 }
 
+func combineSelectors(a, b []SelectorStats) []SelectorStats {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	combined := make([]SelectorStats, 0, len(a)+len(b))
+	combined = append(combined, a...)
+	return append(combined, b...)
+}
+
 func combineNamespaces(a, b map[string]struct{}) map[string]struct{} {
 	if a == nil {
 		return b
@@ -351,6 +388,7 @@ func (m ResultMetadata) CombineMetadata(other ResultMetadata) ResultMetadata {
 		FetchedSeriesCount:   m.FetchedSeriesCount + other.FetchedSeriesCount,
 		metadataByName:       combineMetricMetadata(m.metadataByName, other.metadataByName),
 		FetchedMetadataCount: m.FetchedMetadataCount + other.FetchedMetadataCount,
+		Selectors:            combineSelectors(m.Selectors, other.Selectors),
 	}
 }
 
@@ -169,6 +169,26 @@ func TestMergeIntoEmptyWarnings(t *testing.T) {
 	assert.Equal(t, "foo_bar", merge.Warnings[0].Header())
 }
 
+func TestCombineSelectors(t *testing.T) {
+	r := NewResultMetadata()
+	r.Selectors = []SelectorStats{{Matchers: `{__name__="a"}`, FetchedSeriesCount: 2}}
+	rTwo := NewResultMetadata()
+	rTwo.Selectors = []SelectorStats{
+		{Matchers: `{__name__="b"}`, FetchedSeriesCount: 5},
+		{Matchers: `{__name__="c"}`, FetchedSeriesCount: 1},
+	}
+
+	merge := r.CombineMetadata(rTwo)
+	require.Equal(t, 3, len(merge.Selectors))
+	assert.Equal(t, 1, len(r.Selectors))
+	assert.Equal(t, []SelectorStats{
+		{Matchers: `{__name__="b"}`, FetchedSeriesCount: 5},
+		{Matchers: `{__name__="a"}`, FetchedSeriesCount: 2},
+	}, merge.HeaviestSelectors(2))
+	assert.Equal(t, 3, len(merge.HeaviestSelectors(10)))
+	assert.Equal(t, `{__name__="a"}`, merge.Selectors[0].Matchers)
+}
+
 func TestMergeResolutions(t *testing.T) {
 	expected := []time.Duration{1, 2, 3}
 	r := ResultMetadata{}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/m3db/m3/src/query/api/v1/middleware"
+	"github.com/m3db/m3/src/query/api/v1/options"
+	"github.com/m3db/m3/src/query/storage/promremote"
+
+	"go.uber.org/zap"
+)
+
+// promRemoteDebugHandler registers the prom remote pending write queues
+// debug endpoint as a custom handler.
+type promRemoteDebugHandler struct {
+	reporter promremote.QueueStatsReporter
+	logger   *zap.Logger
+}
+
+func newPromRemoteDebugHandler(
+	reporter promremote.QueueStatsReporter,
+	logger *zap.Logger,
+) options.CustomHandler {
+	return &promRemoteDebugHandler{reporter: reporter, logger: logger}
+}
+
+func (h *promRemoteDebugHandler) Route() string {
+	return promremote.DebugURL
+}
+
+func (h *promRemoteDebugHandler) Methods() []string {
+	return []string{promremote.DebugMethod}
+}
+
+func (h *promRemoteDebugHandler) Handler(
+	_ options.HandlerOptions,
+	_ http.Handler,
+) (http.Handler, error) {
+	return promremote.NewDebugHandler(h.reporter, h.logger), nil
+}
+
+func (h *promRemoteDebugHandler) MiddlewareOverride() middleware.OverrideOptions {
+	return nil
+}
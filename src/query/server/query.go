@@ -170,6 +170,11 @@ type RunOptions struct {
 
 	// ApplyCustomRuleStore provides an option to swap the backend used for the rule stores.
 	ApplyCustomRuleStore downsample.CustomRuleStoreFn
+
+	// PromRemoteClosePolicyFn is an optional shutdown hook called once the
+	// server is interrupted, it overrides the configured close policy of the
+	// prom remote storage, e.g. to exit fast on SIGTERM.
+	PromRemoteClosePolicyFn PromRemoteClosePolicyFn
 }
 
 // InstrumentOptionsReady is a set of instrument options
@@ -192,6 +197,10 @@ type BackendStorageTransformFn func(
 	instrument.Options,
 ) (storage.Storage, error)
 
+// PromRemoteClosePolicyFn returns how the prom remote storage handles its
+// pending writes when closed on shutdown.
+type PromRemoteClosePolicyFn func() promremote.ClosePolicy
+
 // RunResult returns metadata about the process run.
 type RunResult struct {
 	MultiProcessRun               bool
@@ -478,6 +487,7 @@ func Run(runOpts RunOptions) RunResult {
 		if err != nil {
 			logger.Fatal("invalid configuration", zap.Error(err))
 		}
+		opts = opts.SetTracer(instrumentOptions.Tracer())
 		promRemoteStorage, err = promremote.NewStorage(opts)
 		if err != nil {
 			logger.Fatal("unable to setup prom remote backend", zap.Error(err))
@@ -540,10 +550,12 @@ func Run(runOpts RunOptions) RunResult {
 		if err != nil {
 			logger.Fatal("invalid configuration", zap.Error(err))
 		}
+		opts = opts.SetTracer(instrumentOptions.Tracer())
 		backendStorage, err = promremote.NewStorage(opts)
 		if err != nil {
 			logger.Fatal("unable to setup prom remote backend", zap.Error(err))
 		}
+		promRemoteStorage = backendStorage
 		defer func() {
 			if err := backendStorage.Close(); err != nil {
 				logger.Error("error when closing storage", zap.Error(err))
@@ -716,6 +728,9 @@ func Run(runOpts RunOptions) RunResult {
 	}
 
 	customHandlers := customHandlerOpts.CustomHandlers
+	if reporter, ok := promRemoteStorage.(promremote.QueueStatsReporter); ok {
+		customHandlers = append(customHandlers, newPromRemoteDebugHandler(reporter, logger))
+	}
 	handler := httpd.NewHandler(handlerOptions, cfg.Middleware, customHandlers...)
 	if err := handler.RegisterRoutes(); err != nil {
 		logger.Fatal("unable to register routes", zap.Error(err))
@@ -804,6 +819,13 @@ func Run(runOpts RunOptions) RunResult {
 		xos.WaitForInterrupt(logger, interruptOpts)
 	}
 
+	// The storages are closed by the deferred funcs, after the close policy is set.
+	if fn := runOpts.PromRemoteClosePolicyFn; fn != nil {
+		if setter, ok := promRemoteStorage.(promremote.ClosePolicySetter); ok {
+			setter.SetClosePolicy(fn())
+		}
+	}
+
 	return runResult
 }
 
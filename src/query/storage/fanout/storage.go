@@ -143,6 +143,10 @@ func (s *fanoutStorage) FetchProm(
 		wg         sync.WaitGroup
 		multiErr   xerrors.MultiError
 		numWarning int
+		numResults int
+		// timeoutErr is set when all the stores that errored timed out.
+		timeoutErr   error
+		onlyTimeouts = true
 	)
 
 	wg.Add(len(stores))
@@ -176,6 +180,11 @@ func (s *fanoutStorage) FetchProm(
 				warning, err := storage.IsWarning(store, err)
 				if !warning {
 					multiErr = multiErr.Add(err)
+					if onlyTimeouts && errors.IsTimeout(err) {
+						timeoutErr = err
+					} else {
+						onlyTimeouts, timeoutErr = false, nil
+					}
 					s.instrumentOpts.Logger().Error(
 						"fanout to store returned error",
 						zap.Error(err),
@@ -201,6 +210,7 @@ func (s *fanoutStorage) FetchProm(
 				return
 			}
 
+			numResults++
 			for _, r := range storeResult.Results() {
 				accumulator.Add(r)
 			}
@@ -211,7 +221,16 @@ func (s *fanoutStorage) FetchProm(
 	// NB: Check multiError first; if any hard error storages errored, the entire
 	// query must be errored.
 	if err := multiErr.FinalError(); err != nil {
-		return storage.PromResult{}, err
+		if timeoutErr == nil || numResults == 0 {
+			return storage.PromResult{}, err
+		}
+		// The series of the other stores are returned along with the timeout
+		// error, the callers may use them as a partial result.
+		result, convertErr := s.promResult(ctx, accumulator, options)
+		if convertErr != nil {
+			return storage.PromResult{}, err
+		}
+		return result, timeoutErr
 	}
 
 	// If there were no successful results at all, return a normal error.
@@ -219,6 +238,14 @@ func (s *fanoutStorage) FetchProm(
 		return storage.PromResult{}, errors.ErrNoValidResults
 	}
 
+	return s.promResult(ctx, accumulator, options)
+}
+
+func (s *fanoutStorage) promResult(
+	ctx context.Context,
+	accumulator consolidators.MultiFetchResult,
+	options *storage.FetchOptions,
+) (storage.PromResult, error) {
 	result, attrs, err := accumulator.FinalResultWithAttrs()
 	if err != nil {
 		return storage.PromResult{}, err
@@ -576,6 +576,70 @@ func TestFanoutFetchErrorContinues(t *testing.T) {
 	require.Equal(t, 2, len(series))
 }
 
+func TestFanoutFetchPromTimeoutReturnsPartialResult(t *testing.T) {
+	timeoutErr := fmt.Errorf("fetch timed out: %w", context.DeadlineExceeded)
+	tests := []struct {
+		name          string
+		errs          []error
+		expectedErr   error
+		expectedCount int
+	}{
+		{
+			name:          "timeout",
+			errs:          []error{timeoutErr},
+			expectedErr:   timeoutErr,
+			expectedCount: 1,
+		},
+		{
+			name:        "timeout and other error",
+			errs:        []error{timeoutErr, errors.New("e")},
+			expectedErr: errors.New("e"),
+		},
+		{
+			name:        "other error",
+			errs:        []error{errors.New("e")},
+			expectedErr: errors.New("e"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := xtest.NewController(t)
+			defer ctrl.Finish()
+
+			filter := func(_ storage.Query, _ storage.Storage) bool { return true }
+			tFilter := func(_ storage.CompleteTagsQuery, _ storage.Storage) bool { return true }
+
+			okStore := storage.NewMockStorage(ctrl)
+			okStore.EXPECT().FetchCompressed(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(fetchResult("ok"), nil)
+			okStore.EXPECT().Type().Return(storage.TypeLocalDC).AnyTimes()
+			okStore.EXPECT().Name().Return("ok").AnyTimes()
+			okStore.EXPECT().ErrorBehavior().Return(storage.BehaviorFail).AnyTimes()
+			stores := []storage.Storage{okStore}
+			for i, err := range tt.errs {
+				errStore := storage.NewMockStorage(ctrl)
+				errStore.EXPECT().FetchCompressed(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, err)
+				errStore.EXPECT().ErrorBehavior().Return(storage.BehaviorFail).AnyTimes()
+				errStore.EXPECT().Name().Return(fmt.Sprintf("err%d", i)).AnyTimes()
+				errStore.EXPECT().Type().Return(storage.TypeLocalDC).AnyTimes()
+				stores = append(stores, errStore)
+			}
+
+			store := NewStorage(stores, filter, filter, tFilter,
+				models.NewTagOptions(), storagem3.NewOptions(encoding.NewOptions()),
+				instrument.NewOptions())
+			opts := storage.NewFetchOptions()
+			opts.SeriesLimit = 300
+			result, err := store.FetchProm(context.TODO(), &storage.FetchQuery{}, opts)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedErr.Error())
+			assert.Equal(t, tt.expectedCount > 0, errs.IsTimeout(err))
+			assert.Len(t, result.PromResult.GetTimeseries(), tt.expectedCount)
+		})
+	}
+}
+
 func fetchResult(name string) consolidators.MultiFetchResult {
 	it, _ := test.BuildTestSeriesIterator(name)
 	iters := encoding.NewSeriesIterators([]encoding.SeriesIterator{it})
@@ -37,6 +37,10 @@ const (
 
 	// BlockResultMetadataFnKey is the context key for a function to receive block metadata results.
 	BlockResultMetadataFnKey ContextKey = "block-meta-result-fn"
+
+	// PartialResultsOnTimeoutContextKey is the context key enabling partial
+	// results when the storage times out.
+	PartialResultsOnTimeoutContextKey ContextKey = "partial-results-on-timeout"
 )
 
 // RemoteReadFlags is a set of flags for storage remote read requests.
@@ -52,6 +56,11 @@ func fetchOptions(ctx context.Context) (*storage.FetchOptions, error) {
 	return nil, errors.New("fetch options not available")
 }
 
+func partialResultsOnTimeout(ctx context.Context) bool {
+	enabled, _ := ctx.Value(PartialResultsOnTimeoutContextKey).(bool)
+	return enabled
+}
+
 func resultMetadataReceiveFn(ctx context.Context) (func(m block.ResultMetadata), error) {
 	value := ctx.Value(BlockResultMetadataFnKey)
 	if v, ok := value.(func(m block.ResultMetadata)); ok {
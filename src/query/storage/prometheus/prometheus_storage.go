@@ -34,6 +34,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/m3db/m3/src/query/block"
+	queryerrors "github.com/m3db/m3/src/query/errors"
 	"github.com/m3db/m3/src/query/generated/proto/prompb"
 	"github.com/m3db/m3/src/query/models"
 	"github.com/m3db/m3/src/query/parser/promql"
@@ -76,6 +77,24 @@ func (e *StorageErr) Error() string {
 	return e.inner.Error()
 }
 
+// PartialResultWarning is added to the result metadata when the storage timed
+// out and the series fetched until then are returned instead of an error.
+var PartialResultWarning = block.Warning{
+	Name:    "m3query",
+	Message: "partial_result_storage_timeout",
+}
+
+// IsPartialResult returns true if the result metadata is that of a partial
+// result returned on a storage timeout.
+func IsPartialResult(meta block.ResultMetadata) bool {
+	for _, warning := range meta.Warnings {
+		if warning == PartialResultWarning {
+			return true
+		}
+	}
+	return false
+}
+
 // NewPrometheusQueryable returns a new prometheus queryable backed by a m3
 // storage.
 func NewPrometheusQueryable(opts PrometheusOptions) promstorage.Queryable {
@@ -138,10 +157,23 @@ func (q *querier) Select(
 	}
 
 	result, err := q.storage.FetchProm(q.ctx, query, fetchOptions)
+	partial := false
 	if err != nil {
-		return promstorage.ErrSeriesSet(NewStorageErr(err))
+		// NB: storages may return the series fetched before timing out along
+		// with the error, e.g. the fanout storage returns those of the stores
+		// that did not time out. They are only used if partial results are enabled.
+		if !queryerrors.IsTimeout(err) || result.PromResult == nil || !partialResultsOnTimeout(q.ctx) {
+			return promstorage.ErrSeriesSet(NewStorageErr(err))
+		}
+		q.logger.Warn("storage timed out, returning partial result", zap.Error(err))
+		partial = true
 	}
 	seriesSet := fromQueryResult(sortSeries, result.PromResult, result.Metadata)
+	if partial {
+		// The warning is added to the metadata only, which the handlers return
+		// as warnings of the response.
+		result.Metadata.AddWarnings(PartialResultWarning)
+	}
 
 	receiveResultMetadataFn, err := resultMetadataReceiveFn(q.ctx)
 	if err != nil {
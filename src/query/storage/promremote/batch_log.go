@@ -0,0 +1,106 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const batchLogMessage = "prom remote write batch"
+
+// newBatchLogger returns a logger writing every entry as a JSON line to path,
+// or to stdout if empty. Unlike the process logger it is never sampled so
+// that the log accounts for every batch.
+func newBatchLogger(path string) (*zap.Logger, error) {
+	if path == "" {
+		path = "stdout"
+	}
+	cfg := zap.Config{
+		Level:             zap.NewAtomicLevelAt(zap.InfoLevel),
+		DisableCaller:     true,
+		DisableStacktrace: true,
+		Encoding:          "json",
+		EncoderConfig: zapcore.EncoderConfig{
+			TimeKey:        "ts",
+			MessageKey:     "msg",
+			LineEnding:     zapcore.DefaultLineEnding,
+			EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+			EncodeDuration: zapcore.StringDurationEncoder,
+		},
+		OutputPaths:      []string{path},
+		ErrorOutputPaths: []string{"stderr"},
+	}
+	return cfg.Build()
+}
+
+// writeOutcome is the result of writing a batch to an endpoint.
+type writeOutcome struct {
+	// status is the status code of the last attempt, zero if none was sent.
+	status   int
+	attempts int
+}
+
+// batchLogEntry describes a flushed batch for the batch log.
+type batchLogEntry struct {
+	tenant    tenantKey
+	requestID string
+	endpoint  string
+	series    int
+	samples   int64
+	bytes     int
+	status    int
+	attempts  int
+	latency   time.Duration
+}
+
+// logBatch logs a flushed batch to the batch log, if enabled.
+func (p *promStorage) logBatch(entry batchLogEntry, err error) {
+	if p.opts.batchLogger == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	retries := entry.attempts - 1
+	if retries < 0 {
+		retries = 0
+	}
+	fields := []zap.Field{
+		zap.String("tenant", string(entry.tenant)),
+		zap.String("requestID", entry.requestID),
+		zap.String("endpoint", entry.endpoint),
+		zap.Int("series", entry.series),
+		zap.Int64("datapoints", entry.samples),
+		zap.Int("bytes", entry.bytes),
+		zap.String("status", result),
+		zap.Int("statusCode", entry.status),
+		zap.Duration("latency", entry.latency),
+		zap.Int("retries", retries),
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	p.opts.batchLogger.Info(batchLogMessage, fields...)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/m3db/m3/src/query/storage/m3/storagemetadata"
+	"github.com/m3db/m3/src/query/storage/promremote/promremotetest"
+	"github.com/m3db/m3/src/x/instrument"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNewBatchLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batches.log")
+	batchLogger, err := newBatchLogger(path)
+	require.NoError(t, err)
+	batchLogger.Info(batchLogMessage, zap.String("tenant", "t1"), zap.Int("series", 2))
+	require.NoError(t, batchLogger.Sync())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &line))
+	assert.Equal(t, batchLogMessage, line["msg"])
+	assert.Equal(t, "t1", line["tenant"])
+	assert.Equal(t, 2.0, line["series"])
+	assert.Contains(t, line, "ts")
+}
+
+func TestWriteBatchLog(t *testing.T) {
+	primary := promremotetest.NewServer(t, false)
+	defer primary.Close()
+	secondary := promremotetest.NewServer(t, false)
+	defer secondary.Close()
+
+	write := func(t *testing.T, mode WriteMode) []observer.LoggedEntry {
+		core, logs := observer.New(zapcore.InfoLevel)
+		promStorage, err := NewStorage(Options{
+			endpoints: []EndpointOptions{
+				{name: "primary", address: primary.WriteAddr(), tenantHeader: "TENANT"},
+				{name: "secondary", address: secondary.WriteAddr(), tenantHeader: "TENANT"},
+			},
+			poolSize:      1,
+			queueSize:     1,
+			scope:         tally.NewTestScope("test_scope", map[string]string{}),
+			logger:        logger,
+			tenantDefault: "unknown",
+			tickDuration:  ptrDuration(tickDuration),
+			queueTimeout:  ptrDuration(queueTimeout),
+		}.SetWriteMode(mode).SetBatchLogger(zap.New(core)))
+		require.NoError(t, err)
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+		return logs.AllUntimed()
+	}
+
+	t.Run("logs the endpoint the batch was written to", func(t *testing.T) {
+		primary.Reset()
+		secondary.Reset()
+		primary.SetError("primary down", http.StatusInternalServerError)
+
+		entries := write(t, WriteModeFailover)
+		require.Len(t, entries, 1)
+		assert.Equal(t, batchLogMessage, entries[0].Message)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "unknown", fields["tenant"])
+		assert.Equal(t, "secondary", fields["endpoint"])
+		assert.Equal(t, int64(1), fields["series"])
+		assert.Equal(t, int64(1), fields["datapoints"])
+		assert.NotZero(t, fields["bytes"])
+		assert.Equal(t, "success", fields["status"])
+		assert.Equal(t, int64(http.StatusOK), fields["statusCode"])
+		assert.Equal(t, int64(1), fields["retries"])
+		assert.Contains(t, fields, "latency")
+		assert.NotContains(t, fields, "error")
+	})
+
+	t.Run("logs failed batches", func(t *testing.T) {
+		primary.Reset()
+		secondary.Reset()
+		primary.SetError("primary down", http.StatusInternalServerError)
+
+		entries := write(t, WriteModePrimary)
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "primary", fields["endpoint"])
+		assert.Equal(t, "failure", fields["status"])
+		assert.Equal(t, int64(http.StatusInternalServerError), fields["statusCode"])
+		assert.Equal(t, int64(0), fields["retries"])
+		assert.Contains(t, fields, "error")
+	})
+}
+
+func TestWriteRequestIDAndUserAgent(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	write := func(t *testing.T, opts Options) (http.Header, map[string]interface{}) {
+		mu.Lock()
+		headers = nil
+		mu.Unlock()
+		core, logs := observer.New(zapcore.InfoLevel)
+		promStorage, err := NewStorage(opts.SetBatchLogger(zap.New(core)))
+		require.NoError(t, err)
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, headers, 1)
+		entries := logs.AllUntimed()
+		require.Len(t, entries, 1)
+		return headers[0], entries[0].ContextMap()
+	}
+	opts := Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: server.URL, tenantHeader: "TENANT"}},
+		poolSize:      1,
+		queueSize:     1,
+		scope:         tally.NoopScope,
+		logger:        logger,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	}
+
+	header, fields := write(t, opts)
+	assert.Equal(t, "m3coordinator/"+instrument.Version, header.Get("User-Agent"))
+	requestID := header.Get(requestIDHeader)
+	require.NotEmpty(t, requestID)
+	assert.Equal(t, requestID, fields["requestID"])
+
+	// Every batch gets its own request id.
+	header, fields = write(t, opts.SetUserAgent("custom-agent/1.0"))
+	assert.Equal(t, "custom-agent/1.0", header.Get("User-Agent"))
+	assert.NotEqual(t, requestID, header.Get(requestIDHeader))
+	assert.Equal(t, header.Get(requestIDHeader), fields["requestID"])
+}
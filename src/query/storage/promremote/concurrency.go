@@ -0,0 +1,124 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/uber-go/tally"
+)
+
+// adaptiveConcurrencyOptions bound the concurrency limit of each endpoint.
+type adaptiveConcurrencyOptions struct {
+	minLimit int
+	maxLimit int
+}
+
+// concurrencyLimiter limits the concurrent requests to an endpoint, shared by all
+// workers. The limit is adjusted with additive increase, multiplicative decrease
+// (AIMD): it halves when the endpoint is overloaded and grows by about one every
+// limit successful requests, so that all workers back off together during a brownout.
+type concurrencyLimiter struct {
+	sync.Mutex
+	limit    float64
+	minLimit float64
+	maxLimit float64
+	inFlight int
+	// changed is closed and replaced whenever a slot may have become available.
+	changed chan struct{}
+	gauge   tally.Gauge
+}
+
+func newConcurrencyLimiter(opts adaptiveConcurrencyOptions, gauge tally.Gauge) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		limit:    float64(opts.maxLimit),
+		minLimit: float64(opts.minLimit),
+		maxLimit: float64(opts.maxLimit),
+		changed:  make(chan struct{}),
+		gauge:    gauge,
+	}
+	l.gauge.Update(math.Floor(l.limit))
+	return l
+}
+
+// newEndpointLimiters returns the concurrency limiter of each http endpoint, or nil
+// if adaptive concurrency is disabled.
+func newEndpointLimiters(opts Options, scope tally.Scope) map[string]*concurrencyLimiter {
+	if opts.adaptiveConcurrency == nil {
+		return nil
+	}
+	limiters := make(map[string]*concurrencyLimiter)
+	for _, endpoint := range allEndpoints(opts) {
+		if endpoint.endpointType != httpEndpointType {
+			continue
+		}
+		if _, ok := limiters[endpoint.name]; ok {
+			continue
+		}
+		gauge := scope.Tagged(map[string]string{"endpoint_name": endpoint.name}).Gauge("concurrency_limit")
+		limiters[endpoint.name] = newConcurrencyLimiter(*opts.adaptiveConcurrency, gauge)
+	}
+	return limiters
+}
+
+// acquire blocks until a request may be sent or the context is done.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the slot of a request and adjusts the limit, decreasing it if the
+// endpoint was overloaded and increasing it otherwise.
+func (l *concurrencyLimiter) release(overloaded bool) {
+	l.Lock()
+	defer l.Unlock()
+	l.inFlight--
+	if overloaded {
+		l.limit = math.Max(l.minLimit, math.Floor(l.limit/2))
+	} else {
+		l.limit = math.Min(l.maxLimit, l.limit+1/l.limit)
+	}
+	l.gauge.Update(math.Floor(l.limit))
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// currentLimit returns the number of requests that may currently be in flight.
+func (l *concurrencyLimiter) currentLimit() int {
+	l.Lock()
+	defer l.Unlock()
+	return int(l.limit)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/query/storage/m3/storagemetadata"
+	"github.com/m3db/m3/src/x/tallytest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestConcurrencyLimiterAIMD(t *testing.T) {
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	l := newConcurrencyLimiter(adaptiveConcurrencyOptions{minLimit: 1, maxLimit: 8}, scope.Gauge("limit"))
+	assertLimit := func(expected int) {
+		assert.Equal(t, expected, l.currentLimit())
+		tallytest.AssertGaugeValue(t, float64(expected), scope.Snapshot(), "test_scope.limit", map[string]string{})
+	}
+	request := func(overloaded bool) {
+		assert.NoError(t, l.acquire(context.Background()))
+		l.release(overloaded)
+	}
+	assertLimit(8)
+
+	// A brownout halves the limit on every error down to the min.
+	for _, expected := range []int{4, 2, 1, 1} {
+		request(true)
+		assertLimit(expected)
+	}
+
+	// The limit grows by about one every limit successes during the recovery:
+	// 1 -> 2 -> 2.5 -> 2.9 -> 3.24.
+	request(false)
+	assertLimit(2)
+	request(false)
+	request(false)
+	assertLimit(2)
+	request(false)
+	assertLimit(3)
+	for i := 0; i < 100; i++ {
+		request(false)
+	}
+	assertLimit(8)
+
+	// A new error cycle halves it again.
+	request(true)
+	assertLimit(4)
+}
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	l := newConcurrencyLimiter(adaptiveConcurrencyOptions{minLimit: 1, maxLimit: 2}, tally.NoopScope.Gauge("limit"))
+	require.NoError(t, l.acquire(context.Background()))
+	require.NoError(t, l.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, l.acquire(ctx))
+
+	// Once overloaded only a single request may be in flight, so a slot is only
+	// available after both in flight requests are done.
+	acquired := make(chan struct{})
+	go func() {
+		assert.NoError(t, l.acquire(context.Background()))
+		close(acquired)
+	}()
+	l.release(true)
+	select {
+	case <-acquired:
+		t.Fatal("acquired above the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.release(false)
+	<-acquired
+}
+
+func TestWriteAdaptiveConcurrency(t *testing.T) {
+	rt := &stubRoundTripper{failures: 2}
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	s, err := NewStorage(Options{
+		endpoints:           []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write", tenantHeader: "TENANT"}},
+		scope:               scope,
+		logger:              logger,
+		poolSize:            4,
+		queueSize:           1,
+		retries:             2,
+		tenantDefault:       "unknown",
+		tickDuration:        ptrDuration(tickDuration),
+		queueTimeout:        ptrDuration(queueTimeout),
+		adaptiveConcurrency: &adaptiveConcurrencyOptions{minLimit: 1, maxLimit: 4},
+	}.SetRoundTripper(rt))
+	require.NoError(t, err)
+	require.NoError(t, writeTestMetric(t, s, storagemetadata.Attributes{}))
+	closeWithCheck(t, s)
+
+	// 4 halved by the two failed attempts is 1, and the successful retry adds 1.
+	tallytest.AssertGaugeValue(t, 2, scope.Snapshot(), "test_scope.prom_remote_storage.concurrency_limit",
+		map[string]string{"endpoint_name": "testEndpoint"})
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2021  Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"net/http"
+
+	xhttp "github.com/m3db/m3/src/x/net/http"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DebugURL is the url for the pending write queues debug endpoint.
+	DebugURL = "/debug/promremote/queues"
+	// DebugMethod is the HTTP method of the pending write queues debug endpoint.
+	DebugMethod = http.MethodGet
+)
+
+type debugHandler struct {
+	reporter QueueStatsReporter
+	logger   *zap.Logger
+}
+
+// NewDebugHandler returns a handler rendering the pending write queues as JSON.
+func NewDebugHandler(reporter QueueStatsReporter, logger *zap.Logger) http.Handler {
+	return &debugHandler{reporter: reporter, logger: logger}
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	xhttp.WriteJSONResponse(w, h.reporter.QueueStats(), h.logger)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2021  Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubQueueStatsReporter struct {
+	stats QueueStats
+}
+
+func (r stubQueueStatsReporter) QueueStats() QueueStats {
+	return r.stats
+}
+
+func TestDebugHandler(t *testing.T) {
+	handler := NewDebugHandler(stubQueueStatsReporter{stats: QueueStats{
+		DataQueueLength:       3,
+		DeadLetterQueueLength: 1,
+		Tenants: []TenantQueueStats{{
+			Tenant:          "foo",
+			Length:          2,
+			Capacity:        10,
+			EnqueuedSamples: 20,
+			DroppedSamples:  5,
+			LastFlush:       time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		}},
+	}}, logger)
+
+	req := httptest.NewRequest(DebugMethod, DebugURL, nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	expected := `{
+		"dataQueueLength": 3,
+		"deadLetterQueueLength": 1,
+		"tenants": [{
+			"tenant": "foo",
+			"length": 2,
+			"capacity": 10,
+			"enqueuedSamples": 20,
+			"droppedSamples": 5,
+			"lastFlush": "2021-06-01T12:00:00Z"
+		}]
+	}`
+	assert.JSONEq(t, expected, recorder.Body.String())
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+const (
+	// endpointHealthBuckets is the number of buckets the success ratio window is
+	// split into, a bucket is also how often a disabled endpoint is probed.
+	endpointHealthBuckets = 10
+
+	defaultEndpointAutoDisableWindow    = time.Minute
+	defaultEndpointAutoDisableMinWrites = 10
+)
+
+// endpointAutoDisableOptions configure when an endpoint is excluded from the
+// failover write mode.
+type endpointAutoDisableOptions struct {
+	minSuccessRatio float64
+	window          time.Duration
+	minWrites       int
+}
+
+// endpointHealth tracks the success ratio of the writes to an endpoint over a
+// rolling window. The endpoint is disabled once the ratio drops below the min
+// success ratio, unlike a circuit breaker counting consecutive failures, and is
+// enabled again when one of the writes it is periodically probed with succeeds.
+type endpointHealth struct {
+	sync.Mutex
+	opts    endpointAutoDisableOptions
+	nowFn   func() time.Time
+	buckets [endpointHealthBuckets]healthBucket
+	// disabled endpoints are only written to once probeAt is reached.
+	disabled bool
+	probeAt  time.Time
+
+	successRatio tally.Gauge
+	autoDisabled tally.Gauge
+}
+
+type healthBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+func newEndpointHealth(opts endpointAutoDisableOptions, scope tally.Scope) *endpointHealth {
+	h := &endpointHealth{
+		opts:         opts,
+		nowFn:        time.Now,
+		successRatio: scope.Gauge("endpoint_success_ratio"),
+		autoDisabled: scope.Gauge("endpoint_auto_disabled"),
+	}
+	h.successRatio.Update(1)
+	h.autoDisabled.Update(0)
+	return h
+}
+
+// newEndpointHealths returns the health of each endpoint, or nil if endpoints
+// are never disabled.
+func newEndpointHealths(opts Options, scope tally.Scope) map[string]*endpointHealth {
+	if opts.endpointAutoDisable == nil {
+		return nil
+	}
+	healths := make(map[string]*endpointHealth)
+	for _, endpoint := range allEndpoints(opts) {
+		if _, ok := healths[endpoint.name]; ok {
+			continue
+		}
+		endpointScope := scope.Tagged(map[string]string{"endpoint_name": endpoint.name})
+		healths[endpoint.name] = newEndpointHealth(*opts.endpointAutoDisable, endpointScope)
+	}
+	return healths
+}
+
+func (h *endpointHealth) bucketWidth() time.Duration {
+	return h.opts.window / endpointHealthBuckets
+}
+
+// allow returns true if the endpoint should be written to, which a disabled
+// endpoint is once per bucket to probe whether it recovered.
+func (h *endpointHealth) allow() bool {
+	h.Lock()
+	defer h.Unlock()
+	if !h.disabled {
+		return true
+	}
+	now := h.nowFn()
+	if now.Before(h.probeAt) {
+		return false
+	}
+	h.probeAt = now.Add(h.bucketWidth())
+	return true
+}
+
+// record accounts for the outcome of a write to the endpoint, disabling it if
+// the success ratio drops below the min, or enabling it if it was a successful probe.
+func (h *endpointHealth) record(success bool) {
+	h.Lock()
+	defer h.Unlock()
+	now := h.nowFn()
+	if h.disabled {
+		if !success {
+			return
+		}
+		h.disabled = false
+		h.buckets = [endpointHealthBuckets]healthBucket{}
+		h.successRatio.Update(1)
+		h.autoDisabled.Update(0)
+		return
+	}
+
+	width := h.bucketWidth()
+	start := now.Truncate(width)
+	bucket := &h.buckets[(start.UnixNano()/int64(width))%endpointHealthBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = healthBucket{start: start}
+	}
+	if success {
+		bucket.successes++
+	} else {
+		bucket.failures++
+	}
+
+	successes, writes := h.windowWritesUnderLock(now)
+	ratio := float64(successes) / float64(writes)
+	h.successRatio.Update(ratio)
+	if writes >= h.opts.minWrites && ratio < h.opts.minSuccessRatio {
+		h.disabled = true
+		h.probeAt = now.Add(width)
+		h.autoDisabled.Update(1)
+	}
+}
+
+// windowWritesUnderLock returns the successful and total writes in the window.
+func (h *endpointHealth) windowWritesUnderLock(now time.Time) (int, int) {
+	var successes, writes int
+	windowStart := now.Add(-h.opts.window)
+	for _, bucket := range h.buckets {
+		if !bucket.start.After(windowStart) {
+			continue
+		}
+		successes += bucket.successes
+		writes += bucket.successes + bucket.failures
+	}
+	return successes, writes
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3/src/query/storage"
+	"github.com/m3db/m3/src/query/storage/promremote/promremotetest"
+	"github.com/m3db/m3/src/x/tallytest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestEndpointHealthSuccessRatio(t *testing.T) {
+	scope := tally.NewTestScope("test_scope", nil)
+	h := newEndpointHealth(endpointAutoDisableOptions{
+		minSuccessRatio: 0.5,
+		window:          10 * time.Second,
+		minWrites:       4,
+	}, scope)
+	now := time.Unix(1000, 0)
+	h.nowFn = func() time.Time { return now }
+
+	// Below the min writes the endpoint isn't disabled whatever its ratio.
+	h.record(false)
+	h.record(false)
+	h.record(true)
+	assert.False(t, h.disabled)
+	tallytest.AssertGaugeValue(t, 1.0/3, scope.Snapshot(), "test_scope.endpoint_success_ratio", nil)
+
+	// Failures older than the window are forgotten.
+	now = now.Add(11 * time.Second)
+	h.record(true)
+	h.record(true)
+	h.record(false)
+	h.record(true)
+	assert.False(t, h.disabled)
+	tallytest.AssertGaugeValue(t, 0.75, scope.Snapshot(), "test_scope.endpoint_success_ratio", nil)
+
+	// The ratio drops below the threshold: 3 out of 7.
+	now = now.Add(time.Second)
+	h.record(false)
+	h.record(false)
+	assert.False(t, h.disabled)
+	h.record(false)
+	assert.True(t, h.disabled)
+	tallytest.AssertGaugeValue(t, 1, scope.Snapshot(), "test_scope.endpoint_auto_disabled", nil)
+
+	// A disabled endpoint is probed once per bucket.
+	assert.False(t, h.allow())
+	now = now.Add(time.Second)
+	assert.True(t, h.allow())
+	assert.False(t, h.allow())
+	h.record(false)
+	assert.True(t, h.disabled)
+
+	// A successful probe brings the ratio back above the threshold.
+	now = now.Add(time.Second)
+	require.True(t, h.allow())
+	h.record(true)
+	assert.False(t, h.disabled)
+	assert.True(t, h.allow())
+	tallytest.AssertGaugeValue(t, 0, scope.Snapshot(), "test_scope.endpoint_auto_disabled", nil)
+	tallytest.AssertGaugeValue(t, 1, scope.Snapshot(), "test_scope.endpoint_success_ratio", nil)
+}
+
+func TestWriteFailoverAutoDisable(t *testing.T) {
+	primary := promremotetest.NewServer(t, false)
+	defer primary.Close()
+	secondary := promremotetest.NewServer(t, false)
+	defer secondary.Close()
+
+	scope := tally.NewTestScope("test_scope", nil)
+	s, err := NewStorage(Options{
+		endpoints: []EndpointOptions{
+			{name: "primary", address: primary.WriteAddr(), tenantHeader: "TENANT"},
+			{name: "secondary", address: secondary.WriteAddr(), tenantHeader: "TENANT"},
+		},
+		poolSize:      1,
+		queueSize:     1,
+		scope:         scope,
+		logger:        logger,
+		tenantDefault: "default",
+		tickDuration:  ptrDuration(time.Hour),
+		queueTimeout:  ptrDuration(queueTimeout),
+		endpointAutoDisable: &endpointAutoDisableOptions{
+			minSuccessRatio: 0.5,
+			window:          10 * time.Second,
+			minWrites:       2,
+		},
+	}.SetWriteMode(WriteModeFailover))
+	require.NoError(t, err)
+	defer closeWithCheck(t, s)
+	p := s.(*promStorage)
+	now := time.Now()
+	p.endpointHealths["primary"].nowFn = func() time.Time { return now }
+
+	write := func() {
+		query := newTestWriteQuery(t, "id", "a")
+		require.NoError(t, p.writeBatch(context.TODO(), "default", []*storage.WriteQuery{query}))
+	}
+	primaryTags := map[string]string{"endpoint_name": "primary"}
+	primaryFailures := map[string]string{"endpoint_name": "primary", "code": "500"}
+
+	primary.SetError("primary down", http.StatusInternalServerError)
+	write()
+	write()
+	tallytest.AssertGaugeValue(t, 1, scope.Snapshot(),
+		"test_scope.prom_remote_storage.endpoint_auto_disabled", primaryTags)
+	tallytest.AssertGaugeValue(t, 0, scope.Snapshot(),
+		"test_scope.prom_remote_storage.endpoint_success_ratio", primaryTags)
+
+	// The disabled primary is skipped until it is probed.
+	write()
+	tallytest.AssertCounterValue(t, 2, scope.Snapshot(),
+		"test_scope.prom_remote_storage.write.total", primaryFailures)
+
+	primary.Reset()
+	now = now.Add(time.Second)
+	write()
+	assert.NotNil(t, primary.GetLastWriteRequest())
+	tallytest.AssertGaugeValue(t, 0, scope.Snapshot(),
+		"test_scope.prom_remote_storage.endpoint_auto_disabled", primaryTags)
+	tallytest.AssertGaugeValue(t, 0, scope.Snapshot(),
+		"test_scope.prom_remote_storage.endpoint_auto_disabled",
+		map[string]string{"endpoint_name": "secondary"})
+}
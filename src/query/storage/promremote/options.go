@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/m3db/m3/src/cmd/services/m3query/config"
 	"github.com/m3db/m3/src/metrics/filters"
@@ -46,45 +47,9 @@ func NewOptions(
 	if err != nil {
 		return Options{}, err
 	}
-	endpoints := make([]EndpointOptions, 0, len(cfg.Endpoints))
-
-	for _, endpoint := range cfg.Endpoints {
-		var (
-			attr = storagemetadata.Attributes{
-				MetricsType: storagemetadata.UnaggregatedMetricsType,
-			}
-			downsampleOptions *m3.ClusterNamespaceDownsampleOptions
-		)
-		if endpoint.StoragePolicy != nil {
-			attr.MetricsType = storagemetadata.AggregatedMetricsType
-			attr.Resolution = endpoint.StoragePolicy.Resolution
-			attr.Retention = endpoint.StoragePolicy.Retention
-			downsampleOptions = &m3.DefaultClusterNamespaceDownsampleOptions
-			if downsample := endpoint.StoragePolicy.Downsample; downsample != nil {
-				downsampleOptions = &m3.ClusterNamespaceDownsampleOptions{
-					All: downsample.All,
-				}
-			}
-		}
-		var otherHeaders map[string]string
-		if len(endpoint.Headers) > 0 {
-			otherHeaders = make(map[string]string, len(endpoint.Headers))
-			for _, header := range endpoint.Headers {
-				if header.Name == endpoint.TenantHeader {
-					return Options{}, fmt.Errorf("header %s is reserved for tenant header", endpoint.TenantHeader)
-				}
-				otherHeaders[header.Name] = header.Value
-			}
-		}
-		endpoints = append(endpoints, EndpointOptions{
-			name:              endpoint.Name,
-			address:           endpoint.Address,
-			attributes:        attr,
-			tenantHeader:      endpoint.TenantHeader,
-			otherHeaders:      otherHeaders,
-			apiToken:          endpoint.ApiToken,
-			downsampleOptions: downsampleOptions,
-		})
+	endpoints, err := newEndpointOptions(cfg.Endpoints)
+	if err != nil {
+		return Options{}, err
 	}
 	tenantRules := make([]TenantRule, 0, len(cfg.TenantRules))
 	for _, tenantRule := range cfg.TenantRules {
@@ -100,10 +65,43 @@ func NewOptions(
 		}
 		logger.Info("adding tenant rule", zap.String("filter", tenantRule.Filter),
 			zap.String("tenant", tenantRule.Tenant))
-		tenantRules = append(tenantRules, TenantRule{
-			Filter: filter,
-			Tenant: tenantRule.Tenant,
-		})
+		var maxFlushDelay time.Duration
+		if tenantRule.MaxFlushDelay != nil {
+			maxFlushDelay = *tenantRule.MaxFlushDelay
+		}
+		rule := TenantRule{
+			Filter:          filter,
+			Tenant:          tenantRule.Tenant,
+			MaxFlushDelay:   maxFlushDelay,
+			Priority:        tenantRule.Priority,
+			Labels:          tenantRule.Labels,
+			OverwriteLabels: tenantRule.OverwriteLabels,
+		}
+		if tenantRule.SampleRate != nil {
+			rule.SampleRate = *tenantRule.SampleRate
+		}
+		if split := tenantRule.Split; split != nil {
+			rule.SplitTenant = split.Tenant
+			rule.SplitPercent = split.Percent
+		}
+		if tenantRule.Endpoints != nil {
+			if rule.Endpoints, err = newEndpointOptions(tenantRule.Endpoints); err != nil {
+				return Options{}, err
+			}
+		}
+		tenantRules = append(tenantRules, rule)
+	}
+	relabelRules := make([]relabelRule, 0, len(cfg.Relabel))
+	for _, relabel := range cfg.Relabel {
+		rule, err := newRelabelRule(relabel)
+		if err != nil {
+			return Options{}, err
+		}
+		relabelRules = append(relabelRules, rule)
+	}
+	writeMode := WriteModePrimary
+	if cfg.WriteMode == config.PromRemoteWriteModeFailover {
+		writeMode = WriteModeFailover
 	}
 	clientOpts := xhttp.DefaultHTTPClientOptions()
 	if cfg.RequestTimeout != nil {
@@ -124,6 +122,66 @@ func NewOptions(
 
 	clientOpts.DisableCompression = true // Already snappy compressed.
 
+	logSampleRate := defaultLogSampleRate
+	if cfg.LogSampleRate != nil {
+		logSampleRate = *cfg.LogSampleRate
+	}
+	wrongTenantLogSampleRate := defaultWrongTenantLogSampleRate
+	if cfg.WrongTenantLogSampleRate != nil {
+		wrongTenantLogSampleRate = *cfg.WrongTenantLogSampleRate
+	}
+	var defaultTenantLogSampleRate float64
+	if cfg.DefaultTenantLogSampleRate != nil {
+		defaultTenantLogSampleRate = *cfg.DefaultTenantLogSampleRate
+	}
+
+	inFlightPolicy := InFlightPolicyBlock
+	if cfg.InFlightPolicy == config.PromRemoteInFlightShed {
+		inFlightPolicy = InFlightPolicyShed
+	}
+
+	closePolicy := ClosePolicyDrain
+	if cfg.ClosePolicy == config.PromRemoteCloseFastExit {
+		closePolicy = ClosePolicyFastExit
+	}
+
+	var endpointAutoDisable *endpointAutoDisableOptions
+	if ad := cfg.EndpointAutoDisable; ad != nil {
+		endpointAutoDisable = &endpointAutoDisableOptions{
+			minSuccessRatio: ad.MinSuccessRatio,
+			window:          defaultEndpointAutoDisableWindow,
+			minWrites:       defaultEndpointAutoDisableMinWrites,
+		}
+		if ad.Window != nil {
+			endpointAutoDisable.window = *ad.Window
+		}
+		if ad.MinWrites > 0 {
+			endpointAutoDisable.minWrites = ad.MinWrites
+		}
+	}
+
+	var adaptiveConcurrency *adaptiveConcurrencyOptions
+	if cfg.AdaptiveConcurrency != nil {
+		adaptiveConcurrency = &adaptiveConcurrencyOptions{
+			minLimit: cfg.AdaptiveConcurrency.MinLimit,
+			maxLimit: cfg.AdaptiveConcurrency.MaxLimit,
+		}
+		if adaptiveConcurrency.minLimit == 0 {
+			adaptiveConcurrency.minLimit = 1
+		}
+		if adaptiveConcurrency.maxLimit == 0 {
+			adaptiveConcurrency.maxLimit = cfg.PoolSize
+		}
+	}
+
+	var batchLogger *zap.Logger
+	if cfg.BatchLog != nil {
+		batchLogger, err = newBatchLogger(cfg.BatchLog.Path)
+		if err != nil {
+			return Options{}, fmt.Errorf("unable to create batch logger: %w", err)
+		}
+	}
+
 	return Options{
 		endpoints:     endpoints,
 		httpOptions:   clientOpts,
@@ -136,9 +194,115 @@ func NewOptions(
 		tenantRules:   tenantRules,
 		tickDuration:  cfg.TickDuration,
 		queueTimeout:  cfg.EnqueueTimeout,
+		closeTimeout:  cfg.CloseTimeout,
+		closePolicy:   closePolicy,
+		seriesLimits: seriesLimits{
+			maxLabels:           cfg.MaxLabelsPerSeries,
+			maxLabelNameLength:  cfg.MaxLabelNameLength,
+			maxLabelValueLength: cfg.MaxLabelValueLength,
+			maxDatapoints:       cfg.MaxDatapointsPerSeries,
+			truncateDatapoints:  cfg.DatapointsCapPolicy == config.PromRemoteDatapointsCapTruncate,
+			maxFutureSkew:       cfg.MaxFutureSkew,
+		},
+		relabelRules:               relabelRules,
+		writeMode:                  writeMode,
+		coalesceSeries:             cfg.CoalesceSeries,
+		logSampleRate:              logSampleRate,
+		wrongTenantLogSampleRate:   wrongTenantLogSampleRate,
+		defaultTenantLogSampleRate: defaultTenantLogSampleRate,
+		adaptiveConcurrency:        adaptiveConcurrency,
+		maxInFlightBatches:         cfg.MaxInFlightBatches,
+		inFlightPolicy:             inFlightPolicy,
+		orderedWriteShards:         cfg.OrderedWriteShards,
+		endpointAutoDisable:        endpointAutoDisable,
+		batchLogger:                batchLogger,
+		userAgent:                  cfg.UserAgent,
 	}, nil
 }
 
+func newEndpointOptions(cfgs []config.PrometheusRemoteBackendEndpointConfiguration) ([]EndpointOptions, error) {
+	endpoints := make([]EndpointOptions, 0, len(cfgs))
+	for _, endpoint := range cfgs {
+		var (
+			attr = storagemetadata.Attributes{
+				MetricsType: storagemetadata.UnaggregatedMetricsType,
+			}
+			downsampleOptions *m3.ClusterNamespaceDownsampleOptions
+		)
+		if endpoint.StoragePolicy != nil {
+			attr.MetricsType = storagemetadata.AggregatedMetricsType
+			attr.Resolution = endpoint.StoragePolicy.Resolution
+			attr.Retention = endpoint.StoragePolicy.Retention
+			downsampleOptions = &m3.DefaultClusterNamespaceDownsampleOptions
+			if downsample := endpoint.StoragePolicy.Downsample; downsample != nil {
+				downsampleOptions = &m3.ClusterNamespaceDownsampleOptions{
+					All: downsample.All,
+				}
+			}
+		}
+		var otherHeaders map[string]string
+		if len(endpoint.Headers) > 0 {
+			otherHeaders = make(map[string]string, len(endpoint.Headers))
+			for _, header := range endpoint.Headers {
+				if header.Name == endpoint.TenantHeader {
+					return nil, fmt.Errorf("header %s is reserved for tenant header", endpoint.TenantHeader)
+				}
+				otherHeaders[header.Name] = header.Value
+			}
+		}
+		endpointType := httpEndpointType
+		if endpoint.Type == config.PromRemoteKafkaEndpointType {
+			endpointType = kafkaEndpointType
+		}
+		var maxIdleConnsPerHost, maxConnsPerHost int
+		if endpoint.MaxIdleConnsPerHost != nil {
+			maxIdleConnsPerHost = *endpoint.MaxIdleConnsPerHost
+		}
+		if endpoint.MaxConnsPerHost != nil {
+			maxConnsPerHost = *endpoint.MaxConnsPerHost
+		}
+		var keepAlive time.Duration
+		if endpoint.KeepAlive != nil {
+			keepAlive = *endpoint.KeepAlive
+		}
+		var h2 *http2Options
+		if endpoint.HTTP2 != nil {
+			h2 = &http2Options{
+				readIdleTimeout: endpoint.HTTP2.ReadIdleTimeout,
+				pingTimeout:     endpoint.HTTP2.PingTimeout,
+			}
+		}
+		var signer *sigV4Signer
+		if endpoint.AuthType == config.PromRemoteSigV4AuthType {
+			var err error
+			if signer, err = newSigV4Signer(endpoint.SigV4); err != nil {
+				return nil, fmt.Errorf("unable to create sigv4 signer for endpoint %s: %w", endpoint.Name, err)
+			}
+		}
+		endpoints = append(endpoints, EndpointOptions{
+			name:                 endpoint.Name,
+			address:              endpoint.Address,
+			endpointType:         endpointType,
+			topic:                endpoint.Topic,
+			attributes:           attr,
+			tenantHeader:         endpoint.TenantHeader,
+			otherHeaders:         otherHeaders,
+			apiToken:             endpoint.ApiToken,
+			idempotencyKeyHeader: endpoint.IdempotencyKeyHeader,
+			bodyEncoding:         bodyEncodingOf(endpoint),
+			remoteWriteVersion:   endpoint.RemoteWriteVersion,
+			acceptEncoding:       endpoint.AcceptEncoding,
+			downsampleOptions:    downsampleOptions,
+			maxIdleConnsPerHost:  maxIdleConnsPerHost,
+			maxConnsPerHost:      maxConnsPerHost,
+			keepAlive:            keepAlive,
+			http2:                h2,
+			sigV4:                signer,
+		})
+	}
+	return endpoints, nil
+}
+
 func validateBackendConfiguration(cfg *config.PrometheusRemoteBackendConfiguration) error {
 	if cfg == nil {
 		return fmt.Errorf("prometheusRemoteBackend configuration is required")
@@ -170,9 +334,141 @@ func validateBackendConfiguration(cfg *config.PrometheusRemoteBackendConfigurati
 	if cfg.EnqueueTimeout != nil && *cfg.EnqueueTimeout <= 0 {
 		return errors.New("enqueueTimeout can't be non positive")
 	}
+	if cfg.CloseTimeout != nil && *cfg.CloseTimeout <= 0 {
+		return errors.New("closeTimeout can't be non positive")
+	}
+	if ac := cfg.AdaptiveConcurrency; ac != nil {
+		if ac.MinLimit < 0 || ac.MaxLimit < 0 {
+			return errors.New("adaptiveConcurrency limits can't be negative")
+		}
+		if ac.MaxLimit > 0 && ac.MinLimit > ac.MaxLimit {
+			return errors.New("adaptiveConcurrency minLimit can't be greater than maxLimit")
+		}
+	}
+	if ad := cfg.EndpointAutoDisable; ad != nil {
+		if ad.MinSuccessRatio <= 0 || ad.MinSuccessRatio > 1 {
+			return errors.New("endpointAutoDisable minSuccessRatio must be between 0 and 1")
+		}
+		if ad.Window != nil && *ad.Window < endpointHealthBuckets*time.Millisecond {
+			return errors.New("endpointAutoDisable window must be at least 10ms")
+		}
+		if ad.MinWrites < 0 {
+			return errors.New("endpointAutoDisable minWrites can't be negative")
+		}
+		if cfg.WriteMode != config.PromRemoteWriteModeFailover {
+			return errors.New("endpointAutoDisable requires the failover write mode")
+		}
+	}
+	if cfg.MaxInFlightBatches < 0 {
+		return errors.New("maxInFlightBatches can't be negative")
+	}
+	if cfg.OrderedWriteShards < 0 {
+		return errors.New("orderedWriteShards can't be negative")
+	}
+	switch cfg.InFlightPolicy {
+	case "", config.PromRemoteInFlightBlock, config.PromRemoteInFlightShed:
+	default:
+		return fmt.Errorf("unknown in-flight policy %s", cfg.InFlightPolicy)
+	}
+	switch cfg.ClosePolicy {
+	case "", config.PromRemoteCloseDrain, config.PromRemoteCloseFastExit:
+	default:
+		return fmt.Errorf("unknown close policy %s", cfg.ClosePolicy)
+	}
+	if cfg.MaxLabelsPerSeries < 0 {
+		return errors.New("maxLabelsPerSeries can't be negative")
+	}
+	if cfg.MaxLabelNameLength < 0 {
+		return errors.New("maxLabelNameLength can't be negative")
+	}
+	if cfg.MaxLabelValueLength < 0 {
+		return errors.New("maxLabelValueLength can't be negative")
+	}
+	if cfg.MaxDatapointsPerSeries < 0 {
+		return errors.New("maxDatapointsPerSeries can't be negative")
+	}
+	if cfg.MaxFutureSkew < 0 {
+		return errors.New("maxFutureSkew can't be negative")
+	}
+	switch cfg.DatapointsCapPolicy {
+	case "", config.PromRemoteDatapointsCapSplit, config.PromRemoteDatapointsCapTruncate:
+	default:
+		return fmt.Errorf("unknown datapoints cap policy %s", cfg.DatapointsCapPolicy)
+	}
+	if cfg.LogSampleRate != nil && !validSampleRate(*cfg.LogSampleRate) {
+		return errors.New("logSampleRate must be between 0 and 1")
+	}
+	if cfg.WrongTenantLogSampleRate != nil && !validSampleRate(*cfg.WrongTenantLogSampleRate) {
+		return errors.New("wrongTenantLogSampleRate must be between 0 and 1")
+	}
+	if cfg.DefaultTenantLogSampleRate != nil && !validSampleRate(*cfg.DefaultTenantLogSampleRate) {
+		return errors.New("defaultTenantLogSampleRate must be between 0 and 1")
+	}
+	switch cfg.WriteMode {
+	case "", config.PromRemoteWriteModePrimary, config.PromRemoteWriteModeFailover:
+	default:
+		return fmt.Errorf("unknown write mode %s", cfg.WriteMode)
+	}
 	requireTenantHeader := strings.TrimSpace(cfg.TenantDefault) != ""
+	overriddenTenants := map[string]struct{}{}
+	labeledTenants := map[string]struct{}{}
+	for _, tenantRule := range cfg.TenantRules {
+		if tenantRule.MaxFlushDelay != nil && *tenantRule.MaxFlushDelay <= 0 {
+			return fmt.Errorf("maxFlushDelay for tenant %s can't be non positive", tenantRule.Tenant)
+		}
+		if rate := tenantRule.SampleRate; rate != nil && (*rate <= 0 || *rate > 1) {
+			return fmt.Errorf("sampleRate for tenant %s must be greater than 0 and at most 1", tenantRule.Tenant)
+		}
+		tenants := []string{tenantRule.Tenant}
+		if split := tenantRule.Split; split != nil {
+			if strings.TrimSpace(split.Tenant) == "" {
+				return fmt.Errorf("split tenant for tenant %s must be set", tenantRule.Tenant)
+			}
+			if split.Percent < 0 || split.Percent > 100 {
+				return fmt.Errorf("split percent for tenant %s must be between 0 and 100", tenantRule.Tenant)
+			}
+			tenants = append(tenants, split.Tenant)
+		}
+		if len(tenantRule.Labels) > 0 {
+			for name := range tenantRule.Labels {
+				if strings.TrimSpace(name) == "" {
+					return fmt.Errorf("injected label names for tenant %s must be set", tenantRule.Tenant)
+				}
+			}
+			for _, tenant := range tenants {
+				if _, ok := labeledTenants[tenant]; ok {
+					return fmt.Errorf("labels for tenant %s are injected by several tenant rules", tenant)
+				}
+				labeledTenants[tenant] = struct{}{}
+			}
+		}
+		if tenantRule.Endpoints == nil {
+			continue
+		}
+		if len(tenantRule.Endpoints) == 0 {
+			return fmt.Errorf("at least one endpoint must be configured for tenant %s when overriding endpoints",
+				tenantRule.Tenant)
+		}
+		if err := validateEndpointsConfiguration(tenantRule.Endpoints, requireTenantHeader, cfg.WriteMode); err != nil {
+			return fmt.Errorf("invalid endpoints for tenant %s: %w", tenantRule.Tenant, err)
+		}
+		for _, tenant := range tenants {
+			if _, ok := overriddenTenants[tenant]; ok {
+				return fmt.Errorf("endpoints for tenant %s are overridden by several tenant rules", tenant)
+			}
+			overriddenTenants[tenant] = struct{}{}
+		}
+	}
+	return validateEndpointsConfiguration(cfg.Endpoints, requireTenantHeader, cfg.WriteMode)
+}
+
+func validateEndpointsConfiguration(
+	endpoints []config.PrometheusRemoteBackendEndpointConfiguration,
+	requireTenantHeader bool,
+	writeMode config.PromRemoteWriteMode,
+) error {
 	seenNames := map[string]struct{}{}
-	for _, endpoint := range cfg.Endpoints {
+	for _, endpoint := range endpoints {
 		if err := validateEndpointConfiguration(endpoint, requireTenantHeader); err != nil {
 			return err
 		}
@@ -180,10 +476,34 @@ func validateBackendConfiguration(cfg *config.PrometheusRemoteBackendConfigurati
 			return fmt.Errorf("endpoint name %s is not unique, ensure all endpoint names are unique", endpoint.Name)
 		}
 		seenNames[endpoint.Name] = struct{}{}
+		// NB: a batch is encoded once and the same payload is sent to every endpoint.
+		if writeMode == config.PromRemoteWriteModeFailover &&
+			bodyEncodingOf(endpoint) != bodyEncodingOf(endpoints[0]) {
+			return errors.New("all endpoints must use the same compression in failover write mode")
+		}
 	}
 	return nil
 }
 
+// bodyEncodingOf returns the body encoding of the endpoint, from its compression
+// or else its deprecated snappy framing.
+func bodyEncodingOf(endpoint config.PrometheusRemoteBackendEndpointConfiguration) bodyEncoding {
+	switch endpoint.Compression {
+	case config.PromRemoteSnappyStreamCompression:
+		return snappyStreamEncoding
+	case config.PromRemoteGzipCompression:
+		return gzipEncoding
+	}
+	if endpoint.SnappyFraming == config.PromRemoteSnappyStreamFraming {
+		return snappyStreamEncoding
+	}
+	return snappyBlockEncoding
+}
+
+func validSampleRate(rate float64) bool {
+	return rate >= 0 && rate <= 1
+}
+
 func validateEndpointConfiguration(endpoint config.PrometheusRemoteBackendEndpointConfiguration, requireTenantHeader bool) error {
 	if endpoint.StoragePolicy != nil {
 		if endpoint.StoragePolicy.Resolution <= 0 {
@@ -193,14 +513,67 @@ func validateEndpointConfiguration(endpoint config.PrometheusRemoteBackendEndpoi
 			return errors.New("endpoint retention must be positive")
 		}
 	}
-	if strings.TrimSpace(endpoint.Address) == "" {
-		return errors.New("endpoint address must be set")
+	switch endpoint.Type {
+	case "", config.PromRemoteHTTPEndpointType:
+		if strings.TrimSpace(endpoint.Address) == "" {
+			return errors.New("endpoint address must be set")
+		}
+	case config.PromRemoteKafkaEndpointType:
+		if strings.TrimSpace(endpoint.Topic) == "" {
+			return errors.New("endpoint topic must be set for kafka endpoints")
+		}
+	default:
+		return fmt.Errorf("unknown endpoint type %s", endpoint.Type)
+	}
+	switch endpoint.Compression {
+	case "", config.PromRemoteSnappyBlockCompression, config.PromRemoteSnappyStreamCompression,
+		config.PromRemoteGzipCompression:
+	default:
+		return fmt.Errorf("unknown compression %s", endpoint.Compression)
+	}
+	switch endpoint.SnappyFraming {
+	case "", config.PromRemoteSnappyBlockFraming, config.PromRemoteSnappyStreamFraming:
+	default:
+		return fmt.Errorf("unknown snappy framing %s", endpoint.SnappyFraming)
+	}
+	if endpoint.Compression != "" && endpoint.SnappyFraming != "" {
+		return errors.New("endpoint compression and deprecated snappy framing must not both be set")
 	}
 	if strings.TrimSpace(endpoint.Name) == "" {
 		return errors.New("endpoint name must be set")
 	}
+	if endpoint.MaxIdleConnsPerHost != nil && *endpoint.MaxIdleConnsPerHost <= 0 {
+		return fmt.Errorf("maxIdleConnsPerHost for endpoint %s must be positive", endpoint.Name)
+	}
+	if endpoint.MaxConnsPerHost != nil && *endpoint.MaxConnsPerHost <= 0 {
+		return fmt.Errorf("maxConnsPerHost for endpoint %s must be positive", endpoint.Name)
+	}
+	if endpoint.KeepAlive != nil && *endpoint.KeepAlive <= 0 {
+		return fmt.Errorf("keepAlive for endpoint %s must be positive", endpoint.Name)
+	}
+	if h2 := endpoint.HTTP2; h2 != nil && (h2.ReadIdleTimeout < 0 || h2.PingTimeout < 0) {
+		return fmt.Errorf("http2 timeouts for endpoint %s can't be negative", endpoint.Name)
+	}
 	if requireTenantHeader && strings.TrimSpace(endpoint.TenantHeader) == "" {
 		return errors.New("endpoint tenant header must be set when default tenant is given")
 	}
+	if endpoint.IdempotencyKeyHeader != "" && endpoint.IdempotencyKeyHeader == endpoint.TenantHeader {
+		return fmt.Errorf("header %s is reserved for tenant header", endpoint.TenantHeader)
+	}
+	switch endpoint.AuthType {
+	case "", config.PromRemoteBasicAuthType:
+	case config.PromRemoteSigV4AuthType:
+		if endpoint.SigV4 == nil || strings.TrimSpace(endpoint.SigV4.Region) == "" {
+			return fmt.Errorf("sigv4 region for endpoint %s must be set", endpoint.Name)
+		}
+		if (endpoint.SigV4.AccessKey == "") != (endpoint.SigV4.SecretKey == "") {
+			return fmt.Errorf("sigv4 access key and secret key for endpoint %s must be set together", endpoint.Name)
+		}
+		if endpoint.ApiToken != "" {
+			return fmt.Errorf("apiToken for endpoint %s can't be set with sigv4 auth", endpoint.Name)
+		}
+	default:
+		return fmt.Errorf("unknown auth type %s", endpoint.AuthType)
+	}
 	return nil
 }
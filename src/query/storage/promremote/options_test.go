@@ -21,6 +21,7 @@
 package promremote
 
 import (
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -143,6 +144,131 @@ func TestTenantRules(t *testing.T) {
 	assert.Equal(t, 2, len(opts.tenantRules))
 	assert.Equal(t, "app-framework", opts.tenantRules[0].Tenant)
 	assert.Equal(t, "monitoring-platform", opts.tenantRules[1].Tenant)
+	assert.Equal(t, time.Duration(0), opts.tenantRules[0].MaxFlushDelay)
+}
+
+func TestTenantRuleMaxFlushDelay(t *testing.T) {
+	cfg := getValidConfig()
+	cfg.TenantRules = []config.PrometheusRemoteBackendTenant{{
+		Filter:        "namespace:m3",
+		Tenant:        "monitoring-platform",
+		MaxFlushDelay: ptrDuration(time.Second),
+	}}
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, opts.tenantRules, 1)
+	assert.Equal(t, time.Second, opts.tenantRules[0].MaxFlushDelay)
+
+	cfg.TenantRules[0].MaxFlushDelay = ptrDuration(0)
+	assertValidationError(t, &cfg, "maxFlushDelay for tenant monitoring-platform can't be non positive")
+}
+
+func TestTenantRulePriorityAndSplit(t *testing.T) {
+	cfg := getValidConfig()
+	cfg.TenantRules = []config.PrometheusRemoteBackendTenant{{
+		Filter:   "namespace:m3",
+		Tenant:   "monitoring-platform",
+		Priority: 10,
+		Split: &config.PrometheusRemoteBackendTenantSplit{
+			Tenant:  "monitoring-platform-canary",
+			Percent: 12.5,
+		},
+	}}
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, opts.tenantRules, 1)
+	assert.Equal(t, 10, opts.tenantRules[0].Priority)
+	assert.Equal(t, "monitoring-platform-canary", opts.tenantRules[0].SplitTenant)
+	assert.Equal(t, 12.5, opts.tenantRules[0].SplitPercent)
+
+	cfg.TenantRules[0].Split.Percent = 100.5
+	assertValidationError(t, &cfg, "split percent for tenant monitoring-platform must be between 0 and 100")
+
+	cfg.TenantRules[0].Split.Percent = 10
+	cfg.TenantRules[0].Split.Tenant = " "
+	assertValidationError(t, &cfg, "split tenant for tenant monitoring-platform must be set")
+}
+
+func TestTenantRuleSampleRate(t *testing.T) {
+	cfg := getValidConfig()
+	cfg.TenantRules = []config.PrometheusRemoteBackendTenant{{
+		Filter: "namespace:m3",
+		Tenant: "monitoring-platform",
+	}}
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, opts.tenantRules[0].SampleRate)
+
+	rate := 0.1
+	cfg.TenantRules[0].SampleRate = &rate
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, opts.tenantRules[0].SampleRate)
+
+	rate = 0
+	assertValidationError(t, &cfg, "sampleRate for tenant monitoring-platform must be greater than 0 and at most 1")
+}
+
+func TestTenantRuleEndpoints(t *testing.T) {
+	cfg := getValidConfig()
+	dedicated := getValidEndpointConfiguration()
+	dedicated.Name = "eu"
+	dedicated.Address = "euAddress"
+	cfg.TenantRules = []config.PrometheusRemoteBackendTenant{
+		{
+			Filter:    "region:eu",
+			Tenant:    "eu-tenant",
+			Endpoints: []config.PrometheusRemoteBackendEndpointConfiguration{dedicated},
+		},
+		{Filter: "namespace:m3", Tenant: "monitoring-platform"},
+	}
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, opts.tenantRules, 2)
+	require.Len(t, opts.tenantRules[0].Endpoints, 1)
+	assert.Equal(t, "eu", opts.tenantRules[0].Endpoints[0].name)
+	assert.Equal(t, "euAddress", opts.tenantRules[0].Endpoints[0].address)
+	assert.Nil(t, opts.tenantRules[1].Endpoints)
+
+	cfg.TenantRules[0].Endpoints = []config.PrometheusRemoteBackendEndpointConfiguration{}
+	assertValidationError(t, &cfg,
+		"at least one endpoint must be configured for tenant eu-tenant when overriding endpoints")
+
+	dedicated.Address = ""
+	cfg.TenantRules[0].Endpoints = []config.PrometheusRemoteBackendEndpointConfiguration{dedicated}
+	assertValidationError(t, &cfg, "invalid endpoints for tenant eu-tenant: endpoint address must be set")
+
+	dedicated.Address = "euAddress"
+	cfg.TenantRules[0].Endpoints = []config.PrometheusRemoteBackendEndpointConfiguration{dedicated}
+	cfg.TenantRules[1].Tenant = "eu-tenant"
+	cfg.TenantRules[1].Endpoints = []config.PrometheusRemoteBackendEndpointConfiguration{dedicated}
+	assertValidationError(t, &cfg, "endpoints for tenant eu-tenant are overridden by several tenant rules")
+}
+
+func TestTenantRuleLabels(t *testing.T) {
+	cfg := getValidConfig()
+	cfg.TenantRules = []config.PrometheusRemoteBackendTenant{
+		{
+			Filter:          "region:eu",
+			Tenant:          "eu-tenant",
+			Labels:          map[string]string{"cluster": "eu-1"},
+			OverwriteLabels: true,
+		},
+		{Filter: "namespace:m3", Tenant: "monitoring-platform"},
+	}
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, opts.tenantRules, 2)
+	assert.Equal(t, map[string]string{"cluster": "eu-1"}, opts.tenantRules[0].Labels)
+	assert.True(t, opts.tenantRules[0].OverwriteLabels)
+	assert.Nil(t, opts.tenantRules[1].Labels)
+
+	cfg.TenantRules[1].Labels = map[string]string{" ": "value"}
+	assertValidationError(t, &cfg, "injected label names for tenant monitoring-platform must be set")
+
+	cfg.TenantRules[1].Tenant = "eu-tenant"
+	cfg.TenantRules[1].Labels = map[string]string{"region": "eu"}
+	assertValidationError(t, &cfg, "labels for tenant eu-tenant are injected by several tenant rules")
 }
 
 func TestUnaggregatedEndpoint(t *testing.T) {
@@ -175,6 +301,311 @@ func TestDefaultDownsampleAll(t *testing.T) {
 	assert.True(t, opts.endpoints[0].downsampleOptions.All)
 }
 
+func TestKafkaEndpoint(t *testing.T) {
+	opts, err := NewOptions(&config.PrometheusRemoteBackendConfiguration{
+		Endpoints: []config.PrometheusRemoteBackendEndpointConfiguration{{
+			Name:  "testEndpoint",
+			Type:  config.PromRemoteKafkaEndpointType,
+			Topic: "remote_write",
+		}},
+	}, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, kafkaEndpointType, opts.endpoints[0].endpointType)
+	assert.Equal(t, "remote_write", opts.endpoints[0].topic)
+}
+
+func TestCompression(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, snappyBlockEncoding, opts.endpoints[0].bodyEncoding)
+
+	for compression, expected := range map[config.PromRemoteCompression]bodyEncoding{
+		config.PromRemoteSnappyBlockCompression:  snappyBlockEncoding,
+		config.PromRemoteSnappyStreamCompression: snappyStreamEncoding,
+		config.PromRemoteGzipCompression:         gzipEncoding,
+	} {
+		cfg.Endpoints[0].Compression = compression
+		opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+		require.NoError(t, err)
+		assert.Equal(t, expected, opts.endpoints[0].bodyEncoding)
+	}
+
+	cfg.Endpoints[0].Compression = "lz4"
+	assertValidationError(t, &cfg, "unknown compression lz4")
+}
+
+func TestDeprecatedSnappyFraming(t *testing.T) {
+	cfg := getValidConfig()
+	for framing, expected := range map[config.PromRemoteSnappyFraming]bodyEncoding{
+		config.PromRemoteSnappyBlockFraming:  snappyBlockEncoding,
+		config.PromRemoteSnappyStreamFraming: snappyStreamEncoding,
+	} {
+		cfg.Endpoints[0].SnappyFraming = framing
+		opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+		require.NoError(t, err)
+		assert.Equal(t, expected, opts.endpoints[0].bodyEncoding)
+	}
+
+	cfg.Endpoints[0].Compression = config.PromRemoteGzipCompression
+	assertValidationError(t, &cfg,
+		"endpoint compression and deprecated snappy framing must not both be set")
+
+	cfg.Endpoints[0].Compression = ""
+	cfg.Endpoints[0].SnappyFraming = "gzip"
+	assertValidationError(t, &cfg, "unknown snappy framing gzip")
+}
+
+func TestRemoteWriteVersion(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "0.1.0", opts.endpoints[0].remoteWriteVersionOrDefault())
+
+	cfg.Endpoints[0].RemoteWriteVersion = "1.0"
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", opts.endpoints[0].remoteWriteVersionOrDefault())
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Empty(t, opts.endpoints[0].acceptEncoding)
+
+	cfg.Endpoints[0].AcceptEncoding = "gzip"
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", opts.endpoints[0].acceptEncoding)
+}
+
+func TestSigV4AuthType(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Nil(t, opts.endpoints[0].sigV4)
+
+	cfg.Endpoints[0].AuthType = config.PromRemoteSigV4AuthType
+	assertValidationError(t, &cfg, "sigv4 region for endpoint testName must be set")
+
+	cfg.Endpoints[0].SigV4 = &config.PrometheusRemoteBackendSigV4Configuration{
+		Region:    "us-east-1",
+		AccessKey: "AKID",
+	}
+	assertValidationError(t, &cfg, "sigv4 access key and secret key for endpoint testName must be set together")
+
+	cfg.Endpoints[0].SigV4.SecretKey = "SECRET"
+	cfg.Endpoints[0].ApiToken = "token"
+	assertValidationError(t, &cfg, "apiToken for endpoint testName can't be set with sigv4 auth")
+
+	cfg.Endpoints[0].ApiToken = ""
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	require.NotNil(t, opts.endpoints[0].sigV4)
+	assert.Equal(t, "us-east-1", opts.endpoints[0].sigV4.region)
+	assert.Equal(t, "aps", opts.endpoints[0].sigV4.service)
+
+	cfg.Endpoints[0].AuthType = "oauth"
+	assertValidationError(t, &cfg, "unknown auth type oauth")
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	cfg := getValidConfig()
+	cfg.PoolSize = 10
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Nil(t, opts.adaptiveConcurrency)
+
+	cfg.AdaptiveConcurrency = &config.PrometheusRemoteBackendAdaptiveConcurrencyConfiguration{}
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, &adaptiveConcurrencyOptions{minLimit: 1, maxLimit: 10}, opts.adaptiveConcurrency)
+
+	cfg.AdaptiveConcurrency.MinLimit = 4
+	cfg.AdaptiveConcurrency.MaxLimit = 2
+	assertValidationError(t, &cfg, "adaptiveConcurrency minLimit can't be greater than maxLimit")
+
+	cfg.AdaptiveConcurrency.MinLimit = -1
+	assertValidationError(t, &cfg, "adaptiveConcurrency limits can't be negative")
+}
+
+func TestWriteMode(t *testing.T) {
+	cfg := getValidConfig()
+	secondary := getValidEndpointConfiguration()
+	secondary.Name = "secondary"
+	cfg.Endpoints = append(cfg.Endpoints, secondary)
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, WriteModePrimary, opts.writeMode)
+
+	cfg.WriteMode = config.PromRemoteWriteModeFailover
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, WriteModeFailover, opts.writeMode)
+
+	cfg.Endpoints[1].Compression = config.PromRemoteGzipCompression
+	assertValidationError(t, &cfg, "all endpoints must use the same compression in failover write mode")
+
+	// The deprecated snappy framing is compared by the encoding it maps to.
+	cfg.Endpoints[0].Compression = config.PromRemoteSnappyStreamCompression
+	cfg.Endpoints[1].Compression = ""
+	cfg.Endpoints[1].SnappyFraming = config.PromRemoteSnappyStreamFraming
+	_, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	cfg.Endpoints[0].Compression = ""
+	cfg.Endpoints[1].SnappyFraming = ""
+
+	cfg.WriteMode = "broadcast"
+	assertValidationError(t, &cfg, "unknown write mode broadcast")
+}
+
+func TestInFlightPolicy(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 0, opts.maxInFlightBatches)
+	assert.Equal(t, InFlightPolicyBlock, opts.inFlightPolicy)
+
+	cfg.MaxInFlightBatches = 4
+	cfg.InFlightPolicy = config.PromRemoteInFlightShed
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 4, opts.maxInFlightBatches)
+	assert.Equal(t, InFlightPolicyShed, opts.inFlightPolicy)
+
+	cfg.InFlightPolicy = "spill"
+	assertValidationError(t, &cfg, "unknown in-flight policy spill")
+
+	cfg.InFlightPolicy = config.PromRemoteInFlightBlock
+	cfg.MaxInFlightBatches = -1
+	assertValidationError(t, &cfg, "maxInFlightBatches can't be negative")
+}
+
+func TestClosePolicy(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, ClosePolicyDrain, opts.closePolicy)
+
+	cfg.ClosePolicy = config.PromRemoteCloseFastExit
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, ClosePolicyFastExit, opts.closePolicy)
+
+	cfg.ClosePolicy = "abort"
+	assertValidationError(t, &cfg, "unknown close policy abort")
+}
+
+func TestOrderedWriteShards(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 0, opts.orderedWriteShards)
+
+	cfg.OrderedWriteShards = 4
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 4, opts.orderedWriteShards)
+
+	cfg.OrderedWriteShards = -1
+	assertValidationError(t, &cfg, "orderedWriteShards can't be negative")
+}
+
+func TestEndpointAutoDisable(t *testing.T) {
+	cfg := getValidConfig()
+	cfg.WriteMode = config.PromRemoteWriteModeFailover
+	cfg.EndpointAutoDisable = &config.PrometheusRemoteBackendEndpointAutoDisableConfiguration{
+		MinSuccessRatio: 0.8,
+	}
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, &endpointAutoDisableOptions{
+		minSuccessRatio: 0.8,
+		window:          time.Minute,
+		minWrites:       10,
+	}, opts.endpointAutoDisable)
+
+	cfg.EndpointAutoDisable.Window = ptrDuration(time.Millisecond)
+	assertValidationError(t, &cfg, "endpointAutoDisable window must be at least 10ms")
+
+	cfg.EndpointAutoDisable.Window = nil
+	cfg.EndpointAutoDisable.MinSuccessRatio = 1.5
+	assertValidationError(t, &cfg, "endpointAutoDisable minSuccessRatio must be between 0 and 1")
+
+	cfg.EndpointAutoDisable.MinSuccessRatio = 0.8
+	cfg.WriteMode = config.PromRemoteWriteModePrimary
+	assertValidationError(t, &cfg, "endpointAutoDisable requires the failover write mode")
+}
+
+func TestBatchLog(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Nil(t, opts.batchLogger)
+
+	cfg.BatchLog = &config.PrometheusRemoteBackendBatchLogConfiguration{
+		Path: filepath.Join(t.TempDir(), "batches.log"),
+	}
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.NotNil(t, opts.batchLogger)
+
+	cfg.BatchLog.Path = filepath.Join(t.TempDir(), "missing", "batches.log")
+	_, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.Error(t, err)
+}
+
+func TestEndpointConnectionPool(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 0, opts.endpoints[0].maxIdleConnsPerHost)
+	assert.Equal(t, 0, opts.endpoints[0].maxConnsPerHost)
+
+	cfg.Endpoints[0].MaxIdleConnsPerHost = ptrInt(500)
+	cfg.Endpoints[0].MaxConnsPerHost = ptrInt(1000)
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 500, opts.endpoints[0].maxIdleConnsPerHost)
+	assert.Equal(t, 1000, opts.endpoints[0].maxConnsPerHost)
+
+	cfg.Endpoints[0].MaxIdleConnsPerHost = ptrInt(0)
+	assertValidationError(t, &cfg, "maxIdleConnsPerHost for endpoint testName must be positive")
+
+	cfg.Endpoints[0].MaxIdleConnsPerHost = nil
+	cfg.Endpoints[0].MaxConnsPerHost = ptrInt(-1)
+	assertValidationError(t, &cfg, "maxConnsPerHost for endpoint testName must be positive")
+}
+
+func TestEndpointHTTP2(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Nil(t, opts.endpoints[0].http2)
+	assert.Zero(t, opts.endpoints[0].keepAlive)
+	assert.False(t, opts.endpoints[0].dedicatedClient())
+
+	cfg.Endpoints[0].KeepAlive = ptrDuration(30 * time.Second)
+	cfg.Endpoints[0].HTTP2 = &config.PrometheusRemoteBackendHTTP2Configuration{
+		ReadIdleTimeout: 10 * time.Second,
+		PingTimeout:     5 * time.Second,
+	}
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, opts.endpoints[0].keepAlive)
+	assert.Equal(t, &http2Options{readIdleTimeout: 10 * time.Second, pingTimeout: 5 * time.Second},
+		opts.endpoints[0].http2)
+	assert.True(t, opts.endpoints[0].dedicatedClient())
+
+	cfg.Endpoints[0].HTTP2.PingTimeout = -time.Second
+	assertValidationError(t, &cfg, "http2 timeouts for endpoint testName can't be negative")
+
+	cfg.Endpoints[0].HTTP2 = nil
+	cfg.Endpoints[0].KeepAlive = ptrDuration(0)
+	assertValidationError(t, &cfg, "keepAlive for endpoint testName must be positive")
+}
+
 func TestHTTPDefaults(t *testing.T) {
 	cfg, err := NewOptions(&config.PrometheusRemoteBackendConfiguration{
 		Endpoints: []config.PrometheusRemoteBackendEndpointConfiguration{getValidEndpointConfiguration()},
@@ -251,6 +682,120 @@ func TestValidation(t *testing.T) {
 		cfg.ConnectTimeout = ptrDuration(-1)
 		assertValidationError(t, &cfg, "connectTimeout can't be negative")
 	})
+
+	t.Run("non negative series limits", func(t *testing.T) {
+		cfg := getValidConfig()
+		cfg.MaxLabelsPerSeries = -1
+		assertValidationError(t, &cfg, "maxLabelsPerSeries can't be negative")
+
+		cfg = getValidConfig()
+		cfg.MaxLabelNameLength = -1
+		assertValidationError(t, &cfg, "maxLabelNameLength can't be negative")
+
+		cfg = getValidConfig()
+		cfg.MaxLabelValueLength = -1
+		assertValidationError(t, &cfg, "maxLabelValueLength can't be negative")
+
+		cfg = getValidConfig()
+		cfg.MaxDatapointsPerSeries = -1
+		assertValidationError(t, &cfg, "maxDatapointsPerSeries can't be negative")
+
+		cfg = getValidConfig()
+		cfg.DatapointsCapPolicy = "drop"
+		assertValidationError(t, &cfg, "unknown datapoints cap policy drop")
+
+		cfg = getValidConfig()
+		cfg.MaxFutureSkew = -time.Minute
+		assertValidationError(t, &cfg, "maxFutureSkew can't be negative")
+	})
+}
+
+func TestRelabelRules(t *testing.T) {
+	cfg := getValidConfig()
+	cfg.Relabel = []config.PrometheusRemoteBackendRelabelConfiguration{
+		{Action: config.PromRemoteRelabelDrop, Regex: "__tmp_.*"},
+		{Action: config.PromRemoteRelabelAddPrefix, Regex: "job", Replacement: "exported_"},
+	}
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, opts.relabelRules, 2)
+	assert.Equal(t, relabelDrop, opts.relabelRules[0].action)
+	assert.Equal(t, relabelAddPrefix, opts.relabelRules[1].action)
+
+	cfg.Relabel = append(cfg.Relabel, config.PrometheusRemoteBackendRelabelConfiguration{
+		Action: "keep",
+	})
+	assertValidationError(t, &cfg, `unknown relabel action "keep"`)
+}
+
+func TestSeriesLimits(t *testing.T) {
+	cfg := getValidConfig()
+	cfg.MaxLabelsPerSeries = 64
+	cfg.MaxLabelNameLength = 128
+	cfg.MaxLabelValueLength = 2048
+	cfg.MaxDatapointsPerSeries = 100
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, seriesLimits{
+		maxLabels:           64,
+		maxLabelNameLength:  128,
+		maxLabelValueLength: 2048,
+		maxDatapoints:       100,
+	}, opts.seriesLimits)
+
+	cfg.DatapointsCapPolicy = config.PromRemoteDatapointsCapTruncate
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, opts.seriesLimits.truncateDatapoints)
+
+	cfg.MaxFutureSkew = time.Hour
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, opts.seriesLimits.maxFutureSkew)
+}
+
+func TestCoalesceSeries(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, opts.coalesceSeries)
+
+	cfg.CoalesceSeries = true
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, opts.coalesceSeries)
+}
+
+func TestLogSampleRates(t *testing.T) {
+	cfg := getValidConfig()
+	opts, err := NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, defaultLogSampleRate, opts.logSampleRate)
+	assert.Equal(t, defaultWrongTenantLogSampleRate, opts.wrongTenantLogSampleRate)
+
+	cfg.LogSampleRate = ptrFloat64(0.5)
+	cfg.WrongTenantLogSampleRate = ptrFloat64(1)
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, opts.logSampleRate)
+	assert.Equal(t, 1.0, opts.wrongTenantLogSampleRate)
+	assert.Zero(t, opts.defaultTenantLogSampleRate)
+
+	cfg.DefaultTenantLogSampleRate = ptrFloat64(0.1)
+	opts, err = NewOptions(&cfg, tally.NoopScope, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, opts.defaultTenantLogSampleRate)
+
+	cfg.LogSampleRate = ptrFloat64(1.5)
+	assertValidationError(t, &cfg, "logSampleRate must be between 0 and 1")
+
+	cfg.LogSampleRate = nil
+	cfg.WrongTenantLogSampleRate = ptrFloat64(-0.1)
+	assertValidationError(t, &cfg, "wrongTenantLogSampleRate must be between 0 and 1")
+
+	cfg.WrongTenantLogSampleRate = nil
+	cfg.DefaultTenantLogSampleRate = ptrFloat64(2)
+	assertValidationError(t, &cfg, "defaultTenantLogSampleRate must be between 0 and 1")
 }
 
 func TestValidateEndpoint(t *testing.T) {
@@ -266,6 +811,29 @@ func TestValidateEndpoint(t *testing.T) {
 		assertEndpointValidationError(t, cfg, "endpoint address must be set")
 	})
 
+	t.Run("kafka endpoint requires topic", func(t *testing.T) {
+		cfg := getValidEndpointConfiguration()
+		cfg.Type = config.PromRemoteKafkaEndpointType
+		cfg.Address = ""
+		assertEndpointValidationError(t, cfg, "endpoint topic must be set for kafka endpoints")
+
+		cfg.Topic = "remote_write"
+		require.NoError(t, validateEndpointConfiguration(cfg, false))
+	})
+
+	t.Run("idempotency key header can't be tenant header", func(t *testing.T) {
+		cfg := getValidEndpointConfiguration()
+		cfg.TenantHeader = "TENANT"
+		cfg.IdempotencyKeyHeader = "TENANT"
+		assertEndpointValidationError(t, cfg, "header TENANT is reserved for tenant header")
+	})
+
+	t.Run("unknown endpoint type", func(t *testing.T) {
+		cfg := getValidEndpointConfiguration()
+		cfg.Type = "grpc"
+		assertEndpointValidationError(t, cfg, "unknown endpoint type grpc")
+	})
+
 	t.Run("storage policy is optional", func(t *testing.T) {
 		cfg := getValidEndpointConfiguration()
 		cfg.StoragePolicy = nil
@@ -336,3 +904,5 @@ func getValidEndpointConfiguration() config.PrometheusRemoteBackendEndpointConfi
 func ptrDuration(n time.Duration) *time.Duration { return &n }
 
 func ptrInt(n int) *int { return &n }
+
+func ptrFloat64(n float64) *float64 { return &n }
@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"context"
+	"sync"
+
+	"github.com/m3db/m3/src/query/storage"
+)
+
+// seriesOrdering preserves the order of the writes of each series across the
+// batches flushed concurrently: the batches of a tenant are split into shards
+// by series and each shard writes at most one batch at a time, in flush order.
+type seriesOrdering struct {
+	sync.Mutex
+	shards int
+	// last is closed once the last batch dispatched for the shard is written.
+	last map[orderingShard]chan struct{}
+}
+
+type orderingShard struct {
+	tenant tenantKey
+	shard  int
+}
+
+func newSeriesOrdering(shards int) *seriesOrdering {
+	return &seriesOrdering{
+		shards: shards,
+		last:   make(map[orderingShard]chan struct{}),
+	}
+}
+
+// split returns the queries of the batch by shard, keeping their order.
+func (o *seriesOrdering) split(batch []*storage.WriteQuery) [][]*storage.WriteQuery {
+	if o.shards == 1 {
+		return [][]*storage.WriteQuery{batch}
+	}
+	shards := make([][]*storage.WriteQuery, o.shards)
+	for _, query := range batch {
+		shard := query.Tags().HashedID() % uint64(o.shards)
+		shards[shard] = append(shards[shard], query)
+	}
+	return shards
+}
+
+// next returns the turn of the next batch of the shard, which must be taken in
+// flush order.
+func (o *seriesOrdering) next(t tenantKey, shard int) orderingTurn {
+	key := orderingShard{tenant: t, shard: shard}
+	turn := orderingTurn{cur: make(chan struct{})}
+	o.Lock()
+	turn.prev = o.last[key]
+	o.last[key] = turn.cur
+	o.Unlock()
+	return turn
+}
+
+// orderingTurn is the turn of a batch to be written, the zero value never waits.
+type orderingTurn struct {
+	prev <-chan struct{}
+	cur  chan struct{}
+}
+
+// wait blocks until the previous batch of the shard is written, or the writes
+// are cancelled.
+func (t orderingTurn) wait(ctx context.Context) {
+	if t.prev == nil {
+		return
+	}
+	select {
+	case <-t.prev:
+	case <-ctx.Done():
+	}
+}
+
+// done lets the next batch of the shard be written.
+func (t orderingTurn) done() {
+	if t.cur != nil {
+		close(t.cur)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2021  Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremotetest
+
+import (
+	"context"
+	"sync"
+)
+
+// Message is a message recorded by TestProducer.
+type Message struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// TestProducer is an in-memory message producer. Intended for test usage.
+type TestProducer struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+// NewProducer creates a new in-memory producer.
+func NewProducer() *TestProducer {
+	return &TestProducer{}
+}
+
+// Produce records the message, or returns the error set with SetError.
+func (p *TestProducer) Produce(_ context.Context, topic string, key, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, Message{Topic: topic, Key: key, Value: value})
+	return nil
+}
+
+// Messages returns all recorded messages.
+func (p *TestProducer) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
+
+// SetError sets the error returned for all subsequent messages.
+func (p *TestProducer) SetError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
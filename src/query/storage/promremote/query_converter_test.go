@@ -21,14 +21,19 @@
 package promremote
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
 	"testing"
 	"time"
 
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
 	"github.com/m3db/m3/src/query/models"
 	"github.com/m3db/m3/src/query/storage"
 	"github.com/m3db/m3/src/query/ts"
 	xtime "github.com/m3db/m3/src/x/time"
 
+	"github.com/golang/snappy"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -164,27 +169,489 @@ func TestWriteQueryConverter(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			q, err := storage.NewWriteQuery(tc.input)
 			require.NoError(t, err)
-			r, samples := convertWriteQuery([]*storage.WriteQuery{q})
+			r, stats := convertWriteQuery([]*storage.WriteQuery{q}, convertOptions{})
 			assert.Equal(t, tc.expected, r)
-			assert.Equal(t, tc.samples, samples)
+			assert.Equal(t, tc.samples, stats.samples)
 		})
 	}
 }
 
 func TestConvertQueryNil(t *testing.T) {
-	r, samples := convertWriteQuery(nil)
+	r, stats := convertWriteQuery(nil, convertOptions{})
 	assert.Nil(t, r)
-	assert.Equal(t, 0, samples)
+	assert.Equal(t, 0, stats.samples)
+}
+
+func TestConvertQuerySeriesLimits(t *testing.T) {
+	now := xtime.Now()
+	newQuery := func(tags ...models.Tag) *storage.WriteQuery {
+		q, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags: models.Tags{
+				Opts: models.NewTagOptions(),
+				Tags: tags,
+			},
+			Datapoints: ts.Datapoints{
+				{Timestamp: now, Value: 1},
+				{Timestamp: now.Add(time.Second), Value: 2},
+			},
+			Unit: xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		return q
+	}
+	tag := func(name, value string) models.Tag {
+		return models.Tag{Name: []byte(name), Value: []byte(value)}
+	}
+	var (
+		valid         = newQuery(tag("a", "1"), tag("b", "2"))
+		tooManyLabels = newQuery(tag("a", "1"), tag("b", "2"), tag("c", "3"))
+		longName      = newQuery(tag("long_name", "1"))
+		longValue     = newQuery(tag("a", "long_value"))
+		queries       = []*storage.WriteQuery{valid, tooManyLabels, longName, longValue}
+	)
+
+	t.Run("no limits", func(t *testing.T) {
+		r, stats := convertWriteQuery(queries, convertOptions{})
+		require.Len(t, r.Timeseries, 4)
+		assert.Equal(t, convertStats{samples: 8}, stats)
+	})
+
+	t.Run("limits drop individual series", func(t *testing.T) {
+		r, stats := convertWriteQuery(queries, convertOptions{limits: seriesLimits{
+			maxLabels:           2,
+			maxLabelNameLength:  4,
+			maxLabelValueLength: 4,
+		}})
+		require.Len(t, r.Timeseries, 1)
+		assert.Equal(t, []prompb.Label{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+			r.Timeseries[0].Labels)
+		assert.Equal(t, convertStats{
+			samples:        8,
+			droppedSamples: 6,
+			tooManyLabels:  1,
+			labelTooLong:   2,
+		}, stats)
+	})
+
+	t.Run("limits at boundary", func(t *testing.T) {
+		r, stats := convertWriteQuery(queries, convertOptions{limits: seriesLimits{
+			maxLabels:           3,
+			maxLabelNameLength:  len("long_name"),
+			maxLabelValueLength: len("long_value"),
+		}})
+		require.Len(t, r.Timeseries, 4)
+		assert.Equal(t, 0, stats.droppedSamples)
+	})
+
+	t.Run("limits apply after relabeling", func(t *testing.T) {
+		rule, err := newRelabelRule(config.PrometheusRemoteBackendRelabelConfiguration{
+			Action: config.PromRemoteRelabelDrop,
+			Regex:  "c|long_name",
+		})
+		require.NoError(t, err)
+		r, stats := convertWriteQuery([]*storage.WriteQuery{tooManyLabels, longName}, convertOptions{
+			limits:       seriesLimits{maxLabels: 2, maxLabelNameLength: 4},
+			relabelRules: []relabelRule{rule},
+		})
+		require.Len(t, r.Timeseries, 2)
+		assert.Equal(t, []prompb.Label{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+			r.Timeseries[0].Labels)
+		assert.Empty(t, r.Timeseries[1].Labels)
+		assert.Equal(t, 0, stats.droppedSamples)
+	})
+
+	t.Run("all series dropped", func(t *testing.T) {
+		_, stats, err := convertAndEncodeWriteQuery([]*storage.WriteQuery{tooManyLabels},
+			convertOptions{limits: seriesLimits{maxLabels: 1}})
+		require.Error(t, err)
+		assert.Equal(t, 1, stats.tooManyLabels)
+		assert.Equal(t, 2, stats.droppedSamples)
+	})
+}
+
+func TestConvertQuerySkipsMalformedSeries(t *testing.T) {
+	now := xtime.Now()
+	newQuery := func(name, value string) *storage.WriteQuery {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags: models.Tags{Opts: models.NewTagOptions(), Tags: []models.Tag{
+				{Name: []byte(name), Value: []byte(value)},
+			}},
+			Datapoints: ts.Datapoints{{Timestamp: now, Value: 1}, {Timestamp: now.Add(time.Second), Value: 2}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		return wq
+	}
+	var (
+		valid    = newQuery("a", "1")
+		badValue = newQuery("a", "\xff")
+		badName  = newQuery("\xfe", "1")
+	)
+	encoded, stats, err := convertAndEncodeWriteQuery(
+		[]*storage.WriteQuery{badValue, valid, badName}, convertOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, encoded)
+	assert.Equal(t, 1, stats.series)
+	assert.Equal(t, 6, stats.samples)
+	assert.Equal(t, 4, stats.droppedSamples)
+	require.Len(t, stats.skipped, 2)
+	assert.Equal(t, badValue, stats.skipped[0].query)
+	assert.EqualError(t, stats.skipped[0].err, "value of label a is not valid UTF-8")
+	assert.Equal(t, badName, stats.skipped[1].query)
+	assert.EqualError(t, stats.skipped[1].err, `label name "\xfe" is not valid UTF-8`)
+
+	_, stats, err = convertAndEncodeWriteQuery([]*storage.WriteQuery{badValue}, convertOptions{})
+	require.Error(t, err)
+	assert.Len(t, stats.skipped, 1)
+}
+
+func TestConvertQuerySkipsRelabelCollisions(t *testing.T) {
+	now := xtime.Now()
+	newQuery := func(tags ...string) *storage.WriteQuery {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags:       models.MustMakeTags(tags...),
+			Datapoints: ts.Datapoints{{Timestamp: now, Value: 1}, {Timestamp: now.Add(time.Second), Value: 2}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		return wq
+	}
+	rule, err := newRelabelRule(config.PrometheusRemoteBackendRelabelConfiguration{
+		Action:      config.PromRemoteRelabelRename,
+		Regex:       "foo_(.*)",
+		Replacement: "$1",
+	})
+	require.NoError(t, err)
+
+	var (
+		renamed   = newQuery("foo_baz", "1", "qux", "2")
+		colliding = newQuery("bar", "1", "foo_bar", "2")
+	)
+	r, stats := convertWriteQuery([]*storage.WriteQuery{colliding, renamed}, convertOptions{
+		relabelRules: []relabelRule{rule},
+	})
+	require.Len(t, r.Timeseries, 1)
+	assert.Equal(t, []prompb.Label{{Name: "baz", Value: "1"}, {Name: "qux", Value: "2"}},
+		r.Timeseries[0].Labels)
+	assert.Equal(t, 2, stats.droppedSamples)
+	require.Len(t, stats.skipped, 1)
+	assert.Equal(t, colliding, stats.skipped[0].query)
+	assert.EqualError(t, stats.skipped[0].err, "relabeling maps two labels to the same name bar")
+}
+
+func TestConvertQueryCapDatapoints(t *testing.T) {
+	now := xtime.Now().Truncate(time.Second)
+	newQuery := func(value string, n int) *storage.WriteQuery {
+		datapoints := make(ts.Datapoints, 0, n)
+		for i := n - 1; i >= 0; i-- {
+			datapoints = append(datapoints, ts.Datapoint{
+				Timestamp: now.Add(time.Duration(i) * time.Second),
+				Value:     float64(i),
+			})
+		}
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags: models.Tags{Opts: models.NewTagOptions(), Tags: []models.Tag{
+				{Name: []byte("a"), Value: []byte(value)},
+			}},
+			Datapoints: datapoints,
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		return wq
+	}
+	queries := []*storage.WriteQuery{newQuery("big", 5), newQuery("small", 2)}
+	values := func(series prompb.TimeSeries) []float64 {
+		var values []float64
+		for _, sample := range series.Samples {
+			values = append(values, sample.Value)
+		}
+		return values
+	}
+
+	t.Run("split", func(t *testing.T) {
+		promQuery, stats := convertWriteQuery(queries, convertOptions{
+			limits: seriesLimits{maxDatapoints: 2},
+		})
+		require.Len(t, promQuery.Timeseries, 4)
+		for i, expected := range [][]float64{{0, 1}, {2, 3}, {4}} {
+			assert.Equal(t, []prompb.Label{{Name: "a", Value: "big"}}, promQuery.Timeseries[i].Labels)
+			assert.Equal(t, expected, values(promQuery.Timeseries[i]))
+		}
+		assert.Equal(t, []float64{0, 1}, values(promQuery.Timeseries[3]))
+		assert.Equal(t, 1, stats.cappedSeries)
+		assert.Equal(t, 0, stats.droppedSamples)
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		promQuery, stats := convertWriteQuery(queries, convertOptions{
+			limits: seriesLimits{maxDatapoints: 2, truncateDatapoints: true},
+		})
+		require.Len(t, promQuery.Timeseries, 2)
+		// The most recent datapoints of the big series survive.
+		assert.Equal(t, []float64{3, 4}, values(promQuery.Timeseries[0]))
+		assert.Equal(t, []prompb.Sample{
+			{Value: 3, Timestamp: now.Add(3 * time.Second).ToNormalizedTime(time.Millisecond)},
+			{Value: 4, Timestamp: now.Add(4 * time.Second).ToNormalizedTime(time.Millisecond)},
+		}, promQuery.Timeseries[0].Samples)
+		assert.Equal(t, []float64{0, 1}, values(promQuery.Timeseries[1]))
+		assert.Equal(t, 1, stats.cappedSeries)
+		assert.Equal(t, 3, stats.droppedSamples)
+	})
+
+	t.Run("coalesced series are capped", func(t *testing.T) {
+		promQuery, stats := convertWriteQuery([]*storage.WriteQuery{newQuery("small", 2), newQuery("small", 2)},
+			convertOptions{coalesceSeries: true, limits: seriesLimits{maxDatapoints: 3}})
+		require.Len(t, promQuery.Timeseries, 2)
+		assert.Equal(t, 1, stats.cappedSeries)
+	})
+}
+
+func TestConvertQueryMaxFutureSkew(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	newQuery := func(value string, offsets ...time.Duration) *storage.WriteQuery {
+		datapoints := make(ts.Datapoints, 0, len(offsets))
+		for _, offset := range offsets {
+			datapoints = append(datapoints, ts.Datapoint{
+				Timestamp: xtime.ToUnixNano(now.Add(offset)),
+				Value:     offset.Seconds(),
+			})
+		}
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags: models.Tags{Opts: models.NewTagOptions(), Tags: []models.Tag{
+				{Name: []byte("a"), Value: []byte(value)},
+			}},
+			Datapoints: datapoints,
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		return wq
+	}
+	queries := []*storage.WriteQuery{
+		newQuery("mixed", -time.Minute, 0, time.Minute, 3*time.Hour, 5*time.Minute),
+		newQuery("future", 2*time.Hour),
+		newQuery("past", -time.Hour),
+	}
+	values := func(series prompb.TimeSeries) []float64 {
+		var values []float64
+		for _, sample := range series.Samples {
+			values = append(values, sample.Value)
+		}
+		return values
+	}
+
+	t.Run("no limit", func(t *testing.T) {
+		promQuery, stats := convertWriteQuery(queries, convertOptions{now: now})
+		require.Len(t, promQuery.Timeseries, 3)
+		assert.Equal(t, 0, stats.futureSamples)
+		assert.Equal(t, 0, stats.droppedSamples)
+	})
+
+	t.Run("future datapoints are dropped", func(t *testing.T) {
+		promQuery, stats := convertWriteQuery(queries, convertOptions{
+			limits: seriesLimits{maxFutureSkew: 5 * time.Minute},
+			now:    now,
+		})
+		// The series with only future datapoints is left out.
+		require.Len(t, promQuery.Timeseries, 2)
+		assert.Equal(t, []prompb.Label{{Name: "a", Value: "mixed"}}, promQuery.Timeseries[0].Labels)
+		assert.Equal(t, []float64{-60, 0, 60, 300}, values(promQuery.Timeseries[0]))
+		assert.Equal(t, []prompb.Label{{Name: "a", Value: "past"}}, promQuery.Timeseries[1].Labels)
+		assert.Equal(t, []float64{-3600}, values(promQuery.Timeseries[1]))
+		assert.Equal(t, 2, stats.futureSamples)
+		assert.Equal(t, 2, stats.droppedSamples)
+		assert.Equal(t, 7, stats.samples)
+	})
+
+	t.Run("coalesced series", func(t *testing.T) {
+		promQuery, stats := convertWriteQuery([]*storage.WriteQuery{
+			newQuery("a", 2*time.Hour), newQuery("a", 0), newQuery("a", time.Hour),
+		}, convertOptions{
+			coalesceSeries: true,
+			limits:         seriesLimits{maxFutureSkew: time.Minute},
+			now:            now,
+		})
+		require.Len(t, promQuery.Timeseries, 1)
+		assert.Equal(t, []float64{0}, values(promQuery.Timeseries[0]))
+		assert.Equal(t, 2, stats.futureSamples)
+	})
+}
+
+func TestConvertQueryCoalesceSeries(t *testing.T) {
+	now := xtime.Now().Truncate(time.Second)
+	newQuery := func(tags []models.Tag, datapoints ts.Datapoints) *storage.WriteQuery {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags:       models.Tags{Opts: models.NewTagOptions(), Tags: tags},
+			Datapoints: datapoints,
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		return wq
+	}
+	var (
+		a = models.Tag{Name: []byte("a"), Value: []byte("1")}
+		b = models.Tag{Name: []byte("b"), Value: []byte("2")}
+		c = models.Tag{Name: []byte("c"), Value: []byte("3")}
+	)
+	queries := []*storage.WriteQuery{
+		newQuery([]models.Tag{a, b}, ts.Datapoints{
+			{Timestamp: now.Add(2 * time.Second), Value: 3},
+			{Timestamp: now, Value: 1},
+		}),
+		newQuery([]models.Tag{c}, ts.Datapoints{{Timestamp: now, Value: 10}}),
+		newQuery([]models.Tag{a, b}, ts.Datapoints{{Timestamp: now.Add(time.Second), Value: 2}}),
+	}
+
+	promQuery, stats := convertWriteQuery(queries, convertOptions{})
+	require.Len(t, promQuery.Timeseries, 3)
+	assert.Equal(t, 0, stats.coalescedSeries)
+
+	promQuery, stats = convertWriteQuery(queries, convertOptions{coalesceSeries: true})
+	assert.Equal(t, 4, stats.samples)
+	assert.Equal(t, 1, stats.coalescedSeries)
+	ms := now.ToNormalizedTime(time.Millisecond)
+	assert.Equal(t, []prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+			Samples: []prompb.Sample{
+				{Timestamp: ms, Value: 1},
+				{Timestamp: ms + 1000, Value: 2},
+				{Timestamp: ms + 2000, Value: 3},
+			},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "c", Value: "3"}},
+			Samples: []prompb.Sample{{Timestamp: ms, Value: 10}},
+		},
+	}, promQuery.Timeseries)
+}
+
+func TestConvertQueryInjectedLabels(t *testing.T) {
+	now := xtime.Now().Truncate(time.Second)
+	newQuery := func(tags ...models.Tag) *storage.WriteQuery {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags:       models.Tags{Opts: models.NewTagOptions(), Tags: tags},
+			Datapoints: ts.Datapoints{{Timestamp: now, Value: 1}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		return wq
+	}
+	var (
+		job     = models.Tag{Name: []byte("job"), Value: []byte("api")}
+		region  = models.Tag{Name: []byte("region"), Value: []byte("us")}
+		cluster = models.Tag{Name: []byte("cluster"), Value: []byte("c1")}
+		labels  = map[string]string{"cluster": "c1", "region": "eu"}
+	)
+
+	t.Run("no overwrite", func(t *testing.T) {
+		r, _ := convertWriteQuery([]*storage.WriteQuery{newQuery(job), newQuery(job, region)}, convertOptions{
+			labels: newInjectedLabels(labels, false),
+		})
+		require.Len(t, r.Timeseries, 2)
+		assert.Equal(t, []prompb.Label{
+			{Name: "cluster", Value: "c1"}, {Name: "job", Value: "api"}, {Name: "region", Value: "eu"},
+		}, r.Timeseries[0].Labels)
+		assert.Equal(t, []prompb.Label{
+			{Name: "cluster", Value: "c1"}, {Name: "job", Value: "api"}, {Name: "region", Value: "us"},
+		}, r.Timeseries[1].Labels)
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		r, _ := convertWriteQuery([]*storage.WriteQuery{newQuery(job, region)}, convertOptions{
+			labels: newInjectedLabels(labels, true),
+		})
+		require.Len(t, r.Timeseries, 1)
+		assert.Equal(t, []prompb.Label{
+			{Name: "cluster", Value: "c1"}, {Name: "job", Value: "api"}, {Name: "region", Value: "eu"},
+		}, r.Timeseries[0].Labels)
+	})
+
+	t.Run("coalesce", func(t *testing.T) {
+		// Both series end up with the same labels once injected so they are merged.
+		r, stats := convertWriteQuery([]*storage.WriteQuery{newQuery(job), newQuery(cluster, job)}, convertOptions{
+			labels:         newInjectedLabels(map[string]string{"cluster": "c1"}, false),
+			coalesceSeries: true,
+		})
+		require.Len(t, r.Timeseries, 1)
+		assert.Equal(t, 1, stats.coalescedSeries)
+		assert.Equal(t, []prompb.Label{{Name: "cluster", Value: "c1"}, {Name: "job", Value: "api"}},
+			r.Timeseries[0].Labels)
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		_, stats := convertWriteQuery([]*storage.WriteQuery{newQuery(job)}, convertOptions{
+			labels: newInjectedLabels(labels, false),
+			limits: seriesLimits{maxLabels: 2},
+		})
+		assert.Equal(t, 1, stats.tooManyLabels)
+	})
 }
 
 func TestEncodeWriteQuery(t *testing.T) {
-	data, samples, err := convertAndEncodeWriteQuery(nil)
+	data, stats, err := convertAndEncodeWriteQuery(nil, convertOptions{})
 	require.Error(t, err)
 	assert.Len(t, data, 0)
-	assert.Equal(t, 0, samples)
+	assert.Equal(t, 0, stats.samples)
 	assert.Contains(t, err.Error(), "received nil query")
 }
 
+func TestEncodeWriteQueryFraming(t *testing.T) {
+	queries := make([]*storage.WriteQuery, 0, 100)
+	for i := 0; i < 100; i++ {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags: models.Tags{
+				Opts: models.NewTagOptions(),
+				Tags: []models.Tag{{Name: []byte("instance"), Value: []byte(time.Duration(i).String())}},
+			},
+			Datapoints: ts.Datapoints{{Timestamp: xtime.Now(), Value: float64(i)}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		queries = append(queries, wq)
+	}
+	expected, _ := convertWriteQuery(queries, convertOptions{})
+	expectedData, err := expected.Marshal()
+	require.NoError(t, err)
+
+	decoders := map[bodyEncoding]func([]byte) ([]byte, error){
+		snappyBlockEncoding: func(encoded []byte) ([]byte, error) {
+			return snappy.Decode(nil, encoded)
+		},
+		snappyStreamEncoding: func(encoded []byte) ([]byte, error) {
+			return io.ReadAll(snappy.NewReader(bytes.NewReader(encoded)))
+		},
+		gzipEncoding: func(encoded []byte) ([]byte, error) {
+			r, err := gzip.NewReader(bytes.NewReader(encoded))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(r)
+		},
+	}
+	for encoding, decode := range decoders {
+		encoded, stats, err := convertAndEncodeWriteQuery(queries, convertOptions{encoding: encoding})
+		require.NoError(t, err)
+		assert.Equal(t, 100, stats.samples)
+
+		decoded, err := decode(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, expectedData, decoded)
+
+		var actual prompb.WriteRequest
+		require.NoError(t, actual.Unmarshal(decoded))
+		assert.Equal(t, *expected, actual)
+	}
+
+	// The snappy framings aren't interchangeable.
+	block, _, err := convertAndEncodeWriteQuery(queries, convertOptions{encoding: snappyBlockEncoding})
+	require.NoError(t, err)
+	_, err = decoders[snappyStreamEncoding](block)
+	assert.Error(t, err)
+	assert.Equal(t, "snappy", snappyBlockEncoding.contentEncoding())
+	assert.Equal(t, "x-snappy-framed", snappyStreamEncoding.contentEncoding())
+	assert.Equal(t, "gzip", gzipEncoding.contentEncoding())
+}
+
 func promWriteRequest(ts prompb.TimeSeries) *prompb.WriteRequest {
 	return &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{ts}}
 }
@@ -21,8 +21,13 @@
 package promremote
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
 	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/m3db/m3/src/query/storage"
 
@@ -33,56 +38,369 @@ import (
 
 var errNilQuery = errors.New("received nil query or no samples in query")
 
-func convertAndEncodeWriteQuery(queries []*storage.WriteQuery) ([]byte, int, error) {
-	promQuery, samples := convertWriteQuery(queries)
+// seriesLimits bounds the labels of series written to the remote endpoint,
+// series violating any of them are dropped. Zero disables a limit.
+type seriesLimits struct {
+	maxLabels           int
+	maxLabelNameLength  int
+	maxLabelValueLength int
+	// maxDatapoints caps the datapoints of a series instead, the series is split
+	// into several series entries or, if truncateDatapoints is set, truncated
+	// to its most recent datapoints.
+	maxDatapoints      int
+	truncateDatapoints bool
+	// maxFutureSkew drops the datapoints later than now plus the skew, leaving
+	// the rest of their series.
+	maxFutureSkew time.Duration
+}
+
+// convertOptions are the options used when converting a batch of write queries.
+type convertOptions struct {
+	limits       seriesLimits
+	relabelRules []relabelRule
+	encoding     bodyEncoding
+	// coalesceSeries merges the samples of queries with the same labels
+	// into a single series.
+	coalesceSeries bool
+	// labels are injected into every series of the batch.
+	labels injectedLabels
+	// now is the time the datapoints in the future are relative to.
+	now time.Time
+}
+
+// maxTimestamp returns the latest timestamp in milliseconds of the samples
+// written, zero if there is no limit.
+func (o convertOptions) maxTimestamp() int64 {
+	if o.limits.maxFutureSkew <= 0 {
+		return 0
+	}
+	return o.now.Add(o.limits.maxFutureSkew).UnixNano() / int64(time.Millisecond)
+}
+
+// injectedLabels are the labels added to every series written for a tenant.
+type injectedLabels struct {
+	// labels are sorted by name.
+	labels []prompb.Label
+	// overwrite replaces the value of a series label with the same name,
+	// otherwise the series label is kept.
+	overwrite bool
+}
+
+func newInjectedLabels(labels map[string]string, overwrite bool) injectedLabels {
+	result := injectedLabels{
+		labels:    make([]prompb.Label, 0, len(labels)),
+		overwrite: overwrite,
+	}
+	for name, value := range labels {
+		result.labels = append(result.labels, prompb.Label{Name: name, Value: value})
+	}
+	sort.Slice(result.labels, func(i, j int) bool {
+		return result.labels[i].Name < result.labels[j].Name
+	})
+	return result
+}
+
+func (l injectedLabels) empty() bool {
+	return len(l.labels) == 0
+}
+
+// inject adds the injected labels to the series labels, keeping them sorted by name
+// as required by the remote write spec.
+func (l injectedLabels) inject(labels []prompb.Label) []prompb.Label {
+	if l.empty() {
+		return labels
+	}
+	for _, injected := range l.labels {
+		found := false
+		for i := range labels {
+			if labels[i].Name != injected.Name {
+				continue
+			}
+			found = true
+			if l.overwrite {
+				labels[i].Value = injected.Value
+			}
+			break
+		}
+		if !found {
+			labels = append(labels, injected)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
+// convertStats counts the samples seen while converting a batch along with
+// the series and samples dropped for violating seriesLimits.
+type convertStats struct {
+	samples        int
+	droppedSamples int
+	tooManyLabels  int
+	labelTooLong   int
+	// coalescedSeries is the number of queries merged into an earlier series
+	// with the same labels.
+	coalescedSeries int
+	// uncompressedBytes is the size of the encoded batch before compression.
+	uncompressedBytes int
+	// series is the number of series of the encoded batch.
+	series int
+	// cappedSeries is the number of series with more datapoints than the max,
+	// the datapoints truncated are counted in droppedSamples.
+	cappedSeries int
+	// futureSamples is the number of datapoints later than the max future skew,
+	// they are counted in droppedSamples.
+	futureSamples int
+	// skipped are the malformed series left out of the batch, their samples
+	// are counted in droppedSamples.
+	skipped []skippedSeries
+}
+
+// skippedSeries is a series that could not be encoded along with the reason.
+type skippedSeries struct {
+	query *storage.WriteQuery
+	err   error
+}
+
+func convertAndEncodeWriteQuery(
+	queries []*storage.WriteQuery,
+	opts convertOptions,
+) ([]byte, convertStats, error) {
+	promQuery, stats := convertWriteQuery(queries, opts)
 	if promQuery == nil || len(promQuery.Timeseries) == 0 {
-		return []byte{}, samples, errNilQuery
+		return []byte{}, stats, errNilQuery
 	}
+	stats.series = len(promQuery.Timeseries)
 	data, err := promQuery.Marshal()
 	if err != nil {
-		return nil, samples, err
+		return nil, stats, err
+	}
+	stats.uncompressedBytes = len(data)
+	encoded, err := opts.encoding.encode(data)
+	return encoded, stats, err
+}
+
+// encode compresses data with the body encoding.
+func (e bodyEncoding) encode(data []byte) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch e {
+	case snappyStreamEncoding:
+		w = snappy.NewBufferedWriter(&buf)
+	case gzipEncoding:
+		w = gzip.NewWriter(&buf)
+	default:
+		return snappy.Encode(nil, data), nil
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// contentEncoding is the content-encoding header value of data encoded with the body encoding.
+func (e bodyEncoding) contentEncoding() string {
+	switch e {
+	case snappyStreamEncoding:
+		return "x-snappy-framed"
+	case gzipEncoding:
+		return "gzip"
 	}
-	return snappy.Encode(nil, data), samples, nil
+	return "snappy"
 }
 
-func convertWriteQuery(queries []*storage.WriteQuery) (*prompb.WriteRequest, int) {
+func convertWriteQuery(queries []*storage.WriteQuery, opts convertOptions) (*prompb.WriteRequest, convertStats) {
+	var stats convertStats
 	if queries == nil || len(queries) == 0 {
-		return nil, 0
+		return nil, stats
 	}
 	ts := make([]prompb.TimeSeries, 0, len(queries))
-	sampleCount := 0
+	var seriesIndex map[string]int
+	if opts.coalesceSeries {
+		seriesIndex = make(map[string]int, len(queries))
+	}
+	maxTimestamp := opts.maxTimestamp()
 	for _, query := range queries {
 		if query == nil || len(query.Datapoints()) == 0 {
 			continue
 		}
+		stats.samples += len(query.Datapoints())
 		ourLabels := storage.TagsToPromLabels(query.Tags())
-		labels := make([]prompb.Label, 0, len(ourLabels))
+		labels := make([]prompb.Label, 0, len(ourLabels)+len(opts.labels.labels))
 		for _, tag := range ourLabels {
 			labels = append(labels, prompb.Label{
 				Name:  string(tag.Name),
 				Value: string(tag.Value),
 			})
 		}
-		sampleCount += len(query.Datapoints())
-		samples := make([]prompb.Sample, 0, len(query.Datapoints()))
-		for _, dp := range query.Datapoints() {
-			samples = append(samples, prompb.Sample{
-				Value:     dp.Value,
-				Timestamp: dp.Timestamp.ToNormalizedTime(time.Millisecond),
-			})
+		labels, err := applyRelabelRules(opts.relabelRules, labels)
+		if err != nil {
+			stats.skipped = append(stats.skipped, skippedSeries{query: query, err: err})
+			stats.droppedSamples += len(query.Datapoints())
+			continue
+		}
+		// Injected labels are added after relabeling so that they can't be dropped,
+		// and before the limits and coalescing so that they count towards both.
+		labels = opts.labels.inject(labels)
+		if opts.limits.maxLabels > 0 && len(labels) > opts.limits.maxLabels {
+			stats.tooManyLabels++
+			stats.droppedSamples += len(query.Datapoints())
+			continue
+		}
+		if !opts.limits.labelsWithinLength(labels) {
+			stats.labelTooLong++
+			stats.droppedSamples += len(query.Datapoints())
+			continue
+		}
+		// Malformed series are skipped rather than failing the whole batch.
+		if err := validateLabels(labels); err != nil {
+			stats.skipped = append(stats.skipped, skippedSeries{query: query, err: err})
+			stats.droppedSamples += len(query.Datapoints())
+			continue
+		}
+		var key string
+		if seriesIndex != nil {
+			key = seriesKey(labels)
+			if i, ok := seriesIndex[key]; ok {
+				ts[i].Samples = appendSamples(ts[i].Samples, query, maxTimestamp, &stats)
+				stats.coalescedSeries++
+				continue
+			}
+		}
+		samples := appendSamples(make([]prompb.Sample, 0, len(query.Datapoints())), query, maxTimestamp, &stats)
+		if len(samples) == 0 {
+			// All the datapoints of the series are in the future.
+			continue
+		}
+		if seriesIndex != nil {
+			seriesIndex[key] = len(ts)
 		}
-		// Need to make sure the samples meet remote write spec:
-		// https://prometheus.io/docs/concepts/remote_write_spec/#ordering
-		sort.Slice(samples, func(i, j int) bool {
-			return samples[i].Timestamp < samples[j].Timestamp
-		})
 		ts = append(ts, prompb.TimeSeries{
 			Labels:  labels,
 			Samples: samples,
 		})
 	}
+	for _, series := range ts {
+		// Need to make sure the samples meet remote write spec:
+		// https://prometheus.io/docs/concepts/remote_write_spec/#ordering
+		samples := series.Samples
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].Timestamp < samples[j].Timestamp
+		})
+	}
+	if opts.limits.maxDatapoints > 0 {
+		ts = opts.limits.capDatapoints(ts, &stats)
+	}
 
 	return &prompb.WriteRequest{
 		Timeseries: ts,
-	}, sampleCount
+	}, stats
+}
+
+// appendSamples appends the datapoints of the query, except those later than
+// maxTimestamp when it is positive.
+func appendSamples(
+	samples []prompb.Sample,
+	query *storage.WriteQuery,
+	maxTimestamp int64,
+	stats *convertStats,
+) []prompb.Sample {
+	for _, dp := range query.Datapoints() {
+		timestamp := dp.Timestamp.ToNormalizedTime(time.Millisecond)
+		if maxTimestamp > 0 && timestamp > maxTimestamp {
+			stats.futureSamples++
+			stats.droppedSamples++
+			continue
+		}
+		samples = append(samples, prompb.Sample{
+			Value:     dp.Value,
+			Timestamp: timestamp,
+		})
+	}
+	return samples
+}
+
+// seriesKey identifies a label set regardless of the order of the labels.
+func seriesKey(labels []prompb.Label) string {
+	sorted := make([]prompb.Label, len(labels))
+	copy(sorted, labels)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	var b strings.Builder
+	for _, label := range sorted {
+		b.WriteString(label.Name)
+		b.WriteByte(0xff)
+		b.WriteString(label.Value)
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// validateLabels returns an error if the labels can't be written as a remote
+// write series, e.g. because relabeling emptied a label name.
+func validateLabels(labels []prompb.Label) error {
+	for _, label := range labels {
+		if label.Name == "" {
+			return errors.New("empty label name")
+		}
+		if !utf8.ValidString(label.Name) {
+			return errors.Errorf("label name %q is not valid UTF-8", label.Name)
+		}
+		if !utf8.ValidString(label.Value) {
+			return errors.Errorf("value of label %s is not valid UTF-8", label.Name)
+		}
+	}
+	return nil
+}
+
+// capDatapoints splits or truncates the series with more datapoints than the
+// max, whose samples must be sorted by time. Truncating keeps the most recent
+// samples, a backlogged producer flushing stale datapoints still writes its
+// latest values.
+func (l seriesLimits) capDatapoints(ts []prompb.TimeSeries, stats *convertStats) []prompb.TimeSeries {
+	capped := make([]prompb.TimeSeries, 0, len(ts))
+	for _, series := range ts {
+		if len(series.Samples) <= l.maxDatapoints {
+			capped = append(capped, series)
+			continue
+		}
+		stats.cappedSeries++
+		if l.truncateDatapoints {
+			dropped := len(series.Samples) - l.maxDatapoints
+			stats.droppedSamples += dropped
+			series.Samples = series.Samples[dropped:]
+			capped = append(capped, series)
+			continue
+		}
+		for start := 0; start < len(series.Samples); start += l.maxDatapoints {
+			end := start + l.maxDatapoints
+			if end > len(series.Samples) {
+				end = len(series.Samples)
+			}
+			capped = append(capped, prompb.TimeSeries{
+				Labels:  series.Labels,
+				Samples: series.Samples[start:end],
+			})
+		}
+	}
+	return capped
+}
+
+func (l seriesLimits) labelsWithinLength(labels []prompb.Label) bool {
+	for _, label := range labels {
+		if l.maxLabelNameLength > 0 && len(label.Name) > l.maxLabelNameLength {
+			return false
+		}
+		if l.maxLabelValueLength > 0 && len(label.Value) > l.maxLabelValueLength {
+			return false
+		}
+	}
+	return true
 }
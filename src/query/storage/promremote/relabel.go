@@ -0,0 +1,118 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+type relabelAction int
+
+const (
+	relabelDrop relabelAction = iota
+	relabelRename
+	relabelAddPrefix
+)
+
+// relabelRule is a compiled label rewrite applied to every series before it
+// is written. It is a small subset of Prometheus relabeling that only
+// operates on label names.
+type relabelRule struct {
+	action      relabelAction
+	regex       *regexp.Regexp
+	replacement string
+}
+
+func newRelabelRule(cfg config.PrometheusRemoteBackendRelabelConfiguration) (relabelRule, error) {
+	var action relabelAction
+	switch cfg.Action {
+	case config.PromRemoteRelabelDrop:
+		action = relabelDrop
+	case config.PromRemoteRelabelRename:
+		action = relabelRename
+	case config.PromRemoteRelabelAddPrefix:
+		action = relabelAddPrefix
+	default:
+		return relabelRule{}, fmt.Errorf("unknown relabel action %q", cfg.Action)
+	}
+	if action != relabelDrop && cfg.Replacement == "" {
+		return relabelRule{}, fmt.Errorf("relabel action %s requires a replacement", cfg.Action)
+	}
+	// NB: anchor the regex so it has to match the whole label name, same as Prometheus.
+	regex, err := regexp.Compile("^(?:" + cfg.Regex + ")$")
+	if err != nil {
+		return relabelRule{}, fmt.Errorf("invalid relabel regex %s: %w", cfg.Regex, err)
+	}
+	return relabelRule{
+		action:      action,
+		regex:       regex,
+		replacement: cfg.Replacement,
+	}, nil
+}
+
+// applyRelabelRules applies the rules in order to the given labels, reusing
+// the labels slice. Labels are re-sorted by name as required by the remote
+// write spec since renames may change their order. An error is returned when
+// the renames map two labels to the same name, the series can't be written.
+func applyRelabelRules(rules []relabelRule, labels []prompb.Label) ([]prompb.Label, error) {
+	if len(rules) == 0 {
+		return labels, nil
+	}
+	renamed := false
+	for _, rule := range rules {
+		result := labels[:0]
+		for _, label := range labels {
+			if !rule.regex.MatchString(label.Name) {
+				result = append(result, label)
+				continue
+			}
+			switch rule.action {
+			case relabelDrop:
+				continue
+			case relabelRename:
+				label.Name = rule.regex.ReplaceAllString(label.Name, rule.replacement)
+				renamed = true
+			case relabelAddPrefix:
+				label.Name = rule.replacement + label.Name
+				renamed = true
+			}
+			result = append(result, label)
+		}
+		labels = result
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	if renamed {
+		for i := 1; i < len(labels); i++ {
+			if labels[i-1].Name == labels[i].Name {
+				return nil, fmt.Errorf("relabeling maps two labels to the same name %s", labels[i].Name)
+			}
+		}
+	}
+	return labels, nil
+}
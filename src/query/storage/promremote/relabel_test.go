@@ -0,0 +1,204 @@
+// Copyright (c) 2021 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"testing"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRelabelRule(t *testing.T) {
+	t.Run("unknown action", func(t *testing.T) {
+		_, err := newRelabelRule(config.PrometheusRemoteBackendRelabelConfiguration{
+			Action: "keep",
+			Regex:  "foo",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown relabel action "keep"`)
+	})
+
+	t.Run("replacement required", func(t *testing.T) {
+		_, err := newRelabelRule(config.PrometheusRemoteBackendRelabelConfiguration{
+			Action: config.PromRemoteRelabelRename,
+			Regex:  "foo",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "relabel action rename requires a replacement")
+	})
+
+	t.Run("invalid regex", func(t *testing.T) {
+		_, err := newRelabelRule(config.PrometheusRemoteBackendRelabelConfiguration{
+			Action: config.PromRemoteRelabelDrop,
+			Regex:  "(",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid relabel regex")
+	})
+}
+
+func TestApplyRelabelRules(t *testing.T) {
+	newRules := func(cfgs ...config.PrometheusRemoteBackendRelabelConfiguration) []relabelRule {
+		rules := make([]relabelRule, 0, len(cfgs))
+		for _, cfg := range cfgs {
+			rule, err := newRelabelRule(cfg)
+			require.NoError(t, err)
+			rules = append(rules, rule)
+		}
+		return rules
+	}
+	newLabels := func() []prompb.Label {
+		return []prompb.Label{
+			{Name: "__name__", Value: "requests"},
+			{Name: "__tmp_shard", Value: "1"},
+			{Name: "instance", Value: "host"},
+			{Name: "job", Value: "api"},
+		}
+	}
+
+	tcs := []struct {
+		name     string
+		rules    []relabelRule
+		expected []prompb.Label
+	}{
+		{
+			name:     "no rules",
+			expected: newLabels(),
+		},
+		{
+			name: "drop",
+			rules: newRules(config.PrometheusRemoteBackendRelabelConfiguration{
+				Action: config.PromRemoteRelabelDrop,
+				Regex:  "__tmp_.*",
+			}),
+			expected: []prompb.Label{
+				{Name: "__name__", Value: "requests"},
+				{Name: "instance", Value: "host"},
+				{Name: "job", Value: "api"},
+			},
+		},
+		{
+			name: "regex matches the whole name",
+			rules: newRules(config.PrometheusRemoteBackendRelabelConfiguration{
+				Action: config.PromRemoteRelabelDrop,
+				Regex:  "inst",
+			}),
+			expected: newLabels(),
+		},
+		{
+			name: "rename with capture group",
+			rules: newRules(config.PrometheusRemoteBackendRelabelConfiguration{
+				Action:      config.PromRemoteRelabelRename,
+				Regex:       "__tmp_(.*)",
+				Replacement: "m3_$1",
+			}),
+			expected: []prompb.Label{
+				{Name: "__name__", Value: "requests"},
+				{Name: "instance", Value: "host"},
+				{Name: "job", Value: "api"},
+				{Name: "m3_shard", Value: "1"},
+			},
+		},
+		{
+			name: "add prefix",
+			rules: newRules(config.PrometheusRemoteBackendRelabelConfiguration{
+				Action:      config.PromRemoteRelabelAddPrefix,
+				Regex:       "instance|job",
+				Replacement: "exported_",
+			}),
+			expected: []prompb.Label{
+				{Name: "__name__", Value: "requests"},
+				{Name: "__tmp_shard", Value: "1"},
+				{Name: "exported_instance", Value: "host"},
+				{Name: "exported_job", Value: "api"},
+			},
+		},
+		{
+			name: "rules are applied in order",
+			rules: newRules(
+				config.PrometheusRemoteBackendRelabelConfiguration{
+					Action:      config.PromRemoteRelabelRename,
+					Regex:       "job",
+					Replacement: "__tmp_job",
+				},
+				config.PrometheusRemoteBackendRelabelConfiguration{
+					Action: config.PromRemoteRelabelDrop,
+					Regex:  "__tmp_.*",
+				},
+			),
+			expected: []prompb.Label{
+				{Name: "__name__", Value: "requests"},
+				{Name: "instance", Value: "host"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			labels, err := applyRelabelRules(tc.rules, newLabels())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, labels)
+		})
+	}
+}
+
+func TestApplyRelabelRulesCollision(t *testing.T) {
+	tcs := []struct {
+		name string
+		cfg  config.PrometheusRemoteBackendRelabelConfiguration
+	}{
+		{
+			name: "rename",
+			cfg: config.PrometheusRemoteBackendRelabelConfiguration{
+				Action:      config.PromRemoteRelabelRename,
+				Regex:       "foo_(.*)",
+				Replacement: "$1",
+			},
+		},
+		{
+			name: "add prefix",
+			cfg: config.PrometheusRemoteBackendRelabelConfiguration{
+				Action:      config.PromRemoteRelabelAddPrefix,
+				Regex:       "bar",
+				Replacement: "foo_",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := newRelabelRule(tc.cfg)
+			require.NoError(t, err)
+			_, err = applyRelabelRules([]relabelRule{rule}, []prompb.Label{
+				{Name: "bar", Value: "1"},
+				{Name: "foo_bar", Value: "2"},
+			})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "relabeling maps two labels to the same name")
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// defaultSigV4Service is the service of AWS managed Prometheus endpoints.
+const defaultSigV4Service = "aps"
+
+// sigV4Signer signs requests with AWS SigV4.
+type sigV4Signer struct {
+	signer  *v4.Signer
+	region  string
+	service string
+}
+
+func newSigV4Signer(cfg *config.PrometheusRemoteBackendSigV4Configuration) (*sigV4Signer, error) {
+	if cfg == nil {
+		return nil, errors.New("sigv4 configuration must be set")
+	}
+	var creds *credentials.Credentials
+	if cfg.AccessKey != "" {
+		creds = credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")
+	} else {
+		// The credentials of the default chain are cached and refreshed once they expire.
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config:  aws.Config{Region: aws.String(cfg.Region)},
+			Profile: cfg.Profile,
+		})
+		if err != nil {
+			return nil, err
+		}
+		creds = sess.Config.Credentials
+	}
+	service := cfg.Service
+	if service == "" {
+		service = defaultSigV4Service
+	}
+	return &sigV4Signer{
+		signer:  v4.NewSigner(creds),
+		region:  cfg.Region,
+		service: service,
+	}, nil
+}
+
+// sign signs the request with the given body, which also becomes the request body.
+func (s *sigV4Signer) sign(req *http.Request, body []byte) error {
+	_, err := s.signer.Sign(req, bytes.NewReader(body), s.service, s.region, time.Now())
+	return err
+}
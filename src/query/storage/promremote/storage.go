@@ -22,12 +22,18 @@ package promremote
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -37,27 +43,78 @@ import (
 	"github.com/m3db/m3/src/query/storage"
 	"github.com/m3db/m3/src/query/storage/m3/consolidators"
 	"github.com/m3db/m3/src/query/storage/m3/storagemetadata"
+	"github.com/m3db/m3/src/query/tracepoint"
 	"github.com/m3db/m3/src/query/ts"
 	xerrors "github.com/m3db/m3/src/x/errors"
 	"github.com/m3db/m3/src/x/instrument"
 	xhttp "github.com/m3db/m3/src/x/net/http"
 	xsync "github.com/m3db/m3/src/x/sync"
 
+	"github.com/golang/snappy"
+	"github.com/google/uuid"
+	"github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
 	"github.com/pkg/errors"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
 )
 
 const metricsScope = "prom_remote_storage"
-const logSamplingRate = 0.001
+
+const (
+	defaultLogSampleRate            = 0.001
+	defaultWrongTenantLogSampleRate = 0.01
+
+	remoteWriteVersionHeader  = "X-Prometheus-Remote-Write-Version"
+	defaultRemoteWriteVersion = "0.1.0"
+
+	// requestIDHeader carries the id generated for every batch, which is
+	// logged along with the batch so that backend logs can be correlated.
+	requestIDHeader = "X-Request-ID"
+
+	// fastExitGrace is how long Close attempts to flush the pending writes with
+	// the fast exit close policy, unless the close timeout is shorter.
+	fastExitGrace = time.Second
+)
 
 var errorReadingBody = []byte("error reading body")
 
+var errBatchShed = errors.New("batch shed by the in-flight batch limit")
+
 // WriteQueue A thread-safe queue
 type WriteQueue struct {
 	t        tenantKey
 	capacity int
-	queries  []*storage.WriteQuery
+	// batches batches the queries of the tenant, see BatchQueue.
+	batches BatchQueue
+	// oldest is when the first query currently in the queue was added.
+	oldest time.Time
+	// maxFlushDelay is how long a query may wait in the queue before it is
+	// flushed regardless of the tick, zero means it is only flushed on tick.
+	maxFlushDelay time.Duration
+	// endpoints override the global endpoints for the writes of the tenant when set.
+	endpoints []EndpointOptions
+	// labels are injected into every series written for the tenant.
+	labels injectedLabels
+	// sampleRate is the fraction of the tenant's writes kept, zero keeps all of them.
+	sampleRate  float64
+	sampledDrop tally.Counter
+	// enqueuedSamples and lastFlush are only tracked for debugging, see QueueStats.
+	enqueuedSamples int64
+	lastFlush       time.Time
+	// droppedSamples are samples of this tenant dropped or failed to be written.
+	droppedSamples atomic.Int64
+	// bytesMetrics are the bytes of this tenant written by endpoint name.
+	bytesMetrics map[string]tenantBytesMetrics
+	// drainFlushed, drainFailed and drainAbandoned count the writes of this
+	// tenant completed while closing, see TenantDrainStats.
+	drainFlushed   atomic.Int64
+	drainFailed    atomic.Int64
+	drainAbandoned atomic.Int64
+	// tenantMetrics are the tenant tagged counters, see tenantMetrics.
+	tenantMetrics lazyTenantMetrics
 
 	sync.RWMutex
 }
@@ -65,15 +122,83 @@ type WriteQueue struct {
 func NewWriteQueue(t tenantKey, capacity int) *WriteQueue {
 	return &WriteQueue{
 		t:        t,
+		capacity: capacity,
+		batches:  newSizedBatchQueue(capacity),
+	}
+}
+
+// newTenantWriteQueue returns the queue of the tenant, batching with the batch
+// queue of the options if set.
+func newTenantWriteQueue(opts Options, t tenantKey) *WriteQueue {
+	queue := NewWriteQueue(t, opts.queueSize)
+	if opts.newBatchQueueFn != nil {
+		queue.batches = opts.newBatchQueueFn(string(t), opts.queueSize)
+	}
+	return queue
+}
+
+// sizedBatchQueue is the default BatchQueue, returning a batch once the
+// capacity is reached.
+type sizedBatchQueue struct {
+	capacity int
+	queries  []*storage.WriteQuery
+}
+
+func newSizedBatchQueue(capacity int) *sizedBatchQueue {
+	return &sizedBatchQueue{
 		capacity: capacity,
 		queries:  make([]*storage.WriteQuery, 0, capacity),
 	}
 }
 
+func (q *sizedBatchQueue) Add(query *storage.WriteQuery) []*storage.WriteQuery {
+	var res []*storage.WriteQuery
+	if len(q.queries) >= q.capacity {
+		res = q.Pop()
+	}
+	q.queries = append(q.queries, query)
+	return res
+}
+
+func (q *sizedBatchQueue) Len() int {
+	return len(q.queries)
+}
+
+func (q *sizedBatchQueue) Pop() []*storage.WriteQuery {
+	res := q.queries
+	q.queries = make([]*storage.WriteQuery, 0, q.capacity)
+	return res
+}
+
+// tenantBytesMetrics count the bytes of a tenant successfully written to an endpoint.
+type tenantBytesMetrics struct {
+	written             tally.Counter
+	uncompressedWritten tally.Counter
+}
+
+// initBytesMetrics creates the bytes metrics of the tenant for each of its endpoints,
+// which keeps the cardinality of the metrics bounded by the fixed tenants.
+func (wq *WriteQueue) initBytesMetrics(scope tally.Scope, endpoints []EndpointOptions) {
+	wq.bytesMetrics = make(map[string]tenantBytesMetrics, len(endpoints))
+	for _, endpoint := range endpoints {
+		tenantScope := scope.Tagged(map[string]string{
+			"tenant":        string(wq.t),
+			"endpoint_name": endpoint.name,
+		})
+		wq.bytesMetrics[endpoint.name] = tenantBytesMetrics{
+			written:             tenantScope.Counter("bytes_written"),
+			uncompressedWritten: tenantScope.Counter("uncompressed_bytes_written"),
+		}
+	}
+}
+
 // This one can only be called with the lock held by the call site.
 func (wq *WriteQueue) popUnderLock() []*storage.WriteQuery {
-	res := wq.queries
-	wq.queries = make([]*storage.WriteQuery, 0, wq.capacity)
+	res := wq.batches.Pop()
+	wq.oldest = time.Time{}
+	if len(res) > 0 {
+		wq.lastFlush = time.Now()
+	}
 	return res
 }
 
@@ -86,7 +211,7 @@ func (wq *WriteQueue) pop() []*storage.WriteQuery {
 func (wq *WriteQueue) Len() int {
 	wq.RLock()
 	defer wq.RUnlock()
-	return len(wq.queries)
+	return wq.batches.Len()
 }
 
 func (wq *WriteQueue) Add(query *storage.WriteQuery) []*storage.WriteQuery {
@@ -96,26 +221,62 @@ func (wq *WriteQueue) Add(query *storage.WriteQuery) []*storage.WriteQuery {
 	// but the majority of the time it won't be full and therefore not worth optimizating.
 	// NB: we have to check if the queue is full under the lock. Otherwise, two goroutines
 	// may see the full queue and try to pop it at the same time.
-	var res []*storage.WriteQuery
-	if len(wq.queries) >= wq.capacity {
-		res = wq.popUnderLock()
+	res := wq.batches.Add(query)
+	if len(res) > 0 {
+		wq.lastFlush = time.Now()
+		wq.oldest = time.Time{}
+	}
+	if wq.oldest.IsZero() {
+		wq.oldest = time.Now()
 	}
-	wq.queries = append(wq.queries, query)
+	wq.enqueuedSamples += int64(query.Datapoints().Len())
+	wq.metrics().enqueuedSamples.Inc(int64(query.Datapoints().Len()))
 	return res
 }
 
-func (wq *WriteQueue) Flush(ctx context.Context, p *promStorage) {
+// addEnqueuedSamples tracks samples written for the tenant without going through the queue.
+func (wq *WriteQueue) addEnqueuedSamples(samples int64) {
+	wq.Lock()
+	defer wq.Unlock()
+	wq.enqueuedSamples += samples
+	wq.metrics().enqueuedSamples.Inc(samples)
+}
+
+// stats returns a snapshot of the queue, only holding the read lock while copying.
+func (wq *WriteQueue) stats() TenantQueueStats {
+	wq.RLock()
+	defer wq.RUnlock()
+	return TenantQueueStats{
+		Tenant:          string(wq.t),
+		Length:          wq.batches.Len(),
+		Capacity:        wq.capacity,
+		EnqueuedSamples: wq.enqueuedSamples,
+		DroppedSamples:  wq.droppedSamples.Load(),
+		LastFlush:       wq.lastFlush,
+	}
+}
+
+// overdue returns true if the oldest query in the queue has waited longer than maxFlushDelay.
+func (wq *WriteQueue) overdue(now time.Time) bool {
+	if wq.maxFlushDelay <= 0 {
+		return false
+	}
+	wq.RLock()
+	defer wq.RUnlock()
+	return wq.batches.Len() > 0 && now.Sub(wq.oldest) >= wq.maxFlushDelay
+}
+
+// Flush pops the queued queries and submits their write to the worker pool, like
+// full batches returned by Add, so that all writes are bounded by the pool size.
+// It returns the number of queries flushed.
+func (wq *WriteQueue) Flush(ctx context.Context, p *promStorage, wg *sync.WaitGroup) int {
 	data := wq.pop()
-	size := int64(len(data))
-	if size == 0 {
-		return
+	if len(data) == 0 {
+		return 0
 	}
 	p.tickWrites.Inc(1)
-	if err := p.writeBatch(ctx, wq.t, data); err != nil {
-		p.logger.Error("error writing async batch",
-			zap.String("tenant", string(wq.t)),
-			zap.Error(err))
-	}
+	p.submitBatch(ctx, wg, wq.t, data, nil)
+	return len(data)
 }
 
 // introduce a dead letter queue to store the timed out samples from main queue
@@ -179,57 +340,186 @@ func validateOptions(opts Options) error {
 	if opts.tickDuration == nil {
 		return errors.New("tickDuration must be set")
 	}
+	if opts.maxInFlightBatches < 0 {
+		return errors.New("maxInFlightBatches must be greater than or equal to 0")
+	}
+	if opts.orderedWriteShards < 0 {
+		return errors.New("orderedWriteShards must be greater than or equal to 0")
+	}
 	if len(opts.endpoints) == 0 {
 		return errors.New("endpoint must not be empty")
 	}
+	for _, rule := range opts.tenantRules {
+		if rule.Endpoints != nil && len(rule.Endpoints) == 0 {
+			return fmt.Errorf("endpoint must not be empty for tenant %s", rule.Tenant)
+		}
+	}
+	for _, endpoint := range allEndpoints(opts) {
+		if endpoint.endpointType == kafkaEndpointType && opts.messageProducer == nil {
+			return fmt.Errorf("message producer must be set for kafka endpoint %s", endpoint.name)
+		}
+	}
 	return nil
 }
 
+func newHTTPClient(opts Options, httpOptions xhttp.HTTPClientOptions, h2 *http2Options) (*http.Client, error) {
+	client := xhttp.NewHTTPClient(httpOptions)
+	if opts.roundTripper != nil {
+		client.Transport = opts.roundTripper
+		return client, nil
+	}
+	if h2 == nil {
+		return client, nil
+	}
+	// NB: the transport dials with a custom dialer so HTTP/2 must be forced.
+	transport := client.Transport.(*http.Transport)
+	transport.ForceAttemptHTTP2 = true
+	h2Transport, err := http2.ConfigureTransports(transport)
+	if err != nil {
+		return nil, err
+	}
+	h2Transport.ReadIdleTimeout = h2.readIdleTimeout
+	h2Transport.PingTimeout = h2.pingTimeout
+	return client, nil
+}
+
+// allEndpoints returns the global endpoints followed by the endpoints of the tenant rules.
+func allEndpoints(opts Options) []EndpointOptions {
+	endpoints := append([]EndpointOptions(nil), opts.endpoints...)
+	for _, rule := range opts.tenantRules {
+		endpoints = append(endpoints, rule.Endpoints...)
+	}
+	return endpoints
+}
+
 // NewStorage returns new Prometheus remote write compatible storage
 func NewStorage(opts Options) (storage.Storage, error) {
 	if err := validateOptions(opts); err != nil {
 		return nil, err
 	}
 	opts.logger.Info("Creating a new promoremote storage...")
-	client := xhttp.NewHTTPClient(opts.httpOptions)
+	if opts.tracer == nil {
+		opts.tracer = opentracing.NoopTracer{}
+	}
+	client, err := newHTTPClient(opts, opts.httpOptions, nil)
+	if err != nil {
+		return nil, err
+	}
+	endpointClients := make(map[string]*http.Client)
+	for _, endpoint := range allEndpoints(opts) {
+		if !endpoint.dedicatedClient() {
+			continue
+		}
+		// Endpoints tuning their connections get a dedicated client.
+		httpOptions := opts.httpOptions
+		if endpoint.maxIdleConnsPerHost > 0 {
+			httpOptions.MaxIdleConnsPerHost = endpoint.maxIdleConnsPerHost
+		}
+		if endpoint.maxConnsPerHost > 0 {
+			httpOptions.MaxConnsPerHost = endpoint.maxConnsPerHost
+		}
+		if endpoint.keepAlive > 0 {
+			httpOptions.KeepAlive = endpoint.keepAlive
+		}
+		endpointClient, err := newHTTPClient(opts, httpOptions, endpoint.http2)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create http client for endpoint %s: %w", endpoint.name, err)
+		}
+		endpointClients[endpoint.name] = endpointClient
+	}
 	scope := opts.scope.SubScope(metricsScope)
+	opts.tenantRules = sortTenantRules(opts.tenantRules)
 	// Use fixed
 	queriesWithFixedTenants := make(map[tenantKey]*WriteQueue, len(opts.tenantRules)+1)
-	queriesWithFixedTenants[tenantKey(opts.tenantDefault)] = NewWriteQueue(tenantKey(opts.tenantDefault), opts.queueSize)
+	queriesWithFixedTenants[tenantKey(opts.tenantDefault)] = newTenantWriteQueue(opts, tenantKey(opts.tenantDefault))
 	for _, rule := range opts.tenantRules {
-		tenant := tenantKey(rule.Tenant)
-		if _, ok := queriesWithFixedTenants[tenant]; !ok {
-			opts.logger.Info("Added a new tenant to the fixed tenant list", zap.String("tenant", string(tenant)))
-			queriesWithFixedTenants[tenant] = NewWriteQueue(tenant, opts.queueSize)
+		tenants := []tenantKey{tenantKey(rule.Tenant)}
+		if rule.SplitTenant != "" {
+			tenants = append(tenants, tenantKey(rule.SplitTenant))
+		}
+		for _, tenant := range tenants {
+			if _, ok := queriesWithFixedTenants[tenant]; !ok {
+				opts.logger.Info("Added a new tenant to the fixed tenant list", zap.String("tenant", string(tenant)))
+				queriesWithFixedTenants[tenant] = newTenantWriteQueue(opts, tenant)
+			}
+			// If several rules route to the same tenant, the tightest delay wins.
+			if queue := queriesWithFixedTenants[tenant]; rule.MaxFlushDelay > 0 &&
+				(queue.maxFlushDelay == 0 || rule.MaxFlushDelay < queue.maxFlushDelay) {
+				queue.maxFlushDelay = rule.MaxFlushDelay
+			}
+			if queue := queriesWithFixedTenants[tenant]; rule.Endpoints != nil && queue.endpoints == nil {
+				queue.endpoints = rule.Endpoints
+			}
+			if queue := queriesWithFixedTenants[tenant]; len(rule.Labels) > 0 && queue.labels.empty() {
+				queue.labels = newInjectedLabels(rule.Labels, rule.OverwriteLabels)
+			}
+			// If several rules route to the same tenant, the lowest sample rate wins.
+			if queue := queriesWithFixedTenants[tenant]; rule.SampleRate > 0 &&
+				(queue.sampleRate == 0 || rule.SampleRate < queue.sampleRate) {
+				queue.sampleRate = rule.SampleRate
+			}
 		}
 	}
 	// large data queue size to avoid dropping samples
 	dataQueueCapacity := (opts.retries + 1) * len(opts.tenantRules) * opts.queueSize
 	opts.logger.Info("Creating data queue", zap.Int("capacity", dataQueueCapacity))
 	s := &promStorage{
-		opts:            opts,
-		client:          client,
-		endpointMetrics: initEndpointMetrics(opts.endpoints, scope),
-		scope:           scope,
-		enqueuedSamples: scope.Counter("enqueued_samples"),
-		writtenSamples:  scope.Counter("written_samples"),
-		droppedSamples:  scope.Counter("dropped_samples"),
-		failedSamples:   scope.Counter("failed_samples"),
-		inFlightSamples: scope.Gauge("in_flight_samples"),
-		batchWrites:     scope.Counter("batch_writes"),
-		tickWrites:      scope.Counter("tick_writes"),
-		droppedWrites:   scope.Counter("dropped_writes"),
-		errWrites:       scope.Counter("err_writes"),
-		retryWrites:     scope.Counter("retry_writes"),
-		dupWrites:       scope.Counter("duplicate_writes"),
-		logger:          opts.logger,
-		dataQueue:       make(chan *storage.WriteQuery, dataQueueCapacity),
-		dataQueueSize:   scope.Gauge("data_queue_size"),
-		dlq:             newDeadLetterQueue(opts.logger, dataQueueCapacity),
-		dlqSize:         scope.Gauge("dead_letter_queue_size"),
-		workerPool:      xsync.NewWorkerPool(opts.poolSize),
-		writeLoopDone:   make(chan struct{}),
+		opts:                opts,
+		client:              client,
+		endpointClients:     endpointClients,
+		endpointMetrics:     initEndpointMetrics(allEndpoints(opts), scope),
+		endpointLimiters:    newEndpointLimiters(opts, scope),
+		endpointHealths:     newEndpointHealths(opts, scope),
+		scope:               scope,
+		enqueuedSamples:     scope.Counter("enqueued_samples"),
+		writtenSamples:      scope.Counter("written_samples"),
+		droppedSamples:      scope.Counter("dropped_samples"),
+		failedSamples:       scope.Counter("failed_samples"),
+		inFlightSamples:     scope.Gauge("in_flight_samples"),
+		batchWrites:         scope.Counter("batch_writes"),
+		tickWrites:          scope.Counter("tick_writes"),
+		droppedWrites:       scope.Counter("dropped_writes"),
+		noTenantFound:       scope.Counter("no_tenant_found"),
+		defaultedSeries:     scope.Counter("defaulted_series"),
+		errWrites:           scope.Counter("err_writes"),
+		retryWrites:         scope.Counter("retry_writes"),
+		dupWrites:           scope.Counter("duplicate_writes"),
+		bufferFullWrites:    scope.Counter("buffer_full_writes"),
+		overdueFlushes:      scope.Counter("overdue_flushes"),
+		seriesTooManyLabels: scope.Counter("series_too_many_labels"),
+		seriesLabelTooLong:  scope.Counter("series_label_too_long"),
+		seriesCoalesced:     scope.Counter("series_coalesced"),
+		encodeSkippedSeries: scope.Counter("encode_skipped_series"),
+		seriesCapped:        scope.Counter("series_datapoints_capped"),
+		futureDropped:       scope.Counter("future_timestamp_dropped"),
+		failoverWrites:      scope.Counter("failover_writes"),
+		shedBatches:         scope.Counter("shed_batches"),
+		inFlightBatches:     scope.Gauge("inflight_batches"),
+		logger:              opts.logger,
+		dataQueue:           make(chan *storage.WriteQuery, dataQueueCapacity),
+		dataQueueSize:       scope.Gauge("data_queue_size"),
+		dlq:                 newDeadLetterQueue(opts.logger, dataQueueCapacity),
+		dlqSize:             scope.Gauge("dead_letter_queue_size"),
+		workerPool:          xsync.NewWorkerPool(opts.poolSize),
+		writeLoopDone:       make(chan struct{}),
+		pendingQueries:      queriesWithFixedTenants,
+	}
+	for tenant, queue := range queriesWithFixedTenants {
+		queue.tenantMetrics.scope = scope
+		queue.initBytesMetrics(scope, s.tenantEndpoints(tenant))
+		queue.sampledDrop = scope.Tagged(map[string]string{"tenant": string(tenant)}).Counter("sampled_drop")
+	}
+	s.writesCtx, s.cancelWrites = context.WithCancel(context.Background())
+	if opts.maxInFlightBatches > 0 {
+		s.inFlightBatchTokens = make(chan struct{}, opts.maxInFlightBatches)
 	}
+	if opts.orderedWriteShards > 0 {
+		s.ordering = newSeriesOrdering(opts.orderedWriteShards)
+	}
+	s.SetLogSampleRate(opts.logSampleRate)
+	s.SetWrongTenantLogSampleRate(opts.wrongTenantLogSampleRate)
+	s.SetDefaultTenantLogSampleRate(opts.defaultTenantLogSampleRate)
+	s.SetClosePolicy(opts.closePolicy)
 	// carry over this queriesWithFixedTenants to make sure it is not concurrency safe
 	s.startAsync(queriesWithFixedTenants)
 	opts.logger.Info("Prometheus remote write storage created", zap.Int("num_tenants", len(queriesWithFixedTenants)))
@@ -238,8 +528,10 @@ func NewStorage(opts Options) (storage.Storage, error) {
 
 type promStorage struct {
 	unimplementedPromStorageMethods
-	opts            Options
-	client          *http.Client
+	opts   Options
+	client *http.Client
+	// endpointClients are the clients of the endpoints with their own connection pool sizing.
+	endpointClients map[string]*http.Client
 	endpointMetrics map[string]*instrument.HttpMetrics
 	scope           tally.Scope
 	// Don't measure WriteQuery it is a very weird M3 internal data structure.
@@ -254,79 +546,416 @@ type promStorage struct {
 	tickWrites    tally.Counter
 	batchWrites   tally.Counter
 	droppedWrites tally.Counter
-	errWrites     tally.Counter
-	retryWrites   tally.Counter
-	dupWrites     tally.Counter
-	logger        *zap.Logger
-	dataQueue     chan *storage.WriteQuery
-	dataQueueSize tally.Gauge
-	dlq           *deadLetterQueue
-	dlqSize       tally.Gauge
-	workerPool    xsync.WorkerPool
-	writeLoopDone chan struct{}
+	// noTenantFound are # of writes dropped because the tenant resolver found no tenant
+	noTenantFound tally.Counter
+	// defaultedSeries are # of writes routed to the default tenant as no tenant rule matched
+	defaultedSeries tally.Counter
+	errWrites       tally.Counter
+	retryWrites     tally.Counter
+	dupWrites       tally.Counter
+	// bufferFullWrites are # of TryWrite calls rejected because the data queue is full
+	bufferFullWrites tally.Counter
+	// overdueFlushes are # of queue flushes triggered by a tenant's max flush delay
+	overdueFlushes tally.Counter
+	// failoverWrites are # of batch writes to an endpoint other than the primary
+	failoverWrites tally.Counter
+	// shedBatches are # of batches dropped because the in-flight batch limit was reached
+	shedBatches tally.Counter
+	// inFlightBatches are # of batches dispatched to the worker pool and not yet written
+	inFlightBatches     tally.Gauge
+	inFlightBatchValue  atomic.Int64
+	inFlightBatchTokens chan struct{}
+	// ordering serializes the batches writing the same series, nil if disabled.
+	ordering *seriesOrdering
+	// series are # of individual series dropped, merged into another series
+	// with the same labels, or capped to the max datapoints, before writing
+	seriesTooManyLabels tally.Counter
+	seriesLabelTooLong  tally.Counter
+	seriesCoalesced     tally.Counter
+	encodeSkippedSeries tally.Counter
+	seriesCapped        tally.Counter
+	futureDropped       tally.Counter
+	logger              *zap.Logger
+	dataQueue           chan *storage.WriteQuery
+	dataQueueSize       tally.Gauge
+	dlq                 *deadLetterQueue
+	dlqSize             tally.Gauge
+	workerPool          xsync.WorkerPool
+	writeLoopDone       chan struct{}
+	// writesCtx is cancelled once the close timeout expires to abandon the pending writes.
+	writesCtx    context.Context
+	cancelWrites context.CancelFunc
+	// batchWriters are the WriteBatch calls in progress, waited for when draining.
+	batchWriters sync.WaitGroup
+	// draining is set once the write loop drains the pending writes on close.
+	draining atomic.Bool
+	// drainErr is set by the write loop before it signals writeLoopDone.
+	drainErr error
+	// pendingQueries is owned by the write loop, the map is never modified after
+	// creation so it is safe to read the queues for QueueStats.
+	pendingQueries map[tenantKey]*WriteQueue
+	// endpointLimiters are the adaptive concurrency limiters of the endpoints, nil if disabled.
+	endpointLimiters map[string]*concurrencyLimiter
+	// endpointHealths track the success ratio of the endpoints, nil if they are never disabled.
+	endpointHealths map[string]*endpointHealth
+	// logSampleRate, wrongTenantLogSampleRate and defaultTenantLogSampleRate hold
+	// the float64 bits of the rates so that they can be adjusted while writing.
+	logSampleRate              atomic.Uint64
+	wrongTenantLogSampleRate   atomic.Uint64
+	defaultTenantLogSampleRate atomic.Uint64
+	// closePolicy holds the ClosePolicy so that it can be changed on shutdown.
+	closePolicy atomic.Int32
 }
 
 type tenantKey string
 
-func (p *promStorage) getTenant(query *storage.WriteQuery) tenantKey {
-	for _, rule := range p.opts.tenantRules {
+// splitBuckets is the number of buckets series are hashed into when a tenant
+// rule splits its series, allowing split percentages with two decimals.
+const splitBuckets = 10000
+
+// getTenant resolves the tenant of the query with the tenant resolver, or the
+// tenant rules when none is set. It returns false if the write must be dropped.
+func (p *promStorage) getTenant(query *storage.WriteQuery) (tenantKey, bool) {
+	if p.opts.tenantResolver == nil {
+		t, ok := matchTenantRule(p.opts.tenantRules, query)
+		if !ok {
+			p.defaultTenant(query)
+			t = tenantKey(p.opts.tenantDefault)
+		}
+		return t, true
+	}
+	t, ok := p.opts.tenantResolver.Resolve(query)
+	return tenantKey(t), ok
+}
+
+// ruleTenantResolver resolves the tenant of writes with the tenant rules.
+type ruleTenantResolver struct {
+	rules         []TenantRule
+	tenantDefault string
+}
+
+// NewRuleTenantResolver returns the default TenantResolver, which routes a write
+// to the tenant of the first matching rule by descending priority and to the
+// default tenant if none matches. Custom resolvers can use it as a fallback.
+func NewRuleTenantResolver(rules []TenantRule, tenantDefault string) TenantResolver {
+	return ruleTenantResolver{rules: sortTenantRules(rules), tenantDefault: tenantDefault}
+}
+
+func (r ruleTenantResolver) Resolve(query *storage.WriteQuery) (string, bool) {
+	return string(ruleTenant(r.rules, r.tenantDefault, query)), true
+}
+
+// ruleTenant returns the tenant of the first of the sorted rules matching the query.
+func ruleTenant(rules []TenantRule, tenantDefault string, query *storage.WriteQuery) tenantKey {
+	if t, ok := matchTenantRule(rules, query); ok {
+		return t
+	}
+	return tenantKey(tenantDefault)
+}
+
+// matchTenantRule returns the tenant of the first of the sorted rules matching
+// the query, false if none matches.
+func matchTenantRule(rules []TenantRule, query *storage.WriteQuery) (tenantKey, bool) {
+	for _, rule := range rules {
 		if ok := rule.Filter.MatchTags(query.Tags()); ok {
-			return tenantKey(rule.Tenant)
+			if rule.SplitTenant != "" &&
+				float64(query.Tags().HashedID()%splitBuckets) < rule.SplitPercent*splitBuckets/100 {
+				return tenantKey(rule.SplitTenant), true
+			}
+			return tenantKey(rule.Tenant), true
 		}
 	}
-	return tenantKey(p.opts.tenantDefault)
+	return "", false
+}
+
+// sortTenantRules returns the rules in evaluation order, by descending priority
+// and otherwise in their configured order.
+func sortTenantRules(rules []TenantRule) []TenantRule {
+	sorted := make([]TenantRule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	return sorted
 }
 
 func (p *promStorage) appendSample(ctx context.Context, wg *sync.WaitGroup, pendingQuery map[tenantKey]*WriteQueue, query *storage.WriteQuery) {
-	t := p.getTenant(query)
+	t, ok := p.getTenant(query)
+	if !ok {
+		p.dropNoTenant(query)
+		return
+	}
 	if _, ok := pendingQuery[t]; !ok {
-		p.droppedWrites.Inc(1)
-		p.logger.Error("no pre-defined tenant found, dropping it",
-			zap.String("tenant", string(t)),
-			zap.String("defaultTenant", p.opts.tenantDefault),
-			zap.String("timeseries", query.String()))
+		p.dropWrongTenant(t, query)
+		return
+	}
+	if pendingQuery[t].sampledOut() {
+		p.dropSampled(pendingQuery[t], query)
 		return
 	}
 	if dataBatch := pendingQuery[t].Add(query); dataBatch != nil {
 		p.batchWrites.Inc(1)
-		wg.Add(1)
-		p.workerPool.Go(func() {
-			defer wg.Done()
-			if err := p.writeBatch(ctx, t, dataBatch); err != nil {
-				p.logger.Error("error writing async batch",
-					zap.String("tenant", string(t)),
-					zap.Error(err))
+		pendingQuery[t].metrics().batchWrites.Inc(1)
+		p.submitBatch(ctx, wg, t, dataBatch, nil)
+	}
+}
+
+// submitBatch writes the batch on the worker pool, blocking until a worker is available.
+// With ordered writes the batch is written as one batch per shard of series.
+// The errors of the writes are collected in errs when it isn't nil, and only logged otherwise.
+func (p *promStorage) submitBatch(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	t tenantKey,
+	batch []*storage.WriteQuery,
+	errs *batchErrors,
+) {
+	if p.ordering == nil {
+		p.dispatchBatch(ctx, wg, t, batch, 0, errs)
+		return
+	}
+	for shard, shardBatch := range p.ordering.split(batch) {
+		if len(shardBatch) > 0 {
+			p.dispatchBatch(ctx, wg, t, shardBatch, shard, errs)
+		}
+	}
+}
+
+func (p *promStorage) dispatchBatch(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	t tenantKey,
+	batch []*storage.WriteQuery,
+	shard int,
+	errs *batchErrors,
+) {
+	if !p.acquireInFlightBatch(ctx) {
+		p.shedBatch(ctx, t, batch)
+		errs.add(errBatchShed)
+		return
+	}
+	var turn orderingTurn
+	if p.ordering != nil {
+		turn = p.ordering.next(t, shard)
+	}
+	wg.Add(1)
+	p.workerPool.Go(func() {
+		defer wg.Done()
+		defer p.releaseInFlightBatch()
+		defer turn.done()
+		// NB: the batch holds its worker while waiting for the previous batch of
+		// its shard, waiting before taking a worker would block the write loop.
+		turn.wait(ctx)
+		err := p.writeBatch(ctx, t, batch)
+		if err != nil && errs == nil {
+			p.logger.Error("error writing async batch",
+				zap.String("tenant", string(t)),
+				zap.Error(err))
+		}
+		errs.add(err)
+		if p.draining.Load() {
+			p.recordDrain(ctx, t, len(batch), err)
+		}
+	})
+}
+
+// batchErrors collects the errors of batches written concurrently.
+type batchErrors struct {
+	sync.Mutex
+	multiErr xerrors.MultiError
+}
+
+func (e *batchErrors) add(err error) {
+	if e == nil || err == nil {
+		return
+	}
+	e.Lock()
+	e.multiErr = e.multiErr.Add(err)
+	e.Unlock()
+}
+
+func (e *batchErrors) finalError() error {
+	e.Lock()
+	defer e.Unlock()
+	return e.multiErr.FinalError()
+}
+
+// acquireInFlightBatch reserves an in-flight batch, blocking or returning false
+// according to the in-flight policy once the limit is reached. Batches are never
+// shed while draining, but blocking stops when the writes are cancelled.
+func (p *promStorage) acquireInFlightBatch(ctx context.Context) bool {
+	if p.inFlightBatchTokens != nil {
+		if p.opts.inFlightPolicy == InFlightPolicyShed && !p.draining.Load() {
+			select {
+			case p.inFlightBatchTokens <- struct{}{}:
+			default:
+				return false
 			}
-		})
+		} else {
+			select {
+			case p.inFlightBatchTokens <- struct{}{}:
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+	p.inFlightBatches.Update(float64(p.inFlightBatchValue.Add(1)))
+	return true
+}
+
+func (p *promStorage) releaseInFlightBatch() {
+	p.inFlightBatches.Update(float64(p.inFlightBatchValue.Add(-1)))
+	if p.inFlightBatchTokens != nil {
+		<-p.inFlightBatchTokens
+	}
+}
+
+// shedBatch drops a batch that couldn't be dispatched.
+func (p *promStorage) shedBatch(ctx context.Context, t tenantKey, batch []*storage.WriteQuery) {
+	var samples int64
+	for _, query := range batch {
+		samples += int64(query.Datapoints().Len())
+	}
+	p.shedBatches.Inc(1)
+	p.inFlightSamples.Update(float64(p.inFlightSampleValue.Add(-samples)))
+	p.droppedSamples.Inc(samples)
+	p.addTenantDroppedSamples(t, samples)
+	if p.draining.Load() {
+		p.recordDrain(ctx, t, len(batch), errBatchShed)
+	}
+	if p.sampleLog(&p.logSampleRate) {
+		p.logger.Warn("in-flight batch limit reached, dropping batch",
+			zap.String("tenant", string(t)),
+			zap.Int("size", len(batch)),
+			zap.Int("maxInFlightBatches", p.opts.maxInFlightBatches))
+	}
+}
+
+// recordDrain counts the outcome of a batch of the tenant completed while closing,
+// a batch failing because the close timeout cancelled it is abandoned.
+func (p *promStorage) recordDrain(ctx context.Context, t tenantKey, n int, err error) {
+	queue, ok := p.pendingQueries[t]
+	if !ok {
+		return
+	}
+	switch {
+	case err == nil:
+		queue.drainFlushed.Add(int64(n))
+	case ctx.Err() != nil:
+		queue.drainAbandoned.Add(int64(n))
+	default:
+		queue.drainFailed.Add(int64(n))
+	}
+}
+
+// drainSummary returns the writes of each tenant completed while closing.
+func drainSummary(pendingQuery map[tenantKey]*WriteQueue) map[string]TenantDrainStats {
+	summary := make(map[string]TenantDrainStats, len(pendingQuery))
+	for t, queue := range pendingQuery {
+		summary[string(t)] = TenantDrainStats{
+			Flushed:   int(queue.drainFlushed.Load()),
+			Failed:    int(queue.drainFailed.Load()),
+			Abandoned: int(queue.drainAbandoned.Load()),
+		}
+	}
+	return summary
+}
+
+// dropNoTenant accounts for a query the tenant resolver found no tenant for.
+func (p *promStorage) dropNoTenant(query *storage.WriteQuery) {
+	p.droppedWrites.Inc(1)
+	p.noTenantFound.Inc(1)
+	if p.sampleLog(&p.wrongTenantLogSampleRate) {
+		p.logger.Error("no tenant found, dropping it",
+			zap.String("timeseries", query.String()))
 	}
 }
 
+// sampledOut returns true if the query must be dropped to only keep the sample
+// rate of the tenant's writes.
+func (wq *WriteQueue) sampledOut() bool {
+	return wq.sampleRate > 0 && wq.sampleRate < 1 && rand.Float64() >= wq.sampleRate
+}
+
+// dropSampled accounts for a query dropped by the sample rate of its tenant.
+func (p *promStorage) dropSampled(queue *WriteQueue, query *storage.WriteQuery) {
+	samples := int64(query.Datapoints().Len())
+	queue.sampledDrop.Inc(1)
+	queue.addDroppedSamples(samples)
+	p.droppedSamples.Inc(samples)
+	p.inFlightSamples.Update(float64(p.inFlightSampleValue.Add(-samples)))
+}
+
+// defaultTenant accounts for a query routed to the default tenant as it matched
+// no tenant rule, logging a sample of them to discover misrouted series.
+func (p *promStorage) defaultTenant(query *storage.WriteQuery) {
+	p.defaultedSeries.Inc(1)
+	if p.sampleLog(&p.defaultTenantLogSampleRate) {
+		p.logger.Info("no tenant rule matched, routing to the default tenant",
+			zap.String("defaultTenant", p.opts.tenantDefault),
+			zap.String("timeseries", query.Tags().String()))
+	}
+}
+
+// dropWrongTenant accounts for a query routed to a tenant without a queue.
+func (p *promStorage) dropWrongTenant(t tenantKey, query *storage.WriteQuery) {
+	p.droppedWrites.Inc(1)
+	if p.sampleLog(&p.wrongTenantLogSampleRate) {
+		p.logger.Error("no pre-defined tenant found, dropping it",
+			zap.String("tenant", string(t)),
+			zap.String("defaultTenant", p.opts.tenantDefault),
+			zap.String("timeseries", query.String()))
+	}
+}
+
+// flushOverdueQueues flushes the queues whose oldest query has waited longer than
+// the tenant's max flush delay, leaving all other queues to be flushed on tick.
+func (p *promStorage) flushOverdueQueues(ctx context.Context, wg *sync.WaitGroup, pendingQuery map[tenantKey]*WriteQueue) {
+	now := time.Now()
+	for _, queue := range pendingQuery {
+		if !queue.overdue(now) {
+			continue
+		}
+		p.overdueFlushes.Inc(1)
+		queue.Flush(ctx, p, wg)
+	}
+}
+
+// overdueCheckInterval returns how often queues with a max flush delay are checked,
+// which is half of the smallest delay so that no query waits much longer than its delay.
+func overdueCheckInterval(pendingQuery map[tenantKey]*WriteQueue) time.Duration {
+	var interval time.Duration
+	for _, queue := range pendingQuery {
+		if queue.maxFlushDelay > 0 && (interval == 0 || queue.maxFlushDelay < interval) {
+			interval = queue.maxFlushDelay
+		}
+	}
+	return interval / 2
+}
+
 func (p *promStorage) flushPendingQueues(ctx context.Context, wg *sync.WaitGroup, pendingQuery map[tenantKey]*WriteQueue) int {
 	numWrites := 0
 	p.dlq.flush(p, ctx, wg, pendingQuery)
 	for _, queue := range pendingQuery {
-		if queue.Len() == 0 {
-			continue
-		}
-		numWrites += queue.Len()
-		wg.Add(1)
-		// Copy the loop variable
-		q := queue
-		p.workerPool.Go(func() {
-			q.Flush(ctx, p)
-			wg.Done()
-		})
+		numWrites += queue.Flush(ctx, p, wg)
 	}
 	return numWrites
 }
 
 func (p *promStorage) writeLoop(pendingQuery map[tenantKey]*WriteQueue) {
 	// This function ensures that all pending writes are flushed before returning.
-	ctxForWrites, cancel := context.WithCancel(context.Background())
+	ctxForWrites, cancel := p.writesCtx, p.cancelWrites
 	defer cancel()
 	var wg sync.WaitGroup
-	p.workerPool.Init()
 	ticker := time.NewTicker(*p.opts.tickDuration)
+	defer ticker.Stop()
+	// A nil channel never fires so the overdue check is disabled unless a tenant has a max flush delay.
+	var overdueC <-chan time.Time
+	if interval := overdueCheckInterval(pendingQuery); interval > 0 {
+		overdueTicker := time.NewTicker(interval)
+		defer overdueTicker.Stop()
+		overdueC = overdueTicker.C
+	}
 	stop := false
 	for !stop {
 		select {
@@ -342,24 +971,80 @@ func (p *promStorage) writeLoop(pendingQuery map[tenantKey]*WriteQueue) {
 			break
 		case <-ticker.C:
 			p.flushPendingQueues(ctxForWrites, &wg, pendingQuery)
+		case <-overdueC:
+			p.flushOverdueQueues(ctxForWrites, &wg, pendingQuery)
 		}
 	}
 	// At this point, `p.dataQueue` is drained and closed.
 	p.logger.Info("Draining pending per-tenant write queues")
-	numWrites := p.flushPendingQueues(ctxForWrites, &wg, pendingQuery)
-	p.logger.Info("Waiting for all async pending writes to finish",
-		zap.Int("numWrites", numWrites))
-	// Block until all pending writes are flushed because we don't want to lose any data.
-	wg.Wait()
+	p.draining.Store(true)
+	drained := make(chan struct{})
+	var numWrites int
+	go func() {
+		defer close(drained)
+		numWrites = p.flushPendingQueues(ctxForWrites, &wg, pendingQuery)
+		p.logger.Info("Waiting for all async pending writes to finish",
+			zap.Int("numWrites", numWrites))
+		// Block until all pending writes are flushed because we don't want to lose any data.
+		wg.Wait()
+		p.batchWriters.Wait()
+	}()
+	p.waitForDrain(drained, cancel)
+	summary := drainSummary(pendingQuery)
+	abandoned := false
+	for tenant, stats := range summary {
+		if stats.Failed == 0 && stats.Abandoned == 0 {
+			continue
+		}
+		abandoned = abandoned || stats.Abandoned > 0
+		p.logger.Warn("pending writes of tenant not flushed on close",
+			zap.String("tenant", tenant),
+			zap.Int("flushed", stats.Flushed),
+			zap.Int("failed", stats.Failed),
+			zap.Int("abandoned", stats.Abandoned))
+	}
+	if abandoned {
+		p.drainErr = &UnflushedWritesError{Tenants: summary}
+	}
 	p.logger.Info("All async pending writes are done",
 		zap.Int("numWrites", numWrites))
 	p.writeLoopDone <- struct{}{}
 }
 
+// waitForDrain waits for the pending writes to be flushed. Once the close timeout
+// expires, or the fast exit grace with the fast exit close policy, the pending
+// writes are cancelled, which makes them fail fast, and it waits for them to be
+// accounted as abandoned.
+func (p *promStorage) waitForDrain(drained <-chan struct{}, cancel context.CancelFunc) {
+	timeout := p.opts.closeTimeout
+	if ClosePolicy(p.closePolicy.Load()) == ClosePolicyFastExit &&
+		(timeout == nil || *timeout > fastExitGrace) {
+		grace := fastExitGrace
+		timeout = &grace
+	}
+	if timeout == nil {
+		<-drained
+		return
+	}
+	timer := time.NewTimer(*timeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+		p.logger.Warn("timed out flushing pending writes on close, abandoning them",
+			zap.Duration("closeTimeout", *timeout))
+		cancel()
+		<-drained
+	}
+}
+
 func (p *promStorage) startAsync(pendingQuery map[tenantKey]*WriteQueue) {
 	p.logger.Info("Start prometheus remote write storage async job",
 		zap.Int("queueSize", p.opts.queueSize),
 		zap.Int("poolSize", p.opts.poolSize))
+	// The pool is initialized before the write loop starts since WriteBatch
+	// also uses it from the caller's goroutine.
+	p.workerPool.Init()
 	go func() {
 		p.logger.Info("Starting the write loop")
 		p.writeLoop(pendingQuery)
@@ -368,7 +1053,7 @@ func (p *promStorage) startAsync(pendingQuery map[tenantKey]*WriteQueue) {
 
 func deepCopy(queryOpt storage.WriteQueryOptions) storage.WriteQueryOptions {
 	// Only need Tags and DataPoints for writing to remote Prom. Other field are not used.
-	// getTenant() only uses Tags.Tags.
+	// The default tenant resolver only uses Tags.Tags.
 	// See src/query/storage/promremote/query_coverter.go
 	// Unit is copied to pass the validation in NewWriteQuery()
 	// FromIngestor is used for logging only.
@@ -399,16 +1084,18 @@ func deepCopy(queryOpt storage.WriteQueryOptions) storage.WriteQueryOptions {
 	return cp
 }
 
-func (p *promStorage) Write(_ context.Context, query *storage.WriteQuery) error {
+// prepareWrite returns the query to enqueue and its number of samples, or nil
+// if the query should not be written.
+func (p *promStorage) prepareWrite(query *storage.WriteQuery) (*storage.WriteQuery, int64) {
 	if query == nil {
-		return nil
+		return nil, 0
 	}
 	samples := int64(query.Datapoints().Len())
 	if query.Options().DuplicateWrite {
 		// M3 call site may write the same data according to different storage policies.
 		// See downsampleAndWriter in src/cmd/services/m3coordinator/ingest/write.go
 		p.dupWrites.Inc(1)
-		return nil
+		return nil, 0
 	}
 	if query.Options().FromIngestor {
 		// src/cmd/services/m3coordinator/ingest/m3msg/ingest.go reuses a WriteQuery object to write different
@@ -418,22 +1105,42 @@ func (p *promStorage) Write(_ context.Context, query *storage.WriteQuery) error
 		if err != nil {
 			p.droppedSamples.Inc(samples)
 			p.logger.Error("error copying write", zap.Error(err), zap.String("write", query.String()))
-			return nil
+			return nil, 0
 		}
 		query = queryCopy
 	}
+	return query, samples
+}
+
+func (p *promStorage) enqueued(samples int64) {
+	p.enqueuedSamples.Inc(samples)
+	p.inFlightSamples.Update(float64(p.inFlightSampleValue.Add(samples)))
+	p.dataQueueSize.Update(float64(len(p.dataQueue)))
+}
+
+// dataQueueFullness returns the fraction of the data queue in use.
+func (p *promStorage) dataQueueFullness() float64 {
+	if cap(p.dataQueue) == 0 {
+		return 0
+	}
+	return float64(len(p.dataQueue)) / float64(cap(p.dataQueue))
+}
+
+func (p *promStorage) Write(_ context.Context, query *storage.WriteQuery) error {
+	query, samples := p.prepareWrite(query)
+	if query == nil {
+		return nil
+	}
 
 	select {
 	case p.dataQueue <- query:
 		// The data is enqueued successfully.
-		p.enqueuedSamples.Inc(samples)
-		p.inFlightSamples.Update(float64(p.inFlightSampleValue.Add(samples)))
-		p.dataQueueSize.Update(float64(len(p.dataQueue)))
+		p.enqueued(samples)
 	case <-time.After(*p.opts.queueTimeout):
 		err := p.dlq.add(query)
 		if err != nil {
 			p.droppedSamples.Inc(samples)
-			if rand.Float32() < logSamplingRate {
+			if p.sampleLog(&p.logSampleRate) {
 				p.logger.Error("error enqueue samples for prom remote write", zap.Error(err),
 					zap.String("data", query.String()))
 			}
@@ -442,8 +1149,106 @@ func (p *promStorage) Write(_ context.Context, query *storage.WriteQuery) error
 	return nil
 }
 
-func (p *promStorage) writeBatch(ctx context.Context, tenant tenantKey, queries []*storage.WriteQuery) error {
-	if rand.Float32() < logSamplingRate {
+// TryWrite enqueues the query without blocking, returning ErrBufferFull if the
+// data queue shared by all tenants is full so that the caller can shed load.
+// Unlike Write, a rejected query is not added to the dead letter queue.
+func (p *promStorage) TryWrite(_ context.Context, query *storage.WriteQuery) (WriteStatus, error) {
+	query, samples := p.prepareWrite(query)
+	if query == nil {
+		return WriteStatus{QueueFullness: p.dataQueueFullness()}, nil
+	}
+
+	select {
+	case p.dataQueue <- query:
+		p.enqueued(samples)
+		return WriteStatus{QueueFullness: p.dataQueueFullness()}, nil
+	default:
+		p.bufferFullWrites.Inc(1)
+		return WriteStatus{QueueFullness: 1}, ErrBufferFull
+	}
+}
+
+// WriteBatch writes queries that the caller has already batched. The queries are
+// grouped by tenant and flushed directly in batches of the queue size instead of
+// being sent one by one through the data queue, blocking until all are written.
+// The batches are subject to the in-flight batch limit like the queued writes,
+// and closing the storage waits for them like for the pending queued writes.
+func (p *promStorage) WriteBatch(ctx context.Context, queries []*storage.WriteQuery) error {
+	p.batchWriters.Add(1)
+	defer p.batchWriters.Done()
+	// The writes are abandoned like the queued writes once the close timeout expires.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-p.writesCtx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+
+	batches := make(map[tenantKey][]*storage.WriteQuery)
+	for _, query := range queries {
+		query, samples := p.prepareWrite(query)
+		if query == nil {
+			continue
+		}
+		t, ok := p.getTenant(query)
+		if !ok {
+			p.dropNoTenant(query)
+			continue
+		}
+		queue, ok := p.pendingQueries[t]
+		if !ok {
+			p.dropWrongTenant(t, query)
+			continue
+		}
+		queue.addEnqueuedSamples(samples)
+		p.enqueued(samples)
+		if queue.sampledOut() {
+			p.dropSampled(queue, query)
+			continue
+		}
+		batches[t] = append(batches[t], query)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs batchErrors
+	)
+	for t, queries := range batches {
+		for start := 0; start < len(queries); start += p.opts.queueSize {
+			end := start + p.opts.queueSize
+			if end > len(queries) {
+				end = len(queries)
+			}
+			p.batchWrites.Inc(1)
+			p.tenantMetrics(t).batchWrites.Inc(1)
+			p.submitBatch(ctx, &wg, t, queries[start:end], &errs)
+		}
+	}
+	wg.Wait()
+	return errs.finalError()
+}
+
+func (p *promStorage) writeBatch(ctx context.Context, tenant tenantKey, queries []*storage.WriteQuery) (err error) {
+	// NB: the request id is shared by all the attempts and endpoints the batch is written to.
+	requestID := uuid.NewString()
+	sp, ctx := opentracing.StartSpanFromContextWithTracer(ctx, p.opts.tracer, tracepoint.PromRemoteWriteBatch)
+	sp.SetTag("tenant", string(tenant))
+	sp.SetTag("requestID", requestID)
+	sp.LogFields(opentracinglog.Int("queries", len(queries)))
+	defer func() {
+		if err != nil {
+			sp.LogFields(opentracinglog.Error(err))
+			opentracingext.Error.Set(sp, true)
+		}
+		sp.Finish()
+	}()
+
+	if p.sampleLog(&p.logSampleRate) {
 		p.logger.Debug("async write batch",
 			zap.String("tenant", string(tenant)),
 			zap.Int("size", len(queries)))
@@ -451,32 +1256,218 @@ func (p *promStorage) writeBatch(ctx context.Context, tenant tenantKey, queries
 	if len(queries) == 0 {
 		return nil
 	}
-	encoded, samples, err := convertAndEncodeWriteQuery(queries)
-	sampleCount := int64(samples)
+	// We only write to the first endpoint since this storage(Panthoen) doesn't distinguish raw data samples
+	// from aggregated ones, the other endpoints are only written to on failover.
+	start := time.Now()
+	tenantEndpoints := p.tenantEndpoints(tenant)
+	endpoint := tenantEndpoints[0]
+	var labels injectedLabels
+	if queue, ok := p.pendingQueries[tenant]; ok {
+		labels = queue.labels
+	}
+	encoded, stats, err := convertAndEncodeWriteQuery(queries, convertOptions{
+		limits:         p.opts.seriesLimits,
+		relabelRules:   p.opts.relabelRules,
+		encoding:       endpoint.bodyEncoding,
+		coalesceSeries: p.opts.coalesceSeries,
+		labels:         labels,
+		now:            time.Now(),
+	})
+	sampleCount := int64(stats.samples)
+	sp.LogFields(
+		opentracinglog.Int("samples", stats.samples),
+		opentracinglog.Int("bytes", len(encoded)),
+	)
 	p.logger.Debug("async write batch",
 		zap.String("tenant", string(tenant)),
+		zap.String("requestID", requestID),
 		zap.Int("size", len(queries)), zap.Int64("samples", sampleCount))
 	p.inFlightSamples.Update(float64(p.inFlightSampleValue.Add(-sampleCount)))
+	// Series violating the configured limits are dropped individually so that
+	// they don't fail the rest of the batch.
+	p.seriesTooManyLabels.Inc(int64(stats.tooManyLabels))
+	p.seriesLabelTooLong.Inc(int64(stats.labelTooLong))
+	p.seriesCoalesced.Inc(int64(stats.coalescedSeries))
+	p.encodeSkippedSeries.Inc(int64(len(stats.skipped)))
+	p.seriesCapped.Inc(int64(stats.cappedSeries))
+	p.futureDropped.Inc(int64(stats.futureSamples))
+	if len(stats.skipped) > 0 && p.sampleLog(&p.logSampleRate) {
+		p.logger.Warn("skipped malformed series of async write batch",
+			zap.String("tenant", string(tenant)),
+			zap.Int("skipped", len(stats.skipped)),
+			zap.String("series", stats.skipped[0].query.String()),
+			zap.Error(stats.skipped[0].err))
+	}
+	p.droppedSamples.Inc(int64(stats.droppedSamples))
+	p.addTenantDroppedSamples(tenant, int64(stats.droppedSamples))
+	sampleCount -= int64(stats.droppedSamples)
+	entry := batchLogEntry{
+		tenant:    tenant,
+		requestID: requestID,
+		series:    stats.series,
+		samples:   sampleCount,
+		bytes:     len(encoded),
+	}
 	if err != nil {
 		p.errWrites.Inc(1)
+		p.tenantMetrics(tenant).errWrites.Inc(1)
 		p.failedSamples.Inc(sampleCount)
+		p.addTenantDroppedSamples(tenant, sampleCount)
+		entry.latency = time.Since(start)
+		p.logBatch(entry, err)
 		return err
 	}
 
-	// We only write to the first endpoint since this storage(Panthoen) doesn't distinguish raw data samples
-	// from aggregated ones.
-	endpoint := p.opts.endpoints[0]
-	metrics := p.endpointMetrics[endpoint.name]
-	err = p.write(ctx, metrics, endpoint, tenant, bytes.NewReader(encoded))
+	endpoints := tenantEndpoints[:1]
+	if p.opts.writeMode == WriteModeFailover {
+		endpoints = p.enabledEndpoints(tenantEndpoints)
+	}
+	for i, endpoint := range endpoints {
+		if i > 0 {
+			p.failoverWrites.Inc(1)
+		}
+		metrics := p.endpointMetrics[endpoint.name]
+		var outcome writeOutcome
+		switch endpoint.endpointType {
+		case kafkaEndpointType:
+			outcome, err = p.produce(ctx, metrics, endpoint, tenant, encoded)
+		default:
+			outcome, err = p.write(ctx, metrics, endpoint, tenant, requestID, encoded)
+		}
+		entry.endpoint = endpoint.name
+		entry.status = outcome.status
+		entry.attempts += outcome.attempts
+		p.recordEndpointHealth(ctx, endpoint, err)
+		if err == nil {
+			p.addTenantBytesWritten(tenant, endpoint, len(encoded), stats.uncompressedBytes)
+			break
+		}
+		if i < len(endpoints)-1 && p.sampleLog(&p.logSampleRate) {
+			p.logger.Warn("prom remote write failed, failing over to the next endpoint",
+				zap.String("endpoint", endpoint.name),
+				zap.String("tenant", string(tenant)),
+				zap.Error(err))
+		}
+	}
 	if err != nil {
 		p.errWrites.Inc(1)
+		p.tenantMetrics(tenant).errWrites.Inc(1)
 		p.failedSamples.Inc(sampleCount)
+		p.addTenantDroppedSamples(tenant, sampleCount)
 	} else {
 		p.writtenSamples.Inc(sampleCount)
 	}
+	entry.latency = time.Since(start)
+	p.logBatch(entry, err)
 	return err
 }
 
+// enabledEndpoints returns the endpoints not disabled for their success ratio, or
+// all of them if all are disabled so that writes are never dropped for it.
+func (p *promStorage) enabledEndpoints(endpoints []EndpointOptions) []EndpointOptions {
+	if p.endpointHealths == nil {
+		return endpoints
+	}
+	enabled := make([]EndpointOptions, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if p.endpointHealths[endpoint.name].allow() {
+			enabled = append(enabled, endpoint)
+		}
+	}
+	if len(enabled) == 0 {
+		return endpoints
+	}
+	return enabled
+}
+
+// recordEndpointHealth accounts for the outcome of a write to the endpoint. Invalid
+// batches and cancelled writes say nothing about the endpoint's health.
+func (p *promStorage) recordEndpointHealth(ctx context.Context, endpoint EndpointOptions, err error) {
+	health, ok := p.endpointHealths[endpoint.name]
+	if !ok || ctx.Err() != nil || xerrors.IsInvalidParams(err) {
+		return
+	}
+	health.record(err == nil)
+}
+
+// tenantEndpoints returns the endpoints the tenant's writes are sent to.
+func (p *promStorage) tenantEndpoints(tenant tenantKey) []EndpointOptions {
+	if queue, ok := p.pendingQueries[tenant]; ok && queue.endpoints != nil {
+		return queue.endpoints
+	}
+	return p.opts.endpoints
+}
+
+// SetLogSampleRate sets the fraction of write errors and batches logged, it
+// is safe to call while writing.
+func (p *promStorage) SetLogSampleRate(rate float64) {
+	p.logSampleRate.Store(math.Float64bits(rate))
+}
+
+// SetWrongTenantLogSampleRate sets the fraction of writes dropped for an
+// unknown tenant that are logged, it is safe to call while writing.
+func (p *promStorage) SetWrongTenantLogSampleRate(rate float64) {
+	p.wrongTenantLogSampleRate.Store(math.Float64bits(rate))
+}
+
+// SetDefaultTenantLogSampleRate sets the fraction of writes matching no tenant
+// rule whose series are logged, it is safe to call while writing.
+func (p *promStorage) SetDefaultTenantLogSampleRate(rate float64) {
+	p.defaultTenantLogSampleRate.Store(math.Float64bits(rate))
+}
+
+// SetClosePolicy sets how Close handles the writes still pending, it is safe
+// to call while writing, e.g. from a shutdown hook right before Close.
+func (p *promStorage) SetClosePolicy(policy ClosePolicy) {
+	p.closePolicy.Store(int32(policy))
+}
+
+func (p *promStorage) sampleLog(rate *atomic.Uint64) bool {
+	return rand.Float64() < math.Float64frombits(rate.Load())
+}
+
+func (p *promStorage) addTenantDroppedSamples(tenant tenantKey, samples int64) {
+	if queue, ok := p.pendingQueries[tenant]; ok && samples > 0 {
+		queue.addDroppedSamples(samples)
+	}
+}
+
+// addDroppedSamples tracks samples of the tenant dropped or failed to be written.
+func (wq *WriteQueue) addDroppedSamples(samples int64) {
+	wq.droppedSamples.Add(samples)
+	wq.metrics().droppedSamples.Inc(samples)
+}
+
+// addTenantBytesWritten tracks the bytes of a batch written to the endpoint for the
+// tenant, retries of the batch are not counted.
+func (p *promStorage) addTenantBytesWritten(tenant tenantKey, endpoint EndpointOptions, encoded, uncompressed int) {
+	queue, ok := p.pendingQueries[tenant]
+	if !ok {
+		return
+	}
+	if metrics, ok := queue.bytesMetrics[endpoint.name]; ok {
+		metrics.written.Inc(int64(encoded))
+		metrics.uncompressedWritten.Inc(int64(uncompressed))
+	}
+}
+
+// QueueStats returns a snapshot of the pending per-tenant write queues. Each
+// queue is only read locked while it is copied so the write loop is not blocked.
+func (p *promStorage) QueueStats() QueueStats {
+	stats := QueueStats{
+		DataQueueLength:       len(p.dataQueue),
+		DeadLetterQueueLength: p.dlq.size(),
+		Tenants:               make([]TenantQueueStats, 0, len(p.pendingQueries)),
+	}
+	for _, queue := range p.pendingQueries {
+		stats.Tenants = append(stats.Tenants, queue.stats())
+	}
+	sort.Slice(stats.Tenants, func(i, j int) bool {
+		return stats.Tenants[i].Tenant < stats.Tenants[j].Tenant
+	})
+	return stats
+}
+
 func (p *promStorage) Type() storage.Type {
 	return storage.TypeRemoteDC
 }
@@ -491,7 +1482,10 @@ func (p *promStorage) Close() error {
 	p.dataQueueSize.Update(float64(len(p.dataQueue)))
 	// After this point, all writes are flushed or errored out.
 	p.client.CloseIdleConnections()
-	return nil
+	for _, client := range p.endpointClients {
+		client.CloseIdleConnections()
+	}
+	return p.drainErr
 }
 
 func (p *promStorage) ErrorBehavior() storage.ErrorBehavior {
@@ -508,14 +1502,34 @@ func (p *promStorage) write(
 	metrics *instrument.HttpMetrics,
 	endpoint EndpointOptions,
 	tenant tenantKey,
-	encoded io.Reader,
-) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.address, encoded)
+	requestID string,
+	encoded []byte,
+) (_ writeOutcome, err error) {
+	sp, ctx := opentracing.StartSpanFromContextWithTracer(ctx, p.opts.tracer, tracepoint.PromRemoteWrite)
+	sp.SetTag("endpoint", endpoint.name)
+	sp.SetTag("tenant", string(tenant))
+	defer func() {
+		if err != nil {
+			sp.LogFields(opentracinglog.Error(err))
+			opentracingext.Error.Set(sp, true)
+		}
+		sp.Finish()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.address, bytes.NewReader(encoded))
 	if err != nil {
-		return err
+		return writeOutcome{}, err
 	}
-	req.Header.Set("content-encoding", "snappy")
+	req.Header.Set("content-encoding", endpoint.bodyEncoding.contentEncoding())
 	req.Header.Set(xhttp.HeaderContentType, xhttp.ContentTypeProtobuf)
+	req.Header.Set(remoteWriteVersionHeader, endpoint.remoteWriteVersionOrDefault())
+	req.Header.Set("User-Agent", p.opts.userAgentOrDefault())
+	req.Header.Set(requestIDHeader, requestID)
+	if endpoint.acceptEncoding != "" {
+		// NB: the client doesn't decompress responses itself since compression is
+		// disabled on its transport, error bodies are decoded by doRequest.
+		req.Header.Set("Accept-Encoding", endpoint.acceptEncoding)
+	}
 	if endpoint.apiToken != "" {
 		req.Header.Set("Authorization", fmt.Sprintf("Basic %s",
 			base64.StdEncoding.EncodeToString([]byte(
@@ -530,12 +1544,31 @@ func (p *promStorage) write(
 		}
 	}
 	req.Header.Set(endpoint.tenantHeader, string(tenant))
+	if endpoint.idempotencyKeyHeader != "" {
+		// NB: the key is set once so that all retries of this batch carry the same key.
+		req.Header.Set(endpoint.idempotencyKeyHeader, idempotencyKey(tenant, encoded))
+	}
 
 	start := time.Now()
 	status := 0
+	attempts := 0
 	backoff := 100 * time.Millisecond
 	for i := p.opts.retries; i >= 0; i-- {
-		status, err = p.doRequest(req)
+		if attempts > 0 {
+			// The body was consumed by the previous attempt.
+			if req.Body, err = req.GetBody(); err != nil {
+				break
+			}
+		}
+		if endpoint.sigV4 != nil {
+			// NB: the signature covers the body, the headers and the request time
+			// so the request is signed on every attempt, once everything is set.
+			if err = endpoint.sigV4.sign(req, encoded); err != nil {
+				break
+			}
+		}
+		attempts++
+		status, err = p.writeAttempt(ctx, endpoint, req, attempts)
 		if err == nil || status == http.StatusConflict || status == http.StatusTooManyRequests {
 			// 409 is a valid status code due to RWA dual scrape issue
 			// see https://docs.google.com/document/d/19exXqcXxtc37jbdFbztt97-I2S5A873__sAMOGFWD6Q/edit?tab=t.0#heading=h.8kznn96p9jea
@@ -543,23 +1576,102 @@ func (p *promStorage) write(
 			err = nil
 			break
 		}
+		if ctx.Err() != nil {
+			// The write was cancelled, e.g. by the close timeout, so don't retry it.
+			break
+		}
 		p.retryWrites.Inc(1)
 		time.Sleep(backoff)
 		backoff *= 2
 	}
 	methodDuration := time.Since(start)
 	metrics.RecordResponse(status, methodDuration)
-	return err
+	opentracingext.HTTPStatusCode.Set(sp, uint16(status))
+	sp.LogFields(opentracinglog.Int("attempts", attempts))
+	return writeOutcome{status: status, attempts: attempts}, err
+}
+
+// writeAttempt sends the request once, in its own span so that the retries of
+// a write can be told apart.
+func (p *promStorage) writeAttempt(
+	ctx context.Context,
+	endpoint EndpointOptions,
+	req *http.Request,
+	attempt int,
+) (int, error) {
+	sp, ctx := opentracing.StartSpanFromContextWithTracer(ctx, p.opts.tracer, tracepoint.PromRemoteWriteAttempt)
+	sp.SetTag("attempt", attempt)
+	status, err := p.limitedRequest(ctx, endpoint, req)
+	opentracingext.HTTPStatusCode.Set(sp, uint16(status))
+	if err != nil {
+		sp.LogFields(opentracinglog.Error(err))
+		opentracingext.Error.Set(sp, true)
+	}
+	sp.Finish()
+	return status, err
+}
+
+// produce publishes the encoded batch to a kafka endpoint keyed by tenant. Retries are
+// left to the producer, which usually has its own retry and batching policy.
+func (p *promStorage) produce(
+	ctx context.Context,
+	metrics *instrument.HttpMetrics,
+	endpoint EndpointOptions,
+	tenant tenantKey,
+	encoded []byte,
+) (writeOutcome, error) {
+	start := time.Now()
+	err := p.opts.messageProducer.Produce(ctx, endpoint.topic, []byte(tenant), encoded)
+	// NB: record the equivalent http status so dashboards work the same for all endpoint types.
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusServiceUnavailable
+		err = fmt.Errorf("error producing to topic %s: %w", endpoint.topic, err)
+	}
+	metrics.RecordResponse(status, time.Since(start))
+	return writeOutcome{status: status, attempts: 1}, err
+}
+
+// idempotencyKey returns a deterministic key for a batch so that backends can
+// dedupe a batch that was committed but retried, e.g. after a timeout.
+func idempotencyKey(tenant tenantKey, encoded []byte) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(tenant))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(encoded)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (p *promStorage) endpointClient(endpoint EndpointOptions) *http.Client {
+	if client, ok := p.endpointClients[endpoint.name]; ok {
+		return client
+	}
+	return p.client
 }
 
-func (p *promStorage) doRequest(req *http.Request) (int, error) {
-	resp, err := p.client.Do(req)
+// limitedRequest sends the request once the endpoint's concurrency limiter, if
+// any, allows it and reports whether the endpoint was overloaded.
+func (p *promStorage) limitedRequest(ctx context.Context, endpoint EndpointOptions, req *http.Request) (int, error) {
+	limiter, ok := p.endpointLimiters[endpoint.name]
+	if !ok {
+		return p.doRequest(p.endpointClient(endpoint), req)
+	}
+	if err := limiter.acquire(ctx); err != nil {
+		return http.StatusServiceUnavailable, err
+	}
+	status, err := p.doRequest(p.endpointClient(endpoint), req)
+	limiter.release(err != nil && (status >= 500 || status == http.StatusTooManyRequests))
+	return status, err
+}
+
+func (p *promStorage) doRequest(client *http.Client, req *http.Request) (int, error) {
+	resp, err := client.Do(req)
 	if err != nil {
 		return http.StatusServiceUnavailable, fmt.Errorf("503 error to connect to remote endpoint: %v", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 	if resp.StatusCode/100 != 2 {
-		response, err := io.ReadAll(resp.Body)
+		response, err := readResponseBody(resp)
 		if err != nil {
 			p.logger.Error("error reading body", zap.Error(err))
 			response = errorReadingBody
@@ -573,6 +1685,29 @@ func (p *promStorage) doRequest(req *http.Request) (int, error) {
 	return resp.StatusCode, nil
 }
 
+// readResponseBody reads the body of the response, decoding it if it is gzip
+// or snappy encoded.
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		r, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = r.Close() }()
+		return io.ReadAll(r)
+	case "snappy":
+		encoded, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return snappy.Decode(nil, encoded)
+	case "x-snappy-framed":
+		return io.ReadAll(snappy.NewReader(resp.Body))
+	}
+	return io.ReadAll(resp.Body)
+}
+
 func initEndpointMetrics(endpoints []EndpointOptions, scope tally.Scope) map[string]*instrument.HttpMetrics {
 	metrics := make(map[string]*instrument.HttpMetrics, len(endpoints))
 	for _, endpoint := range endpoints {
@@ -21,28 +21,46 @@
 package promremote
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/m3db/m3/src/metrics/filters"
 	"io"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/m3db/m3/src/cmd/services/m3query/config"
 	"github.com/m3db/m3/src/query/models"
 	"github.com/m3db/m3/src/query/storage"
 	"github.com/m3db/m3/src/query/storage/m3/storagemetadata"
 	"github.com/m3db/m3/src/query/storage/promremote/promremotetest"
+	"github.com/m3db/m3/src/query/tracepoint"
 	"github.com/m3db/m3/src/query/ts"
+	xclock "github.com/m3db/m3/src/x/clock"
+	xhttp "github.com/m3db/m3/src/x/net/http"
 	"github.com/m3db/m3/src/x/tallytest"
 	xtime "github.com/m3db/m3/src/x/time"
 
+	"github.com/golang/snappy"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 var (
@@ -363,6 +381,27 @@ func TestWriteBasedOnRetention(t *testing.T) {
 	})
 }
 
+func TestSetLogSampleRate(t *testing.T) {
+	p := &promStorage{}
+	assert.False(t, p.sampleLog(&p.logSampleRate))
+	assert.False(t, p.sampleLog(&p.wrongTenantLogSampleRate))
+
+	p.SetLogSampleRate(1)
+	assert.True(t, p.sampleLog(&p.logSampleRate))
+	assert.False(t, p.sampleLog(&p.wrongTenantLogSampleRate))
+
+	p.SetWrongTenantLogSampleRate(1)
+	p.SetLogSampleRate(0)
+	assert.False(t, p.sampleLog(&p.logSampleRate))
+	assert.True(t, p.sampleLog(&p.wrongTenantLogSampleRate))
+	assert.False(t, p.sampleLog(&p.defaultTenantLogSampleRate))
+
+	p.SetDefaultTenantLogSampleRate(1)
+	assert.True(t, p.sampleLog(&p.defaultTenantLogSampleRate))
+
+	var _ LogSampleRateSetter = p
+}
+
 func TestLoad(t *testing.T) {
 	t.Run("no jitter - small", func(t *testing.T) {
 		LoadTestPromRemoteStorage(t, false, 1, 2, 10)
@@ -508,6 +547,2150 @@ func TestErrorHandling(t *testing.T) {
 	})
 }
 
+func TestWriteFailover(t *testing.T) {
+	primary := promremotetest.NewServer(t, false)
+	defer primary.Close()
+	secondary := promremotetest.NewServer(t, false)
+	defer secondary.Close()
+
+	newStorage := func(scope tally.Scope, mode WriteMode) storage.Storage {
+		promStorage, err := NewStorage(Options{
+			endpoints: []EndpointOptions{
+				{name: "primary", address: primary.WriteAddr(), tenantHeader: "TENANT"},
+				{name: "secondary", address: secondary.WriteAddr(), tenantHeader: "TENANT"},
+			},
+			poolSize:      1,
+			queueSize:     1,
+			scope:         scope,
+			logger:        logger,
+			tenantDefault: "unknown",
+			tickDuration:  ptrDuration(tickDuration),
+			queueTimeout:  ptrDuration(queueTimeout),
+		}.SetWriteMode(mode))
+		require.NoError(t, err)
+		return promStorage
+	}
+
+	t.Run("secondary receives the batch when the primary fails", func(t *testing.T) {
+		primary.Reset()
+		secondary.Reset()
+		primary.SetError("primary down", http.StatusInternalServerError)
+
+		scope := tally.NewTestScope("test_scope", map[string]string{})
+		promStorage := newStorage(scope, WriteModeFailover)
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+		verifyMetrics(t, scope)
+
+		promWrite := secondary.GetLastWriteRequest()
+		require.NotNil(t, promWrite)
+		require.Len(t, promWrite.Timeseries, 1)
+		assert.Equal(t, []prompb.Label{{Name: "test_tag_name", Value: "test_tag_value"}},
+			promWrite.Timeseries[0].Labels)
+
+		tallytest.AssertCounterValue(
+			t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.write.total",
+			map[string]string{"endpoint_name": "primary", "code": "500"},
+		)
+		tallytest.AssertCounterValue(
+			t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.failover_writes",
+			map[string]string{},
+		)
+		tallytest.AssertCounterValue(
+			t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.written_samples",
+			map[string]string{},
+		)
+		tallytest.AssertCounterValue(
+			t, 0, scope.Snapshot(), "test_scope.prom_remote_storage.err_writes",
+			map[string]string{},
+		)
+	})
+
+	t.Run("secondary is not written when the primary succeeds", func(t *testing.T) {
+		primary.Reset()
+		secondary.Reset()
+
+		scope := tally.NewTestScope("test_scope", map[string]string{})
+		promStorage := newStorage(scope, WriteModeFailover)
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+
+		assert.NotNil(t, primary.GetLastWriteRequest())
+		assert.Nil(t, secondary.GetLastWriteRequest())
+		tallytest.AssertCounterValue(
+			t, 0, scope.Snapshot(), "test_scope.prom_remote_storage.failover_writes",
+			map[string]string{},
+		)
+	})
+
+	t.Run("primary mode doesn't fail over", func(t *testing.T) {
+		primary.Reset()
+		secondary.Reset()
+		primary.SetError("primary down", http.StatusInternalServerError)
+
+		scope := tally.NewTestScope("test_scope", map[string]string{})
+		promStorage := newStorage(scope, WriteModePrimary)
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+
+		assert.Nil(t, secondary.GetLastWriteRequest())
+		tallytest.AssertCounterValue(
+			t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.err_writes",
+			map[string]string{},
+		)
+	})
+}
+
+func TestWriteBatchTracing(t *testing.T) {
+	svr := promremotetest.NewServer(t, false)
+	defer svr.Close()
+
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	mtr := mocktracer.New()
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: svr.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		retries:       1,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	}.SetTracer(mtr))
+	require.NoError(t, err)
+	defer closeWithCheck(t, s)
+	promStorage := s.(*promStorage)
+
+	wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+		Tags: models.Tags{
+			Opts: models.NewTagOptions(),
+			Tags: []models.Tag{{
+				Name:  []byte("test_tag_name"),
+				Value: []byte("test_tag_value"),
+			}},
+		},
+		Datapoints: ts.Datapoints{{Timestamp: xtime.Now(), Value: 42}},
+		Unit:       xtime.Millisecond,
+	})
+	require.NoError(t, err)
+
+	findSpans := func(spans []*mocktracer.MockSpan, name string) []*mocktracer.MockSpan {
+		var found []*mocktracer.MockSpan
+		for _, sp := range spans {
+			if sp.OperationName == name {
+				found = append(found, sp)
+			}
+		}
+		return found
+	}
+	findSpan := func(spans []*mocktracer.MockSpan, name string) *mocktracer.MockSpan {
+		if found := findSpans(spans, name); len(found) > 0 {
+			return found[0]
+		}
+		return nil
+	}
+
+	t.Run("success", func(t *testing.T) {
+		svr.Reset()
+		mtr.Reset()
+		root := mtr.StartSpan("root")
+		ctx := opentracing.ContextWithSpan(context.Background(), root)
+
+		require.NoError(t, promStorage.writeBatch(ctx, "tenant", []*storage.WriteQuery{wq}))
+		root.Finish()
+
+		spans := mtr.FinishedSpans()
+		require.Len(t, spans, 4)
+		batchSpan := findSpan(spans, tracepoint.PromRemoteWriteBatch)
+		require.NotNil(t, batchSpan)
+		assert.Equal(t, "tenant", batchSpan.Tag("tenant"))
+		assert.Nil(t, batchSpan.Tag("error"))
+
+		writeSpan := findSpan(spans, tracepoint.PromRemoteWrite)
+		require.NotNil(t, writeSpan)
+		assert.Equal(t, batchSpan.SpanContext.SpanID, writeSpan.ParentID)
+		assert.Equal(t, "testEndpoint", writeSpan.Tag("endpoint"))
+		assert.Equal(t, uint16(http.StatusOK), writeSpan.Tag("http.status_code"))
+
+		attemptSpan := findSpan(spans, tracepoint.PromRemoteWriteAttempt)
+		require.NotNil(t, attemptSpan)
+		assert.Equal(t, writeSpan.SpanContext.SpanID, attemptSpan.ParentID)
+		assert.Equal(t, 1, attemptSpan.Tag("attempt"))
+		assert.Equal(t, uint16(http.StatusOK), attemptSpan.Tag("http.status_code"))
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		svr.Reset()
+		svr.SetError("test err", http.StatusInternalServerError)
+		mtr.Reset()
+		root := mtr.StartSpan("root")
+		ctx := opentracing.ContextWithSpan(context.Background(), root)
+
+		require.Error(t, promStorage.writeBatch(ctx, "tenant", []*storage.WriteQuery{wq}))
+		root.Finish()
+
+		attemptSpans := findSpans(mtr.FinishedSpans(), tracepoint.PromRemoteWriteAttempt)
+		require.Len(t, attemptSpans, 2)
+		for i, sp := range attemptSpans {
+			assert.Equal(t, i+1, sp.Tag("attempt"))
+			assert.Equal(t, true, sp.Tag("error"))
+			assert.Equal(t, uint16(http.StatusInternalServerError), sp.Tag("http.status_code"))
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		svr.Reset()
+		svr.SetError("test err", http.StatusForbidden)
+		mtr.Reset()
+		root := mtr.StartSpan("root")
+		ctx := opentracing.ContextWithSpan(context.Background(), root)
+
+		require.Error(t, promStorage.writeBatch(ctx, "tenant", []*storage.WriteQuery{wq}))
+		root.Finish()
+
+		spans := mtr.FinishedSpans()
+		batchSpan := findSpan(spans, tracepoint.PromRemoteWriteBatch)
+		require.NotNil(t, batchSpan)
+		assert.Equal(t, true, batchSpan.Tag("error"))
+
+		writeSpan := findSpan(spans, tracepoint.PromRemoteWrite)
+		require.NotNil(t, writeSpan)
+		assert.Equal(t, true, writeSpan.Tag("error"))
+		assert.Equal(t, uint16(http.StatusForbidden), writeSpan.Tag("http.status_code"))
+	})
+}
+
+func TestWriteSeriesLimits(t *testing.T) {
+	svr := promremotetest.NewServer(t, false)
+	defer svr.Close()
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	defer verifyMetrics(t, scope)
+	promStorage, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: svr.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     10,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+		seriesLimits:  seriesLimits{maxLabels: 1},
+	})
+	require.NoError(t, err)
+
+	now := xtime.Now()
+	for _, tags := range [][]models.Tag{
+		{{Name: []byte("a"), Value: []byte("1")}},
+		{{Name: []byte("a"), Value: []byte("1")}, {Name: []byte("b"), Value: []byte("2")}},
+	} {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags:       models.Tags{Opts: models.NewTagOptions(), Tags: tags},
+			Datapoints: ts.Datapoints{{Timestamp: now, Value: 42}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NoError(t, promStorage.Write(context.TODO(), wq))
+	}
+	closeWithCheck(t, promStorage)
+
+	promWrite := getWriteRequest(svr)
+	require.NotNil(t, promWrite)
+	require.Len(t, promWrite.Timeseries, 1)
+	assert.Equal(t, []prompb.Label{{Name: "a", Value: "1"}}, promWrite.Timeseries[0].Labels)
+
+	snapshot := scope.Snapshot()
+	tallytest.AssertCounterValue(t, 1, snapshot,
+		"test_scope.prom_remote_storage.series_too_many_labels", map[string]string{})
+	tallytest.AssertCounterValue(t, 1, snapshot,
+		"test_scope.prom_remote_storage.dropped_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 1, snapshot,
+		"test_scope.prom_remote_storage.written_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 0, snapshot,
+		"test_scope.prom_remote_storage.err_writes", map[string]string{})
+}
+
+func TestWriteMaxDatapointsPerSeries(t *testing.T) {
+	svr := promremotetest.NewServer(t, false)
+	defer svr.Close()
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	defer verifyMetrics(t, scope)
+	promStorage, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: svr.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     10,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+		seriesLimits:  seriesLimits{maxDatapoints: 2, truncateDatapoints: true},
+	})
+	require.NoError(t, err)
+
+	now := xtime.Now().Truncate(time.Second)
+	var datapoints ts.Datapoints
+	for i := 0; i < 5; i++ {
+		datapoints = append(datapoints, ts.Datapoint{Timestamp: now.Add(time.Duration(i) * time.Second), Value: 42})
+	}
+	wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+		Tags:       models.Tags{Opts: models.NewTagOptions(), Tags: []models.Tag{{Name: []byte("a"), Value: []byte("1")}}},
+		Datapoints: datapoints,
+		Unit:       xtime.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, promStorage.Write(context.TODO(), wq))
+	closeWithCheck(t, promStorage)
+
+	promWrite := getWriteRequest(svr)
+	require.NotNil(t, promWrite)
+	require.Len(t, promWrite.Timeseries, 1)
+	assert.Len(t, promWrite.Timeseries[0].Samples, 2)
+
+	snapshot := scope.Snapshot()
+	tallytest.AssertCounterValue(t, 1, snapshot,
+		"test_scope.prom_remote_storage.series_datapoints_capped", map[string]string{})
+	tallytest.AssertCounterValue(t, 3, snapshot,
+		"test_scope.prom_remote_storage.dropped_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 2, snapshot,
+		"test_scope.prom_remote_storage.written_samples", map[string]string{})
+}
+
+func TestWriteMaxFutureSkew(t *testing.T) {
+	svr := promremotetest.NewServer(t, false)
+	defer svr.Close()
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	defer verifyMetrics(t, scope)
+	promStorage, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: svr.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     10,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+		seriesLimits:  seriesLimits{maxFutureSkew: time.Hour},
+	})
+	require.NoError(t, err)
+
+	now := xtime.Now().Truncate(time.Second)
+	wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+		Tags: models.Tags{Opts: models.NewTagOptions(), Tags: []models.Tag{{Name: []byte("a"), Value: []byte("1")}}},
+		Datapoints: ts.Datapoints{
+			{Timestamp: now.Add(-time.Minute), Value: 1},
+			{Timestamp: now.Add(3 * time.Hour), Value: 2},
+			{Timestamp: now, Value: 3},
+		},
+		Unit: xtime.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, promStorage.Write(context.TODO(), wq))
+	closeWithCheck(t, promStorage)
+
+	promWrite := getWriteRequest(svr)
+	require.NotNil(t, promWrite)
+	require.Len(t, promWrite.Timeseries, 1)
+	require.Len(t, promWrite.Timeseries[0].Samples, 2)
+	assert.Equal(t, float64(1), promWrite.Timeseries[0].Samples[0].Value)
+	assert.Equal(t, float64(3), promWrite.Timeseries[0].Samples[1].Value)
+
+	snapshot := scope.Snapshot()
+	tallytest.AssertCounterValue(t, 1, snapshot,
+		"test_scope.prom_remote_storage.future_timestamp_dropped", map[string]string{})
+	tallytest.AssertCounterValue(t, 1, snapshot,
+		"test_scope.prom_remote_storage.dropped_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 2, snapshot,
+		"test_scope.prom_remote_storage.written_samples", map[string]string{})
+}
+
+func TestWriteSkipsMalformedSeries(t *testing.T) {
+	svr := promremotetest.NewServer(t, false)
+	defer svr.Close()
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	defer verifyMetrics(t, scope)
+	promStorage, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: svr.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     10,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	now := xtime.Now()
+	for _, value := range []string{"1", "2", "\xff", "3"} {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags: models.Tags{Opts: models.NewTagOptions(), Tags: []models.Tag{
+				{Name: []byte("a"), Value: []byte(value)},
+			}},
+			Datapoints: ts.Datapoints{{Timestamp: now, Value: 42}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NoError(t, promStorage.Write(context.TODO(), wq))
+	}
+	closeWithCheck(t, promStorage)
+
+	promWrite := getWriteRequest(svr)
+	require.NotNil(t, promWrite)
+	var values []string
+	for _, series := range promWrite.Timeseries {
+		require.Len(t, series.Labels, 1)
+		values = append(values, series.Labels[0].Value)
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, values)
+
+	snapshot := scope.Snapshot()
+	tallytest.AssertCounterValue(t, 1, snapshot,
+		"test_scope.prom_remote_storage.encode_skipped_series", map[string]string{})
+	tallytest.AssertCounterValue(t, 1, snapshot,
+		"test_scope.prom_remote_storage.dropped_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 3, snapshot,
+		"test_scope.prom_remote_storage.written_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 0, snapshot,
+		"test_scope.prom_remote_storage.err_writes", map[string]string{})
+}
+
+func TestMaxFlushDelay(t *testing.T) {
+	svr := promremotetest.NewServer(t, false)
+	defer svr.Close()
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	defer verifyMetrics(t, scope)
+
+	filterValues, err := filters.ValidateTagsFilter("test_tag_name:urgent")
+	require.NoError(t, err)
+	filter, err := filters.NewTagsFilter(filterValues, filters.Conjunction, filters.TagsFilterOptions{})
+	require.NoError(t, err)
+	promStorage, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: svr.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     100,
+		tenantDefault: "unknown",
+		tenantRules: []TenantRule{{
+			Filter:        filter,
+			Tenant:        "urgent",
+			MaxFlushDelay: 20 * time.Millisecond,
+		}},
+		// Never tick during the test.
+		tickDuration: ptrDuration(time.Hour),
+		queueTimeout: ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	write := func(value string) {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags: models.Tags{
+				Opts: models.NewTagOptions(),
+				Tags: []models.Tag{{Name: []byte("test_tag_name"), Value: []byte(value)}},
+			},
+			Datapoints: ts.Datapoints{{Timestamp: xtime.Now(), Value: 42}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NoError(t, promStorage.Write(context.TODO(), wq))
+	}
+	write("other")
+	write("urgent")
+
+	promWrite := getWriteRequest(svr)
+	require.NotNil(t, promWrite)
+	require.Len(t, promWrite.Timeseries, 1)
+	assert.Equal(t, "urgent", promWrite.Timeseries[0].Labels[0].Value)
+
+	// The tenant without a max flush delay is only flushed on close.
+	closeWithCheck(t, promStorage)
+	assert.Equal(t, 2, svr.GetTotalSamples())
+	tallytest.AssertCounterValue(t, 1, scope.Snapshot(),
+		"test_scope.prom_remote_storage.overdue_flushes", map[string]string{})
+}
+
+func TestFlushConcurrency(t *testing.T) {
+	var (
+		inFlight    atomic.Int32
+		maxInFlight atomic.Int32
+		written     atomic.Int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			max := maxInFlight.Load()
+			if n <= max || maxInFlight.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		written.Add(1)
+	}))
+	defer server.Close()
+
+	const (
+		numTenants = 8
+		poolSize   = 2
+	)
+	tenantRules := make([]TenantRule, 0, numTenants)
+	for i := 0; i < numTenants; i++ {
+		tenantRules = append(tenantRules, newTestTenantRule(t, fmt.Sprintf("job:job%d", i), fmt.Sprintf("tenant%d", i), 0))
+	}
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: server.URL, tenantHeader: "TENANT"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      poolSize,
+		queueSize:     100,
+		tenantDefault: "default",
+		tenantRules:   tenantRules,
+		tickDuration:  ptrDuration(10 * time.Millisecond),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	// The queues are never full so every batch is flushed on tick.
+	for i := 0; i < numTenants; i++ {
+		require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "job", fmt.Sprintf("job%d", i))))
+	}
+	closeWithCheck(t, s)
+
+	assert.Equal(t, int32(numTenants), written.Load())
+	assert.True(t, maxInFlight.Load() <= poolSize, "max in flight writes %d", maxInFlight.Load())
+}
+
+func TestOrderedWrites(t *testing.T) {
+	for _, batch := range []bool{false, true} {
+		t.Run(fmt.Sprintf("batch=%v", batch), func(t *testing.T) {
+			testOrderedWrites(t, batch)
+		})
+	}
+}
+
+func testOrderedWrites(t *testing.T, batch bool) {
+	var (
+		mu       sync.Mutex
+		received = make(map[string][]float64)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		data, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		var req prompb.WriteRequest
+		require.NoError(t, req.Unmarshal(data))
+		// Earlier samples take longer to be written, so that they would land
+		// after later ones if written concurrently.
+		for _, series := range req.Timeseries {
+			for _, sample := range series.Samples {
+				time.Sleep(time.Duration(10-sample.Value) * time.Millisecond)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, series := range req.Timeseries {
+			for _, sample := range series.Samples {
+				received[series.Labels[0].Value] = append(received[series.Labels[0].Value], sample.Value)
+			}
+		}
+	}))
+	defer server.Close()
+
+	s, err := NewStorage(Options{
+		endpoints:          []EndpointOptions{{name: "testEndpoint", address: server.URL, tenantHeader: "TENANT"}},
+		scope:              tally.NoopScope,
+		logger:             logger,
+		poolSize:           8,
+		queueSize:          1,
+		tenantDefault:      "default",
+		tickDuration:       ptrDuration(tickDuration),
+		queueTimeout:       ptrDuration(queueTimeout),
+		orderedWriteShards: 2,
+	})
+	require.NoError(t, err)
+
+	// Every write is flushed as its own batch.
+	now := xtime.Now().Truncate(time.Second)
+	var queries []*storage.WriteQuery
+	for i := 0; i < 10; i++ {
+		for _, series := range []string{"a", "b"} {
+			wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+				Tags: models.Tags{Opts: models.NewTagOptions(), Tags: []models.Tag{
+					{Name: []byte("series"), Value: []byte(series)},
+				}},
+				Datapoints: ts.Datapoints{{Timestamp: now.Add(time.Duration(i) * time.Second), Value: float64(i)}},
+				Unit:       xtime.Millisecond,
+			})
+			require.NoError(t, err)
+			queries = append(queries, wq)
+		}
+	}
+	if batch {
+		require.NoError(t, s.(BatchWriter).WriteBatch(context.TODO(), queries))
+	} else {
+		for _, query := range queries {
+			require.NoError(t, s.Write(context.TODO(), query))
+		}
+	}
+	closeWithCheck(t, s)
+
+	expected := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	assert.Equal(t, map[string][]float64{"a": expected, "b": expected}, received)
+}
+
+// pairBatchQueue returns a batch as soon as two queries are pending.
+type pairBatchQueue struct {
+	queries []*storage.WriteQuery
+}
+
+func (q *pairBatchQueue) Add(query *storage.WriteQuery) []*storage.WriteQuery {
+	q.queries = append(q.queries, query)
+	if len(q.queries) < 2 {
+		return nil
+	}
+	return q.Pop()
+}
+
+func (q *pairBatchQueue) Len() int { return len(q.queries) }
+
+func (q *pairBatchQueue) Pop() []*storage.WriteQuery {
+	res := q.queries
+	q.queries = nil
+	return res
+}
+
+func TestCustomBatchQueue(t *testing.T) {
+	fakeProm := promremotetest.NewServer(t, false)
+	defer fakeProm.Close()
+
+	var (
+		mu      sync.Mutex
+		created = make(map[string]int)
+	)
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: fakeProm.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     100,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{newTestTenantRule(t, "region:eu", "eu", 0)},
+		// Never tick during the test.
+		tickDuration: ptrDuration(time.Hour),
+		queueTimeout: ptrDuration(queueTimeout),
+	}.SetNewBatchQueueFn(func(tenant string, queueSize int) BatchQueue {
+		mu.Lock()
+		defer mu.Unlock()
+		created[tenant] = queueSize
+		return &pairBatchQueue{}
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"default": 100, "eu": 100}, created)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "eu", "id", fmt.Sprint(i))))
+	}
+	// Two pairs are written well before the queue size is reached.
+	require.True(t, xclock.WaitUntil(func() bool { return fakeProm.GetTotalSamples() == 4 }, time.Second))
+	require.True(t, xclock.WaitUntil(func() bool {
+		for _, stats := range s.(QueueStatsReporter).QueueStats().Tenants {
+			if stats.Tenant == "eu" {
+				return stats.Length == 1
+			}
+		}
+		return false
+	}, time.Second))
+
+	// The last query is flushed on close.
+	closeWithCheck(t, s)
+	assert.Equal(t, 5, fakeProm.GetTotalSamples())
+}
+
+func TestQueueStats(t *testing.T) {
+	svr := promremotetest.NewServer(t, false)
+	defer svr.Close()
+	svr.SetError("bad request", http.StatusBadRequest)
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+
+	filterValues, err := filters.ValidateTagsFilter("test_tag_name:urgent")
+	require.NoError(t, err)
+	filter, err := filters.NewTagsFilter(filterValues, filters.Conjunction, filters.TagsFilterOptions{})
+	require.NoError(t, err)
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: svr.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     100,
+		tenantDefault: "unknown",
+		tenantRules: []TenantRule{{
+			Filter:        filter,
+			Tenant:        "urgent",
+			MaxFlushDelay: 20 * time.Millisecond,
+		}},
+		// Never tick during the test.
+		tickDuration: ptrDuration(time.Hour),
+		queueTimeout: ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+	defer closeWithCheck(t, s)
+	reporter, ok := s.(QueueStatsReporter)
+	require.True(t, ok)
+
+	before := time.Now()
+	for _, value := range []string{"other", "urgent"} {
+		wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags: models.Tags{
+				Opts: models.NewTagOptions(),
+				Tags: []models.Tag{{Name: []byte("test_tag_name"), Value: []byte(value)}},
+			},
+			Datapoints: ts.Datapoints{{Timestamp: xtime.Now(), Value: 42}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.Write(context.TODO(), wq))
+	}
+
+	// The urgent queue is flushed by its max flush delay and the write fails.
+	var stats QueueStats
+	for retries := 0; retries < 10; retries++ {
+		stats = reporter.QueueStats()
+		if stats.Tenants[1].DroppedSamples > 0 {
+			break
+		}
+		time.Sleep(tickDuration)
+	}
+	assert.Equal(t, 0, stats.DataQueueLength)
+	assert.Equal(t, 0, stats.DeadLetterQueueLength)
+	require.Len(t, stats.Tenants, 2)
+
+	unknown := stats.Tenants[0]
+	assert.Equal(t, "unknown", unknown.Tenant)
+	assert.Equal(t, 1, unknown.Length)
+	assert.Equal(t, 100, unknown.Capacity)
+	assert.Equal(t, int64(1), unknown.EnqueuedSamples)
+	assert.Equal(t, int64(0), unknown.DroppedSamples)
+	assert.True(t, unknown.LastFlush.IsZero())
+
+	urgent := stats.Tenants[1]
+	assert.Equal(t, "urgent", urgent.Tenant)
+	assert.Equal(t, 0, urgent.Length)
+	assert.Equal(t, int64(1), urgent.EnqueuedSamples)
+	assert.Equal(t, int64(1), urgent.DroppedSamples)
+	assert.False(t, urgent.LastFlush.Before(before))
+}
+
+func newTestTenantRule(t *testing.T, filter, tenant string, priority int) TenantRule {
+	return TenantRule{Filter: mustTagsFilter(t, filter), Tenant: tenant, Priority: priority}
+}
+
+// routedTenant returns the tenant the query is routed to, requiring one to be found.
+func routedTenant(t *testing.T, p *promStorage, query *storage.WriteQuery) tenantKey {
+	tenant, ok := p.getTenant(query)
+	require.True(t, ok)
+	return tenant
+}
+
+func newTestWriteQuery(t *testing.T, tags ...string) *storage.WriteQuery {
+	modelTags := models.NewTags(len(tags)/2, models.NewTagOptions())
+	for i := 0; i < len(tags); i += 2 {
+		modelTags = modelTags.AddTag(models.Tag{Name: []byte(tags[i]), Value: []byte(tags[i+1])})
+	}
+	wq, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+		Tags:       modelTags,
+		Datapoints: ts.Datapoints{{Timestamp: xtime.Now(), Value: 42}},
+		Unit:       xtime.Millisecond,
+	})
+	require.NoError(t, err)
+	return wq
+}
+
+func TestGetTenantPriority(t *testing.T) {
+	p := &promStorage{opts: Options{
+		tenantDefault: "default",
+		tenantRules: sortTenantRules([]TenantRule{
+			newTestTenantRule(t, "job:*", "low", 0),
+			newTestTenantRule(t, "job:api", "high", 10),
+			newTestTenantRule(t, "job:api", "high-later", 10),
+			newTestTenantRule(t, "job:db", "negative", -1),
+		}),
+	}, defaultedSeries: tally.NoopScope.Counter("defaulted_series")}
+
+	assert.Equal(t, tenantKey("high"), routedTenant(t, p, newTestWriteQuery(t, "job", "api")))
+	assert.Equal(t, tenantKey("low"), routedTenant(t, p, newTestWriteQuery(t, "job", "db")))
+	assert.Equal(t, tenantKey("low"), routedTenant(t, p, newTestWriteQuery(t, "job", "web")))
+	assert.Equal(t, tenantKey("default"), routedTenant(t, p, newTestWriteQuery(t, "service", "web")))
+}
+
+func TestGetTenantSplit(t *testing.T) {
+	rule := newTestTenantRule(t, "job:api", "stable", 0)
+	rule.SplitTenant = "canary"
+	rule.SplitPercent = 25
+	p := &promStorage{opts: Options{tenantDefault: "default", tenantRules: []TenantRule{rule}}}
+
+	const numSeries = 10000
+	routed := make(map[string]tenantKey, numSeries)
+	canary := 0
+	for i := 0; i < numSeries; i++ {
+		id := fmt.Sprint(i)
+		tenant := routedTenant(t, p, newTestWriteQuery(t, "job", "api", "instance", id))
+		routed[id] = tenant
+		if tenant == "canary" {
+			canary++
+		}
+	}
+	// The split is hash based so it is only approximately the configured percentage.
+	assert.InDelta(t, numSeries/4, canary, numSeries/50)
+
+	// A series always routes to the same tenant.
+	for i := 0; i < numSeries; i++ {
+		id := fmt.Sprint(i)
+		require.Equal(t, routed[id], routedTenant(t, p, newTestWriteQuery(t, "job", "api", "instance", id)))
+	}
+
+	p.opts.tenantRules[0].SplitPercent = 0
+	for id := range routed {
+		require.Equal(t, tenantKey("stable"), routedTenant(t, p, newTestWriteQuery(t, "job", "api", "instance", id)))
+	}
+	p.opts.tenantRules[0].SplitPercent = 100
+	for id := range routed {
+		require.Equal(t, tenantKey("canary"), routedTenant(t, p, newTestWriteQuery(t, "job", "api", "instance", id)))
+	}
+}
+
+func TestSplitTenantQueue(t *testing.T) {
+	rule := newTestTenantRule(t, "job:api", "stable", 0)
+	rule.SplitTenant = "canary"
+	rule.SplitPercent = 100
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: "http://localhost:0", tenantHeader: "TENANT"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     100,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{rule},
+		tickDuration:  ptrDuration(time.Hour),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+	defer closeWithCheck(t, s)
+
+	var tenants []string
+	for _, stats := range s.(QueueStatsReporter).QueueStats().Tenants {
+		tenants = append(tenants, stats.Tenant)
+	}
+	assert.Equal(t, []string{"canary", "default", "stable"}, tenants)
+}
+
+func TestTenantEndpoints(t *testing.T) {
+	global := promremotetest.NewServer(t, false)
+	defer global.Close()
+	dedicated := promremotetest.NewServer(t, false)
+	defer dedicated.Close()
+
+	rule := newTestTenantRule(t, "region:eu", "eu", 0)
+	rule.Endpoints = []EndpointOptions{{name: "eu", address: dedicated.WriteAddr(), tenantHeader: "TENANT"}}
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "global", address: global.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{rule},
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "eu")))
+	require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "us")))
+	closeWithCheck(t, s)
+
+	for _, tt := range []struct {
+		endpoint string
+		server   *promremotetest.TestPromServer
+		region   string
+	}{
+		{endpoint: "eu", server: dedicated, region: "eu"},
+		{endpoint: "global", server: global, region: "us"},
+	} {
+		assert.Equal(t, 1, tt.server.GetTotalSamples(), tt.endpoint)
+		promWrite := tt.server.GetLastWriteRequest()
+		require.NotNil(t, promWrite, tt.endpoint)
+		require.Len(t, promWrite.Timeseries, 1)
+		assert.Equal(t, []prompb.Label{{Name: "region", Value: tt.region}}, promWrite.Timeseries[0].Labels)
+		tallytest.AssertCounterValue(
+			t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.write.total",
+			map[string]string{"endpoint_name": tt.endpoint, "code": "200"},
+		)
+	}
+
+	rule.Endpoints = []EndpointOptions{}
+	_, err = NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "global", address: global.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{rule},
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.EqualError(t, err, "endpoint must not be empty for tenant eu")
+}
+
+func TestTenantBytesWritten(t *testing.T) {
+	fakeProm := promremotetest.NewServer(t, false)
+	defer fakeProm.Close()
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: fakeProm.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{newTestTenantRule(t, "region:eu", "eu", 0)},
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	query := newTestWriteQuery(t, "region", "eu")
+	require.NoError(t, s.Write(context.TODO(), query))
+	closeWithCheck(t, s)
+
+	encoded, stats, err := convertAndEncodeWriteQuery([]*storage.WriteQuery{query}, convertOptions{})
+	require.NoError(t, err)
+	require.True(t, stats.uncompressedBytes > 0)
+	snapshot := scope.Snapshot()
+	tags := map[string]string{"tenant": "eu", "endpoint_name": "testEndpoint"}
+	tallytest.AssertCounterValue(t, int64(len(encoded)), snapshot,
+		"test_scope.prom_remote_storage.bytes_written", tags)
+	tallytest.AssertCounterValue(t, int64(stats.uncompressedBytes), snapshot,
+		"test_scope.prom_remote_storage.uncompressed_bytes_written", tags)
+	tags["tenant"] = "default"
+	tallytest.AssertCounterValue(t, 0, snapshot, "test_scope.prom_remote_storage.bytes_written", tags)
+}
+
+func TestTenantSampleRate(t *testing.T) {
+	for _, batch := range []bool{false, true} {
+		t.Run(fmt.Sprintf("batch=%v", batch), func(t *testing.T) {
+			testTenantSampleRate(t, batch)
+		})
+	}
+}
+
+func testTenantSampleRate(t *testing.T, batch bool) {
+	fakeProm := promremotetest.NewServer(t, false)
+	defer fakeProm.Close()
+
+	rule := newTestTenantRule(t, "region:eu", "eu", 0)
+	rule.SampleRate = 0.25
+	scope := tally.NewTestScope("test_scope", nil)
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: fakeProm.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     100,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{rule},
+		tickDuration:  ptrDuration(time.Hour),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	const writes = 2000
+	var queries []*storage.WriteQuery
+	for i := 0; i < writes; i++ {
+		queries = append(queries,
+			newTestWriteQuery(t, "region", "eu", "id", fmt.Sprint(i)),
+			newTestWriteQuery(t, "region", "us", "id", fmt.Sprint(i)))
+	}
+	if batch {
+		require.NoError(t, s.(BatchWriter).WriteBatch(context.TODO(), queries))
+	} else {
+		for _, query := range queries {
+			require.NoError(t, s.Write(context.TODO(), query))
+		}
+	}
+	closeWithCheck(t, s)
+
+	counters := scope.Snapshot().Counters()
+	dropped := counters["test_scope.prom_remote_storage.sampled_drop+tenant=eu"].Value()
+	// About three quarters of the tenant's writes are dropped.
+	assert.InDelta(t, 0.75*writes, dropped, 0.1*writes)
+	tallytest.AssertCounterValue(t, 0, scope.Snapshot(), "test_scope.prom_remote_storage.sampled_drop",
+		map[string]string{"tenant": "default"})
+	tallytest.AssertCounterValue(t, dropped, scope.Snapshot(), "test_scope.prom_remote_storage.dropped_samples", nil)
+	assert.Equal(t, 2*writes-int(dropped), fakeProm.GetTotalSamples())
+}
+
+func TestTenantMetrics(t *testing.T) {
+	fakeProm := promremotetest.NewServer(t, false)
+	defer fakeProm.Close()
+
+	scope := tally.NewTestScope("test_scope", nil)
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: fakeProm.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{newTestTenantRule(t, "region:eu", "eu", 0)},
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "eu", "id", "1")))
+	require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "eu", "id", "2")))
+	require.True(t, xclock.WaitUntil(func() bool { return fakeProm.GetTotalSamples() == 2 }, time.Second))
+	fakeProm.SetError("test err", http.StatusBadRequest)
+	require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "us")))
+	closeWithCheck(t, s)
+
+	snapshot := scope.Snapshot()
+	eu := map[string]string{"tenant": "eu"}
+	tallytest.AssertCounterValue(t, 2, snapshot, "test_scope.prom_remote_storage.tenant_enqueued_samples", eu)
+	tallytest.AssertCounterValue(t, 0, snapshot, "test_scope.prom_remote_storage.tenant_err_writes", eu)
+	tallytest.AssertCounterValue(t, 0, snapshot, "test_scope.prom_remote_storage.tenant_dropped_samples", eu)
+
+	def := map[string]string{"tenant": "default"}
+	tallytest.AssertCounterValue(t, 1, snapshot, "test_scope.prom_remote_storage.tenant_enqueued_samples", def)
+	tallytest.AssertCounterValue(t, 1, snapshot, "test_scope.prom_remote_storage.tenant_err_writes", def)
+	tallytest.AssertCounterValue(t, 1, snapshot, "test_scope.prom_remote_storage.tenant_dropped_samples", def)
+
+	// The global counters are still reported, as the sum over the tenants.
+	counters := snapshot.Counters()
+	assert.Equal(t, counters["test_scope.prom_remote_storage.batch_writes+"].Value(),
+		counters["test_scope.prom_remote_storage.tenant_batch_writes+tenant=eu"].Value()+
+			counters["test_scope.prom_remote_storage.tenant_batch_writes+tenant=default"].Value())
+	tallytest.AssertCounterValue(t, 1, snapshot, "test_scope.prom_remote_storage.err_writes", nil)
+}
+
+func TestDefaultedSeries(t *testing.T) {
+	fakeProm := promremotetest.NewServer(t, false)
+	defer fakeProm.Close()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	scope := tally.NewTestScope("test_scope", nil)
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: fakeProm.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        zap.New(core),
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{newTestTenantRule(t, "region:eu", "eu", 0)},
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	}.SetDefaultTenantLogSampleRate(1))
+	require.NoError(t, err)
+
+	require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "eu")))
+	require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "us")))
+	closeWithCheck(t, s)
+
+	tallytest.AssertCounterValue(t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.defaulted_series", nil)
+	entries := logs.FilterMessage("no tenant rule matched, routing to the default tenant").AllUntimed()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "default", fields["defaultTenant"])
+	assert.Contains(t, fields["timeseries"], "region: us")
+	assert.Equal(t, 2, fakeProm.GetTotalSamples())
+}
+
+func TestTenantLabels(t *testing.T) {
+	fakeProm := promremotetest.NewServer(t, false)
+	defer fakeProm.Close()
+
+	rule := newTestTenantRule(t, "region:eu", "eu", 0)
+	rule.Labels = map[string]string{"cluster": "eu-1", "region": "europe"}
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: fakeProm.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{rule},
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	query := newTestWriteQuery(t, "region", "eu")
+	require.NoError(t, s.Write(context.TODO(), query))
+	closeWithCheck(t, s)
+
+	promWrite := fakeProm.GetLastWriteRequest()
+	require.NotNil(t, promWrite)
+	require.Len(t, promWrite.Timeseries, 1)
+	assert.Equal(t, []prompb.Label{
+		{Name: "cluster", Value: "eu-1"},
+		{Name: "region", Value: "eu"},
+	}, promWrite.Timeseries[0].Labels)
+
+	// The labels are injected into the written series only, the query is still
+	// routed on its original tags.
+	value, ok := query.Tags().Get([]byte("region"))
+	require.True(t, ok)
+	assert.Equal(t, "eu", string(value))
+	_, ok = query.Tags().Get([]byte("cluster"))
+	assert.False(t, ok)
+	assert.Equal(t, tenantKey("eu"), routedTenant(t, s.(*promStorage), query))
+}
+
+func TestWriteBatch(t *testing.T) {
+	fakeProm := promremotetest.NewServer(t, false)
+	defer fakeProm.Close()
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: fakeProm.WriteAddr(), tenantHeader: "TENANT"}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      2,
+		queueSize:     2,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{newTestTenantRule(t, "region:eu", "eu", 0)},
+		// The tick never fires so that any write must have been flushed by WriteBatch.
+		tickDuration: ptrDuration(time.Hour),
+		queueTimeout: ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+	defer closeWithCheck(t, s)
+	var _ BatchWriter = s.(*promStorage)
+
+	dup, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+		Tags:           models.NewTags(1, models.NewTagOptions()).AddTag(models.Tag{Name: []byte("region"), Value: []byte("eu")}),
+		Datapoints:     ts.Datapoints{{Timestamp: xtime.Now(), Value: 42}},
+		Unit:           xtime.Millisecond,
+		DuplicateWrite: true,
+	})
+	require.NoError(t, err)
+	err = s.(BatchWriter).WriteBatch(context.TODO(), []*storage.WriteQuery{
+		newTestWriteQuery(t, "region", "eu"),
+		newTestWriteQuery(t, "region", "us"),
+		newTestWriteQuery(t, "region", "eu"),
+		dup,
+		newTestWriteQuery(t, "region", "eu"),
+		nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, fakeProm.GetTotalSamples())
+
+	enqueued := make(map[string]int64)
+	for _, stats := range s.(QueueStatsReporter).QueueStats().Tenants {
+		assert.Zero(t, stats.Length, stats.Tenant)
+		enqueued[stats.Tenant] = stats.EnqueuedSamples
+	}
+	assert.Equal(t, map[string]int64{"default": 1, "eu": 3}, enqueued)
+
+	snapshot := scope.Snapshot()
+	// The eu queries are split into batches of the queue size.
+	tallytest.AssertCounterValue(t, 3, snapshot, "test_scope.prom_remote_storage.batch_writes", map[string]string{})
+	tallytest.AssertCounterValue(t, 4, snapshot, "test_scope.prom_remote_storage.enqueued_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 4, snapshot, "test_scope.prom_remote_storage.written_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 1, snapshot, "test_scope.prom_remote_storage.duplicate_writes", map[string]string{})
+
+	fakeProm.SetError("server error", http.StatusInternalServerError)
+	err = s.(BatchWriter).WriteBatch(context.TODO(), []*storage.WriteQuery{newTestWriteQuery(t, "region", "eu")})
+	require.Error(t, err)
+}
+
+// tagTenantResolver routes writes to the tenant of their tenant tag, falling
+// back on the rules if set.
+type tagTenantResolver struct {
+	fallback TenantResolver
+}
+
+func (r tagTenantResolver) Resolve(query *storage.WriteQuery) (string, bool) {
+	if tenant, ok := query.Tags().Get([]byte("tenant")); ok {
+		return string(tenant), true
+	}
+	if r.fallback != nil {
+		return r.fallback.Resolve(query)
+	}
+	return "", false
+}
+
+func TestTenantResolver(t *testing.T) {
+	rules := []TenantRule{
+		newTestTenantRule(t, "region:eu", "eu", 0),
+		newTestTenantRule(t, "region:us", "us", 0),
+	}
+	queries := func() []*storage.WriteQuery {
+		return []*storage.WriteQuery{
+			newTestWriteQuery(t, "tenant", "us", "region", "eu"),
+			newTestWriteQuery(t, "region", "eu"),
+			newTestWriteQuery(t, "region", "ap"),
+			newTestWriteQuery(t, "tenant", "unknown"),
+		}
+	}
+	for _, tt := range []struct {
+		name          string
+		resolver      TenantResolver
+		enqueued      map[string]int64
+		noTenantFound int64
+		droppedWrites int64
+	}{
+		{
+			name:          "default rules",
+			enqueued:      map[string]int64{"default": 2, "eu": 2, "us": 0},
+			droppedWrites: 0,
+		},
+		{
+			name:          "custom",
+			resolver:      tagTenantResolver{},
+			enqueued:      map[string]int64{"default": 0, "eu": 0, "us": 1},
+			noTenantFound: 2,
+			droppedWrites: 3,
+		},
+		{
+			name:          "custom with rules fallback",
+			resolver:      tagTenantResolver{fallback: NewRuleTenantResolver(rules, "default")},
+			enqueued:      map[string]int64{"default": 1, "eu": 1, "us": 1},
+			droppedWrites: 1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeProm := promremotetest.NewServer(t, false)
+			defer fakeProm.Close()
+			scope := tally.NewTestScope("test_scope", map[string]string{})
+			opts := Options{
+				endpoints:     []EndpointOptions{{name: "testEndpoint", address: fakeProm.WriteAddr(), tenantHeader: "TENANT"}},
+				scope:         scope,
+				logger:        logger,
+				poolSize:      1,
+				queueSize:     10,
+				tenantDefault: "default",
+				tenantRules:   rules,
+				tickDuration:  ptrDuration(time.Hour),
+				queueTimeout:  ptrDuration(queueTimeout),
+			}
+			if tt.resolver != nil {
+				opts = opts.SetTenantResolver(tt.resolver)
+			}
+			s, err := NewStorage(opts)
+			require.NoError(t, err)
+			defer closeWithCheck(t, s)
+
+			require.NoError(t, s.(BatchWriter).WriteBatch(context.TODO(), queries()))
+			enqueued := make(map[string]int64)
+			for _, stats := range s.(QueueStatsReporter).QueueStats().Tenants {
+				enqueued[stats.Tenant] = stats.EnqueuedSamples
+			}
+			assert.Equal(t, tt.enqueued, enqueued)
+			snapshot := scope.Snapshot()
+			tallytest.AssertCounterValue(t, tt.noTenantFound, snapshot,
+				"test_scope.prom_remote_storage.no_tenant_found", map[string]string{})
+			tallytest.AssertCounterValue(t, tt.droppedWrites, snapshot,
+				"test_scope.prom_remote_storage.dropped_writes", map[string]string{})
+		})
+	}
+}
+
+func benchmarkWrite(b *testing.B, batched bool) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	defer server.Close()
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: server.URL, tenantHeader: "TENANT"}},
+		scope:         tally.NoopScope,
+		logger:        zap.NewNop(),
+		poolSize:      10,
+		queueSize:     1000,
+		tenantDefault: "default",
+		tenantRules: []TenantRule{
+			{Filter: mustTagsFilter(b, "region:eu"), Tenant: "eu"},
+			{Filter: mustTagsFilter(b, "region:us"), Tenant: "us"},
+		},
+		tickDuration: ptrDuration(tickDuration),
+		queueTimeout: ptrDuration(queueTimeout),
+	})
+	require.NoError(b, err)
+
+	const batchSize = 1000
+	regions := []string{"eu", "us", "ap"}
+	queries := make([]*storage.WriteQuery, 0, batchSize)
+	for i := 0; i < batchSize; i++ {
+		tags := models.NewTags(2, models.NewTagOptions()).
+			AddTag(models.Tag{Name: []byte("region"), Value: []byte(regions[i%len(regions)])}).
+			AddTag(models.Tag{Name: []byte("instance"), Value: []byte(fmt.Sprint(i))})
+		query, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+			Tags:       tags,
+			Datapoints: ts.Datapoints{{Timestamp: xtime.Now(), Value: 42}},
+			Unit:       xtime.Millisecond,
+		})
+		require.NoError(b, err)
+		queries = append(queries, query)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if batched {
+			require.NoError(b, s.(BatchWriter).WriteBatch(context.TODO(), queries))
+			continue
+		}
+		for _, query := range queries {
+			require.NoError(b, s.Write(context.TODO(), query))
+		}
+	}
+	require.NoError(b, s.Close())
+}
+
+func BenchmarkWrite(b *testing.B) {
+	benchmarkWrite(b, false)
+}
+
+func BenchmarkWriteBatch(b *testing.B) {
+	benchmarkWrite(b, true)
+}
+
+func mustTagsFilter(t testing.TB, filter string) filters.TagsFilter {
+	filterValues, err := filters.ValidateTagsFilter(filter)
+	require.NoError(t, err)
+	tagsFilter, err := filters.NewTagsFilter(filterValues, filters.Conjunction, filters.TagsFilterOptions{})
+	require.NoError(t, err)
+	return tagsFilter
+}
+
+func TestEndpointClients(t *testing.T) {
+	s, err := NewStorage(Options{
+		endpoints: []EndpointOptions{
+			{name: "default", address: "http://localhost:0", tenantHeader: "TENANT"},
+			{
+				name:                "busy",
+				address:             "http://localhost:0",
+				tenantHeader:        "TENANT",
+				maxIdleConnsPerHost: 500,
+				maxConnsPerHost:     1000,
+			},
+		},
+		httpOptions:   xhttp.DefaultHTTPClientOptions(),
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "default",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+	defer closeWithCheck(t, s)
+	promStorage := s.(*promStorage)
+
+	transport := promStorage.endpointClient(promStorage.opts.endpoints[0]).Transport.(*http.Transport)
+	assert.Equal(t, 100, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 0, transport.MaxConnsPerHost)
+
+	transport = promStorage.endpointClient(promStorage.opts.endpoints[1]).Transport.(*http.Transport)
+	assert.Equal(t, 100, transport.MaxIdleConns)
+	assert.Equal(t, 500, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 1000, transport.MaxConnsPerHost)
+}
+
+func TestWriteHTTP2(t *testing.T) {
+	var protoMajor int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&protoMajor, int32(r.ProtoMajor))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	s, err := NewStorage(Options{
+		endpoints: []EndpointOptions{{
+			name:         "h2",
+			address:      srv.URL,
+			tenantHeader: "TENANT",
+			keepAlive:    30 * time.Second,
+			http2:        &http2Options{readIdleTimeout: 10 * time.Second, pingTimeout: 5 * time.Second},
+		}},
+		httpOptions:   xhttp.DefaultHTTPClientOptions(),
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "default",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+	promStorage := s.(*promStorage)
+
+	transport := promStorage.endpointClient(promStorage.opts.endpoints[0]).Transport.(*http.Transport)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.Contains(t, transport.TLSNextProto, "h2")
+	assert.Contains(t, transport.TLSClientConfig.NextProtos, "h2")
+	// Trust the certificate of the test server.
+	transport.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	require.NoError(t, writeTestMetric(t, s, storagemetadata.Attributes{}))
+	closeWithCheck(t, s)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&protoMajor))
+}
+
+func TestTryWrite(t *testing.T) {
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	// The write loop isn't started so that the data queue fills up.
+	p := &promStorage{
+		logger:           logger,
+		enqueuedSamples:  scope.Counter("enqueued_samples"),
+		inFlightSamples:  scope.Gauge("in_flight_samples"),
+		dataQueue:        make(chan *storage.WriteQuery, 2),
+		dataQueueSize:    scope.Gauge("data_queue_size"),
+		dupWrites:        scope.Counter("duplicate_writes"),
+		bufferFullWrites: scope.Counter("buffer_full_writes"),
+	}
+	var _ BackpressureWriter = p
+
+	status, err := p.TryWrite(context.TODO(), newTestWriteQuery(t, "job", "api"))
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, status.QueueFullness)
+
+	dup, err := storage.NewWriteQuery(storage.WriteQueryOptions{
+		Tags:           models.NewTags(1, models.NewTagOptions()).AddTag(models.Tag{Name: []byte("job"), Value: []byte("api")}),
+		Datapoints:     ts.Datapoints{{Timestamp: xtime.Now(), Value: 42}},
+		Unit:           xtime.Millisecond,
+		DuplicateWrite: true,
+	})
+	require.NoError(t, err)
+	status, err = p.TryWrite(context.TODO(), dup)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, status.QueueFullness)
+
+	status, err = p.TryWrite(context.TODO(), newTestWriteQuery(t, "job", "api"))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, status.QueueFullness)
+
+	status, err = p.TryWrite(context.TODO(), newTestWriteQuery(t, "job", "api"))
+	require.True(t, errors.Is(err, ErrBufferFull))
+	assert.Equal(t, 1.0, status.QueueFullness)
+	assert.Len(t, p.dataQueue, 2)
+
+	snapshot := scope.Snapshot()
+	tallytest.AssertCounterValue(t, 2, snapshot, "test_scope.enqueued_samples", map[string]string{})
+	tallytest.AssertCounterValue(t, 1, snapshot, "test_scope.duplicate_writes", map[string]string{})
+	tallytest.AssertCounterValue(t, 1, snapshot, "test_scope.buffer_full_writes", map[string]string{})
+}
+
+func TestWriteKafkaEndpoint(t *testing.T) {
+	newStorage := func(scope tally.Scope, producer MessageProducer) (storage.Storage, error) {
+		return NewStorage(Options{
+			endpoints: []EndpointOptions{{
+				name:         "testEndpoint",
+				endpointType: kafkaEndpointType,
+				topic:        "remote_write",
+			}},
+			scope:         scope,
+			logger:        logger,
+			poolSize:      1,
+			queueSize:     1,
+			tenantDefault: "unknown",
+			tickDuration:  ptrDuration(tickDuration),
+			queueTimeout:  ptrDuration(queueTimeout),
+		}.SetMessageProducer(producer))
+	}
+
+	t.Run("producer required", func(t *testing.T) {
+		_, err := newStorage(tally.NoopScope, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "message producer must be set for kafka endpoint testEndpoint")
+	})
+
+	t.Run("produces encoded batch keyed by tenant", func(t *testing.T) {
+		producer := promremotetest.NewProducer()
+		scope := tally.NewTestScope("test_scope", map[string]string{})
+		defer verifyMetrics(t, scope)
+		promStorage, err := newStorage(scope, producer)
+		require.NoError(t, err)
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+
+		messages := producer.Messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "remote_write", messages[0].Topic)
+		assert.Equal(t, []byte("unknown"), messages[0].Key)
+		promWrite, err := remote.DecodeWriteRequest(bytes.NewReader(messages[0].Value))
+		require.NoError(t, err)
+		require.Len(t, promWrite.Timeseries, 1)
+
+		tallytest.AssertCounterValue(
+			t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.write.total",
+			map[string]string{"endpoint_name": "testEndpoint", "code": "200"},
+		)
+	})
+
+	t.Run("producer error", func(t *testing.T) {
+		producer := promremotetest.NewProducer()
+		producer.SetError(errors.New("broker unavailable"))
+		scope := tally.NewTestScope("test_scope", map[string]string{})
+		defer verifyMetrics(t, scope)
+		promStorage, err := newStorage(scope, producer)
+		require.NoError(t, err)
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+
+		assert.Empty(t, producer.Messages())
+		tallytest.AssertCounterValue(
+			t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.err_writes",
+			map[string]string{},
+		)
+		tallytest.AssertCounterValue(
+			t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.write.total",
+			map[string]string{"endpoint_name": "testEndpoint", "code": "503"},
+		)
+	})
+}
+
+type stubRoundTripper struct {
+	sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	// failures is the number of requests to fail before succeeding.
+	failures int
+}
+
+func (rt *stubRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	rt.Lock()
+	defer rt.Unlock()
+	rt.requests = append(rt.requests, req)
+	rt.bodies = append(rt.bodies, body)
+	status := http.StatusOK
+	if rt.failures > 0 {
+		rt.failures--
+		status = http.StatusInternalServerError
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+		Request:    req,
+	}, nil
+}
+
+func TestWriteWithRoundTripper(t *testing.T) {
+	rt := &stubRoundTripper{}
+	scope := tally.NewTestScope("test_scope", map[string]string{})
+	defer verifyMetrics(t, scope)
+	opts := Options{
+		endpoints: []EndpointOptions{{
+			name:         "testEndpoint",
+			address:      "http://remote.invalid/write",
+			tenantHeader: "TENANT",
+			apiToken:     "token",
+		}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	}.SetRoundTripper(rt)
+	promStorage, err := NewStorage(opts)
+	require.NoError(t, err)
+
+	require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+	closeWithCheck(t, promStorage)
+
+	rt.Lock()
+	defer rt.Unlock()
+	require.Len(t, rt.requests, 1)
+	req := rt.requests[0]
+	assert.Equal(t, "http://remote.invalid/write", req.URL.String())
+	assert.Equal(t, "snappy", req.Header.Get("content-encoding"))
+	assert.Equal(t, "application/x-protobuf", req.Header.Get("content-type"))
+	assert.Equal(t, "unknown", req.Header.Get("TENANT"))
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("unknown:token")),
+		req.Header.Get("Authorization"))
+
+	promWrite, err := remote.DecodeWriteRequest(bytes.NewReader(rt.bodies[0]))
+	require.NoError(t, err)
+	require.Len(t, promWrite.Timeseries, 1)
+	assert.Equal(t, []prompb.Label{{Name: "test_tag_name", Value: "test_tag_value"}},
+		promWrite.Timeseries[0].Labels)
+
+	tallytest.AssertCounterValue(
+		t, 1, scope.Snapshot(), "test_scope.prom_remote_storage.write.total",
+		map[string]string{"endpoint_name": "testEndpoint", "code": "200"},
+	)
+}
+
+func TestWriteSnappyStreamFraming(t *testing.T) {
+	rt := &stubRoundTripper{}
+	opts := Options{
+		endpoints: []EndpointOptions{{
+			name:         "testEndpoint",
+			address:      "http://remote.invalid/write",
+			tenantHeader: "TENANT",
+			bodyEncoding: snappyStreamEncoding,
+		}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	}.SetRoundTripper(rt)
+	promStorage, err := NewStorage(opts)
+	require.NoError(t, err)
+
+	require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+	closeWithCheck(t, promStorage)
+
+	rt.Lock()
+	defer rt.Unlock()
+	require.Len(t, rt.requests, 1)
+	assert.Equal(t, "x-snappy-framed", rt.requests[0].Header.Get("content-encoding"))
+
+	data, err := io.ReadAll(snappy.NewReader(bytes.NewReader(rt.bodies[0])))
+	require.NoError(t, err)
+	var promWrite prompb.WriteRequest
+	require.NoError(t, promWrite.Unmarshal(data))
+	require.Len(t, promWrite.Timeseries, 1)
+	assert.Equal(t, []prompb.Label{{Name: "test_tag_name", Value: "test_tag_value"}},
+		promWrite.Timeseries[0].Labels)
+}
+
+func TestWriteGzipFraming(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []prompb.WriteRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("content-encoding") != "gzip" ||
+			r.Header.Get(remoteWriteVersionHeader) != defaultRemoteWriteVersion {
+			http.Error(w, "unexpected headers", http.StatusBadRequest)
+			return
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(gz)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req prompb.WriteRequest
+		if err := req.Unmarshal(data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, req)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	scope := tally.NewTestScope("test_scope", nil)
+	promStorage, err := NewStorage(Options{
+		endpoints: []EndpointOptions{{
+			name:         "testEndpoint",
+			address:      srv.URL,
+			tenantHeader: "TENANT",
+			bodyEncoding: gzipEncoding,
+		}},
+		scope:         scope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+	closeWithCheck(t, promStorage)
+
+	tallytest.AssertCounterValue(t, 0, scope.Snapshot(), "test_scope.prom_remote_storage.err_writes", nil)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1)
+	require.Len(t, received[0].Timeseries, 1)
+	assert.Equal(t, []prompb.Label{{Name: "test_tag_name", Value: "test_tag_value"}},
+		received[0].Timeseries[0].Labels)
+}
+
+func TestWriteCompressedErrorBody(t *testing.T) {
+	const message = "out of order sample"
+	encoders := map[string]func([]byte) []byte{
+		"gzip": func(data []byte) []byte {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			_, _ = w.Write(data)
+			_ = w.Close()
+			return buf.Bytes()
+		},
+		"snappy": func(data []byte) []byte {
+			return snappy.Encode(nil, data)
+		},
+		"x-snappy-framed": func(data []byte) []byte {
+			var buf bytes.Buffer
+			w := snappy.NewBufferedWriter(&buf)
+			_, _ = w.Write(data)
+			_ = w.Close()
+			return buf.Bytes()
+		},
+	}
+	for encoding, encode := range encoders {
+		t.Run(encoding, func(t *testing.T) {
+			var acceptEncoding atomic.Value
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding.Store(r.Header.Get("Accept-Encoding"))
+				w.Header().Set("Content-Encoding", encoding)
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(encode([]byte(message)))
+			}))
+			defer srv.Close()
+
+			core, logs := observer.New(zapcore.ErrorLevel)
+			promStorage, err := NewStorage(Options{
+				endpoints: []EndpointOptions{{
+					name:           "testEndpoint",
+					address:        srv.URL,
+					tenantHeader:   "TENANT",
+					acceptEncoding: "gzip, snappy",
+				}},
+				scope:         tally.NoopScope,
+				logger:        zap.New(core),
+				poolSize:      1,
+				queueSize:     1,
+				tenantDefault: "unknown",
+				tickDuration:  ptrDuration(tickDuration),
+				queueTimeout:  ptrDuration(queueTimeout),
+			})
+			require.NoError(t, err)
+
+			require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+			closeWithCheck(t, promStorage)
+
+			assert.Equal(t, "gzip, snappy", acceptEncoding.Load())
+			entries := logs.FilterMessage("error writing async batch").AllUntimed()
+			require.Len(t, entries, 1)
+			assert.Contains(t, entries[0].ContextMap()["error"], "resp="+message)
+		})
+	}
+}
+
+// blockingRoundTripper blocks every request until it is cancelled.
+type blockingRoundTripper struct{}
+
+func (blockingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestCloseTimeoutReportsAbandonedWrites(t *testing.T) {
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write", tenantHeader: "TENANT"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      4,
+		queueSize:     10,
+		retries:       3,
+		tenantDefault: "default",
+		tenantRules:   []TenantRule{newTestTenantRule(t, "region:eu", "eu", 0)},
+		tickDuration:  ptrDuration(time.Hour),
+		queueTimeout:  ptrDuration(queueTimeout),
+		closeTimeout:  ptrDuration(100 * time.Millisecond),
+	}.SetRoundTripper(blockingRoundTripper{}))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "eu", "id", fmt.Sprint(i))))
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "region", "us", "id", fmt.Sprint(i))))
+	}
+
+	err = s.Close()
+	var unflushed *UnflushedWritesError
+	require.True(t, errors.As(err, &unflushed), err)
+	assert.Equal(t, map[string]TenantDrainStats{
+		"eu":      {Abandoned: 3},
+		"default": {Abandoned: 2},
+	}, unflushed.Tenants)
+	assert.EqualError(t, err, "prom remote writes abandoned on close, by tenant: default: 2, eu: 3")
+}
+
+func TestCloseTimeoutFlushedWrites(t *testing.T) {
+	rt := &stubRoundTripper{}
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write", tenantHeader: "TENANT"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     10,
+		tenantDefault: "default",
+		tickDuration:  ptrDuration(time.Hour),
+		queueTimeout:  ptrDuration(queueTimeout),
+		closeTimeout:  ptrDuration(time.Minute),
+	}.SetRoundTripper(rt))
+	require.NoError(t, err)
+	require.NoError(t, writeTestMetric(t, s, storagemetadata.Attributes{}))
+	closeWithCheck(t, s)
+
+	assert.Equal(t, TenantDrainStats{Flushed: 1}, drainSummary(s.(*promStorage).pendingQueries)["default"])
+}
+
+func TestClosePolicyDrain(t *testing.T) {
+	rt := gatedRoundTripper{gate: make(chan struct{})}
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     10,
+		tenantDefault: "default",
+		tickDuration:  ptrDuration(time.Hour),
+		queueTimeout:  ptrDuration(queueTimeout),
+		closePolicy:   ClosePolicyDrain,
+	}.SetRoundTripper(rt))
+	require.NoError(t, err)
+	require.NoError(t, writeTestMetric(t, s, storagemetadata.Attributes{}))
+
+	// The write is flushed once the gate opens, well after the fast exit grace.
+	time.AfterFunc(fastExitGrace+100*time.Millisecond, func() { close(rt.gate) })
+	closeWithCheck(t, s)
+
+	assert.Equal(t, TenantDrainStats{Flushed: 1}, drainSummary(s.(*promStorage).pendingQueries)["default"])
+}
+
+func TestClosePolicyFastExit(t *testing.T) {
+	s, err := NewStorage(Options{
+		endpoints:     []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write"}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     10,
+		tenantDefault: "default",
+		tickDuration:  ptrDuration(time.Hour),
+		queueTimeout:  ptrDuration(queueTimeout),
+		closeTimeout:  ptrDuration(time.Minute),
+	}.SetRoundTripper(blockingRoundTripper{}))
+	require.NoError(t, err)
+	require.NoError(t, writeTestMetric(t, s, storagemetadata.Attributes{}))
+
+	// The shutdown hook switches to the fast exit on a running storage.
+	setter, ok := s.(ClosePolicySetter)
+	require.True(t, ok)
+	setter.SetClosePolicy(ClosePolicyFastExit)
+
+	start := time.Now()
+	err = s.Close()
+	assert.True(t, time.Since(start) < 10*fastExitGrace)
+	var unflushed *UnflushedWritesError
+	require.True(t, errors.As(err, &unflushed), err)
+	assert.Equal(t, map[string]TenantDrainStats{"default": {Abandoned: 1}}, unflushed.Tenants)
+}
+
+func TestWriteBatchDrain(t *testing.T) {
+	t.Run("flushed", func(t *testing.T) {
+		rt := gatedRoundTripper{gate: make(chan struct{})}
+		s, err := NewStorage(Options{
+			endpoints:     []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write"}},
+			scope:         tally.NoopScope,
+			logger:        logger,
+			poolSize:      1,
+			queueSize:     10,
+			tenantDefault: "default",
+			tickDuration:  ptrDuration(time.Hour),
+			queueTimeout:  ptrDuration(queueTimeout),
+		}.SetRoundTripper(rt))
+		require.NoError(t, err)
+		p := s.(*promStorage)
+
+		errC := make(chan error, 1)
+		go func() {
+			errC <- p.WriteBatch(context.TODO(), []*storage.WriteQuery{newTestWriteQuery(t, "id", "1")})
+		}()
+		require.True(t, xclock.WaitUntil(func() bool { return p.inFlightBatchValue.Load() == 1 }, 5*time.Second))
+
+		// The batch is written once the storage is draining.
+		time.AfterFunc(100*time.Millisecond, func() { close(rt.gate) })
+		closeWithCheck(t, s)
+		require.NoError(t, <-errC)
+		assert.Equal(t, TenantDrainStats{Flushed: 1}, drainSummary(p.pendingQueries)["default"])
+	})
+
+	t.Run("abandoned", func(t *testing.T) {
+		s, err := NewStorage(Options{
+			endpoints:     []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write"}},
+			scope:         tally.NoopScope,
+			logger:        logger,
+			poolSize:      1,
+			queueSize:     10,
+			tenantDefault: "default",
+			tickDuration:  ptrDuration(time.Hour),
+			queueTimeout:  ptrDuration(queueTimeout),
+			closeTimeout:  ptrDuration(100 * time.Millisecond),
+		}.SetRoundTripper(blockingRoundTripper{}))
+		require.NoError(t, err)
+		p := s.(*promStorage)
+
+		errC := make(chan error, 1)
+		go func() {
+			errC <- p.WriteBatch(context.TODO(), []*storage.WriteQuery{newTestWriteQuery(t, "id", "1")})
+		}()
+		require.True(t, xclock.WaitUntil(func() bool { return p.inFlightBatchValue.Load() == 1 }, 5*time.Second))
+
+		err = s.Close()
+		var unflushed *UnflushedWritesError
+		require.True(t, errors.As(err, &unflushed), err)
+		assert.Equal(t, map[string]TenantDrainStats{"default": {Abandoned: 1}}, unflushed.Tenants)
+		require.Error(t, <-errC)
+	})
+}
+
+// gatedRoundTripper blocks every request until the gate is opened.
+type gatedRoundTripper struct {
+	gate chan struct{}
+}
+
+func (rt gatedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-rt.gate:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestMaxInFlightBatchesShed(t *testing.T) {
+	scope := tally.NewTestScope("test_scope", nil)
+	s, err := NewStorage(Options{
+		endpoints:          []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write"}},
+		scope:              scope,
+		logger:             logger,
+		poolSize:           8,
+		queueSize:          1,
+		tenantDefault:      "default",
+		tickDuration:       ptrDuration(time.Hour),
+		queueTimeout:       ptrDuration(queueTimeout),
+		closeTimeout:       ptrDuration(100 * time.Millisecond),
+		maxInFlightBatches: 2,
+		inFlightPolicy:     InFlightPolicyShed,
+	}.SetRoundTripper(blockingRoundTripper{}))
+	require.NoError(t, err)
+	p := s.(*promStorage)
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "id", fmt.Sprint(i))))
+	}
+	require.True(t, xclock.WaitUntil(func() bool {
+		return p.pendingQueries["default"].droppedSamples.Load() == 3
+	}, 5*time.Second))
+	assert.Equal(t, int64(2), p.inFlightBatchValue.Load())
+	tallytest.AssertCounterValue(t, 3, scope.Snapshot(), "test_scope.prom_remote_storage.shed_batches", nil)
+	tallytest.AssertGaugeValue(t, 2, scope.Snapshot(), "test_scope.prom_remote_storage.inflight_batches", nil)
+
+	// Batched writes are shed too while the stalled batches hold the limit.
+	err = s.(BatchWriter).WriteBatch(context.TODO(), []*storage.WriteQuery{
+		newTestWriteQuery(t, "id", "6"),
+		newTestWriteQuery(t, "id", "7"),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), errBatchShed.Error())
+	assert.Equal(t, int64(5), p.pendingQueries["default"].droppedSamples.Load())
+	assert.Equal(t, int64(2), p.inFlightBatchValue.Load())
+	tallytest.AssertCounterValue(t, 5, scope.Snapshot(), "test_scope.prom_remote_storage.shed_batches", nil)
+
+	err = s.Close()
+	var unflushed *UnflushedWritesError
+	require.True(t, errors.As(err, &unflushed), err)
+	// The two stalled batches and the batch flushed on close are abandoned.
+	assert.Equal(t, TenantDrainStats{Abandoned: 3}, unflushed.Tenants["default"])
+}
+
+func TestMaxInFlightBatchesBlock(t *testing.T) {
+	rt := gatedRoundTripper{gate: make(chan struct{})}
+	s, err := NewStorage(Options{
+		endpoints:          []EndpointOptions{{name: "testEndpoint", address: "http://remote.invalid/write"}},
+		scope:              tally.NoopScope,
+		logger:             logger,
+		poolSize:           8,
+		queueSize:          1,
+		tenantDefault:      "default",
+		tickDuration:       ptrDuration(time.Hour),
+		queueTimeout:       ptrDuration(queueTimeout),
+		maxInFlightBatches: 2,
+	}.SetRoundTripper(rt))
+	require.NoError(t, err)
+	p := s.(*promStorage)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.Write(context.TODO(), newTestWriteQuery(t, "id", fmt.Sprint(i))))
+	}
+	require.True(t, xclock.WaitUntil(func() bool {
+		return p.inFlightBatchValue.Load() == 2
+	}, 5*time.Second))
+	// The write loop is blocked on dispatching the third batch.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(2), p.inFlightBatchValue.Load())
+
+	close(rt.gate)
+	closeWithCheck(t, s)
+	assert.Equal(t, int64(0), p.inFlightBatchValue.Load())
+	assert.Equal(t, int64(0), p.pendingQueries["default"].droppedSamples.Load())
+}
+
+func TestWriteRemoteWriteVersion(t *testing.T) {
+	for _, tt := range []struct {
+		version  string
+		expected string
+	}{
+		{version: "", expected: "0.1.0"},
+		{version: "1.0", expected: "1.0"},
+	} {
+		rt := &stubRoundTripper{}
+		promStorage, err := NewStorage(Options{
+			endpoints: []EndpointOptions{{
+				name:               "testEndpoint",
+				address:            "http://remote.invalid/write",
+				tenantHeader:       "TENANT",
+				remoteWriteVersion: tt.version,
+			}},
+			scope:         tally.NoopScope,
+			logger:        logger,
+			poolSize:      1,
+			queueSize:     1,
+			tenantDefault: "unknown",
+			tickDuration:  ptrDuration(tickDuration),
+			queueTimeout:  ptrDuration(queueTimeout),
+		}.SetRoundTripper(rt))
+		require.NoError(t, err)
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+
+		rt.Lock()
+		require.Len(t, rt.requests, 1)
+		assert.Equal(t, tt.expected, rt.requests[0].Header.Get("X-Prometheus-Remote-Write-Version"))
+		rt.Unlock()
+	}
+}
+
+func TestWriteSigV4(t *testing.T) {
+	signer, err := newSigV4Signer(&config.PrometheusRemoteBackendSigV4Configuration{
+		Region:    "us-east-1",
+		AccessKey: "AKID",
+		SecretKey: "SECRET",
+	})
+	require.NoError(t, err)
+	rt := &stubRoundTripper{failures: 1}
+	promStorage, err := NewStorage(Options{
+		endpoints: []EndpointOptions{{
+			name:         "testEndpoint",
+			address:      "http://remote.invalid/write",
+			tenantHeader: "TENANT",
+			sigV4:        signer,
+		}},
+		scope:         tally.NoopScope,
+		logger:        logger,
+		poolSize:      1,
+		queueSize:     1,
+		retries:       1,
+		tenantDefault: "unknown",
+		tickDuration:  ptrDuration(tickDuration),
+		queueTimeout:  ptrDuration(queueTimeout),
+	}.SetRoundTripper(rt))
+	require.NoError(t, err)
+	require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+	closeWithCheck(t, promStorage)
+
+	rt.Lock()
+	defer rt.Unlock()
+	// The retry is signed again and sends the whole body.
+	require.Len(t, rt.requests, 2)
+	for i, req := range rt.requests {
+		auth := req.Header.Get("Authorization")
+		assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"), auth)
+		assert.Contains(t, auth, "/us-east-1/aps/aws4_request")
+		// The tenant header is set before signing so it is covered by the signature.
+		assert.Contains(t, auth, "tenant")
+		assert.NotEmpty(t, req.Header.Get("X-Amz-Date"))
+		assert.Equal(t, rt.bodies[0], rt.bodies[i])
+	}
+}
+
+func TestWriteIdempotencyKey(t *testing.T) {
+	newStorage := func(rt http.RoundTripper, header string) storage.Storage {
+		promStorage, err := NewStorage(Options{
+			endpoints: []EndpointOptions{{
+				name:                 "testEndpoint",
+				address:              "http://remote.invalid/write",
+				tenantHeader:         "TENANT",
+				idempotencyKeyHeader: header,
+			}},
+			scope:         tally.NoopScope,
+			logger:        logger,
+			poolSize:      1,
+			queueSize:     1,
+			retries:       2,
+			tenantDefault: "unknown",
+			tickDuration:  ptrDuration(tickDuration),
+			queueTimeout:  ptrDuration(queueTimeout),
+		}.SetRoundTripper(rt))
+		require.NoError(t, err)
+		return promStorage
+	}
+
+	t.Run("key is stable across retries", func(t *testing.T) {
+		rt := &stubRoundTripper{failures: 2}
+		promStorage := newStorage(rt, "Idempotency-Key")
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+
+		rt.Lock()
+		defer rt.Unlock()
+		require.Len(t, rt.requests, 3)
+		key := rt.requests[0].Header.Get("Idempotency-Key")
+		assert.Equal(t, idempotencyKey("unknown", rt.bodies[0]), key)
+		for i, req := range rt.requests {
+			assert.Equal(t, key, req.Header.Get("Idempotency-Key"))
+			// Retries must resend the full payload.
+			assert.Equal(t, rt.bodies[0], rt.bodies[i])
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		rt := &stubRoundTripper{}
+		promStorage := newStorage(rt, "")
+		require.NoError(t, writeTestMetric(t, promStorage, storagemetadata.Attributes{}))
+		closeWithCheck(t, promStorage)
+
+		rt.Lock()
+		defer rt.Unlock()
+		require.Len(t, rt.requests, 1)
+		assert.Empty(t, rt.requests[0].Header.Get("Idempotency-Key"))
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	key := idempotencyKey("tenant", []byte("payload"))
+	assert.Equal(t, key, idempotencyKey("tenant", []byte("payload")))
+	assert.NotEqual(t, key, idempotencyKey("other", []byte("payload")))
+	assert.NotEqual(t, key, idempotencyKey("tenant", []byte("other")))
+}
+
 func closeWithCheck(t *testing.T, c io.Closer) {
 	require.NoError(t, c.Close())
 }
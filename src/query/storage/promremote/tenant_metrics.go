@@ -0,0 +1,78 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package promremote
+
+import (
+	"sync"
+
+	"github.com/uber-go/tally"
+)
+
+// tenantMetrics are the tenant tagged variants of the key storage counters,
+// named apart from the global ones which keep their tags.
+type tenantMetrics struct {
+	enqueuedSamples tally.Counter
+	droppedSamples  tally.Counter
+	batchWrites     tally.Counter
+	errWrites       tally.Counter
+}
+
+var noopTenantMetrics = newTenantMetrics(tally.NoopScope, "")
+
+func newTenantMetrics(scope tally.Scope, tenant tenantKey) *tenantMetrics {
+	scope = scope.Tagged(map[string]string{"tenant": string(tenant)})
+	return &tenantMetrics{
+		enqueuedSamples: scope.Counter("tenant_enqueued_samples"),
+		droppedSamples:  scope.Counter("tenant_dropped_samples"),
+		batchWrites:     scope.Counter("tenant_batch_writes"),
+		errWrites:       scope.Counter("tenant_err_writes"),
+	}
+}
+
+// lazyTenantMetrics creates the metrics of a tenant on first use. Only the
+// queues of the fixed tenants have metrics so that their cardinality is
+// bounded by the configuration.
+type lazyTenantMetrics struct {
+	scope   tally.Scope
+	once    sync.Once
+	metrics *tenantMetrics
+}
+
+func (wq *WriteQueue) metrics() *tenantMetrics {
+	wq.tenantMetrics.once.Do(func() {
+		if wq.tenantMetrics.scope == nil {
+			wq.tenantMetrics.metrics = noopTenantMetrics
+			return
+		}
+		wq.tenantMetrics.metrics = newTenantMetrics(wq.tenantMetrics.scope, wq.t)
+	})
+	return wq.tenantMetrics.metrics
+}
+
+// tenantMetrics returns the metrics of the tenant, or metrics reporting
+// nothing if it isn't one of the fixed tenants.
+func (p *promStorage) tenantMetrics(tenant tenantKey) *tenantMetrics {
+	queue, ok := p.pendingQueries[tenant]
+	if !ok {
+		return noopTenantMetrics
+	}
+	return queue.metrics()
+}
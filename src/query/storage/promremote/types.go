@@ -22,15 +22,24 @@
 package promremote
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/m3db/m3/src/dbnode/client"
 	"github.com/m3db/m3/src/metrics/filters"
+	"github.com/m3db/m3/src/query/storage"
 	"github.com/m3db/m3/src/query/storage/m3"
 	"github.com/m3db/m3/src/query/storage/m3/storagemetadata"
 	"github.com/m3db/m3/src/x/ident"
+	"github.com/m3db/m3/src/x/instrument"
 	xhttp "github.com/m3db/m3/src/x/net/http"
 
+	"github.com/opentracing/opentracing-go"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
@@ -49,6 +58,155 @@ type Options struct {
 	tenantRules   []TenantRule
 	tickDuration  *time.Duration
 	queueTimeout  *time.Duration
+	seriesLimits  seriesLimits
+	relabelRules  []relabelRule
+	writeMode     WriteMode
+	// coalesceSeries merges the queries of a batch with the same labels
+	// into a single series before encoding.
+	coalesceSeries bool
+	// closeTimeout bounds how long Close waits for the pending writes to be
+	// flushed before abandoning them, nil waits until all of them are done.
+	closeTimeout *time.Duration
+	// closePolicy is whether Close drains the pending writes or gives up on
+	// them after a brief attempt.
+	closePolicy ClosePolicy
+	// adaptiveConcurrency limits the concurrent requests to each endpoint when set.
+	adaptiveConcurrency *adaptiveConcurrencyOptions
+	// maxInFlightBatches bounds the batches dispatched and not yet written,
+	// zero means no limit.
+	maxInFlightBatches int
+	inFlightPolicy     InFlightPolicy
+	// orderedWriteShards preserves the write order of each series when positive,
+	// see PrometheusRemoteBackendConfiguration.OrderedWriteShards.
+	orderedWriteShards int
+	// endpointAutoDisable excludes unhealthy endpoints from the failover write mode when set.
+	endpointAutoDisable *endpointAutoDisableOptions
+	// batchLogger logs every flushed batch when set.
+	batchLogger *zap.Logger
+	// userAgent is the User-Agent of the writes to http endpoints, empty uses
+	// defaultUserAgent.
+	userAgent string
+	// newBatchQueueFn creates the batch queues of the tenants, nil batches by queue size.
+	newBatchQueueFn NewBatchQueueFn
+
+	logSampleRate              float64
+	wrongTenantLogSampleRate   float64
+	defaultTenantLogSampleRate float64
+
+	roundTripper    http.RoundTripper
+	messageProducer MessageProducer
+	tenantResolver  TenantResolver
+	// tracer starts the spans of the writes, nil uses a noop tracer.
+	tracer opentracing.Tracer
+}
+
+// TenantResolver resolves the tenant a write is routed to, e.g. from its tags.
+// The tenant must be one of the tenants of the tenant rules or the default
+// tenant, writes routed to any other tenant are dropped.
+type TenantResolver interface {
+	// Resolve returns the tenant of the query, or false to drop the write.
+	Resolve(query *storage.WriteQuery) (string, bool)
+}
+
+// SetTenantResolver sets the resolver of the tenant of each write in place of
+// the tenant rules, see NewRuleTenantResolver to fall back on the rules.
+func (o Options) SetTenantResolver(value TenantResolver) Options {
+	o.tenantResolver = value
+	return o
+}
+
+// MessageProducer publishes encoded remote write requests to a message queue
+// such as Kafka, used by endpoints of the kafka type.
+type MessageProducer interface {
+	// Produce publishes a single message to the given topic.
+	Produce(ctx context.Context, topic string, key, value []byte) error
+}
+
+// SetMessageProducer sets the producer used to write to kafka endpoints.
+func (o Options) SetMessageProducer(value MessageProducer) Options {
+	o.messageProducer = value
+	return o
+}
+
+// SetNewBatchQueueFn sets how the batch queues of the tenants are created,
+// replacing the default batching by queue size.
+func (o Options) SetNewBatchQueueFn(value NewBatchQueueFn) Options {
+	o.newBatchQueueFn = value
+	return o
+}
+
+// SetWriteMode sets how batches are written to the endpoints.
+func (o Options) SetWriteMode(value WriteMode) Options {
+	o.writeMode = value
+	return o
+}
+
+// SetClosePolicy sets whether Close drains the pending writes or returns
+// quickly, see ClosePolicySetter to change it on a running storage.
+func (o Options) SetClosePolicy(value ClosePolicy) Options {
+	o.closePolicy = value
+	return o
+}
+
+// SetRoundTripper sets the http.RoundTripper used to send requests to the
+// remote endpoints in place of the default transport, e.g. to route through
+// an egress proxy.
+func (o Options) SetRoundTripper(value http.RoundTripper) Options {
+	o.roundTripper = value
+	return o
+}
+
+// SetTracer sets the tracer the spans of the writes are started with, they
+// aren't traced by default.
+func (o Options) SetTracer(value opentracing.Tracer) Options {
+	o.tracer = value
+	return o
+}
+
+// SetBatchLogger sets the logger every flushed batch is logged to, nil
+// disables the batch log.
+func (o Options) SetBatchLogger(value *zap.Logger) Options {
+	o.batchLogger = value
+	return o
+}
+
+// SetUserAgent sets the User-Agent of the writes to http endpoints, empty
+// uses the default identifying the m3 coordinator and its version.
+func (o Options) SetUserAgent(value string) Options {
+	o.userAgent = value
+	return o
+}
+
+func (o Options) userAgentOrDefault() string {
+	if o.userAgent == "" {
+		return defaultUserAgent()
+	}
+	return o.userAgent
+}
+
+// defaultUserAgent identifies the m3 coordinator and its build version.
+func defaultUserAgent() string {
+	return "m3coordinator/" + instrument.Version
+}
+
+// SetLogSampleRate sets the fraction of write errors and batches logged.
+func (o Options) SetLogSampleRate(value float64) Options {
+	o.logSampleRate = value
+	return o
+}
+
+// SetWrongTenantLogSampleRate sets the fraction of writes dropped for an
+// unknown tenant that are logged.
+func (o Options) SetWrongTenantLogSampleRate(value float64) Options {
+	o.wrongTenantLogSampleRate = value
+	return o
+}
+
+// SetDefaultTenantLogSampleRate sets the fraction of writes matching no tenant
+// rule whose series are logged.
+func (o Options) SetDefaultTenantLogSampleRate(value float64) Options {
+	o.defaultTenantLogSampleRate = value
+	return o
 }
 
 // Namespaces returns M3 namespaces from endpoint opts.
@@ -63,17 +221,130 @@ func (o Options) Namespaces() m3.ClusterNamespaces {
 type TenantRule struct {
 	Filter filters.TagsFilter
 	Tenant string
+	// MaxFlushDelay bounds how long a write for this tenant may be queued
+	// before it is flushed, independent of the tick. Zero disables it.
+	MaxFlushDelay time.Duration
+	// Priority orders the evaluation of the rules, higher priority rules are
+	// evaluated first and rules with the same priority keep their order.
+	Priority int
+	// SplitTenant receives SplitPercent of the matching series, selected by
+	// series hash so that a series always routes to the same tenant.
+	SplitTenant  string
+	SplitPercent float64
+	// Endpoints override the global endpoints for the writes of the tenant
+	// and its split tenant when set.
+	Endpoints []EndpointOptions
+	// Labels are injected into every series written for the tenant and its
+	// split tenant. A series label with the same name is only replaced when
+	// OverwriteLabels is set.
+	Labels          map[string]string
+	OverwriteLabels bool
+	// SampleRate is the fraction of the writes of the tenant and its split
+	// tenant that are kept, the others are dropped at random to shed load.
+	// Zero keeps all of them like 1 does.
+	SampleRate float64
 }
 
+// WriteMode is how a batch is written to the endpoints.
+type WriteMode int
+
+const (
+	// WriteModePrimary writes a batch to the first endpoint only.
+	WriteModePrimary WriteMode = iota
+	// WriteModeFailover writes a batch to the endpoints in order, moving on to
+	// the next endpoint only when a write permanently fails.
+	WriteModeFailover
+)
+
+// InFlightPolicy is how a batch is dispatched once the in-flight batch limit is reached.
+type InFlightPolicy int
+
+const (
+	// InFlightPolicyBlock blocks the dispatch until an in-flight batch is written.
+	InFlightPolicyBlock InFlightPolicy = iota
+	// InFlightPolicyShed drops the batch, except while draining on close.
+	InFlightPolicyShed
+)
+
+// ClosePolicy is how Close handles the writes still pending.
+type ClosePolicy int
+
+const (
+	// ClosePolicyDrain waits for the pending writes to be flushed, bounded by
+	// the close timeout if any.
+	ClosePolicyDrain ClosePolicy = iota
+	// ClosePolicyFastExit makes a brief attempt at flushing the pending writes
+	// and abandons the ones not written by then.
+	ClosePolicyFastExit
+)
+
+type bodyEncoding int
+
+const (
+	snappyBlockEncoding bodyEncoding = iota
+	snappyStreamEncoding
+	gzipEncoding
+)
+
+type endpointType int
+
+const (
+	httpEndpointType endpointType = iota
+	kafkaEndpointType
+)
+
 // EndpointOptions for single prometheus remote write capable endpoint.
 type EndpointOptions struct {
 	name              string
 	address           string
+	endpointType      endpointType
+	topic             string
 	attributes        storagemetadata.Attributes
 	tenantHeader      string
 	otherHeaders      map[string]string
 	apiToken          string
 	downsampleOptions *m3.ClusterNamespaceDownsampleOptions
+
+	// idempotencyKeyHeader is the header carrying the batch idempotency key, empty disables it.
+	idempotencyKeyHeader string
+	// bodyEncoding is the compression of the encoded batches sent to the endpoint.
+	bodyEncoding bodyEncoding
+	// remoteWriteVersion is the remote write protocol version sent to the endpoint,
+	// defaults to defaultRemoteWriteVersion when empty.
+	remoteWriteVersion string
+	// acceptEncoding is the Accept-Encoding header sent to the endpoint, empty omits it.
+	acceptEncoding string
+	// maxIdleConnsPerHost and maxConnsPerHost override the connection pool
+	// sizing of the http client for the endpoint when positive.
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	// keepAlive overrides the keep-alive period of the http client for the
+	// endpoint when positive.
+	keepAlive time.Duration
+	// http2 forces HTTP/2 for the endpoint when set.
+	http2 *http2Options
+	// sigV4 signs the requests to the endpoint when set.
+	sigV4 *sigV4Signer
+}
+
+// http2Options configures the HTTP/2 connections to an endpoint, zero values
+// keep the defaults of the HTTP/2 transport.
+type http2Options struct {
+	readIdleTimeout time.Duration
+	pingTimeout     time.Duration
+}
+
+// dedicatedClient returns true if the endpoint tunes its connections and
+// needs an http client of its own.
+func (e EndpointOptions) dedicatedClient() bool {
+	return e.maxIdleConnsPerHost > 0 || e.maxConnsPerHost > 0 || e.keepAlive > 0 || e.http2 != nil
+}
+
+func (e EndpointOptions) remoteWriteVersionOrDefault() string {
+	if e.remoteWriteVersion == "" {
+		return defaultRemoteWriteVersion
+	}
+	return e.remoteWriteVersion
 }
 
 func newClusterNamespace(endpoint EndpointOptions) m3.ClusterNamespace {
@@ -101,3 +372,117 @@ func (e promRemoteNamespace) Session() client.Session {
 	// NB(antanas): should never be called since there is no m3db backend in this case.
 	panic("M3DB client session can't be used when using prom remote storage backend")
 }
+
+// ErrBufferFull is returned by TryWrite when the write buffer is full.
+var ErrBufferFull = errors.New("prom remote write buffer is full")
+
+// UnflushedWritesError is returned by Close when writes were abandoned because
+// the pending writes could not be flushed before the close timeout.
+type UnflushedWritesError struct {
+	// Tenants is the drain summary of every tenant by tenant.
+	Tenants map[string]TenantDrainStats
+}
+
+// TenantDrainStats counts the writes of a tenant completed while closing.
+type TenantDrainStats struct {
+	// Flushed writes were written to the remote endpoint.
+	Flushed int
+	// Failed writes errored before the close timeout.
+	Failed int
+	// Abandoned writes were cancelled by the close timeout.
+	Abandoned int
+}
+
+func (e *UnflushedWritesError) Error() string {
+	tenants := make([]string, 0, len(e.Tenants))
+	for tenant, stats := range e.Tenants {
+		if stats.Abandoned > 0 {
+			tenants = append(tenants, fmt.Sprintf("%s: %d", tenant, stats.Abandoned))
+		}
+	}
+	sort.Strings(tenants)
+	return fmt.Sprintf("prom remote writes abandoned on close, by tenant: %s", strings.Join(tenants, ", "))
+}
+
+// BackpressureWriter writes without blocking, reporting how full the write
+// buffer is so that the caller can shed load before writes are dropped.
+type BackpressureWriter interface {
+	// TryWrite enqueues the query or returns ErrBufferFull without blocking.
+	TryWrite(ctx context.Context, query *storage.WriteQuery) (WriteStatus, error)
+}
+
+// BatchWriter writes queries the caller has already batched, e.g. for backfills,
+// without enqueuing them one by one.
+type BatchWriter interface {
+	// WriteBatch groups the queries by tenant and writes them, returning once
+	// all of them are written.
+	WriteBatch(ctx context.Context, queries []*storage.WriteQuery) error
+}
+
+// WriteStatus is the state of the write buffer after a write.
+type WriteStatus struct {
+	// QueueFullness is the fraction of the write buffer in use, between 0 and 1.
+	QueueFullness float64
+}
+
+// BatchQueue batches the writes of a tenant before they are written, the default
+// returns a batch once the queue size is reached. Calls are serialized by the
+// tenant's WriteQueue so implementations don't need to be safe for concurrent use.
+type BatchQueue interface {
+	// Add adds the query, returning a batch to write if one is complete.
+	Add(query *storage.WriteQuery) []*storage.WriteQuery
+	// Len returns the number of queries pending.
+	Len() int
+	// Pop removes and returns all the queries pending, which are written
+	// when the queues are flushed on tick, once overdue and on close.
+	Pop() []*storage.WriteQuery
+}
+
+// NewBatchQueueFn creates the batch queue of a tenant given the queue size.
+type NewBatchQueueFn func(tenant string, queueSize int) BatchQueue
+
+// LogSampleRateSetter adjusts the log sampling of a running storage, e.g. to
+// temporarily log more while debugging a routing problem.
+type LogSampleRateSetter interface {
+	// SetLogSampleRate sets the fraction of write errors and batches logged.
+	SetLogSampleRate(rate float64)
+	// SetWrongTenantLogSampleRate sets the fraction of writes dropped for an
+	// unknown tenant that are logged.
+	SetWrongTenantLogSampleRate(rate float64)
+	// SetDefaultTenantLogSampleRate sets the fraction of writes matching no
+	// tenant rule whose series are logged.
+	SetDefaultTenantLogSampleRate(rate float64)
+}
+
+// ClosePolicySetter changes how a running storage handles the pending writes on
+// Close, e.g. for a shutdown hook to exit fast on SIGTERM.
+type ClosePolicySetter interface {
+	// SetClosePolicy sets how Close handles the writes still pending.
+	SetClosePolicy(policy ClosePolicy)
+}
+
+// QueueStatsReporter reports a snapshot of the pending write queues.
+type QueueStatsReporter interface {
+	// QueueStats returns a snapshot of the pending write queues.
+	QueueStats() QueueStats
+}
+
+// QueueStats is a point in time snapshot of the pending write queues.
+type QueueStats struct {
+	// DataQueueLength is the number of writes waiting to be assigned to a tenant queue.
+	DataQueueLength int `json:"dataQueueLength"`
+	// DeadLetterQueueLength is the number of writes waiting to be retried on the next tick.
+	DeadLetterQueueLength int `json:"deadLetterQueueLength"`
+	// Tenants are the per tenant queues sorted by tenant.
+	Tenants []TenantQueueStats `json:"tenants"`
+}
+
+// TenantQueueStats is a point in time snapshot of a tenant's pending write queue.
+type TenantQueueStats struct {
+	Tenant          string    `json:"tenant"`
+	Length          int       `json:"length"`
+	Capacity        int       `json:"capacity"`
+	EnqueuedSamples int64     `json:"enqueuedSamples"`
+	DroppedSamples  int64     `json:"droppedSamples"`
+	LastFlush       time.Time `json:"lastFlush"`
+}
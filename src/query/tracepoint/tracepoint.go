@@ -45,4 +45,25 @@ const (
 
 	// TemporalDecodeParallel is time taken for a parallel pass decode time.
 	TemporalDecodeParallel = "temporal.parallelProcess.decode"
+
+	// PromReadParse is for parsing the request in the prom read handler.
+	PromReadParse = "prom.readHandler.parse"
+
+	// PromReadExec is for creating and executing the PromQL query in the prom read handler.
+	PromReadExec = "prom.readHandler.exec"
+
+	// PromReadLimit is for applying returned data limits in the prom read handler.
+	PromReadLimit = "prom.readHandler.limit"
+
+	// PromReadRespond is for serializing and writing the response in the prom read handler.
+	PromReadRespond = "prom.readHandler.respond"
+
+	// PromRemoteWriteBatch is for encoding and writing a batch in the prom remote storage.
+	PromRemoteWriteBatch = "promremote.promStorage.writeBatch"
+
+	// PromRemoteWrite is for sending an encoded batch to a remote endpoint, including retries.
+	PromRemoteWrite = "promremote.promStorage.write"
+
+	// PromRemoteWriteAttempt is for a single request sending an encoded batch to a remote endpoint.
+	PromRemoteWriteAttempt = "promremote.promStorage.writeAttempt"
 )
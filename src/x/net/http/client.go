@@ -31,15 +31,18 @@ import (
 // library's http.Transport struct.
 type ProxyFunc func(*http.Request) (*url.URL, error)
 
-// HTTPClientOptions specify HTTP Client options.
+// HTTPClientOptions specify HTTP Client options. MaxIdleConnsPerHost defaults
+// to MaxIdleConns and a zero MaxConnsPerHost doesn't limit the connections per host.
 type HTTPClientOptions struct {
-	RequestTimeout     time.Duration `yaml:"requestTimeout"`
-	ConnectTimeout     time.Duration `yaml:"connectTimeout"`
-	KeepAlive          time.Duration `yaml:"keepAlive"`
-	IdleConnTimeout    time.Duration `yaml:"idleConnTimeout"`
-	MaxIdleConns       int           `yaml:"maxIdleConns"`
-	DisableCompression bool          `yaml:"disableCompression"`
-	Proxy              ProxyFunc     `yaml:"proxy"`
+	RequestTimeout      time.Duration `yaml:"requestTimeout"`
+	ConnectTimeout      time.Duration `yaml:"connectTimeout"`
+	KeepAlive           time.Duration `yaml:"keepAlive"`
+	IdleConnTimeout     time.Duration `yaml:"idleConnTimeout"`
+	MaxIdleConns        int           `yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost int           `yaml:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     int           `yaml:"maxConnsPerHost"`
+	DisableCompression  bool          `yaml:"disableCompression"`
+	Proxy               ProxyFunc     `yaml:"proxy"`
 }
 
 // NewHTTPClient constructs a new HTTP Client.
@@ -51,6 +54,9 @@ func NewHTTPClient(o HTTPClientOptions) *http.Client {
 	if o.Proxy == nil {
 		o.Proxy = http.ProxyFromEnvironment
 	}
+	if o.MaxIdleConnsPerHost == 0 {
+		o.MaxIdleConnsPerHost = o.MaxIdleConns
+	}
 
 	return &http.Client{
 		Timeout: o.RequestTimeout,
@@ -64,7 +70,8 @@ func NewHTTPClient(o HTTPClientOptions) *http.Client {
 			TLSHandshakeTimeout:   o.ConnectTimeout,
 			ExpectContinueTimeout: o.ConnectTimeout,
 			MaxIdleConns:          o.MaxIdleConns,
-			MaxIdleConnsPerHost:   o.MaxIdleConns,
+			MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       o.MaxConnsPerHost,
 			DisableCompression:    o.DisableCompression,
 		},
 	}
@@ -105,10 +105,7 @@ func WriteError(w http.ResponseWriter, err error, opts ...WriteErrorOption) {
 		fn(&o)
 	}
 
-	errorRewriteFnLock.RLock()
-	err = errorRewriteFn(err)
-	errorRewriteFnLock.RUnlock()
-
+	err = rewriteError(err)
 	statusCode := getStatusCode(err)
 	if o.response == nil {
 		w.Header().Set(HeaderContentType, ContentTypeJSON)
@@ -130,6 +127,17 @@ func SetErrorRewriteFn(f ErrorRewriteFn) ErrorRewriteFn {
 	return res
 }
 
+// StatusCode returns the status code WriteError serves for the error.
+func StatusCode(err error) int {
+	return getStatusCode(rewriteError(err))
+}
+
+func rewriteError(err error) error {
+	errorRewriteFnLock.RLock()
+	defer errorRewriteFnLock.RUnlock()
+	return errorRewriteFn(err)
+}
+
 func getStatusCode(err error) int {
 	switch v := err.(type) {
 	case Error:
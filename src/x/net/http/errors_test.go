@@ -92,6 +92,7 @@ func TestErrorStatus(t *testing.T) {
 			recorder := httptest.NewRecorder()
 			WriteError(recorder, tt.err)
 			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			assert.Equal(t, tt.expectedStatus, StatusCode(tt.err))
 		})
 	}
 }
@@ -132,6 +133,7 @@ func TestErrorRewrite(t *testing.T) {
 			WriteError(recorder, tt.err)
 			assert.JSONEq(t, tt.expectedBody, recorder.Body.String())
 			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			assert.Equal(t, tt.expectedStatus, StatusCode(tt.err))
 		})
 	}
 }